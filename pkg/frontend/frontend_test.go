@@ -295,3 +295,7 @@ type limits struct {
 func (l limits) MaxQueriersPerUser(_ string) int {
 	return l.queriers
 }
+
+func (l limits) TenantQueueWeight(_ string) int {
+	return 1
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-kit/log"
@@ -20,6 +21,8 @@ import (
 	"golang.org/x/sync/semaphore"
 
 	apierror "github.com/grafana/mimir/pkg/api/error"
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/util"
 	util_math "github.com/grafana/mimir/pkg/util/math"
 	"github.com/grafana/mimir/pkg/util/spanlogger"
@@ -97,6 +100,9 @@ type Limits interface {
 
 	// BlockedQueries returns the blocked queries.
 	BlockedQueries(userID string) []*validation.BlockedQuery
+
+	// QueryIngestersWithin returns the maximum lookback beyond which queries are not sent to ingester.
+	QueryIngestersWithin(userID string) time.Duration
 }
 
 type limitsMiddleware struct {
@@ -203,8 +209,9 @@ type limitedParallelismRoundTripper struct {
 func newLimitedParallelismRoundTripper(next http.RoundTripper, codec Codec, limits Limits, middlewares ...Middleware) http.RoundTripper {
 	return limitedParallelismRoundTripper{
 		downstream: roundTripperHandler{
-			next:  next,
-			codec: codec,
+			next:   next,
+			codec:  codec,
+			limits: limits,
 		},
 		codec:      codec,
 		limits:     limits,
@@ -259,6 +266,8 @@ type roundTripperHandler struct {
 	logger log.Logger
 	next   http.RoundTripper
 	codec  Codec
+	// limits are used to tell the component expected to serve the requests; optional
+	limits Limits
 }
 
 func (rth roundTripperHandler) Do(ctx context.Context, r Request) (Response, error) {
@@ -270,6 +279,13 @@ func (rth roundTripperHandler) Do(ctx context.Context, r Request) (Response, err
 	if err := user.InjectOrgIDIntoHTTPRequest(ctx, request); err != nil {
 		return nil, apierror.New(apierror.TypeBadData, err.Error())
 	}
+	queue.InjectPriorityClassIntoHTTPRequest(ctx, request)
+	request.Header.Set(queue.CostEstimateHeader, strconv.FormatInt(estimatedQueryCost(r), 10))
+	if rth.limits != nil {
+		if component := expectedQueryComponent(ctx, r, rth.limits, time.Now()); component != "" {
+			request.Header.Set(querycomponent.Header, string(component))
+		}
+	}
 
 	response, err := rth.next.RoundTrip(request)
 	if err != nil {
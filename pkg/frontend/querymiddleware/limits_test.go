@@ -22,6 +22,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.uber.org/atomic"
 
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/validation"
 )
@@ -432,6 +433,10 @@ func (m multiTenantMockLimits) BlockedQueries(userID string) []*validation.Block
 	return m.byTenant[userID].blockedQueries
 }
 
+func (m multiTenantMockLimits) QueryIngestersWithin(userID string) time.Duration {
+	return m.byTenant[userID].queryIngestersWithin
+}
+
 func (m multiTenantMockLimits) CreationGracePeriod(userID string) time.Duration {
 	return m.byTenant[userID].creationGracePeriod
 }
@@ -462,6 +467,7 @@ type mockLimits struct {
 	resultsCacheTTLForLabelsQuery        time.Duration
 	resultsCacheForUnalignedQueryEnabled bool
 	blockedQueries                       []*validation.BlockedQuery
+	queryIngestersWithin                 time.Duration
 }
 
 func (m mockLimits) MaxQueryLookback(string) time.Duration {
@@ -534,6 +540,10 @@ func (m mockLimits) BlockedQueries(string) []*validation.BlockedQuery {
 	return m.blockedQueries
 }
 
+func (m mockLimits) QueryIngestersWithin(string) time.Duration {
+	return m.queryIngestersWithin
+}
+
 func (m mockLimits) ResultsCacheTTLForLabelsQuery(string) time.Duration {
 	return m.resultsCacheTTLForLabelsQuery
 }
@@ -649,6 +659,60 @@ func TestLimitedRoundTripper_MaxQueryParallelismLateScheduling(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestLimitedRoundTripper_PropagatesPriorityClassToSubRequests(t *testing.T) {
+	for name, tc := range map[string]struct {
+		header   string
+		expected string
+	}{
+		"no priority class": {header: "", expected: ""},
+		"background":        {header: "background", expected: "background"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mtx        sync.Mutex
+				received   []string
+				downstream = RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+					mtx.Lock()
+					defer mtx.Unlock()
+					received = append(received, r.Header.Get(queue.PriorityClassHeader))
+					return &http.Response{
+						Body: http.NoBody,
+					}, nil
+				})
+				ctx = user.InjectOrgID(context.Background(), "foo")
+			)
+
+			codec := newTestPrometheusCodec()
+			r, err := codec.EncodeRequest(ctx, &PrometheusRangeQueryRequest{
+				Path:  "/api/v1/query_range",
+				Start: time.Now().Add(time.Hour).Unix(),
+				End:   util.TimeToMillis(time.Now()),
+				Step:  int64(1 * time.Second * time.Millisecond),
+				Query: `foo`,
+			})
+			require.NoError(t, err)
+			// the query-frontend transport carries the priority class asked for by the client in the context
+			if tc.header != "" {
+				r = r.WithContext(queue.ContextWithPriorityClass(r.Context(), queue.ParsePriorityClass(tc.header)))
+			}
+
+			_, err = newLimitedParallelismRoundTripper(downstream, codec, mockLimits{maxQueryParallelism: 1},
+				MiddlewareFunc(func(next Handler) Handler {
+					return HandlerFunc(func(c context.Context, _ Request) (Response, error) {
+						// sub-requests are encoded from scratch, without the headers of the original request
+						for i := 0; i < 3; i++ {
+							_, _ = next.Do(c, &PrometheusRangeQueryRequest{Path: "/api/v1/query_range", Query: `foo`})
+						}
+						return newEmptyPrometheusResponse(), nil
+					})
+				}),
+			).RoundTrip(r)
+			require.NoError(t, err)
+			assert.Equal(t, []string{tc.expected, tc.expected, tc.expected}, received)
+		})
+	}
+}
+
 func TestLimitedRoundTripper_OriginalRequestContextCancellation(t *testing.T) {
 	var (
 		maxQueryParallelism = 2
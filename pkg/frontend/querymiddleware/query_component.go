@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/dskit/tenant"
+	"github.com/prometheus/prometheus/model/timestamp"
+
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
+	"github.com/grafana/mimir/pkg/util/validation"
+)
+
+// expectedQueryComponent returns the component expected to serve the request, from its time range and the
+// query-ingesters-within limit of its tenants, or an empty component if it cannot be told.
+func expectedQueryComponent(ctx context.Context, r Request, limits Limits, now time.Time) querycomponent.Component {
+	tenantIDs, err := tenant.TenantIDs(ctx)
+	if err != nil {
+		return ""
+	}
+	queryIngestersWithin := validation.MaxDurationPerTenant(tenantIDs, limits.QueryIngestersWithin)
+	return querycomponent.Expected(timestamp.Time(r.GetStart()), timestamp.Time(r.GetEnd()), now, queryIngestersWithin)
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
+)
+
+func TestRoundTripperHandler_ShouldSetQueryComponentHeader(t *testing.T) {
+	now := time.Now()
+
+	for name, tc := range map[string]struct {
+		limits   Limits
+		start    time.Time
+		end      time.Time
+		expected string
+	}{
+		"recent data": {
+			limits: mockLimits{queryIngestersWithin: 13 * time.Hour},
+			start:  now.Add(-time.Hour), end: now,
+			expected: "ingester",
+		},
+		"old data": {
+			limits: mockLimits{queryIngestersWithin: 13 * time.Hour},
+			start:  now.Add(-48 * time.Hour), end: now.Add(-24 * time.Hour),
+			expected: "store-gateway",
+		},
+		"time range across the query ingesters within boundary": {
+			limits: mockLimits{queryIngestersWithin: 13 * time.Hour},
+			start:  now.Add(-24 * time.Hour), end: now,
+			expected: "ingester-and-store-gateway",
+		},
+		"query ingesters within disabled": {
+			limits: mockLimits{},
+			start:  now.Add(-48 * time.Hour), end: now.Add(-24 * time.Hour),
+		},
+		"no limits": {
+			start: now.Add(-time.Hour), end: now,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var received http.Header
+			handler := roundTripperHandler{
+				next: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+					received = r.Header
+					return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+				}),
+				codec:  newTestPrometheusCodec(),
+				limits: tc.limits,
+			}
+
+			ctx := user.InjectOrgID(context.Background(), "user-1")
+			_, _ = handler.Do(ctx, &PrometheusRangeQueryRequest{Path: "/api/v1/query_range", Start: tc.start.UnixMilli(), End: tc.end.UnixMilli(), Step: time.Minute.Milliseconds(), Query: `up`})
+			require.NotNil(t, received)
+			assert.Equal(t, tc.expected, received.Get(querycomponent.Header))
+		})
+	}
+}
@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import "math"
+
+// estimatedQueryCost estimates the cost of executing a request in a querier as the number of points it evaluates:
+// its number of steps times its estimated number of series, or times 1 series if the request carries no estimate.
+// The shards of a query carry the series estimate of the whole query, so the cost of each shard is overestimated.
+func estimatedQueryCost(r Request) int64 {
+	steps := int64(1)
+	if step := r.GetStep(); step > 0 && r.GetEnd() > r.GetStart() {
+		steps = (r.GetEnd()-r.GetStart())/step + 1
+	}
+
+	series := r.GetHints().GetEstimatedSeriesCount()
+	if series <= 1 {
+		return steps
+	}
+	if series > uint64(math.MaxInt64/steps) {
+		return math.MaxInt64
+	}
+	return steps * int64(series)
+}
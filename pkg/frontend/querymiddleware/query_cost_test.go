@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querymiddleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/grafana/dskit/user"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/scheduler/queue"
+)
+
+func TestEstimatedQueryCost(t *testing.T) {
+	const start = int64(1_700_000_000_000)
+	hour := time.Hour.Milliseconds()
+	minute := time.Minute.Milliseconds()
+
+	for name, tc := range map[string]struct {
+		request  Request
+		expected int64
+	}{
+		"instant query": {
+			request:  &PrometheusInstantQueryRequest{Time: start, Query: `up`},
+			expected: 1,
+		},
+		"instant query with series estimate": {
+			request:  (&PrometheusInstantQueryRequest{Time: start, Query: `up`}).WithEstimatedSeriesCountHint(500),
+			expected: 500,
+		},
+		"range query": {
+			request:  &PrometheusRangeQueryRequest{Start: start, End: start + hour, Step: minute, Query: `up`},
+			expected: 61,
+		},
+		"range query with series estimate": {
+			request:  (&PrometheusRangeQueryRequest{Start: start, End: start + hour, Step: minute, Query: `up`}).WithEstimatedSeriesCountHint(1000),
+			expected: 61_000,
+		},
+		"overflowing estimate": {
+			request:  (&PrometheusRangeQueryRequest{Start: start, End: start + hour, Step: minute, Query: `up`}).WithEstimatedSeriesCountHint(math.MaxUint64),
+			expected: math.MaxInt64,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, estimatedQueryCost(tc.request))
+		})
+	}
+}
+
+func TestRoundTripperHandler_ShouldSetCostEstimateHeader(t *testing.T) {
+	var received http.Header
+	handler := roundTripperHandler{
+		next: RoundTripFunc(func(r *http.Request) (*http.Response, error) {
+			received = r.Header
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		}),
+		codec: newTestPrometheusCodec(),
+	}
+
+	ctx := user.InjectOrgID(context.Background(), "user-1")
+	_, _ = handler.Do(ctx, &PrometheusRangeQueryRequest{Path: "/api/v1/query_range", Start: 0, End: time.Hour.Milliseconds(), Step: time.Minute.Milliseconds(), Query: `up`})
+	require.NotNil(t, received)
+	assert.Equal(t, "61", received.Get(queue.CostEstimateHeader))
+}
@@ -28,7 +28,9 @@ import (
 
 	apierror "github.com/grafana/mimir/pkg/api/error"
 	"github.com/grafana/mimir/pkg/frontend/querymiddleware"
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
 	querier_stats "github.com/grafana/mimir/pkg/querier/stats"
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/util"
 	"github.com/grafana/mimir/pkg/util/activitytracker"
 	util_log "github.com/grafana/mimir/pkg/util/log"
@@ -41,6 +43,10 @@ const (
 )
 
 var (
+	// schedulingHeaders tell the query-scheduler how to queue a request. They are set by the query-frontend,
+	// so they must not be accepted from clients.
+	schedulingHeaders = []string{queue.CostEstimateHeader, queue.PriorityClassHeader, querycomponent.Header}
+
 	errCanceled              = httpgrpc.Errorf(StatusClientClosedRequest, context.Canceled.Error())
 	errDeadlineExceeded      = httpgrpc.Errorf(http.StatusGatewayTimeout, context.DeadlineExceeded.Error())
 	errRequestEntityTooLarge = httpgrpc.Errorf(http.StatusRequestEntityTooLarge, "http: request body too large")
@@ -174,6 +180,8 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		r = r.WithContext(ctx)
 	}
 
+	r = withoutSchedulingHeaders(r)
+
 	// Ensure to close the request body reader.
 	defer func() { _ = r.Body.Close() }()
 
@@ -220,6 +228,32 @@ func (f *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// withoutSchedulingHeaders returns the request without the schedulingHeaders set by the client. The priority class
+// asked for by the client is carried by the request context instead, where it can only be one of the known classes.
+func withoutSchedulingHeaders(r *http.Request) *http.Request {
+	found := false
+	for _, h := range schedulingHeaders {
+		if _, ok := r.Header[h]; ok {
+			found = true
+		}
+	}
+	if !found {
+		return r
+	}
+
+	ctx := r.Context()
+	if priority := r.Header.Get(queue.PriorityClassHeader); priority != "" {
+		ctx = queue.ContextWithPriorityClass(ctx, queue.ParsePriorityClass(priority))
+	}
+	// WithContext returns a shallow copy of the request, so that replacing its headers leaves the caller's request unchanged.
+	r = r.WithContext(ctx)
+	r.Header = r.Header.Clone()
+	for _, h := range schedulingHeaders {
+		r.Header.Del(h)
+	}
+	return r
+}
+
 // reportSlowQuery reports slow queries.
 func (f *Handler) reportSlowQuery(r *http.Request, queryString url.Values, queryResponseTime time.Duration, details *querymiddleware.QueryDetails) {
 	logMessage := append([]interface{}{
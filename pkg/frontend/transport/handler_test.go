@@ -32,6 +32,8 @@ import (
 	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/frontend/querymiddleware"
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/util/activitytracker"
 )
 
@@ -271,6 +273,54 @@ func TestHandler_FailedRoundTrip(t *testing.T) {
 	}
 }
 
+func TestHandler_ShouldStripSchedulingHeadersSetByClient(t *testing.T) {
+	for name, priorityClass := range map[string]string{
+		"with priority class":    "Background",
+		"without priority class": "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			var received *http.Request
+			roundTripper := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				received = req
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("{}"))}, nil
+			})
+			handler := NewHandler(HandlerConfig{MaxBodySize: 1024}, roundTripper, log.NewNopLogger(), nil, nil)
+
+			req := httptest.NewRequest("GET", "/api/v1/labels", nil)
+			req = req.WithContext(user.InjectOrgID(context.Background(), "12345"))
+			req.Header.Set(queue.CostEstimateHeader, "0")
+			if priorityClass != "" {
+				req.Header.Set(queue.PriorityClassHeader, priorityClass)
+			}
+			req.Header.Set(querycomponent.Header, "ingester")
+			req.Header.Set("User-Agent", "test-user-agent")
+			resp := httptest.NewRecorder()
+
+			handler.ServeHTTP(resp, req)
+			require.Equal(t, http.StatusOK, resp.Code)
+			require.NotNil(t, received)
+
+			assert.Empty(t, received.Header.Get(queue.CostEstimateHeader))
+			assert.Empty(t, received.Header.Get(queue.PriorityClassHeader))
+			assert.Empty(t, received.Header.Get(querycomponent.Header))
+			assert.Equal(t, "test-user-agent", received.Header.Get("User-Agent"))
+
+			// the priority class asked for by the client is carried by the context instead
+			priority, ok := queue.PriorityClassFromContext(received.Context())
+			if priorityClass != "" {
+				assert.True(t, ok)
+				assert.Equal(t, queue.PriorityClassBackground, priority)
+			} else {
+				assert.False(t, ok)
+			}
+
+			// the client's request is left untouched
+			assert.Equal(t, "0", req.Header.Get(queue.CostEstimateHeader))
+			assert.Equal(t, "ingester", req.Header.Get(querycomponent.Header))
+		})
+	}
+}
+
 // Test Handler.Stop.
 func TestHandler_Stop(t *testing.T) {
 	const (
@@ -12,6 +12,8 @@ import (
 	"net/http"
 
 	"github.com/grafana/dskit/httpgrpc"
+
+	"github.com/grafana/mimir/pkg/scheduler/queue"
 )
 
 // GrpcRoundTripper is similar to http.RoundTripper, but works with HTTP requests converted to protobuf messages.
@@ -42,6 +44,8 @@ func (a *grpcRoundTripperAdapter) RoundTrip(r *http.Request) (*http.Response, er
 	if err != nil {
 		return nil, err
 	}
+	// Requests which didn't go through the query middlewares carry their priority class in the context only.
+	queue.InjectPriorityClassIntoHTTPGRPCRequest(r.Context(), req)
 
 	resp, err := a.roundTripper.RoundTripGRPC(r.Context(), req)
 	if err != nil {
@@ -21,8 +21,10 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
 
 	"github.com/grafana/mimir/pkg/frontend/v1/frontendv1pb"
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
 	"github.com/grafana/mimir/pkg/querier/stats"
 	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/util"
@@ -36,19 +38,30 @@ var (
 
 // Config for a Frontend.
 type Config struct {
-	MaxOutstandingPerTenant int           `yaml:"max_outstanding_per_tenant" category:"advanced"`
-	QuerierForgetDelay      time.Duration `yaml:"querier_forget_delay" category:"experimental"`
+	MaxOutstandingPerTenant  int           `yaml:"max_outstanding_per_tenant" category:"advanced"`
+	QuerierForgetDelay       time.Duration `yaml:"querier_forget_delay" category:"experimental"`
+	QuerierCostBudget        int64         `yaml:"querier_cost_budget" category:"experimental"`
+	MaxTenantQueueHistograms int           `yaml:"max_tenant_queue_histograms" category:"experimental"`
+	QueryComponentQueues     bool          `yaml:"query_component_queues" category:"experimental"`
+	PriorityClassMaxWait     time.Duration `yaml:"priority_class_max_wait" category:"experimental"`
 }
 
 // RegisterFlags adds the flags required to config this to the given FlagSet.
 func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.IntVar(&cfg.MaxOutstandingPerTenant, "querier.max-outstanding-requests-per-tenant", 100, "Maximum number of outstanding requests per tenant per frontend; requests beyond this error with HTTP 429.")
 	f.DurationVar(&cfg.QuerierForgetDelay, "query-frontend.querier-forget-delay", 0, "If a querier disconnects without sending notification about graceful shutdown, the query-frontend will keep the querier in the tenant's shard until the forget delay has passed. This feature is useful to reduce the blast radius when shuffle-sharding is enabled.")
+	f.Int64Var(&cfg.QuerierCostBudget, "query-frontend.querier-cost-budget", 0, "Maximum estimated cost of the queries a querier executes at once. The cost of each query is estimated from its number of steps and estimated number of series. A querier is not dispatched a query which would take the estimated cost of its running queries over the budget, unless the querier is idle. 0 to disable.")
+	f.IntVar(&cfg.MaxTenantQueueHistograms, "query-frontend.max-tenant-queue-histograms", 0, "Maximum number of tenants tracked by the per-tenant histograms of the queue wait time and queue depth. The requests of further tenants are tracked together, under the user label __overflow__. 0 to disable the per-tenant histograms.")
+	f.BoolVar(&cfg.QueryComponentQueues, "query-frontend.query-component-queues", false, "Split each tenant's queue into sub-queues by the component expected to serve its queries: the ingesters, the store-gateways, or both, as estimated from the query time range. The sub-queues are dispatched to queriers in turn, so that slow queries served by the store-gateways do not hold back the queries of recent data of the same tenant.")
+	f.DurationVar(&cfg.PriorityClassMaxWait, "query-frontend.priority-class-max-wait", 30*time.Second, "Maximum time the queries of a lower priority class, as set by the Query-Priority header, wait in a tenant's queue for the tenant's queries of the higher classes. Queries which waited longer are dispatched ahead of the higher classes, so that a steady stream of interactive queries does not starve the normal and background queries. 0 to disable.")
 }
 
 type Limits interface {
 	// Returns max queriers to use per tenant, or 0 if shuffle sharding is disabled.
 	MaxQueriersPerUser(user string) int
+
+	// Returns the weight of the tenant's queue, which queriers are dispatched requests in proportion to.
+	TenantQueueWeight(user string) int
 }
 
 // Frontend queues HTTP requests, dispatches them to backends, and handles retries
@@ -70,11 +83,18 @@ type Frontend struct {
 	// Metrics.
 	queueLength       *prometheus.GaugeVec
 	discardedRequests *prometheus.CounterVec
+	expiredRequests   *prometheus.CounterVec
 	numClients        prometheus.GaugeFunc
 	queueDuration     prometheus.Histogram
+
+	tenantQueueHistograms *queue.TenantQueueHistograms
+
+	// Used to assign each request a unique ID.
+	lastRequestID atomic.Uint64
 }
 
 type request struct {
+	id          uint64
 	enqueueTime time.Time
 	queueSpan   opentracing.Span
 	originalCtx context.Context
@@ -84,6 +104,31 @@ type request struct {
 	response chan *httpgrpc.HTTPResponse
 }
 
+// PriorityClass implements queue.PrioritizedRequest.
+func (r *request) PriorityClass() queue.PriorityClass {
+	return queue.PriorityClassFromHTTPGRPCRequest(r.request)
+}
+
+// EstimatedCost implements queue.CostEstimatedRequest.
+func (r *request) EstimatedCost() int64 {
+	return queue.CostEstimateFromHTTPGRPCRequest(r.request)
+}
+
+// ExpectedQueryComponent implements queue.QueryComponentRequest.
+func (r *request) ExpectedQueryComponent() querycomponent.Component {
+	return queue.QueryComponentFromHTTPGRPCRequest(r.request)
+}
+
+// RequestKey implements queue.KeyedRequest.
+func (r *request) RequestKey() queue.RequestKey {
+	return queue.RequestKey{ID: r.id}
+}
+
+// Deadline implements queue.DeadlineRequest: the request is no longer wanted once the client has given up on it.
+func (r *request) Deadline() (time.Time, bool) {
+	return r.originalCtx.Deadline()
+}
+
 // New creates a new frontend. Frontend implements service, and must be started and stopped.
 func New(cfg Config, limits Limits, log log.Logger, registerer prometheus.Registerer) (*Frontend, error) {
 	f := &Frontend{
@@ -99,6 +144,10 @@ func New(cfg Config, limits Limits, log log.Logger, registerer prometheus.Regist
 			Name: "cortex_query_frontend_discarded_requests_total",
 			Help: "Total number of query requests discarded.",
 		}, []string{"user"}),
+		expiredRequests: promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_expired_requests_total",
+			Help: "Total number of query requests dropped from the queue because their deadline passed before they were dispatched.",
+		}, []string{"user"}),
 		queueDuration: promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
 			Name:    "cortex_query_frontend_queue_duration_seconds",
 			Help:    "Time spent by requests in queue before getting picked up by a querier.",
@@ -111,7 +160,14 @@ func New(cfg Config, limits Limits, log log.Logger, registerer prometheus.Regist
 		Help: "Time spent by requests waiting to join the queue or be rejected.",
 	})
 
-	f.requestQueue = queue.NewRequestQueue(log, cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, f.queueLength, f.discardedRequests, enqueueDuration)
+	f.tenantQueueHistograms = queue.NewTenantQueueHistograms(registerer, "cortex_query_frontend", cfg.MaxTenantQueueHistograms)
+	f.requestQueue = queue.NewRequestQueue(log, cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, f.queueLength, f.discardedRequests, enqueueDuration, queue.RequestQueueOptions{
+		QuerierCostBudget:    cfg.QuerierCostBudget,
+		QueryComponentQueues: cfg.QueryComponentQueues,
+		PriorityClassMaxWait: cfg.PriorityClassMaxWait,
+		ExpiredRequests:      f.expiredRequests,
+		TenantHistograms:     f.tenantQueueHistograms,
+	})
 	f.activeUsers = util.NewActiveUsersCleanupWithDefaultValues(f.cleanupInactiveUserMetrics)
 
 	var err error
@@ -158,6 +214,8 @@ func (f *Frontend) stopping(_ error) error {
 func (f *Frontend) cleanupInactiveUserMetrics(user string) {
 	f.queueLength.DeleteLabelValues(user)
 	f.discardedRequests.DeleteLabelValues(user)
+	f.expiredRequests.DeleteLabelValues(user)
+	f.tenantQueueHistograms.DeleteTenant(user)
 }
 
 // RoundTripGRPC round trips a proto (instead of an HTTP request).
@@ -173,6 +231,7 @@ func (f *Frontend) RoundTripGRPC(ctx context.Context, req *httpgrpc.HTTPRequest)
 	}
 
 	request := request{
+		id:          f.lastRequestID.Inc(),
 		request:     req,
 		originalCtx: ctx,
 
@@ -201,7 +260,7 @@ func (f *Frontend) RoundTripGRPC(ctx context.Context, req *httpgrpc.HTTPRequest)
 
 // Process allows backends to pull requests from the frontend.
 func (f *Frontend) Process(server frontendv1pb.Frontend_ProcessServer) error {
-	querierID, err := getQuerierID(server)
+	querierID, queryComponent, err := getQuerierID(server)
 	if err != nil {
 		return err
 	}
@@ -212,7 +271,7 @@ func (f *Frontend) Process(server frontendv1pb.Frontend_ProcessServer) error {
 	lastUserIndex := queue.FirstUser()
 
 	for {
-		reqWrapper, idx, err := f.requestQueue.GetNextRequestForQuerier(server.Context(), lastUserIndex, querierID)
+		reqWrapper, idx, err := f.requestQueue.GetNextRequestForQuerier(server.Context(), lastUserIndex, querierID, queryComponent)
 		if err != nil {
 			return err
 		}
@@ -236,6 +295,7 @@ func (f *Frontend) Process(server frontendv1pb.Frontend_ProcessServer) error {
 		  it's possible that it's own queue would perpetually contain only expired requests.
 		*/
 		if req.originalCtx.Err() != nil {
+			f.requestQueue.CompleteRequest(req)
 			lastUserIndex = lastUserIndex.ReuseLastUser()
 			continue
 		}
@@ -270,16 +330,19 @@ func (f *Frontend) Process(server frontendv1pb.Frontend_ProcessServer) error {
 		// downstream req.  Only way we can do that is to close the stream.
 		// The worker client is expecting this semantics.
 		case <-req.originalCtx.Done():
+			f.requestQueue.CompleteRequest(req)
 			return req.originalCtx.Err()
 
 		// Is there was an error handling this request due to network IO,
 		// then error out this upstream request _and_ stream.
 		case err := <-errs:
+			f.requestQueue.CompleteRequest(req)
 			req.err <- err
 			return err
 
 		// Happy path: merge the stats and propagate the response.
 		case resp := <-resps:
+			f.requestQueue.CompleteRequest(req)
 			if stats.ShouldTrackHTTPGRPCResponse(resp.HttpResponse) {
 				stats := stats.FromContext(req.originalCtx)
 				stats.Merge(resp.Stats) // Safe if stats is nil.
@@ -297,7 +360,8 @@ func (f *Frontend) NotifyClientShutdown(_ context.Context, req *frontendv1pb.Not
 	return &frontendv1pb.NotifyClientShutdownResponse{}, nil
 }
 
-func getQuerierID(server frontendv1pb.Frontend_ProcessServer) (string, error) {
+// getQuerierID returns the ID of the querier, and the query component the querier worker is reserved for, if any.
+func getQuerierID(server frontendv1pb.Frontend_ProcessServer) (string, querycomponent.Component, error) {
 	err := server.Send(&frontendv1pb.FrontendToClient{
 		Type: frontendv1pb.GET_ID,
 		// Old queriers don't support GET_ID, and will try to use the request.
@@ -309,7 +373,7 @@ func getQuerierID(server frontendv1pb.Frontend_ProcessServer) (string, error) {
 	})
 
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	resp, err := server.Recv()
@@ -317,7 +381,7 @@ func getQuerierID(server frontendv1pb.Frontend_ProcessServer) (string, error) {
 	// Old queriers will return empty string, which is fine. All old queriers will be
 	// treated as single querier with lot of connections.
 	// (Note: if resp is nil, GetClientID() returns "")
-	return resp.GetClientID(), err
+	return resp.GetClientID(), querycomponent.Parse(resp.GetQueryComponent()), err
 }
 
 func (f *Frontend) queueRequest(ctx context.Context, req *request) error {
@@ -330,13 +394,14 @@ func (f *Frontend) queueRequest(ctx context.Context, req *request) error {
 	req.enqueueTime = now
 	req.queueSpan, _ = opentracing.StartSpanFromContext(ctx, "queued")
 
-	// aggregate the max queriers limit in the case of a multi tenant query
+	// aggregate the max queriers limit and the queue weight in the case of a multi tenant query
 	maxQueriers := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, f.limits.MaxQueriersPerUser)
+	weight := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, f.limits.TenantQueueWeight)
 
 	joinedTenantID := tenant.JoinTenantIDs(tenantIDs)
 	f.activeUsers.UpdateUserTimestamp(joinedTenantID, now)
 
-	err = f.requestQueue.EnqueueRequestToDispatcher(joinedTenantID, req, maxQueriers, nil)
+	err = f.requestQueue.EnqueueRequestToDispatcher(joinedTenantID, req, maxQueriers, weight, nil)
 	if errors.Is(err, queue.ErrTooManyRequests) {
 		return errTooManyRequest
 	}
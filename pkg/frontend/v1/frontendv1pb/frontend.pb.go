@@ -127,9 +127,10 @@ func (m *FrontendToClient) GetQueueTimeNanos() int64 {
 }
 
 type ClientToFrontend struct {
-	HttpResponse *httpgrpc.HTTPResponse `protobuf:"bytes,1,opt,name=httpResponse,proto3" json:"httpResponse,omitempty"`
-	ClientID     string                 `protobuf:"bytes,2,opt,name=clientID,proto3" json:"clientID,omitempty"`
-	Stats        *stats.Stats           `protobuf:"bytes,3,opt,name=stats,proto3" json:"stats,omitempty"`
+	HttpResponse   *httpgrpc.HTTPResponse `protobuf:"bytes,1,opt,name=httpResponse,proto3" json:"httpResponse,omitempty"`
+	ClientID       string                 `protobuf:"bytes,2,opt,name=clientID,proto3" json:"clientID,omitempty"`
+	Stats          *stats.Stats           `protobuf:"bytes,3,opt,name=stats,proto3" json:"stats,omitempty"`
+	QueryComponent string                 `protobuf:"bytes,4,opt,name=queryComponent,proto3" json:"queryComponent,omitempty"`
 }
 
 func (m *ClientToFrontend) Reset()      { *m = ClientToFrontend{} }
@@ -185,6 +186,13 @@ func (m *ClientToFrontend) GetStats() *stats.Stats {
 	return nil
 }
 
+func (m *ClientToFrontend) GetQueryComponent() string {
+	if m != nil {
+		return m.QueryComponent
+	}
+	return ""
+}
+
 type NotifyClientShutdownRequest struct {
 	ClientID string `protobuf:"bytes,1,opt,name=clientID,proto3" json:"clientID,omitempty"`
 }
@@ -274,39 +282,40 @@ func init() {
 func init() { proto.RegisterFile("frontend.proto", fileDescriptor_eca3873955a29cfe) }
 
 var fileDescriptor_eca3873955a29cfe = []byte{
-	// 498 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x92, 0x41, 0x6e, 0xd3, 0x40,
-	0x14, 0x86, 0xfd, 0x68, 0x28, 0xe1, 0xc5, 0x8a, 0xac, 0x51, 0x41, 0x91, 0x41, 0xa3, 0xc8, 0x82,
-	0xca, 0x62, 0x61, 0x97, 0x20, 0x81, 0x60, 0x59, 0x1a, 0x4a, 0x37, 0x55, 0x71, 0xcc, 0x86, 0x4d,
-	0xe5, 0x24, 0x13, 0xc7, 0x6a, 0xe3, 0x71, 0xec, 0x31, 0x28, 0x3b, 0x4e, 0x80, 0x38, 0x06, 0x67,
-	0x80, 0x0b, 0xb0, 0xcc, 0xb2, 0x4b, 0xe2, 0x6c, 0x58, 0xf6, 0x08, 0xc8, 0x9e, 0xc4, 0x4d, 0xa2,
-	0x88, 0x6e, 0x46, 0x33, 0xf3, 0xbf, 0xf7, 0xfc, 0xfd, 0xbf, 0x07, 0xeb, 0x83, 0x98, 0x87, 0x82,
-	0x85, 0x7d, 0x2b, 0x8a, 0xb9, 0xe0, 0xa4, 0xba, 0x3c, 0xeb, 0x7b, 0x3e, 0xf7, 0x79, 0x71, 0x69,
-	0xe7, 0x3b, 0xa9, 0xeb, 0x07, 0x7e, 0x20, 0x86, 0x69, 0xd7, 0xea, 0xf1, 0x91, 0xed, 0xc7, 0xde,
-	0xc0, 0x0b, 0x3d, 0xbb, 0x9f, 0x5c, 0x04, 0xc2, 0x1e, 0x0a, 0x11, 0xf9, 0x71, 0xd4, 0x2b, 0x37,
-	0x8b, 0x8e, 0x97, 0x5b, 0x3a, 0x46, 0xc1, 0x28, 0x88, 0xed, 0xe8, 0xc2, 0xb7, 0xc7, 0x29, 0x8b,
-	0x03, 0x16, 0xdb, 0x89, 0xf0, 0x44, 0x22, 0x57, 0xd9, 0x67, 0xfc, 0x02, 0xd4, 0xde, 0x2d, 0x60,
-	0x5c, 0xfe, 0xf6, 0x32, 0x60, 0xa1, 0x20, 0xaf, 0xb0, 0x96, 0x8f, 0x77, 0xd8, 0x38, 0x65, 0x89,
-	0x68, 0x40, 0x13, 0xcc, 0x5a, 0xeb, 0x81, 0x55, 0x7e, 0xf2, 0xbd, 0xeb, 0x9e, 0x2d, 0x44, 0x67,
-	0xb5, 0x92, 0x18, 0x58, 0x11, 0x93, 0x88, 0x35, 0xee, 0x34, 0xc1, 0xac, 0xb7, 0xea, 0x56, 0x69,
-	0xdb, 0x9d, 0x44, 0xcc, 0x29, 0x34, 0x62, 0xa0, 0x5a, 0x00, 0xb4, 0x43, 0xaf, 0x7b, 0xc9, 0xfa,
-	0x8d, 0x9d, 0x26, 0x98, 0x55, 0x67, 0xed, 0x8e, 0xec, 0x63, 0x7d, 0x9c, 0xb2, 0x94, 0xb9, 0xc1,
-	0x88, 0x9d, 0x7a, 0x21, 0x4f, 0x1a, 0x95, 0x26, 0x98, 0x3b, 0xce, 0xc6, 0xad, 0xf1, 0x0d, 0x50,
-	0x93, 0xcc, 0x2e, 0x5f, 0xba, 0x20, 0x6f, 0x50, 0x95, 0x4c, 0x49, 0xc4, 0xc3, 0x84, 0x2d, 0xf0,
-	0x1f, 0x6e, 0xe2, 0x4b, 0xd5, 0x59, 0xab, 0x25, 0x3a, 0x56, 0x7b, 0xc5, 0xbc, 0x93, 0xa3, 0xc2,
-	0xc4, 0x7d, 0xa7, 0x3c, 0x13, 0x03, 0xef, 0x16, 0x90, 0x05, 0x71, 0xad, 0xa5, 0x5a, 0x32, 0xc7,
-	0x4e, 0xbe, 0x3a, 0x52, 0x32, 0x5e, 0xe3, 0xa3, 0x53, 0x2e, 0x82, 0xc1, 0x44, 0x52, 0x75, 0x86,
-	0xa9, 0xe8, 0xf3, 0x2f, 0xe1, 0x32, 0x9f, 0xd5, 0xf1, 0xb0, 0x3e, 0xde, 0xa0, 0xf8, 0x78, 0x7b,
-	0xab, 0x44, 0x7b, 0xf6, 0x04, 0x2b, 0x79, 0x8a, 0x44, 0x43, 0x35, 0x37, 0x70, 0xee, 0xb4, 0x3f,
-	0x7c, 0x6c, 0x77, 0x5c, 0x4d, 0x21, 0x88, 0xbb, 0xc7, 0x6d, 0xf7, 0xfc, 0xe4, 0x48, 0x83, 0xd6,
-	0x4f, 0xc0, 0x6a, 0x99, 0xc4, 0x31, 0xde, 0x3b, 0x8b, 0x79, 0x8f, 0x25, 0x09, 0xd1, 0x6f, 0xfe,
-	0xc5, 0x66, 0x60, 0xfa, 0x8a, 0xb6, 0xf9, 0x14, 0x0c, 0xc5, 0x84, 0x03, 0x20, 0x0c, 0xf7, 0xb6,
-	0xb1, 0x91, 0xa7, 0x37, 0x9d, 0xff, 0xb1, 0xad, 0xef, 0xdf, 0x56, 0x26, 0x2d, 0x1e, 0x1e, 0x4e,
-	0x67, 0x54, 0xb9, 0x9a, 0x51, 0xe5, 0x7a, 0x46, 0xe1, 0x6b, 0x46, 0xe1, 0x47, 0x46, 0xe1, 0x77,
-	0x46, 0x61, 0x9a, 0x51, 0xf8, 0x93, 0x51, 0xf8, 0x9b, 0x51, 0xe5, 0x3a, 0xa3, 0xf0, 0x7d, 0x4e,
-	0x95, 0xe9, 0x9c, 0x2a, 0x57, 0x73, 0xaa, 0x7c, 0x52, 0x97, 0xc3, 0x3f, 0x3f, 0x8f, 0xba, 0xdd,
-	0xdd, 0xe2, 0x5d, 0xbf, 0xf8, 0x17, 0x00, 0x00, 0xff, 0xff, 0x90, 0xf8, 0xe3, 0x38, 0x73, 0x03,
-	0x00, 0x00,
+	// 513 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x92, 0xc1, 0x6e, 0xd3, 0x4c,
+	0x10, 0xc7, 0xbd, 0x5f, 0xf3, 0x95, 0x74, 0x13, 0x45, 0xd6, 0xaa, 0xa0, 0xc8, 0xa0, 0x55, 0x64,
+	0x41, 0x65, 0x71, 0xb0, 0x4b, 0x90, 0x40, 0x70, 0x6c, 0x1b, 0x4a, 0x2f, 0x55, 0xd9, 0x98, 0x0b,
+	0x97, 0xca, 0x49, 0x36, 0x8e, 0xd5, 0x7a, 0xd7, 0xb1, 0xd7, 0xa0, 0xdc, 0x78, 0x04, 0x1e, 0x83,
+	0x27, 0xe0, 0x00, 0x2f, 0xc0, 0x31, 0xc7, 0x1e, 0x89, 0x73, 0xe1, 0xd8, 0x47, 0x40, 0xde, 0x75,
+	0xdc, 0xc4, 0x8a, 0xe0, 0xb2, 0xda, 0x99, 0xff, 0xcc, 0xf8, 0xf7, 0x1f, 0x2f, 0x6c, 0x8d, 0x63,
+	0xce, 0x04, 0x65, 0x23, 0x3b, 0x8a, 0xb9, 0xe0, 0xa8, 0xbe, 0x8a, 0x8d, 0x7d, 0x9f, 0xfb, 0x5c,
+	0x26, 0x9d, 0xfc, 0xa6, 0x74, 0xe3, 0xd0, 0x0f, 0xc4, 0x24, 0x1d, 0xd8, 0x43, 0x1e, 0x3a, 0x7e,
+	0xec, 0x8d, 0x3d, 0xe6, 0x39, 0xa3, 0xe4, 0x2a, 0x10, 0xce, 0x44, 0x88, 0xc8, 0x8f, 0xa3, 0x61,
+	0x79, 0x29, 0x3a, 0x5e, 0x6c, 0xe9, 0x08, 0x83, 0x30, 0x88, 0x9d, 0xe8, 0xca, 0x77, 0xa6, 0x29,
+	0x8d, 0x03, 0x1a, 0x3b, 0x89, 0xf0, 0x44, 0xa2, 0x4e, 0xd5, 0x67, 0xfe, 0x00, 0x50, 0x7f, 0x53,
+	0xc0, 0xb8, 0xfc, 0xf8, 0x3a, 0xa0, 0x4c, 0xa0, 0x97, 0xb0, 0x91, 0x8f, 0x27, 0x74, 0x9a, 0xd2,
+	0x44, 0xb4, 0x41, 0x07, 0x58, 0x8d, 0xee, 0x7d, 0xbb, 0xfc, 0xe4, 0x5b, 0xd7, 0xbd, 0x28, 0x44,
+	0xb2, 0x5e, 0x89, 0x4c, 0x58, 0x13, 0xb3, 0x88, 0xb6, 0xff, 0xeb, 0x00, 0xab, 0xd5, 0x6d, 0xd9,
+	0xa5, 0x6d, 0x77, 0x16, 0x51, 0x22, 0x35, 0x64, 0xc2, 0xa6, 0x04, 0xe8, 0x31, 0x6f, 0x70, 0x4d,
+	0x47, 0xed, 0x9d, 0x0e, 0xb0, 0xea, 0x64, 0x23, 0x87, 0x0e, 0x60, 0x6b, 0x9a, 0xd2, 0x94, 0xba,
+	0x41, 0x48, 0xcf, 0x3d, 0xc6, 0x93, 0x76, 0xad, 0x03, 0xac, 0x1d, 0x52, 0xc9, 0x9a, 0xdf, 0x00,
+	0xd4, 0x15, 0xb3, 0xcb, 0x57, 0x2e, 0xd0, 0x6b, 0xd8, 0x54, 0x4c, 0x49, 0xc4, 0x59, 0x42, 0x0b,
+	0xfc, 0x07, 0x55, 0x7c, 0xa5, 0x92, 0x8d, 0x5a, 0x64, 0xc0, 0xfa, 0x50, 0xce, 0x3b, 0x3b, 0x91,
+	0x26, 0xf6, 0x48, 0x19, 0x23, 0x13, 0xfe, 0x2f, 0x21, 0x25, 0x71, 0xa3, 0xdb, 0xb4, 0x65, 0x64,
+	0xf7, 0xf3, 0x93, 0x28, 0xa9, 0x00, 0x8f, 0x67, 0xc7, 0x3c, 0x8c, 0x38, 0xa3, 0x4c, 0x48, 0xf0,
+	0x3d, 0x52, 0xc9, 0x9a, 0xaf, 0xe0, 0xc3, 0x73, 0x2e, 0x82, 0xf1, 0x4c, 0xd1, 0xf7, 0x27, 0xa9,
+	0x18, 0xf1, 0x4f, 0x6c, 0xb5, 0xc7, 0x75, 0x0c, 0xb0, 0x89, 0x61, 0x62, 0xf8, 0x68, 0x7b, 0xab,
+	0xb2, 0xf0, 0xf4, 0x31, 0xac, 0xe5, 0xdb, 0x46, 0x3a, 0x6c, 0xe6, 0x46, 0x2f, 0x49, 0xef, 0xdd,
+	0xfb, 0x5e, 0xdf, 0xd5, 0x35, 0x04, 0xe1, 0xee, 0x69, 0xcf, 0xbd, 0x3c, 0x3b, 0xd1, 0x41, 0xf7,
+	0x3b, 0x80, 0xf5, 0x72, 0x63, 0xa7, 0xf0, 0xde, 0x45, 0xcc, 0x87, 0x34, 0x49, 0x90, 0x71, 0xf7,
+	0xcf, 0xaa, 0x8b, 0x35, 0xd6, 0xb4, 0xea, 0x93, 0x31, 0x35, 0x0b, 0x1c, 0x02, 0x44, 0xe1, 0xfe,
+	0x36, 0x36, 0xf4, 0xe4, 0xae, 0xf3, 0x2f, 0xb6, 0x8d, 0x83, 0x7f, 0x95, 0x29, 0x8b, 0x47, 0x47,
+	0xf3, 0x05, 0xd6, 0x6e, 0x16, 0x58, 0xbb, 0x5d, 0x60, 0xf0, 0x39, 0xc3, 0xe0, 0x6b, 0x86, 0xc1,
+	0xcf, 0x0c, 0x83, 0x79, 0x86, 0xc1, 0xaf, 0x0c, 0x83, 0xdf, 0x19, 0xd6, 0x6e, 0x33, 0x0c, 0xbe,
+	0x2c, 0xb1, 0x36, 0x5f, 0x62, 0xed, 0x66, 0x89, 0xb5, 0x0f, 0xcd, 0xd5, 0xf0, 0x8f, 0xcf, 0xa2,
+	0xc1, 0x60, 0x57, 0xbe, 0xff, 0xe7, 0x7f, 0x06, 0x00, 0x21, 0x1a, 0x5f, 0xc8, 0x9b, 0x03, 0x00,
+	0x00,
 }
 
 func (x Type) String() string {
@@ -377,6 +386,9 @@ func (this *ClientToFrontend) Equal(that interface{}) bool {
 	if !this.Stats.Equal(that1.Stats) {
 		return false
 	}
+	if this.QueryComponent != that1.QueryComponent {
+		return false
+	}
 	return true
 }
 func (this *NotifyClientShutdownRequest) Equal(that interface{}) bool {
@@ -443,7 +455,7 @@ func (this *ClientToFrontend) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 7)
+	s := make([]string, 0, 8)
 	s = append(s, "&frontendv1pb.ClientToFrontend{")
 	if this.HttpResponse != nil {
 		s = append(s, "HttpResponse: "+fmt.Sprintf("%#v", this.HttpResponse)+",\n")
@@ -452,6 +464,7 @@ func (this *ClientToFrontend) GoString() string {
 	if this.Stats != nil {
 		s = append(s, "Stats: "+fmt.Sprintf("%#v", this.Stats)+",\n")
 	}
+	s = append(s, "QueryComponent: "+fmt.Sprintf("%#v", this.QueryComponent)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -713,6 +726,13 @@ func (m *ClientToFrontend) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.QueryComponent) > 0 {
+		i -= len(m.QueryComponent)
+		copy(dAtA[i:], m.QueryComponent)
+		i = encodeVarintFrontend(dAtA, i, uint64(len(m.QueryComponent)))
+		i--
+		dAtA[i] = 0x22
+	}
 	if m.Stats != nil {
 		{
 			size, err := m.Stats.MarshalToSizedBuffer(dAtA[:i])
@@ -851,6 +871,10 @@ func (m *ClientToFrontend) Size() (n int) {
 		l = m.Stats.Size()
 		n += 1 + l + sovFrontend(uint64(l))
 	}
+	l = len(m.QueryComponent)
+	if l > 0 {
+		n += 1 + l + sovFrontend(uint64(l))
+	}
 	return n
 }
 
@@ -903,6 +927,7 @@ func (this *ClientToFrontend) String() string {
 		`HttpResponse:` + strings.Replace(fmt.Sprintf("%v", this.HttpResponse), "HTTPResponse", "httpgrpc.HTTPResponse", 1) + `,`,
 		`ClientID:` + fmt.Sprintf("%v", this.ClientID) + `,`,
 		`Stats:` + strings.Replace(fmt.Sprintf("%v", this.Stats), "Stats", "stats.Stats", 1) + `,`,
+		`QueryComponent:` + fmt.Sprintf("%v", this.QueryComponent) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1214,6 +1239,38 @@ func (m *ClientToFrontend) Unmarshal(dAtA []byte) error {
 				return err
 			}
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QueryComponent", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowFrontend
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthFrontend
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthFrontend
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.QueryComponent = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipFrontend(dAtA[iNdEx:])
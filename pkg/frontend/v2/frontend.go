@@ -39,10 +39,11 @@ import (
 
 // Config for a Frontend.
 type Config struct {
-	SchedulerAddress  string            `yaml:"scheduler_address"`
-	DNSLookupPeriod   time.Duration     `yaml:"scheduler_dns_lookup_period" category:"advanced"`
-	WorkerConcurrency int               `yaml:"scheduler_worker_concurrency" category:"advanced"`
-	GRPCClientConfig  grpcclient.Config `yaml:"grpc_client_config" doc:"description=Configures the gRPC client used to communicate between the query-frontends and the query-schedulers."`
+	SchedulerAddress   string            `yaml:"scheduler_address"`
+	DNSLookupPeriod    time.Duration     `yaml:"scheduler_dns_lookup_period" category:"advanced"`
+	WorkerConcurrency  int               `yaml:"scheduler_worker_concurrency" category:"advanced"`
+	BackpressurePeriod time.Duration     `yaml:"scheduler_backpressure_period" category:"experimental"`
+	GRPCClientConfig   grpcclient.Config `yaml:"grpc_client_config" doc:"description=Configures the gRPC client used to communicate between the query-frontends and the query-schedulers."`
 
 	// Used to find local IP address, that is sent to scheduler and querier-worker.
 	InfNames   []string `yaml:"instance_interface_names" category:"advanced" doc:"default=[<private network interfaces>]"`
@@ -60,6 +61,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	f.StringVar(&cfg.SchedulerAddress, "query-frontend.scheduler-address", "", fmt.Sprintf("Address of the query-scheduler component, in host:port format. The host should resolve to all query-scheduler instances. This option should be set only when query-scheduler component is in use and -%s is set to '%s'.", schedulerdiscovery.ModeFlagName, schedulerdiscovery.ModeDNS))
 	f.DurationVar(&cfg.DNSLookupPeriod, "query-frontend.scheduler-dns-lookup-period", 10*time.Second, "How often to resolve the scheduler-address, in order to look for new query-scheduler instances.")
 	f.IntVar(&cfg.WorkerConcurrency, "query-frontend.scheduler-worker-concurrency", 5, "Number of concurrent workers forwarding queries to single query-scheduler.")
+	f.DurationVar(&cfg.BackpressurePeriod, "query-frontend.scheduler-backpressure-period", 0, "How long to reject the queries of a tenant with HTTP status code 429 after all the query-schedulers the query-frontend is connected to signalled that the tenant's queue is nearly full, see -query-scheduler.tenant-backpressure-queue-length. 0 to ignore the signals.")
 
 	cfg.InfNames = netutil.PrivateNetworkInterfacesWithFallback([]string{"eth0", "en0"}, logger)
 	f.BoolVar(&cfg.EnableIPv6, "query-frontend.instance-enable-ipv6", false, "Enable using a IPv6 instance address (default false).")
@@ -94,6 +96,9 @@ type Frontend struct {
 	schedulerWorkers        *frontendSchedulerWorkers
 	schedulerWorkersWatcher *services.FailureWatcher
 	requests                *requestsInProgress
+
+	backpressure         *schedulerBackpressure
+	backpressureRejected prometheus.Counter
 }
 
 type frontendRequest struct {
@@ -128,8 +133,9 @@ type enqueueResult struct {
 // NewFrontend creates a new frontend.
 func NewFrontend(cfg Config, log log.Logger, reg prometheus.Registerer) (*Frontend, error) {
 	requestsCh := make(chan *frontendRequest)
+	backpressure := newSchedulerBackpressure(cfg.BackpressurePeriod)
 
-	schedulerWorkers, err := newFrontendSchedulerWorkers(cfg, net.JoinHostPort(cfg.Addr, strconv.Itoa(cfg.Port)), requestsCh, log, reg)
+	schedulerWorkers, err := newFrontendSchedulerWorkers(cfg, net.JoinHostPort(cfg.Addr, strconv.Itoa(cfg.Port)), requestsCh, backpressure, log, reg)
 	if err != nil {
 		return nil, err
 	}
@@ -141,6 +147,11 @@ func NewFrontend(cfg Config, log log.Logger, reg prometheus.Registerer) (*Fronte
 		schedulerWorkers:        schedulerWorkers,
 		schedulerWorkersWatcher: services.NewFailureWatcher(),
 		requests:                newRequestsInProgress(),
+		backpressure:            backpressure,
+		backpressureRejected: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "cortex_query_frontend_scheduler_backpressure_rejected_requests_total",
+			Help: "Total number of requests rejected because a query-scheduler signalled that the queue of their tenant is nearly full.",
+		}),
 	}
 	// Randomize to avoid getting responses from queries sent before restart, which could lead to mixing results
 	// between different queries. Note that frontend verifies the user, so it cannot leak results between tenants.
@@ -197,6 +208,14 @@ func (f *Frontend) RoundTripGRPC(ctx context.Context, req *httpgrpc.HTTPRequest)
 	}
 	userID := tenant.JoinTenantIDs(tenantIDs)
 
+	if f.backpressure.active(userID, time.Now()) {
+		f.backpressureRejected.Inc()
+		return &httpgrpc.HTTPResponse{
+			Code: http.StatusTooManyRequests,
+			Body: []byte("too many outstanding requests"),
+		}, nil
+	}
+
 	// Propagate trace context in gRPC too - this will be ignored if using HTTP.
 	tracer, span := opentracing.GlobalTracer(), opentracing.SpanFromContext(ctx)
 	if tracer != nil && span != nil {
@@ -54,9 +54,12 @@ type frontendSchedulerWorkers struct {
 	workers map[string]*frontendSchedulerWorker
 
 	enqueueDuration *prometheus.HistogramVec
+
+	// Shared with the frontend, which rejects the queries of the tenants under backpressure.
+	backpressure *schedulerBackpressure
 }
 
-func newFrontendSchedulerWorkers(cfg Config, frontendAddress string, requestsCh <-chan *frontendRequest, log log.Logger, reg prometheus.Registerer) (*frontendSchedulerWorkers, error) {
+func newFrontendSchedulerWorkers(cfg Config, frontendAddress string, requestsCh <-chan *frontendRequest, backpressure *schedulerBackpressure, log log.Logger, reg prometheus.Registerer) (*frontendSchedulerWorkers, error) {
 	f := &frontendSchedulerWorkers{
 		cfg:                       cfg,
 		log:                       log,
@@ -64,6 +67,7 @@ func newFrontendSchedulerWorkers(cfg Config, frontendAddress string, requestsCh
 		requestsCh:                requestsCh,
 		workers:                   map[string]*frontendSchedulerWorker{},
 		schedulerDiscoveryWatcher: services.NewFailureWatcher(),
+		backpressure:              backpressure,
 		enqueueDuration: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
 			Name: "cortex_query_frontend_enqueue_duration_seconds",
 			Help: "Time spent by requests waiting to join the queue or be rejected.",
@@ -139,7 +143,7 @@ func (f *frontendSchedulerWorkers) addScheduler(address string) {
 	}
 
 	// No worker for this address yet, start a new one.
-	w = newFrontendSchedulerWorker(conn, address, f.frontendAddress, f.requestsCh, f.cfg.WorkerConcurrency, f.enqueueDuration.WithLabelValues(address), f.log)
+	w = newFrontendSchedulerWorker(conn, address, f.frontendAddress, f.requestsCh, f.cfg.WorkerConcurrency, f.enqueueDuration.WithLabelValues(address), f.backpressure, f.log)
 
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -154,6 +158,7 @@ func (f *frontendSchedulerWorkers) addScheduler(address string) {
 		return
 	}
 	f.workers[address] = w
+	f.backpressure.addScheduler(address)
 	w.start()
 }
 
@@ -173,6 +178,7 @@ func (f *frontendSchedulerWorkers) removeScheduler(address string) {
 		level.Info(f.log).Log("msg", "removing connection to query-scheduler", "addr", address)
 		w.stop()
 	}
+	f.backpressure.removeScheduler(address)
 	f.enqueueDuration.Delete(prometheus.Labels{schedulerAddressLabel: address})
 }
 
@@ -233,9 +239,12 @@ type frontendSchedulerWorker struct {
 
 	// How long it takes to enqueue a query.
 	enqueueDuration prometheus.Observer
+
+	// Tenants the scheduler signalled backpressure for.
+	backpressure *schedulerBackpressure
 }
 
-func newFrontendSchedulerWorker(conn *grpc.ClientConn, schedulerAddr string, frontendAddr string, requestsCh <-chan *frontendRequest, concurrency int, enqueueDuration prometheus.Observer, log log.Logger) *frontendSchedulerWorker {
+func newFrontendSchedulerWorker(conn *grpc.ClientConn, schedulerAddr string, frontendAddr string, requestsCh <-chan *frontendRequest, concurrency int, enqueueDuration prometheus.Observer, backpressure *schedulerBackpressure, log log.Logger) *frontendSchedulerWorker {
 	w := &frontendSchedulerWorker{
 		log:             log,
 		conn:            conn,
@@ -245,6 +254,7 @@ func newFrontendSchedulerWorker(conn *grpc.ClientConn, schedulerAddr string, fro
 		requestsCh:      requestsCh,
 		cancelCh:        make(chan uint64, schedulerWorkerCancelChanCapacity),
 		enqueueDuration: enqueueDuration,
+		backpressure:    backpressure,
 	}
 	w.ctx, w.cancel = context.WithCancel(context.Background())
 
@@ -374,14 +384,20 @@ func (w *frontendSchedulerWorker) enqueueRequest(loop schedulerpb.SchedulerForFr
 	durationTimer := prometheus.NewTimer(w.enqueueDuration)
 	defer durationTimer.ObserveDuration()
 
-	err := loop.Send(&schedulerpb.FrontendToScheduler{
+	msg := &schedulerpb.FrontendToScheduler{
 		Type:            schedulerpb.ENQUEUE,
 		QueryID:         req.queryID,
 		UserID:          req.userID,
 		HttpRequest:     req.request,
 		FrontendAddress: w.frontendAddr,
 		StatsEnabled:    req.statsEnabled,
-	})
+	}
+	// Let the scheduler drop the request from its queue once we no longer wait for the response.
+	if deadline, ok := req.ctx.Deadline(); ok {
+		msg.DeadlineUnixNano = deadline.UnixNano()
+	}
+
+	err := loop.Send(msg)
 	if err != nil {
 		level.Warn(spanLogger).Log("msg", "received error while sending request to scheduler", "err", err)
 		req.enqueue <- enqueueResult{status: failed}
@@ -397,6 +413,10 @@ func (w *frontendSchedulerWorker) enqueueRequest(loop schedulerpb.SchedulerForFr
 
 	switch resp.Status {
 	case schedulerpb.OK:
+		if resp.TenantBackpressure {
+			level.Debug(spanLogger).Log("msg", "scheduler signalled backpressure for the tenant", "user", req.userID)
+			w.backpressure.signal(w.schedulerAddr, req.userID, time.Now())
+		}
 		req.enqueue <- enqueueResult{status: waitForResponse, cancelCh: w.cancelCh}
 		// Response will come from querier.
 
@@ -25,6 +25,7 @@ import (
 	"github.com/grafana/dskit/test"
 	"github.com/grafana/dskit/user"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -47,6 +48,10 @@ func setupFrontend(t *testing.T, reg prometheus.Registerer, schedulerReplyFunc f
 }
 
 func setupFrontendWithConcurrencyAndServerOptions(t *testing.T, reg prometheus.Registerer, schedulerReplyFunc func(f *Frontend, msg *schedulerpb.FrontendToScheduler) *schedulerpb.SchedulerToFrontend, concurrency int, opts ...grpc.ServerOption) (*Frontend, *mockScheduler) {
+	return setupFrontendWithConfig(t, reg, nil, schedulerReplyFunc, concurrency, opts...)
+}
+
+func setupFrontendWithConfig(t *testing.T, reg prometheus.Registerer, configure func(cfg *Config), schedulerReplyFunc func(f *Frontend, msg *schedulerpb.FrontendToScheduler) *schedulerpb.SchedulerToFrontend, concurrency int, opts ...grpc.ServerOption) (*Frontend, *mockScheduler) {
 	l, err := net.Listen("tcp", "localhost:0")
 	require.NoError(t, err)
 
@@ -64,6 +69,9 @@ func setupFrontendWithConcurrencyAndServerOptions(t *testing.T, reg prometheus.R
 	cfg.WorkerConcurrency = concurrency
 	cfg.Addr = h
 	cfg.Port = grpcPort
+	if configure != nil {
+		configure(&cfg)
+	}
 
 	logger := log.NewLogfmtLogger(os.Stdout)
 	f, err := NewFrontend(cfg, logger, reg)
@@ -218,6 +226,88 @@ func TestFrontendTooManyRequests(t *testing.T) {
 	require.Equal(t, int32(http.StatusTooManyRequests), resp.Code)
 }
 
+func TestFrontendSchedulerBackpressure(t *testing.T) {
+	const backpressuredUser = "backpressured"
+
+	reg := prometheus.NewRegistry()
+	f, ms := setupFrontendWithConfig(t, reg, func(cfg *Config) {
+		cfg.BackpressurePeriod = time.Minute
+	}, func(f *Frontend, msg *schedulerpb.FrontendToScheduler) *schedulerpb.SchedulerToFrontend {
+		go sendResponseWithDelay(f, 100*time.Millisecond, msg.UserID, msg.QueryID, &httpgrpc.HTTPResponse{Code: 200})
+
+		return &schedulerpb.SchedulerToFrontend{Status: schedulerpb.OK, TenantBackpressure: msg.UserID == backpressuredUser}
+	}, testFrontendWorkerConcurrency)
+
+	// the query during which the scheduler signals backpressure is enqueued as usual
+	resp, err := f.RoundTripGRPC(user.InjectOrgID(context.Background(), backpressuredUser), &httpgrpc.HTTPRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int32(200), resp.Code)
+
+	// further queries of the tenant are rejected without being sent to the scheduler
+	resp, err = f.RoundTripGRPC(user.InjectOrgID(context.Background(), backpressuredUser), &httpgrpc.HTTPRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int32(http.StatusTooManyRequests), resp.Code)
+
+	// other tenants are not affected
+	resp, err = f.RoundTripGRPC(user.InjectOrgID(context.Background(), "other"), &httpgrpc.HTTPRequest{})
+	require.NoError(t, err)
+	require.Equal(t, int32(200), resp.Code)
+
+	ms.checkWithLock(func() {
+		require.Len(t, ms.msgs, 2)
+	})
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_frontend_scheduler_backpressure_rejected_requests_total Total number of requests rejected because a query-scheduler signalled that the queue of their tenant is nearly full.
+		# TYPE cortex_query_frontend_scheduler_backpressure_rejected_requests_total counter
+		cortex_query_frontend_scheduler_backpressure_rejected_requests_total 1
+	`), "cortex_query_frontend_scheduler_backpressure_rejected_requests_total"))
+}
+
+func TestSchedulerBackpressure_Expires(t *testing.T) {
+	now := time.Now()
+	b := newSchedulerBackpressure(time.Minute)
+	b.addScheduler("scheduler-1")
+	b.signal("scheduler-1", "user-1", now)
+
+	require.True(t, b.active("user-1", now.Add(time.Second)))
+	require.False(t, b.active("user-2", now.Add(time.Second)))
+	require.False(t, b.active("user-1", now.Add(time.Minute)))
+	require.Empty(t, b.until)
+
+	// expired signals are pruned even if their tenant sends no further query
+	b.signal("scheduler-1", "user-2", now)
+	b.signal("scheduler-1", "user-3", now.Add(time.Minute))
+	require.Len(t, b.until, 1)
+
+	// signals are ignored unless a backpressure period is set
+	b = newSchedulerBackpressure(0)
+	b.addScheduler("scheduler-1")
+	b.signal("scheduler-1", "user-1", now)
+	require.False(t, b.active("user-1", now))
+}
+
+func TestSchedulerBackpressure_MultipleSchedulers(t *testing.T) {
+	now := time.Now()
+	b := newSchedulerBackpressure(time.Minute)
+	b.addScheduler("scheduler-1")
+	b.addScheduler("scheduler-2")
+
+	// the tenant's queries can still be enqueued to the other query-scheduler
+	b.signal("scheduler-1", "user-1", now)
+	require.False(t, b.active("user-1", now))
+
+	b.signal("scheduler-2", "user-1", now)
+	require.True(t, b.active("user-1", now))
+
+	// the signals of a removed query-scheduler are forgotten
+	b.removeScheduler("scheduler-2")
+	require.Len(t, b.until, 1)
+	require.True(t, b.active("user-1", now))
+	b.removeScheduler("scheduler-1")
+	require.Empty(t, b.until)
+	require.False(t, b.active("user-1", now))
+}
+
 func TestFrontendEnqueueFailure(t *testing.T) {
 	f, _ := setupFrontend(t, nil, func(f *Frontend, msg *schedulerpb.FrontendToScheduler) *schedulerpb.SchedulerToFrontend {
 		return &schedulerpb.SchedulerToFrontend{Status: schedulerpb.SHUTTING_DOWN}
@@ -251,6 +341,10 @@ func TestFrontendCancellation(t *testing.T) {
 		require.True(t, ms.msgs[0].Type == schedulerpb.ENQUEUE)
 		require.True(t, ms.msgs[1].Type == schedulerpb.CANCEL)
 		require.True(t, ms.msgs[0].QueryID == ms.msgs[1].QueryID)
+
+		// the scheduler is told when the frontend stops waiting for the response
+		deadline, _ := ctx.Deadline()
+		require.Equal(t, deadline.UnixNano(), ms.msgs[0].DeadlineUnixNano)
 	})
 }
 
@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package v2
+
+import (
+	"sync"
+	"time"
+)
+
+// schedulerBackpressure tracks the tenants the query-schedulers signalled backpressure for, because their queue is
+// nearly full. The frontend rejects the further queries of such a tenant for a period, instead of enqueuing them
+// only to have them rejected by the query-scheduler once the queue is full.
+//
+// Each query-scheduler keeps its own queue of the tenant, and the frontend does not choose the query-scheduler
+// a query is enqueued to, so the tenant's queries are only rejected while all the query-schedulers the frontend
+// is connected to signalled backpressure for it.
+//
+// A nil schedulerBackpressure ignores the signals.
+type schedulerBackpressure struct {
+	period time.Duration
+
+	mtx sync.Mutex
+	// addresses of the query-schedulers the frontend is connected to
+	schedulers map[string]struct{}
+	// until when the backpressure signalled by each query-scheduler for each tenant lasts
+	until map[schedulerBackpressureKey]time.Time
+	// when the expired signals were last pruned
+	lastPrune time.Time
+}
+
+type schedulerBackpressureKey struct {
+	schedulerAddr string
+	userID        string
+}
+
+func newSchedulerBackpressure(period time.Duration) *schedulerBackpressure {
+	if period <= 0 {
+		return nil
+	}
+	return &schedulerBackpressure{
+		period:     period,
+		schedulers: map[string]struct{}{},
+		until:      map[schedulerBackpressureKey]time.Time{},
+	}
+}
+
+// addScheduler records that the frontend is connected to the query-scheduler.
+func (b *schedulerBackpressure) addScheduler(schedulerAddr string) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.schedulers[schedulerAddr] = struct{}{}
+}
+
+// removeScheduler records that the frontend is no longer connected to the query-scheduler,
+// and forgets the backpressure it signalled.
+func (b *schedulerBackpressure) removeScheduler(schedulerAddr string) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	delete(b.schedulers, schedulerAddr)
+	for key := range b.until {
+		if key.schedulerAddr == schedulerAddr {
+			delete(b.until, key)
+		}
+	}
+}
+
+// signal records the backpressure signalled by a query-scheduler for the tenant.
+// The signals which expired are pruned at most once per backpressure period.
+func (b *schedulerBackpressure) signal(schedulerAddr, userID string, now time.Time) {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if now.Sub(b.lastPrune) >= b.period {
+		for key, until := range b.until {
+			if !now.Before(until) {
+				delete(b.until, key)
+			}
+		}
+		b.lastPrune = now
+	}
+	b.until[schedulerBackpressureKey{schedulerAddr: schedulerAddr, userID: userID}] = now.Add(b.period)
+}
+
+// active returns true if the tenant's queries should be rejected, because each query-scheduler the frontend
+// is connected to signalled backpressure for it less than the backpressure period ago.
+func (b *schedulerBackpressure) active(userID string, now time.Time) bool {
+	if b == nil {
+		return false
+	}
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if len(b.schedulers) == 0 {
+		return false
+	}
+	for schedulerAddr := range b.schedulers {
+		key := schedulerBackpressureKey{schedulerAddr: schedulerAddr, userID: userID}
+		until, ok := b.until[key]
+		if !ok {
+			return false
+		}
+		if !now.Before(until) {
+			delete(b.until, key)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package querycomponent names the components of the read path a query request is expected to fetch its data from,
+// which the query-frontend, the query-scheduler and the querier workers agree on.
+package querycomponent
+
+import "time"
+
+// Header is the HTTP header carrying the component expected to serve a query request.
+const Header = "Query-Component"
+
+// Component is the component of the read path a query request is expected to fetch its data from.
+//
+// Under query component queues, each tenant queue is split into a sub-queue per component, which are dispatched
+// in turn, so that a flood of slow store-gateway queries cannot hold back the cheap queries of recent data
+// of the same tenant. Requests with no known component are queued in the tenant queue itself, which takes its turn
+// along with the sub-queues.
+type Component string
+
+const (
+	Ingester                Component = "ingester"
+	StoreGateway            Component = "store-gateway"
+	IngesterAndStoreGateway Component = "ingester-and-store-gateway"
+)
+
+// Parse returns the component named by s, or an empty component if s names none.
+func Parse(s string) Component {
+	switch c := Component(s); c {
+	case Ingester, StoreGateway, IngesterAndStoreGateway:
+		return c
+	default:
+		return ""
+	}
+}
+
+// Expected returns the component expected to serve a query of the time range from start to end,
+// given that queriers only query the ingesters for the data within queryIngestersWithin of now. Queries of more
+// recent data are expected to be served by the ingesters only, and queries of older data by the store-gateways only.
+// Returns an empty component if queryIngestersWithin is 0, in which case all queries are sent to the ingesters.
+func Expected(start, end, now time.Time, queryIngestersWithin time.Duration) Component {
+	if queryIngestersWithin <= 0 {
+		return ""
+	}
+	ingestersWithin := now.Add(-queryIngestersWithin)
+	switch {
+	case end.Before(ingestersWithin):
+		return StoreGateway
+	case !start.Before(ingestersWithin):
+		return Ingester
+	default:
+		return IngesterAndStoreGateway
+	}
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package querycomponent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	assert.Equal(t, Ingester, Parse("ingester"))
+	assert.Equal(t, StoreGateway, Parse("store-gateway"))
+	assert.Equal(t, IngesterAndStoreGateway, Parse("ingester-and-store-gateway"))
+	assert.Equal(t, Component(""), Parse("querier"))
+	assert.Equal(t, Component(""), Parse(""))
+}
+
+func TestExpected(t *testing.T) {
+	now := time.Now()
+	within := 13 * time.Hour
+
+	for name, tc := range map[string]struct {
+		start, end           time.Time
+		queryIngestersWithin time.Duration
+		expected             Component
+	}{
+		"recent data": {
+			start: now.Add(-time.Hour), end: now, queryIngestersWithin: within,
+			expected: Ingester,
+		},
+		"old data": {
+			start: now.Add(-48 * time.Hour), end: now.Add(-24 * time.Hour), queryIngestersWithin: within,
+			expected: StoreGateway,
+		},
+		"time range across the query ingesters within boundary": {
+			start: now.Add(-24 * time.Hour), end: now, queryIngestersWithin: within,
+			expected: IngesterAndStoreGateway,
+		},
+		"query ingesters within disabled": {
+			start: now.Add(-48 * time.Hour), end: now.Add(-24 * time.Hour),
+			expected: "",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Expected(tc.start, tc.end, now, tc.queryIngestersWithin))
+		})
+	}
+}
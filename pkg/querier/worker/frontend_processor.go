@@ -20,6 +20,7 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/grafana/mimir/pkg/frontend/v1/frontendv1pb"
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
 	querier_stats "github.com/grafana/mimir/pkg/querier/stats"
 )
 
@@ -67,7 +68,7 @@ func (fp *frontendProcessor) notifyShutdown(ctx context.Context, conn *grpc.Clie
 
 // processQueriesOnSingleStream tries to establish a stream to the query-frontend and then process queries received
 // on the stream. This function loops until workerCtx is canceled.
-func (fp *frontendProcessor) processQueriesOnSingleStream(workerCtx context.Context, conn *grpc.ClientConn, address string) {
+func (fp *frontendProcessor) processQueriesOnSingleStream(workerCtx context.Context, conn *grpc.ClientConn, address string, queryComponent querycomponent.Component) {
 	client := fp.frontendClientFactory(conn)
 
 	// Run the gRPC client and process all the queries in a dedicated context that we call the "execution context".
@@ -84,7 +85,7 @@ func (fp *frontendProcessor) processQueriesOnSingleStream(workerCtx context.Cont
 			continue
 		}
 
-		if err := fp.process(c, inflightQuery); err != nil {
+		if err := fp.process(c, queryComponent, inflightQuery); err != nil {
 			if !grpcutil.IsCanceled(err) {
 				level.Error(fp.log).Log("msg", "error processing requests", "address", address, "err", err)
 				backoff.Wait()
@@ -96,7 +97,7 @@ func (fp *frontendProcessor) processQueriesOnSingleStream(workerCtx context.Cont
 }
 
 // process loops processing requests on an established stream.
-func (fp *frontendProcessor) process(c frontendv1pb.Frontend_ProcessClient, inflightQuery *atomic.Bool) error {
+func (fp *frontendProcessor) process(c frontendv1pb.Frontend_ProcessClient, queryComponent querycomponent.Component, inflightQuery *atomic.Bool) error {
 	// Build a child context so we can cancel a query when the stream is closed.
 	ctx, cancel := context.WithCancel(c.Context())
 	defer cancel()
@@ -126,7 +127,7 @@ func (fp *frontendProcessor) process(c frontendv1pb.Frontend_ProcessClient, infl
 			})
 
 		case frontendv1pb.GET_ID:
-			err := c.Send(&frontendv1pb.ClientToFrontend{ClientID: fp.querierID})
+			err := c.Send(&frontendv1pb.ClientToFrontend{ClientID: fp.querierID, QueryComponent: string(queryComponent)})
 			if err != nil {
 				return err
 			}
@@ -42,7 +42,7 @@ func TestFrontendProcessor_processQueriesOnSingleStream(t *testing.T) {
 
 		requestHandler.On("Handle", mock.Anything, mock.Anything).Return(&httpgrpc.HTTPResponse{}, nil)
 
-		fp.processQueriesOnSingleStream(workerCtx, nil, "12.0.0.1")
+		fp.processQueriesOnSingleStream(workerCtx, nil, "12.0.0.1", "")
 
 		// We expect at this point, the execution context has been canceled too.
 		require.Error(t, processClient.Context().Err())
@@ -84,7 +84,7 @@ func TestFrontendProcessor_processQueriesOnSingleStream(t *testing.T) {
 		}).Return(&httpgrpc.HTTPResponse{}, nil)
 
 		startTime := time.Now()
-		fp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1")
+		fp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1", "")
 		assert.GreaterOrEqual(t, time.Since(startTime), time.Second)
 
 		// We expect at this point, the execution context has been canceled too.
@@ -131,7 +131,7 @@ func TestFrontendProcessor_QueryTime(t *testing.T) {
 			}
 		}).Return(&httpgrpc.HTTPResponse{}, nil)
 
-		fp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1")
+		fp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1", "")
 
 		// We expect Send() to be called once, to send the query result.
 		processClient.AssertNumberOfCalls(t, "Send", 1)
@@ -161,7 +161,7 @@ func TestRecvFailDoesntCancelProcess(t *testing.T) {
 		running.Store(true)
 		defer running.Store(false)
 
-		mgr.processQueriesOnSingleStream(ctx, cc, "test:12345")
+		mgr.processQueriesOnSingleStream(ctx, cc, "test:12345", "")
 	}()
 
 	test.Poll(t, time.Second, true, func() interface{} {
@@ -187,7 +187,7 @@ func TestContextCancelStopsProcess(t *testing.T) {
 	cc, err := grpc.DialContext(ctx, "localhost:999", grpc.WithTransportCredentials(insecure.NewCredentials()))
 	require.NoError(t, err)
 
-	pm := newProcessorManager(ctx, &mockProcessor{}, cc, "test")
+	pm := newProcessorManager(ctx, &mockProcessor{}, cc, "test", 0)
 	pm.concurrency(1)
 
 	test.Poll(t, time.Second, 1, func() interface{} {
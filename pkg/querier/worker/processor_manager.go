@@ -12,6 +12,8 @@ import (
 
 	"go.uber.org/atomic"
 	"google.golang.org/grpc"
+
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
 )
 
 const (
@@ -28,20 +30,25 @@ type processorManager struct {
 	ctx context.Context
 	wg  sync.WaitGroup
 
-	// Cancel functions for individual goroutines.
-	cancelsMu sync.Mutex
-	cancels   []context.CancelFunc
+	// Fraction of the goroutines reserved for the queries expected to be served by the ingesters only.
+	reservedIngesterWorkersFraction float64
+
+	// Cancel functions for individual goroutines, and for the goroutines reserved for ingester queries.
+	cancelsMu       sync.Mutex
+	cancels         []context.CancelFunc
+	reservedCancels []context.CancelFunc
 
 	currentProcessors *atomic.Int32
 }
 
-func newProcessorManager(ctx context.Context, p processor, conn *grpc.ClientConn, address string) *processorManager {
+func newProcessorManager(ctx context.Context, p processor, conn *grpc.ClientConn, address string, reservedIngesterWorkersFraction float64) *processorManager {
 	return &processorManager{
-		p:                 p,
-		ctx:               ctx,
-		conn:              conn,
-		address:           address,
-		currentProcessors: atomic.NewInt32(0),
+		p:                               p,
+		ctx:                             ctx,
+		conn:                            conn,
+		address:                         address,
+		reservedIngesterWorkersFraction: reservedIngesterWorkersFraction,
+		currentProcessors:               atomic.NewInt32(0),
 	}
 }
 
@@ -69,9 +76,18 @@ func (pm *processorManager) concurrency(n int) {
 		n = 0
 	}
 
-	for len(pm.cancels) < n {
+	// The number of reserved goroutines is rounded down, so that a single goroutine is never reserved.
+	reserved := int(float64(n) * pm.reservedIngesterWorkersFraction)
+	pm.cancels = pm.resize(pm.cancels, n-reserved, "")
+	pm.reservedCancels = pm.resize(pm.reservedCancels, reserved, querycomponent.Ingester)
+}
+
+// resize starts or stops goroutines processing the queries expected to be served by the query component,
+// or any query if it is empty, so that n of them are left running, and returns their cancel functions.
+func (pm *processorManager) resize(cancels []context.CancelFunc, n int, queryComponent querycomponent.Component) []context.CancelFunc {
+	for len(cancels) < n {
 		ctx, cancel := context.WithCancel(pm.ctx)
-		pm.cancels = append(pm.cancels, cancel)
+		cancels = append(cancels, cancel)
 
 		pm.wg.Add(1)
 		go func() {
@@ -80,12 +96,13 @@ func (pm *processorManager) concurrency(n int) {
 			pm.currentProcessors.Inc()
 			defer pm.currentProcessors.Dec()
 
-			pm.p.processQueriesOnSingleStream(ctx, pm.conn, pm.address)
+			pm.p.processQueriesOnSingleStream(ctx, pm.conn, pm.address, queryComponent)
 		}()
 	}
 
-	for len(pm.cancels) > n {
-		pm.cancels[0]()
-		pm.cancels = pm.cancels[1:]
+	for len(cancels) > n {
+		cancels[0]()
+		cancels = cancels[1:]
 	}
+	return cancels
 }
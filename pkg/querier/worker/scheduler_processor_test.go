@@ -46,7 +46,7 @@ func TestSchedulerProcessor_processQueriesOnSingleStream(t *testing.T) {
 
 		requestHandler.On("Handle", mock.Anything, mock.Anything).Return(&httpgrpc.HTTPResponse{}, nil)
 
-		sp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1")
+		sp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1", "")
 
 		// We expect at this point, the execution context has been canceled too.
 		require.Error(t, loopClient.Context().Err())
@@ -91,7 +91,7 @@ func TestSchedulerProcessor_processQueriesOnSingleStream(t *testing.T) {
 		}).Return(&httpgrpc.HTTPResponse{}, nil)
 
 		startTime := time.Now()
-		sp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1")
+		sp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1", "")
 		assert.GreaterOrEqual(t, time.Since(startTime), time.Second)
 
 		// We expect at this point, the execution context has been canceled too.
@@ -146,7 +146,7 @@ func TestSchedulerProcessor_processQueriesOnSingleStream(t *testing.T) {
 
 		// processQueriesOnSingleStream() blocks and retries until its context is cancelled, so run it in the background.
 		go func() {
-			sp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1")
+			sp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1", "")
 		}()
 
 		require.Eventually(t, func() bool {
@@ -175,7 +175,7 @@ func TestSchedulerProcessor_processQueriesOnSingleStream(t *testing.T) {
 
 		requestHandler.On("Handle", mock.Anything, mock.Anything).Return(&httpgrpc.HTTPResponse{}, nil)
 
-		sp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1")
+		sp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1", "")
 
 		// We expect no error in the log.
 		assert.NotContains(t, logs.String(), "error")
@@ -222,7 +222,7 @@ func TestSchedulerProcessor_QueryTime(t *testing.T) {
 			}
 		}).Return(&httpgrpc.HTTPResponse{}, nil)
 
-		fp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1")
+		fp.processQueriesOnSingleStream(workerCtx, nil, "127.0.0.1", "")
 
 		// We expect Send() to be called twice: first to send the querier ID to scheduler
 		// and then to send the query result.
@@ -22,17 +22,19 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"google.golang.org/grpc"
 
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
 	"github.com/grafana/mimir/pkg/scheduler/schedulerdiscovery"
 	"github.com/grafana/mimir/pkg/util/servicediscovery"
 )
 
 type Config struct {
-	FrontendAddress                string            `yaml:"frontend_address"`
-	SchedulerAddress               string            `yaml:"scheduler_address"`
-	DNSLookupPeriod                time.Duration     `yaml:"dns_lookup_duration" category:"advanced"`
-	QuerierID                      string            `yaml:"id" category:"advanced"`
-	QueryFrontendGRPCClientConfig  grpcclient.Config `yaml:"grpc_client_config" doc:"description=Configures the gRPC client used to communicate between the querier and the query-frontend."`
-	QuerySchedulerGRPCClientConfig grpcclient.Config `yaml:"query_scheduler_grpc_client_config" doc:"description=Configures the gRPC client used to communicate between the querier and the query-scheduler."`
+	FrontendAddress                 string            `yaml:"frontend_address"`
+	SchedulerAddress                string            `yaml:"scheduler_address"`
+	DNSLookupPeriod                 time.Duration     `yaml:"dns_lookup_duration" category:"advanced"`
+	QuerierID                       string            `yaml:"id" category:"advanced"`
+	ReservedIngesterWorkersFraction float64           `yaml:"reserved_ingester_workers_fraction" category:"experimental"`
+	QueryFrontendGRPCClientConfig   grpcclient.Config `yaml:"grpc_client_config" doc:"description=Configures the gRPC client used to communicate between the querier and the query-frontend."`
+	QuerySchedulerGRPCClientConfig  grpcclient.Config `yaml:"query_scheduler_grpc_client_config" doc:"description=Configures the gRPC client used to communicate between the querier and the query-scheduler."`
 
 	// This configuration is injected internally.
 	MaxConcurrentRequests   int                       `yaml:"-"` // Must be same as passed to PromQL Engine.
@@ -44,6 +46,7 @@ func (cfg *Config) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cfg.FrontendAddress, "querier.frontend-address", "", "Address of the query-frontend component, in host:port format. If multiple query-frontends are running, the host should be a DNS resolving to all query-frontend instances. This option should be set only when query-scheduler component is not in use.")
 	f.DurationVar(&cfg.DNSLookupPeriod, "querier.dns-lookup-period", 10*time.Second, "How often to query DNS for query-frontend or query-scheduler address.")
 	f.StringVar(&cfg.QuerierID, "querier.id", "", "Querier ID, sent to the query-frontend to identify requests from the same querier. Defaults to hostname.")
+	f.Float64Var(&cfg.ReservedIngesterWorkersFraction, "querier.reserved-ingester-workers-fraction", 0, "Fraction of the querier workers connected to each query-frontend or query-scheduler which are reserved for the queries expected to be served by the ingesters alone, rounded down, so that slow queries served by the store-gateways cannot take all of the workers. The query-frontend estimates the component serving each query from its time range and -querier.query-ingesters-within. 0 to disable.")
 
 	cfg.QueryFrontendGRPCClientConfig.RegisterFlagsWithPrefix("querier.frontend-client", f)
 	cfg.QuerySchedulerGRPCClientConfig.RegisterFlagsWithPrefix("querier.scheduler-client", f)
@@ -53,6 +56,9 @@ func (cfg *Config) Validate() error {
 	if cfg.FrontendAddress != "" && cfg.SchedulerAddress != "" {
 		return errors.New("frontend address and scheduler address are mutually exclusive, please use only one")
 	}
+	if cfg.ReservedIngesterWorkersFraction < 0 || cfg.ReservedIngesterWorkersFraction >= 1 {
+		return errors.New("the fraction of reserved ingester workers must be at least 0 and less than 1")
+	}
 	if cfg.QuerySchedulerDiscovery.Mode == schedulerdiscovery.ModeRing && (cfg.FrontendAddress != "" || cfg.SchedulerAddress != "") {
 		return fmt.Errorf("frontend address and scheduler address cannot be specified when query-scheduler service discovery mode is set to '%s'", cfg.QuerySchedulerDiscovery.Mode)
 	}
@@ -86,7 +92,9 @@ type processor interface {
 	// This method must react on context being finished, and stop when that happens.
 	//
 	// processorManager (not processor) is responsible for starting as many goroutines as needed for each connection.
-	processQueriesOnSingleStream(ctx context.Context, conn *grpc.ClientConn, address string)
+	//
+	// A non-empty queryComponent reserves the goroutine for the queries expected to be served by that component.
+	processQueriesOnSingleStream(ctx context.Context, conn *grpc.ClientConn, address string, queryComponent querycomponent.Component)
 
 	// notifyShutdown notifies the remote query-frontend or query-scheduler that the querier is
 	// shutting down.
@@ -99,9 +107,10 @@ type serviceDiscoveryFactory func(receiver servicediscovery.Notifications) (serv
 type querierWorker struct {
 	*services.BasicService
 
-	maxConcurrentRequests int
-	grpcClientConfig      grpcclient.Config
-	log                   log.Logger
+	maxConcurrentRequests           int
+	reservedIngesterWorkersFraction float64
+	grpcClientConfig                grpcclient.Config
+	log                             log.Logger
 
 	processor processor
 
@@ -153,17 +162,18 @@ func NewQuerierWorker(cfg Config, handler RequestHandler, log log.Logger, reg pr
 		return nil, errors.New("no query-scheduler or query-frontend address")
 	}
 
-	return newQuerierWorkerWithProcessor(grpcCfg, cfg.MaxConcurrentRequests, log, processor, factory, servs)
+	return newQuerierWorkerWithProcessor(grpcCfg, cfg.MaxConcurrentRequests, cfg.ReservedIngesterWorkersFraction, log, processor, factory, servs)
 }
 
-func newQuerierWorkerWithProcessor(grpcCfg grpcclient.Config, maxConcReq int, log log.Logger, processor processor, newServiceDiscovery serviceDiscoveryFactory, servs []services.Service) (*querierWorker, error) {
+func newQuerierWorkerWithProcessor(grpcCfg grpcclient.Config, maxConcReq int, reservedIngesterWorkersFraction float64, log log.Logger, processor processor, newServiceDiscovery serviceDiscoveryFactory, servs []services.Service) (*querierWorker, error) {
 	f := &querierWorker{
-		grpcClientConfig:      grpcCfg,
-		maxConcurrentRequests: maxConcReq,
-		log:                   log,
-		managers:              map[string]*processorManager{},
-		instances:             map[string]servicediscovery.Instance{},
-		processor:             processor,
+		grpcClientConfig:                grpcCfg,
+		maxConcurrentRequests:           maxConcReq,
+		reservedIngesterWorkersFraction: reservedIngesterWorkersFraction,
+		log:                             log,
+		managers:                        map[string]*processorManager{},
+		instances:                       map[string]servicediscovery.Instance{},
+		processor:                       processor,
 	}
 
 	// There's no service discovery in some tests.
@@ -251,7 +261,7 @@ func (w *querierWorker) InstanceAdded(instance servicediscovery.Instance) {
 		return
 	}
 
-	w.managers[address] = newProcessorManager(ctx, w.processor, conn, address)
+	w.managers[address] = newProcessorManager(ctx, w.processor, conn, address, w.reservedIngesterWorkersFraction)
 	w.instances[address] = instance
 
 	// Called with lock.
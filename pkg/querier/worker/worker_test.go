@@ -8,6 +8,7 @@ package worker
 import (
 	"context"
 	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,6 +20,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
 
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
 	"github.com/grafana/mimir/pkg/scheduler/schedulerdiscovery"
 	"github.com/grafana/mimir/pkg/util/servicediscovery"
 )
@@ -67,6 +69,17 @@ func TestConfig_Validate(t *testing.T) {
 			},
 			expectedErr: `frontend address and scheduler address cannot be specified when query-scheduler service discovery mode is set to 'ring'`,
 		},
+		"should pass if a fraction of the workers is reserved for ingester queries": {
+			setup: func(cfg *Config) {
+				cfg.ReservedIngesterWorkersFraction = 0.25
+			},
+		},
+		"should fail if all of the workers are reserved for ingester queries": {
+			setup: func(cfg *Config) {
+				cfg.ReservedIngesterWorkersFraction = 1
+			},
+			expectedErr: "the fraction of reserved ingester workers must be at least 0 and less than 1",
+		},
 	}
 
 	for testName, testData := range tests {
@@ -174,7 +187,7 @@ func TestResetConcurrency(t *testing.T) {
 				MaxConcurrentRequests: tt.maxConcurrent,
 			}
 
-			w, err := newQuerierWorkerWithProcessor(cfg.QuerySchedulerGRPCClientConfig, cfg.MaxConcurrentRequests, log.NewNopLogger(), &mockProcessor{}, nil, nil)
+			w, err := newQuerierWorkerWithProcessor(cfg.QuerySchedulerGRPCClientConfig, cfg.MaxConcurrentRequests, 0, log.NewNopLogger(), &mockProcessor{}, nil, nil)
 			require.NoError(t, err)
 			require.NoError(t, services.StartAndAwaitRunning(context.Background(), w))
 
@@ -261,7 +274,7 @@ func TestQuerierWorker_getDesiredConcurrency(t *testing.T) {
 				MaxConcurrentRequests: testData.maxConcurrent,
 			}
 
-			w, err := newQuerierWorkerWithProcessor(cfg.QueryFrontendGRPCClientConfig, cfg.MaxConcurrentRequests, log.NewNopLogger(), &mockProcessor{}, nil, nil)
+			w, err := newQuerierWorkerWithProcessor(cfg.QueryFrontendGRPCClientConfig, cfg.MaxConcurrentRequests, 0, log.NewNopLogger(), &mockProcessor{}, nil, nil)
 			require.NoError(t, err)
 
 			for _, instance := range testData.instances {
@@ -285,9 +298,61 @@ func getConcurrentProcessors(w *querierWorker) int {
 	return result
 }
 
+func TestProcessorManager_ShouldReserveWorkersForIngesterQueries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p := &componentRecordingProcessor{running: map[querycomponent.Component]int{}}
+	pm := newProcessorManager(ctx, p, nil, "test", 0.25)
+
+	for _, tc := range []struct {
+		concurrency, expectedReserved int
+	}{
+		{concurrency: 8, expectedReserved: 2},
+		{concurrency: 3, expectedReserved: 0},
+		{concurrency: 4, expectedReserved: 1},
+	} {
+		pm.concurrency(tc.concurrency)
+		test.Poll(t, time.Second, map[querycomponent.Component]int{"": tc.concurrency - tc.expectedReserved, querycomponent.Ingester: tc.expectedReserved}, func() interface{} {
+			return p.runningProcessors()
+		})
+	}
+}
+
+// componentRecordingProcessor counts the running processors by the query component they are reserved for.
+type componentRecordingProcessor struct {
+	mtx     sync.Mutex
+	running map[querycomponent.Component]int
+}
+
+func (p *componentRecordingProcessor) processQueriesOnSingleStream(ctx context.Context, _ *grpc.ClientConn, _ string, queryComponent querycomponent.Component) {
+	p.mtx.Lock()
+	p.running[queryComponent]++
+	p.mtx.Unlock()
+
+	<-ctx.Done()
+
+	p.mtx.Lock()
+	p.running[queryComponent]--
+	p.mtx.Unlock()
+}
+
+func (p *componentRecordingProcessor) notifyShutdown(context.Context, *grpc.ClientConn, string) {}
+
+func (p *componentRecordingProcessor) runningProcessors() map[querycomponent.Component]int {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+
+	running := map[querycomponent.Component]int{}
+	for c, n := range p.running {
+		running[c] = n
+	}
+	return running
+}
+
 type mockProcessor struct{}
 
-func (m mockProcessor) processQueriesOnSingleStream(ctx context.Context, _ *grpc.ClientConn, _ string) {
+func (m mockProcessor) processQueriesOnSingleStream(ctx context.Context, _ *grpc.ClientConn, _ string, _ querycomponent.Component) {
 	<-ctx.Done()
 }
 
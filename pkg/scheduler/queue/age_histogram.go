@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"sort"
+	"time"
+)
+
+// defaultAgeHistogramBuckets are the upper bounds of the buckets of tenant age histograms, unless configured otherwise:
+// under 1s, 1s to 5s, 5s to 30s, and 30s or more.
+var defaultAgeHistogramBuckets = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+
+// tenantAgeHistogram returns the number of the tenant's queued requests in each age bucket as of now,
+// the age of a request being the time since it was enqueued to the back of the tenant queue.
+// There is a bucket below each of the broker's ascending ageHistogramBuckets bounds, and a last bucket for the rest;
+// a request exactly as old as a bound falls in the bucket above it. Requests buffered for a frozen tenant are not counted.
+func (qb *queueBroker) tenantAgeHistogram(tenantID TenantID, now time.Time) []int {
+	bounds := qb.ageHistogramBuckets
+	if len(bounds) == 0 {
+		bounds = defaultAgeHistogramBuckets
+	}
+	counts := make([]int, len(bounds)+1)
+	qb.visitTenantRequests(tenantID, func(request *tenantRequest) bool {
+		age := now.Sub(request.enqueueTime)
+		counts[sort.Search(len(bounds), func(i int) bool { return age < bounds[i] })]++
+		return true
+	})
+	return counts
+}
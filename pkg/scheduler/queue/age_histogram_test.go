@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_TenantAgeHistogram(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+
+	enqueue := func(tenantID TenantID, n int) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: i}, 0))
+		}
+	}
+	enqueue("tenant-1", 2)
+	clk.Advance(25 * time.Second)
+	enqueue("tenant-1", 1)
+	clk.Advance(4 * time.Second)
+	enqueue("tenant-1", 3)
+	clk.Advance(time.Second)
+	enqueue("tenant-1", 1)
+	enqueue("tenant-2", 1)
+	clk.Advance(500 * time.Millisecond)
+	enqueue("tenant-1", 4)
+
+	// ages: 2 at 30.5s, 1 at 5.5s, 3 at 1.5s, 1 at 0.5s and 4 at 0s
+	assert.Equal(t, []int{5, 3, 1, 2}, qb.tenantAgeHistogram("tenant-1", clk.Now()))
+	assert.Equal(t, []int{1, 0, 0, 0}, qb.tenantAgeHistogram("tenant-2", clk.Now()))
+	assert.Equal(t, []int{0, 0, 0, 0}, qb.tenantAgeHistogram("tenant-unknown", clk.Now()))
+
+	// a request exactly as old as a bucket bound falls in the bucket above it
+	assert.Equal(t, []int{0, 1, 0, 0}, qb.tenantAgeHistogram("tenant-2", clk.Now().Add(500*time.Millisecond)))
+
+	qb.ageHistogramBuckets = []time.Duration{time.Second, time.Minute}
+	assert.Equal(t, []int{5, 6, 0}, qb.tenantAgeHistogram("tenant-1", clk.Now()))
+	// the histogram is a read-only view
+	assert.Len(t, queuedRequests(qb, "tenant-1"), 11)
+}
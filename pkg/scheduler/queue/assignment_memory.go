@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// Approximate sizes of the assignment map contents on a 64-bit platform, including
+// the amortized per-entry overhead of the map buckets; exact sizes depend on the map load factor.
+const (
+	// tenantQuerierIDs entry: TenantID string header plus the pointer to the querier ID set,
+	// and the header of the querier ID set itself.
+	assignmentShardedTenantBytes = 88
+	// querier ID set entry: QuerierID string header; the string data is shared with the sorted querier IDs.
+	assignmentQuerierEntryBytes = 24
+)
+
+// assignmentMemoryEstimate estimates the bytes held by the tenant querier assignment maps.
+// The estimate is not exact, but grows linearly with the number of sharded tenants and their shard sizes;
+// unsharded tenants do not hold an entry in the maps.
+func (tqa *tenantQuerierAssignments) assignmentMemoryEstimate() int64 {
+	return assignmentMemoryEstimate(tqa.shardedTenantCount, tqa.shardedQuerierEntries)
+}
+
+func assignmentMemoryEstimate(shardedTenants, querierEntries int) int64 {
+	return int64(shardedTenants)*assignmentShardedTenantBytes + int64(querierEntries)*assignmentQuerierEntryBytes
+}
+
+// exceedsAssignmentMemoryLimit returns true if assigning a querier ID set of the given size to the tenant
+// would take the assignment memory estimate above the configured limit.
+func (tqa *tenantQuerierAssignments) exceedsAssignmentMemoryLimit(tenantID TenantID, shardSize int) bool {
+	if tqa.maxAssignmentMemoryBytes <= 0 {
+		return false
+	}
+
+	shardedTenants, querierEntries := tqa.shardedTenantCount, tqa.shardedQuerierEntries
+	if current := tqa.tenantQuerierIDs[tenantID]; current != nil {
+		// the tenant's current querier ID set is replaced
+		shardedTenants--
+		querierEntries -= len(current)
+	}
+	shardedTenants++
+	querierEntries += shardSize
+
+	return assignmentMemoryEstimate(shardedTenants, querierEntries) > tqa.maxAssignmentMemoryBytes
+}
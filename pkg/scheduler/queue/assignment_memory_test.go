@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_AssignmentMemoryEstimate(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	for i := 0; i < 10; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	tqa := &qb.tenantQuerierAssignments
+	assert.Zero(t, tqa.assignmentMemoryEstimate())
+
+	// unsharded tenants do not hold assignments
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "unsharded", req: "request"}, 0))
+	assert.Zero(t, tqa.assignmentMemoryEstimate())
+
+	var previous int64
+	for i := 0; i < 5; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("sharded-%d", i)), req: "request"}, 3))
+		estimate := tqa.assignmentMemoryEstimate()
+		assert.Equal(t, previous+assignmentMemoryEstimate(1, 3), estimate)
+		previous = estimate
+	}
+
+	// larger shards hold more memory
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "sharded-0", req: "request"}, 6))
+	assert.Equal(t, previous+3*assignmentQuerierEntryBytes, tqa.assignmentMemoryEstimate())
+
+	// removing tenants releases memory
+	for i := 0; i < 5; i++ {
+		tqa.removeTenant(TenantID(fmt.Sprintf("sharded-%d", i)))
+	}
+	assert.Zero(t, tqa.assignmentMemoryEstimate())
+}
+
+func TestQueues_AssignmentMemoryLimit(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	for i := 0; i < 10; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	tqa := &qb.tenantQuerierAssignments
+	// enough memory for 3 tenants sharded across 3 queriers each
+	tqa.maxAssignmentMemoryBytes = assignmentMemoryEstimate(3, 9)
+
+	for i := 0; i < 6; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", i)), req: "request"}, 3))
+	}
+	assert.NoError(t, isConsistent(qb))
+	assert.LessOrEqual(t, tqa.assignmentMemoryEstimate(), tqa.maxAssignmentMemoryBytes)
+	assert.Equal(t, 3, tqa.shardedTenantCount, "tenants beyond the limit are left unsharded")
+	for i := 3; i < 6; i++ {
+		assert.Nil(t, tqa.tenantQuerierIDs[TenantID(fmt.Sprintf("tenant-%d", i))])
+	}
+
+	// a reshuffle keeps the assignment maps within the limit
+	qb.addQuerierConnection("querier-10")
+	assert.NoError(t, isConsistent(qb))
+	assert.LessOrEqual(t, tqa.assignmentMemoryEstimate(), tqa.maxAssignmentMemoryBytes)
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "sort"
+
+// shardingQuerierIDs returns the sorted querier IDs tenants are shuffle sharded across:
+// the authoritative fleet-wide querier set if one is configured, or the locally connected queriers otherwise.
+func (tqa *tenantQuerierAssignments) shardingQuerierIDs() querierIDSlice {
+	if tqa.authoritativeQuerierIDs != nil {
+		return tqa.authoritativeQuerierIDs
+	}
+	return tqa.querierIDsSorted
+}
+
+// setAuthoritativeQueriers overrides the connection-derived querier membership used for shuffle sharding
+// with an externally-supplied fleet-wide querier set, and reshuffles all tenants.
+//
+// A querier may hold connections to several frontends, each of which only sees its own connections;
+// sharding across the authoritative set makes every frontend compute the same shards for the true fleet.
+// Queriers must still be connected locally to receive requests.
+// Passing nil restores sharding across the locally connected queriers.
+func (tqa *tenantQuerierAssignments) setAuthoritativeQueriers(querierIDs []QuerierID) {
+	if querierIDs == nil {
+		tqa.authoritativeQuerierIDs = nil
+		tqa.recomputeTenantQueriers()
+		return
+	}
+
+	uniqueQuerierIDs := make(map[QuerierID]struct{}, len(querierIDs))
+	sorted := make(querierIDSlice, 0, len(querierIDs))
+	for _, querierID := range querierIDs {
+		if _, ok := uniqueQuerierIDs[querierID]; !ok {
+			uniqueQuerierIDs[querierID] = struct{}{}
+			sorted = append(sorted, querierID)
+		}
+	}
+	sort.Sort(sorted)
+
+	tqa.authoritativeQuerierIDs = sorted
+	tqa.recomputeTenantQueriers()
+}
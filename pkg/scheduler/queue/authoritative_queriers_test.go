@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_AuthoritativeQueriers(t *testing.T) {
+	const maxQueriers = 3
+
+	var fleet []QuerierID
+	for i := 0; i < 10; i++ {
+		fleet = append(fleet, QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+
+	// reference broker with direct connections from the whole fleet
+	reference := newQueueBroker(100, 0)
+	for _, querierID := range fleet {
+		reference.addQuerierConnection(querierID)
+	}
+	getOrAdd(t, reference, "tenant-1", maxQueriers)
+	expectedShard := reference.tenantQuerierAssignments.tenantQuerierIDs["tenant-1"]
+	require.Len(t, expectedShard, maxQueriers)
+
+	// broker with direct connections from only a few queriers
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	for _, querierID := range fleet[:4] {
+		qb.addQuerierConnection(querierID)
+	}
+	getOrAdd(t, qb, "tenant-1", maxQueriers)
+	localShard := tqa.tenantQuerierIDs["tenant-1"]
+	for querierID := range localShard {
+		assert.Contains(t, fleet[:4], querierID, "local shard only includes locally connected queriers")
+	}
+
+	// sharding across the authoritative set matches the broker which sees the whole fleet
+	tqa.setAuthoritativeQueriers(append([]QuerierID{fleet[0]}, fleet...))
+	assert.Equal(t, expectedShard, tqa.tenantQuerierIDs["tenant-1"])
+	assert.Len(t, tqa.querierIDsSorted, 4, "local connections are unchanged")
+	assert.NoError(t, isConsistent(qb))
+
+	// local connection changes do not affect the authoritative sharding
+	qb.addQuerierConnection(fleet[5])
+	assert.Equal(t, expectedShard, tqa.tenantQuerierIDs["tenant-1"])
+
+	// clearing the authoritative set restores sharding across local connections
+	tqa.setAuthoritativeQueriers(nil)
+	for querierID := range tqa.tenantQuerierIDs["tenant-1"] {
+		assert.Contains(t, tqa.querierIDsSorted, querierID)
+	}
+	assert.NoError(t, isConsistent(qb))
+}
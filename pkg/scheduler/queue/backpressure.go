@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// Under backpressure, a downstream system which is overwhelmed sets the fraction of dispatches it wants held back,
+// for all tenants or for individual tenants. A tenant which could otherwise be dispatched to a querier is skipped
+// with a probability of its backpressure level, so that its requests are dispatched at the remaining fraction
+// of the rate they would otherwise be, down to not at all at level 1. Tenants skipped this way are left
+// for the next dequeue, and other tenants are served meanwhile.
+//
+// The skip is decided each time the tenant is found dispatchable, which may happen more than once per dequeue
+// when the broker sticks with tenants, slightly raising the effective rate of the tenant.
+
+// setBackpressure sets the backpressure level applying to all tenants, clamped between 0 and 1; 0 lifts it.
+func (qb *queueBroker) setBackpressure(level float64) {
+	qb.backpressureLevel = min(max(level, 0), 1)
+}
+
+// setTenantBackpressure sets the backpressure level of the tenant, clamped between 0 and 1; 0 lifts it.
+// The higher of the tenant's and the global backpressure levels applies to the tenant.
+func (qb *queueBroker) setTenantBackpressure(tenantID TenantID, level float64) {
+	level = min(max(level, 0), 1)
+	if level == 0 {
+		delete(qb.tenantBackpressure, tenantID)
+		return
+	}
+	if qb.tenantBackpressure == nil {
+		qb.tenantBackpressure = map[TenantID]float64{}
+	}
+	qb.tenantBackpressure[tenantID] = level
+}
+
+// tenantBackpressureLevel returns the backpressure level applying to the tenant.
+func (qb *queueBroker) tenantBackpressureLevel(tenantID TenantID) float64 {
+	return max(qb.backpressureLevel, qb.tenantBackpressure[tenantID])
+}
+
+// throttledByBackpressure returns true if the dispatch to the tenant is held back under backpressure.
+func (qb *queueBroker) throttledByBackpressure(tenantID TenantID) bool {
+	level := qb.tenantBackpressureLevel(tenantID)
+	if level <= 0 {
+		return false
+	}
+	return level >= 1 || qb.rng.Float64() < level
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_Backpressure_DispatchRate(t *testing.T) {
+	const attempts = 4000
+
+	for _, level := range []float64{0, 0.25, 0.5, 0.75, 1} {
+		t.Run(fmt.Sprintf("level %v", level), func(t *testing.T) {
+			qb := newQueueBroker(attempts, 0)
+			qb.rng = rand.New(rand.NewSource(1))
+			qb.setBackpressure(level)
+			qb.addQuerierConnection("querier-1")
+			for i := 0; i < attempts; i++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+			}
+
+			dispatched := 0
+			for i := 0; i < attempts; i++ {
+				request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+				require.NoError(t, err)
+				if request != nil {
+					dispatched++
+				}
+			}
+			assert.InDelta(t, (1-level)*attempts, dispatched, 0.05*attempts)
+		})
+	}
+}
+
+func TestQueues_Backpressure_PerTenant(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.rng = rand.New(rand.NewSource(1))
+	qb.addQuerierConnection("querier-1")
+
+	qb.setTenantBackpressure("tenant-paused", 1)
+	qb.setTenantBackpressure("tenant-light", 0.2)
+	qb.setBackpressure(0.5)
+	assert.Equal(t, 1.0, qb.tenantBackpressureLevel("tenant-paused"))
+	assert.Equal(t, 0.5, qb.tenantBackpressureLevel("tenant-light"))
+	assert.Equal(t, 0.5, qb.tenantBackpressureLevel("tenant-other"))
+
+	// a tenant at full backpressure is skipped while other tenants are served
+	qb.setBackpressure(0)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-paused", req: i}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-other", req: i}, 0))
+	}
+	for _, request := range dequeueN(t, qb, "querier-1", 10) {
+		assert.Equal(t, TenantID("tenant-other"), request.tenantID)
+	}
+	request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Nil(t, request)
+
+	// levels are clamped, and lifting the backpressure resumes dispatch
+	qb.setTenantBackpressure("tenant-paused", 2)
+	assert.Equal(t, 1.0, qb.tenantBackpressureLevel("tenant-paused"))
+	qb.setTenantBackpressure("tenant-paused", 0)
+	assert.NotContains(t, qb.tenantBackpressure, TenantID("tenant-paused"))
+	dequeueN(t, qb, "querier-1", 10)
+}
@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// dequeueBatchForQuerier dequeues up to maxRequests requests for the querier in a single poll, capped at the broker's
+// maxDequeueBatchSize. Each request is dequeued as dequeueRequestForQuerier would, with the tenant rotation advancing
+// between requests, so a batch is spread across tenants the same way successive polls would be.
+// Tenants which the batch has already taken maxBatchRequestsPerTenant requests from are skipped for the rest of it.
+//
+// Returns fewer requests than asked for if there are no more requests for the querier, or if the only tenants left
+// with requests for the querier are at the per-tenant cap, along with the index of the last tenant dequeued from
+// to pass to the querier's next poll.
+func (qb *queueBroker) dequeueBatchForQuerier(lastTenantIndex int, querierID QuerierID, maxRequests int) ([]*tenantRequest, int, error) {
+	if qb.maxDequeueBatchSize > 0 && maxRequests > qb.maxDequeueBatchSize {
+		maxRequests = qb.maxDequeueBatchSize
+	}
+	if qb.maxBatchRequestsPerTenant > 0 {
+		qb.batchTenantDequeues = map[TenantID]int{}
+		defer func() { qb.batchTenantDequeues = nil }()
+	}
+
+	var batch []*tenantRequest
+	for len(batch) < maxRequests {
+		request, _, tenantIndex, err := qb.dequeueRequestForQuerier(lastTenantIndex, querierID)
+		if err != nil {
+			return batch, lastTenantIndex, err
+		}
+		if request == nil {
+			break
+		}
+		lastTenantIndex = tenantIndex
+		batch = append(batch, request)
+		if qb.batchTenantDequeues != nil {
+			qb.batchTenantDequeues[request.tenantID]++
+		}
+	}
+	return batch, lastTenantIndex, nil
+}
+
+// tenantAtBatchCap returns true if the batch dequeue in progress has taken maxBatchRequestsPerTenant requests
+// from the tenant.
+func (qb *queueBroker) tenantAtBatchCap(tenantID TenantID) bool {
+	return qb.batchTenantDequeues != nil && qb.batchTenantDequeues[tenantID] >= qb.maxBatchRequestsPerTenant
+}
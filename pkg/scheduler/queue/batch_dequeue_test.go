@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_DequeueBatchForQuerier(t *testing.T) {
+	for testName, testData := range map[string]struct {
+		maxBatchSize int
+		maxRequests  int
+		expectedSize int
+		// size of the batch another querier gets when asking for all the remaining requests next
+		expectedNextSize int
+	}{
+		"unlimited by default": {
+			maxBatchSize:     0,
+			maxRequests:      1000,
+			expectedSize:     20,
+			expectedNextSize: 0,
+		},
+		"huge batch capped": {
+			maxBatchSize:     5,
+			maxRequests:      1000,
+			expectedSize:     5,
+			expectedNextSize: 5,
+		},
+		"batch smaller than the cap": {
+			maxBatchSize:     5,
+			maxRequests:      3,
+			expectedSize:     3,
+			expectedNextSize: 5,
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.maxDequeueBatchSize = testData.maxBatchSize
+			qb.addQuerierConnection("querier-1")
+			qb.addQuerierConnection("querier-2")
+			for i := 0; i < 10; i++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: i}, 0))
+			}
+
+			batch, _, err := qb.dequeueBatchForQuerier(-1, "querier-1", testData.maxRequests)
+			require.NoError(t, err)
+			require.Len(t, batch, testData.expectedSize)
+			// the batch rotates through the tenants
+			for i, request := range batch {
+				assert.Equal(t, []TenantID{"tenant-1", "tenant-2"}[i%2], request.tenantID)
+			}
+
+			next, _, err := qb.dequeueBatchForQuerier(-1, "querier-2", 1000)
+			require.NoError(t, err)
+			assert.Len(t, next, testData.expectedNextSize)
+		})
+	}
+}
+
+func TestQueues_DequeueBatchForQuerier_ShuttingDown(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req"}, 0))
+	qb.notifyQuerierShutdown("querier-1")
+
+	batch, _, err := qb.dequeueBatchForQuerier(-1, "querier-1", 10)
+	assert.ErrorIs(t, err, ErrQuerierShuttingDown)
+	assert.Empty(t, batch)
+}
+
+func TestQueues_DequeueBatchForQuerier_PerTenantCap(t *testing.T) {
+	for testName, testData := range map[string]struct {
+		maxPerTenant     int
+		tenantStickiness int
+		expectedCounts   map[TenantID]int
+	}{
+		"no per-tenant cap by default": {
+			maxPerTenant:   0,
+			expectedCounts: map[TenantID]int{"deep": 10, "shallow-1": 2, "shallow-2": 2, "shallow-3": 2},
+		},
+		"deep tenant capped": {
+			maxPerTenant:   3,
+			expectedCounts: map[TenantID]int{"deep": 3, "shallow-1": 2, "shallow-2": 2, "shallow-3": 2},
+		},
+		"cap applies to all tenants": {
+			maxPerTenant:   1,
+			expectedCounts: map[TenantID]int{"deep": 1, "shallow-1": 1, "shallow-2": 1, "shallow-3": 1},
+		},
+		"cap overrides tenant stickiness": {
+			maxPerTenant:     2,
+			tenantStickiness: 10,
+			expectedCounts:   map[TenantID]int{"deep": 2, "shallow-1": 2, "shallow-2": 2, "shallow-3": 2},
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.maxBatchRequestsPerTenant = testData.maxPerTenant
+			qb.tenantStickiness = testData.tenantStickiness
+			qb.addQuerierConnection("querier-1")
+			for i := 0; i < 20; i++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "deep", req: i}, 0))
+			}
+			for _, tenantID := range []TenantID{"shallow-1", "shallow-2", "shallow-3"} {
+				for i := 0; i < 2; i++ {
+					require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: i}, 0))
+				}
+			}
+
+			batch, _, err := qb.dequeueBatchForQuerier(-1, "querier-1", 16)
+			require.NoError(t, err)
+			counts := map[TenantID]int{}
+			for _, request := range batch {
+				counts[request.tenantID]++
+			}
+			assert.Equal(t, testData.expectedCounts, counts)
+			assert.Nil(t, qb.batchTenantDequeues)
+
+			// the cap only applies within a batch
+			next, _, err := qb.dequeueBatchForQuerier(-1, "querier-1", 1)
+			require.NoError(t, err)
+			require.Len(t, next, 1)
+			assert.Equal(t, TenantID("deep"), next[0].tenantID)
+		})
+	}
+}
@@ -0,0 +1,242 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// BrokerConfig is the effective configuration of a broker, including changes applied at runtime.
+// Strategies and modes are reported by name.
+type BrokerConfig struct {
+	MaxTenantQueueSize             int           `json:"max_tenant_queue_size"`
+	ReservedQueueSlots             int           `json:"reserved_queue_slots"`
+	ReservedSlotsPriorityThreshold int           `json:"reserved_slots_priority_threshold"`
+	ForgetDelay                    time.Duration `json:"forget_delay"`
+	ShardingEnabled                bool          `json:"sharding_enabled"`
+	// number of queriers in the externally-supplied querier set; 0 if shards are computed from the connected queriers
+	AuthoritativeQueriers    int    `json:"authoritative_queriers"`
+	DeferTenantReshuffle     bool   `json:"defer_tenant_reshuffle"`
+	IdleQuerierFastPath      bool   `json:"idle_querier_fast_path"`
+	MaxAssignmentMemoryBytes int64  `json:"max_assignment_memory_bytes"`
+	MaxShardedTenants        int    `json:"max_sharded_tenants"`
+	MaxPriorityBands         int    `json:"max_priority_bands"`
+	TenantOrderCorruption    string `json:"tenant_order_corruption"`
+	QuerierIDValidation      string `json:"querier_id_validation"`
+
+	TenantSelection           string  `json:"tenant_selection"`
+	TierReservedFraction      float64 `json:"tier_reserved_fraction"`
+	TenantStickiness          int     `json:"tenant_stickiness"`
+	MaxDequeueBatchSize       int     `json:"max_dequeue_batch_size"`
+	MaxBatchRequestsPerTenant int     `json:"max_batch_requests_per_tenant"`
+	FairQueuingSlots          int     `json:"fair_queuing_slots"`
+	FairQueuingExactTenants   int     `json:"fair_queuing_exact_tenants"`
+
+	RejectExpiredRequests         bool          `json:"reject_expired_requests"`
+	EvictExpiredRequests          bool          `json:"evict_expired_requests"`
+	QueryComponentQueues          bool          `json:"query_component_queues"`
+	TrackInflight                 bool          `json:"track_inflight"`
+	RecoverCrashedQuerierInflight bool          `json:"recover_crashed_querier_inflight"`
+	InflightFullPolicy            string        `json:"inflight_full_policy"`
+	QuerierOverloadFactor         float64       `json:"querier_overload_factor"`
+	QuerierCostBudget             int64         `json:"querier_cost_budget"`
+	PriorityInversionAge          time.Duration `json:"priority_inversion_age"`
+	DefaultDispatchTimeout        time.Duration `json:"default_dispatch_timeout"`
+	RetryBoostInterval            time.Duration `json:"retry_boost_interval"`
+
+	TenantRemovalPolicy       string        `json:"tenant_removal_policy"`
+	TenantRemovalGracePeriod  time.Duration `json:"tenant_removal_grace_period"`
+	IdleShardCollapsePeriod   time.Duration `json:"idle_shard_collapse_period"`
+	ShardExpansionWindow      time.Duration `json:"shard_expansion_window"`
+	ShardExpansionStep        int           `json:"shard_expansion_step"`
+	ShardExpansionMaxQueriers int           `json:"shard_expansion_max_queriers"`
+	NewQuerierBacklogTenants  int           `json:"new_querier_backlog_tenants"`
+	OverflowBacklogThreshold  int           `json:"overflow_backlog_threshold"`
+
+	DedupMode               string `json:"dedup_mode"`
+	DedupReplaceMovesToBack bool   `json:"dedup_replace_moves_to_back"`
+	DedupMaxKeysPerTenant   int    `json:"dedup_max_keys_per_tenant"`
+
+	TenantHighWatermark            int `json:"tenant_high_watermark"`
+	TenantLowWatermark             int `json:"tenant_low_watermark"`
+	EnqueueBackpressureQueueLength int `json:"enqueue_backpressure_queue_length"`
+
+	MaxQueuedPayloadBytes int64  `json:"max_queued_payload_bytes"`
+	TrackTagDepths        bool   `json:"track_tag_depths"`
+	GlobalMemoryPolicy    string `json:"global_memory_policy"`
+	FrozenEnqueuePolicy   string `json:"frozen_enqueue_policy"`
+
+	RequestOrdering           string        `json:"request_ordering"`
+	StripeTenantRequests      bool          `json:"stripe_tenant_requests"`
+	CacheKeyAffinityMaxWait   time.Duration `json:"cache_key_affinity_max_wait"`
+	PriorityClassMaxWait      time.Duration `json:"priority_class_max_wait"`
+	PriorityBands             int           `json:"priority_bands"`
+	ShardRerandomizeThreshold int           `json:"shard_rerandomize_threshold"`
+
+	ReshuffleStormThreshold  int             `json:"reshuffle_storm_threshold"`
+	ReshuffleStormBusyPeriod time.Duration   `json:"reshuffle_storm_busy_period"`
+	ShardChurnRetention      time.Duration   `json:"shard_churn_retention"`
+	ConnectionDebounce       time.Duration   `json:"connection_debounce"`
+	AgeHistogramBuckets      []time.Duration `json:"age_histogram_buckets,omitempty"`
+	BackpressureLevel        float64         `json:"backpressure_level"`
+}
+
+// config returns the current effective configuration of the broker.
+func (qb *queueBroker) config() BrokerConfig {
+	tqa := &qb.tenantQuerierAssignments
+	maxPriorityBands := tqa.maxPriorityBands
+	if maxPriorityBands <= 0 {
+		maxPriorityBands = defaultMaxPriorityBands
+	}
+	fairQueuingSlots, fairQueuingExactTenants := qb.fairQueuingSlotCount(), qb.fairQueuingExactTenants
+	if fairQueuingExactTenants <= 0 {
+		fairQueuingExactTenants = defaultFairQueuingExactTenants
+	}
+	return BrokerConfig{
+		MaxTenantQueueSize:             qb.maxTenantQueueSize,
+		ReservedQueueSlots:             qb.reservedQueueSlots,
+		ReservedSlotsPriorityThreshold: qb.reservedSlotsPriorityThreshold,
+		ForgetDelay:                    tqa.querierForgetDelay,
+		ShardingEnabled:                !tqa.shardingDisabled,
+		AuthoritativeQueriers:          len(tqa.authoritativeQuerierIDs),
+		DeferTenantReshuffle:           tqa.deferTenantReshuffle,
+		IdleQuerierFastPath:            tqa.idleQuerierFastPath,
+		MaxAssignmentMemoryBytes:       tqa.maxAssignmentMemoryBytes,
+		MaxShardedTenants:              tqa.maxShardedTenants,
+		MaxPriorityBands:               maxPriorityBands,
+		TenantOrderCorruption:          tqa.tenantOrderCorruptionPolicy.name(),
+		QuerierIDValidation:            qb.querierIDValidationPolicy.name(),
+
+		TenantSelection:           qb.tenantSelection.name(),
+		TierReservedFraction:      qb.tierReservedFraction,
+		TenantStickiness:          qb.tenantStickiness,
+		MaxDequeueBatchSize:       qb.maxDequeueBatchSize,
+		MaxBatchRequestsPerTenant: qb.maxBatchRequestsPerTenant,
+		FairQueuingSlots:          fairQueuingSlots,
+		FairQueuingExactTenants:   fairQueuingExactTenants,
+
+		RejectExpiredRequests:         qb.rejectExpiredRequests,
+		EvictExpiredRequests:          qb.evictExpiredRequests,
+		QueryComponentQueues:          qb.queryComponentQueues,
+		TrackInflight:                 qb.trackInflight,
+		RecoverCrashedQuerierInflight: qb.recoverCrashedQuerierInflight,
+		InflightFullPolicy:            qb.inflightFullPolicy.name(),
+		QuerierOverloadFactor:         qb.querierOverloadFactor,
+		QuerierCostBudget:             qb.querierCostBudget,
+		PriorityInversionAge:          qb.priorityInversionAge,
+		DefaultDispatchTimeout:        qb.defaultDispatchTimeout,
+		RetryBoostInterval:            qb.retryBoostInterval,
+
+		TenantRemovalPolicy:       qb.tenantRemovalPolicy.name(),
+		TenantRemovalGracePeriod:  qb.tenantRemovalGracePeriod,
+		IdleShardCollapsePeriod:   qb.idleShardCollapsePeriod,
+		ShardExpansionWindow:      qb.shardExpansionWindow,
+		ShardExpansionStep:        qb.shardExpansionStep,
+		ShardExpansionMaxQueriers: qb.shardExpansionMaxQueriers,
+		NewQuerierBacklogTenants:  qb.newQuerierBacklogTenants,
+		OverflowBacklogThreshold:  qb.overflowBacklogThreshold,
+
+		DedupMode:               qb.dedupMode.name(),
+		DedupReplaceMovesToBack: qb.dedupReplaceMovesToBack,
+		DedupMaxKeysPerTenant:   qb.dedupMaxKeysPerTenant,
+
+		TenantHighWatermark:            qb.tenantHighWatermark,
+		TenantLowWatermark:             qb.tenantLowWatermark,
+		EnqueueBackpressureQueueLength: qb.enqueueBackpressureQueueLength,
+
+		MaxQueuedPayloadBytes: qb.maxQueuedPayloadBytes,
+		TrackTagDepths:        qb.trackTagDepths,
+		GlobalMemoryPolicy:    qb.globalMemoryPolicy.name(),
+		FrozenEnqueuePolicy:   qb.frozenEnqueuePolicy.name(),
+
+		RequestOrdering:           string(qb.tenantRequestOrdering(&queueTenant{})),
+		StripeTenantRequests:      qb.stripeTenantRequests,
+		CacheKeyAffinityMaxWait:   qb.cacheKeyAffinityMaxWait,
+		PriorityClassMaxWait:      qb.priorityClassMaxWait,
+		PriorityBands:             qb.priorityBands,
+		ShardRerandomizeThreshold: qb.shardRerandomizeThreshold,
+
+		ReshuffleStormThreshold:  qb.reshuffleStormThreshold,
+		ReshuffleStormBusyPeriod: qb.reshuffleStormBusyPeriod,
+		ShardChurnRetention:      tqa.shardChurnRetention,
+		ConnectionDebounce:       qb.connectionDebounce,
+		AgeHistogramBuckets:      qb.ageHistogramBuckets,
+		BackpressureLevel:        qb.backpressureLevel,
+	}
+}
+
+// setForgetDelay changes how long a querier which disconnected without notifying a graceful shutdown is retained.
+// A positive delay also applies to the queriers which are already disconnected.
+func (qb *queueBroker) setForgetDelay(forgetDelay time.Duration) {
+	qb.tenantQuerierAssignments.querierForgetDelay = forgetDelay
+}
+
+func (s tenantSelectionStrategy) name() string {
+	switch s {
+	case tenantSelectionRoundRobin:
+		return "round-robin"
+	case tenantSelectionWeightedRandom:
+		return "weighted-random"
+	case tenantSelectionTiered:
+		return "tiered"
+	case tenantSelectionFairQueuing:
+		return "fair-queuing"
+	default:
+		return "unknown"
+	}
+}
+
+func (p inflightFullPolicy) name() string {
+	switch p {
+	case inflightFullQueue:
+		return "queue"
+	case inflightFullReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+func (p tenantRemovalPolicy) name() string {
+	switch p {
+	case tenantRemovalEager:
+		return "eager"
+	case tenantRemovalLazy:
+		return "lazy"
+	default:
+		return "unknown"
+	}
+}
+
+func (p frozenEnqueuePolicy) name() string {
+	switch p {
+	case frozenEnqueueBuffer:
+		return "buffer"
+	case frozenEnqueueReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+func (p globalMemoryPolicy) name() string {
+	switch p {
+	case globalMemoryRejectIncoming:
+		return "reject-incoming"
+	case globalEvictLowestPriority:
+		return "evict-lowest-priority"
+	default:
+		return "unknown"
+	}
+}
+
+func (m dedupMode) name() string {
+	switch m {
+	case dedupDisabled:
+		return "disabled"
+	case dedupReplaceWithLatest:
+		return "replace-with-latest"
+	case dedupCoalesce:
+		return "coalesce"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueues_Config(t *testing.T) {
+	qb := newQueueBroker(100, time.Minute)
+
+	assert.Equal(t, BrokerConfig{
+		MaxTenantQueueSize:      100,
+		ForgetDelay:             time.Minute,
+		ShardingEnabled:         true,
+		MaxPriorityBands:        defaultMaxPriorityBands,
+		TenantOrderCorruption:   "strict",
+		QuerierIDValidation:     "strict",
+		TenantSelection:         "round-robin",
+		FairQueuingSlots:        defaultFairQueuingSlots,
+		FairQueuingExactTenants: defaultFairQueuingExactTenants,
+		InflightFullPolicy:      "queue",
+		TenantRemovalPolicy:     "eager",
+		DedupMode:               "disabled",
+		GlobalMemoryPolicy:      "reject-incoming",
+		FrozenEnqueuePolicy:     "buffer",
+		RequestOrdering:         "priority",
+	}, qb.config())
+
+	// runtime changes are reflected
+	qb.setForgetDelay(time.Hour)
+	qb.setShardingEnabled(false)
+	qb.tenantQuerierAssignments.setAuthoritativeQueriers([]QuerierID{"querier-1", "querier-2"})
+	assert.NoError(t, qb.setPriorityBands(3))
+	qb.tenantSelection = tenantSelectionTiered
+	qb.dedupMode = dedupReplaceWithLatest
+	qb.tenantRemovalPolicy = tenantRemovalLazy
+	qb.tenantRemovalGracePeriod = time.Second
+	qb.inflightFullPolicy = inflightFullReject
+	qb.requestOrdering = RequestOrderingFIFO
+
+	cfg := qb.config()
+	assert.Equal(t, time.Hour, cfg.ForgetDelay)
+	assert.False(t, cfg.ShardingEnabled)
+	assert.Equal(t, 2, cfg.AuthoritativeQueriers)
+	assert.Equal(t, 3, cfg.PriorityBands)
+	assert.Equal(t, "tiered", cfg.TenantSelection)
+	assert.Equal(t, "replace-with-latest", cfg.DedupMode)
+	assert.Equal(t, "lazy", cfg.TenantRemovalPolicy)
+	assert.Equal(t, time.Second, cfg.TenantRemovalGracePeriod)
+	assert.Equal(t, "reject", cfg.InflightFullPolicy)
+	assert.Equal(t, "fifo", cfg.RequestOrdering)
+}
+
+func TestQueues_SetForgetDelay(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, time.Hour)
+	qb.clock = clk
+	qb.addQuerierConnection("querier-1")
+	qb.removeQuerierConnection("querier-1", clk.Now())
+
+	clk.Advance(time.Minute)
+	assert.Zero(t, qb.forgetDisconnectedQueriers(clk.Now()))
+
+	// the shorter delay applies to the querier which is already disconnected
+	qb.setForgetDelay(time.Second)
+	assert.Equal(t, 1, qb.forgetDisconnectedQueriers(clk.Now()))
+	assert.Empty(t, qb.tenantQuerierAssignments.queriersByID)
+}
@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// brokerEventBufferSize is the number of events buffered for each subscriber of the broker events;
+// events published while a subscriber's buffer is full are dropped for it.
+const brokerEventBufferSize = 256
+
+// BrokerEventType is the kind of a state change of the broker.
+type BrokerEventType string
+
+const (
+	// BrokerEventTenantAdded: a tenant queue was created.
+	BrokerEventTenantAdded BrokerEventType = "tenant_added"
+	// BrokerEventTenantRemoved: a tenant queue was removed.
+	BrokerEventTenantRemoved BrokerEventType = "tenant_removed"
+	// BrokerEventQuerierConnected: a querier without connections connected.
+	BrokerEventQuerierConnected BrokerEventType = "querier_connected"
+	// BrokerEventQuerierDisconnected: the last connection of a querier was disconnected.
+	BrokerEventQuerierDisconnected BrokerEventType = "querier_disconnected"
+	// BrokerEventTenantReshuffled: the querier set of a tenant changed.
+	BrokerEventTenantReshuffled BrokerEventType = "tenant_reshuffled"
+	// BrokerEventQueueFull: an enqueue was rejected as the tenant queue is full.
+	BrokerEventQueueFull BrokerEventType = "queue_full"
+)
+
+// BrokerEvent is a significant state change of the broker, streamed to the subscribers of the broker events.
+type BrokerEvent struct {
+	Type      BrokerEventType `json:"type"`
+	Time      time.Time       `json:"time"`
+	TenantID  TenantID        `json:"tenant_id,omitempty"`
+	QuerierID QuerierID       `json:"querier_id,omitempty"`
+	// number of events dropped for the subscriber since the previous event delivered to it
+	Dropped uint64 `json:"dropped,omitempty"`
+}
+
+// brokerEventStream holds the subscribers of the broker events. Unlike the rest of the broker, it is safe
+// for concurrent use, so that consumers can unsubscribe from their own goroutine.
+type brokerEventStream struct {
+	mtx         sync.Mutex
+	subscribers map[*brokerEventSubscriber]struct{}
+	// total number of events dropped for slow subscribers
+	dropped uint64
+}
+
+type brokerEventSubscriber struct {
+	events  chan BrokerEvent
+	dropped uint64
+}
+
+// subscribe streams the broker events to the returned channel until the returned function is called,
+// which closes the channel. Events are buffered for slow consumers up to brokerEventBufferSize, beyond which
+// they are dropped rather than blocking the broker, and counted in the next event delivered.
+func (qb *queueBroker) subscribe() (<-chan BrokerEvent, func()) {
+	s := qb.observer.events()
+	sub := &brokerEventSubscriber{events: make(chan BrokerEvent, brokerEventBufferSize)}
+	s.mtx.Lock()
+	if s.subscribers == nil {
+		s.subscribers = map[*brokerEventSubscriber]struct{}{}
+	}
+	s.subscribers[sub] = struct{}{}
+	s.mtx.Unlock()
+
+	var once sync.Once
+	return sub.events, func() {
+		once.Do(func() {
+			s.mtx.Lock()
+			defer s.mtx.Unlock()
+			delete(s.subscribers, sub)
+			close(sub.events)
+		})
+	}
+}
+
+// droppedBrokerEvents returns the total number of broker events dropped for slow subscribers.
+func (qb *queueBroker) droppedBrokerEvents() uint64 {
+	s := qb.observer.events()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.dropped
+}
+
+// publish sends the event, as of the broker clock, to the subscribers of the broker events.
+func (qb *queueBroker) publish(event BrokerEvent) {
+	if qb.observer.subscribed() {
+		event.Time = qb.clock.Now()
+		qb.observer.publish(event)
+	}
+}
+
+// publish sends the event, as of the broker clock, to the subscribers of the broker events.
+func (tqa *tenantQuerierAssignments) publish(event BrokerEvent) {
+	if tqa.observer.subscribed() {
+		event.Time = tqa.now()
+		tqa.observer.publish(event)
+	}
+}
+
+// events returns the broker event stream of the observer, creating it if needed.
+func (o *brokerObserver) events() *brokerEventStream {
+	if o.eventStream == nil {
+		o.eventStream = &brokerEventStream{}
+	}
+	return o.eventStream
+}
+
+// subscribed returns true if any consumer may be subscribed to the broker events.
+func (o *brokerObserver) subscribed() bool {
+	return o != nil && o.eventStream != nil
+}
+
+func (o *brokerObserver) publish(event BrokerEvent) {
+	s := o.eventStream
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for sub := range s.subscribers {
+		event := event
+		event.Dropped = sub.dropped
+		select {
+		case sub.events <- event:
+			sub.dropped = 0
+		default:
+			sub.dropped++
+			s.dropped++
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receivedEvents returns the events buffered for a subscriber, without their time.
+func receivedEvents(events <-chan BrokerEvent) []BrokerEvent {
+	var received []BrokerEvent
+	for {
+		select {
+		case event := <-events:
+			event.Time = time.Time{}
+			received = append(received, event)
+		default:
+			return received
+		}
+	}
+}
+
+func TestQueues_BrokerEvents(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(1, 0)
+	qb.clock = clk
+	events, unsubscribe := qb.subscribe()
+	defer unsubscribe()
+
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+	assert.Equal(t, []BrokerEvent{
+		{Type: BrokerEventQuerierConnected, QuerierID: "querier-1"},
+		{Type: BrokerEventQuerierConnected, QuerierID: "querier-2"},
+	}, receivedEvents(events))
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r1"}, 1))
+	require.ErrorIs(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r2"}, 1), ErrTooManyRequests)
+	assert.Equal(t, []BrokerEvent{
+		{Type: BrokerEventTenantAdded, TenantID: "tenant-1"},
+		{Type: BrokerEventTenantReshuffled, TenantID: "tenant-1"},
+		{Type: BrokerEventQueueFull, TenantID: "tenant-1"},
+	}, receivedEvents(events))
+
+	// only the last connection of a querier disconnects it
+	qb.removeQuerierConnection("querier-1", clk.Now())
+	assert.Empty(t, receivedEvents(events))
+	_, reshuffled := qb.tenantQuerierAssignments.tenantQuerierIDs["tenant-1"]["querier-2"]
+	qb.removeQuerierConnection("querier-2", clk.Now())
+	received := receivedEvents(events)
+	require.NotEmpty(t, received)
+	assert.Equal(t, BrokerEvent{Type: BrokerEventQuerierDisconnected, QuerierID: "querier-2"}, received[0])
+	if reshuffled {
+		assert.Contains(t, received, BrokerEvent{Type: BrokerEventTenantReshuffled, TenantID: "tenant-1"})
+	}
+
+	dequeueN(t, qb, "querier-1", 1)
+	assert.Contains(t, receivedEvents(events), BrokerEvent{Type: BrokerEventTenantRemoved, TenantID: "tenant-1"})
+}
+
+func TestQueues_BrokerEvents_Time(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	events, unsubscribe := qb.subscribe()
+	defer unsubscribe()
+
+	clk.Advance(time.Minute)
+	qb.addQuerierConnection("querier-1")
+	event := <-events
+	assert.Equal(t, clk.Now(), event.Time)
+}
+
+func TestQueues_BrokerEvents_Unsubscribe(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	events, unsubscribe := qb.subscribe()
+	other, unsubscribeOther := qb.subscribe()
+	defer unsubscribeOther()
+
+	unsubscribe()
+	unsubscribe()
+	_, open := <-events
+	assert.False(t, open)
+
+	// the remaining subscriber still receives events
+	qb.addQuerierConnection("querier-1")
+	assert.Len(t, receivedEvents(other), 1)
+}
+
+func TestQueues_BrokerEvents_SlowConsumer(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	slow, unsubscribeSlow := qb.subscribe()
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := qb.subscribe()
+	defer unsubscribeFast()
+
+	const published = brokerEventBufferSize + 10
+	var delivered int
+	for i := 0; i < published; i++ {
+		qb.tenantQuerierAssignments.publish(BrokerEvent{Type: BrokerEventQueueFull, TenantID: "tenant-1"})
+		delivered += len(receivedEvents(fast))
+	}
+	assert.Equal(t, published, delivered)
+	assert.Equal(t, uint64(10), qb.droppedBrokerEvents())
+
+	// the slow consumer received the buffered events, and the next event delivered to it counts the dropped ones
+	assert.Len(t, receivedEvents(slow), brokerEventBufferSize)
+	qb.tenantQuerierAssignments.publish(BrokerEvent{Type: BrokerEventQueueFull, TenantID: "tenant-1"})
+	assert.Equal(t, []BrokerEvent{{Type: BrokerEventQueueFull, TenantID: "tenant-1", Dropped: 10}}, receivedEvents(slow))
+	assert.Equal(t, []BrokerEvent{{Type: BrokerEventQueueFull, TenantID: "tenant-1"}}, receivedEvents(fast))
+}
@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	brokerTenantQueueLengthDesc = prometheus.NewDesc(
+		"cortex_query_scheduler_broker_tenant_queue_length",
+		"Number of queued requests per tenant.",
+		[]string{"user"}, nil,
+	)
+	brokerQueueLengthDesc = prometheus.NewDesc(
+		"cortex_query_scheduler_broker_queue_length",
+		"Number of queued requests of all tenants.",
+		nil, nil,
+	)
+	brokerQueriersDesc = prometheus.NewDesc(
+		"cortex_query_scheduler_broker_queriers",
+		"Number of queriers known to the broker, by state: connected, shutting_down, or disconnected but not forgotten yet.",
+		[]string{"state"}, nil,
+	)
+	brokerQueueLengthByTagDesc = prometheus.NewDesc(
+		"cortex_query_scheduler_broker_queue_length_by_tag",
+		"Number of queued requests of all tenants carrying each request tag. Only exported if the broker tracks the queue depth by tag.",
+		[]string{"tag"}, nil,
+	)
+	brokerTenantReshufflesDesc = prometheus.NewDesc(
+		"cortex_query_scheduler_broker_tenant_reshuffles_total",
+		"Total number of tenant querier shards computed by shuffle sharding.",
+		nil, nil,
+	)
+)
+
+// brokerMetricsSnapshot holds the values of the broker metrics, taken at once so that a scrape is consistent.
+type brokerMetricsSnapshot struct {
+	tenantQueueLengths map[TenantID]int
+	queueLength        int
+	queueLengthByTag   map[string]int
+	queriersByState    map[string]int
+	tenantReshuffles   uint64
+}
+
+func (qb *queueBroker) metricsSnapshot() brokerMetricsSnapshot {
+	tqa := &qb.tenantQuerierAssignments
+	snapshot := brokerMetricsSnapshot{
+		tenantQueueLengths: make(map[TenantID]int, len(qb.tenantQueuesTree.childQueueOrder)),
+		queriersByState:    map[string]int{"connected": 0, "shutting_down": 0, "disconnected": 0},
+		tenantReshuffles:   tqa.tenantShuffles,
+	}
+	for _, name := range qb.tenantQueuesTree.childQueueOrder {
+		length := qb.tenantQueuesTree.getNode(QueuePath{name}).ItemCount()
+		snapshot.tenantQueueLengths[TenantID(name)] = length
+		snapshot.queueLength += length
+	}
+	if qb.trackTagDepths {
+		snapshot.queueLengthByTag = qb.depthByTag()
+	}
+	for _, querier := range tqa.queriersByID {
+		switch {
+		case querier.shuttingDown:
+			snapshot.queriersByState["shutting_down"]++
+		case querier.connections == 0:
+			snapshot.queriersByState["disconnected"]++
+		default:
+			snapshot.queriersByState["connected"]++
+		}
+	}
+	return snapshot
+}
+
+func (s brokerMetricsSnapshot) collect(ch chan<- prometheus.Metric) {
+	for tenantID, length := range s.tenantQueueLengths {
+		ch <- prometheus.MustNewConstMetric(brokerTenantQueueLengthDesc, prometheus.GaugeValue, float64(length), string(tenantID))
+	}
+	ch <- prometheus.MustNewConstMetric(brokerQueueLengthDesc, prometheus.GaugeValue, float64(s.queueLength))
+	for tag, length := range s.queueLengthByTag {
+		ch <- prometheus.MustNewConstMetric(brokerQueueLengthByTagDesc, prometheus.GaugeValue, float64(length), tag)
+	}
+	for state, count := range s.queriersByState {
+		ch <- prometheus.MustNewConstMetric(brokerQueriersDesc, prometheus.GaugeValue, float64(count), state)
+	}
+	ch <- prometheus.MustNewConstMetric(brokerTenantReshufflesDesc, prometheus.CounterValue, float64(s.tenantReshuffles))
+}
+
+// Describe implements prometheus.Collector.
+func (qb *queueBroker) Describe(ch chan<- *prometheus.Desc) {
+	describeBrokerMetrics(ch)
+}
+
+// Collect implements prometheus.Collector, emitting the broker metrics from a snapshot of the broker.
+// As any other broker method, it must not be called concurrently with the dispatcher;
+// use RequestQueue.BrokerMetricsCollector to collect the metrics of a running queue.
+func (qb *queueBroker) Collect(ch chan<- prometheus.Metric) {
+	qb.metricsSnapshot().collect(ch)
+}
+
+func describeBrokerMetrics(ch chan<- *prometheus.Desc) {
+	ch <- brokerTenantQueueLengthDesc
+	ch <- brokerQueueLengthDesc
+	ch <- brokerQueueLengthByTagDesc
+	ch <- brokerQueriersDesc
+	ch <- brokerTenantReshufflesDesc
+}
+
+// BrokerMetricsCollector returns a collector of the metrics of the queue broker. The metrics are snapshotted
+// by the dispatcher, so that collecting them is safe concurrently with all other RequestQueue methods.
+// Nothing is collected once the queue is stopped.
+func (q *RequestQueue) BrokerMetricsCollector() prometheus.Collector {
+	return requestQueueBrokerCollector{q: q}
+}
+
+type requestQueueBrokerCollector struct {
+	q *RequestQueue
+}
+
+func (c requestQueueBrokerCollector) Describe(ch chan<- *prometheus.Desc) {
+	describeBrokerMetrics(ch)
+}
+
+func (c requestQueueBrokerCollector) Collect(ch chan<- prometheus.Metric) {
+	snapshots := make(chan brokerMetricsSnapshot, 1)
+	inspect := func(qb *queueBroker) {
+		snapshots <- qb.metricsSnapshot()
+	}
+
+	select {
+	case c.q.brokerInspections <- inspect:
+		(<-snapshots).collect(ch)
+	case <-c.q.stopCompleted:
+	}
+}
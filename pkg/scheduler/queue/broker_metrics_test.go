@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_BrokerMetrics(t *testing.T) {
+	qb := newQueueBroker(100, time.Minute)
+	for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"} {
+		qb.addQuerierConnection(querierID)
+	}
+	qb.notifyQuerierShutdown("querier-3")
+	qb.removeQuerierConnection("querier-4", time.Now())
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r1"}, 2))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r2"}, 2))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "r3"}, 0))
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(qb))
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_scheduler_broker_queriers Number of queriers known to the broker, by state: connected, shutting_down, or disconnected but not forgotten yet.
+		# TYPE cortex_query_scheduler_broker_queriers gauge
+		cortex_query_scheduler_broker_queriers{state="connected"} 2
+		cortex_query_scheduler_broker_queriers{state="disconnected"} 1
+		cortex_query_scheduler_broker_queriers{state="shutting_down"} 1
+		# HELP cortex_query_scheduler_broker_queue_length Number of queued requests of all tenants.
+		# TYPE cortex_query_scheduler_broker_queue_length gauge
+		cortex_query_scheduler_broker_queue_length 3
+		# HELP cortex_query_scheduler_broker_tenant_queue_length Number of queued requests per tenant.
+		# TYPE cortex_query_scheduler_broker_tenant_queue_length gauge
+		cortex_query_scheduler_broker_tenant_queue_length{user="tenant-1"} 2
+		cortex_query_scheduler_broker_tenant_queue_length{user="tenant-2"} 1
+		# HELP cortex_query_scheduler_broker_tenant_reshuffles_total Total number of tenant querier shards computed by shuffle sharding.
+		# TYPE cortex_query_scheduler_broker_tenant_reshuffles_total counter
+		cortex_query_scheduler_broker_tenant_reshuffles_total 1
+	`)))
+}
+
+func TestRequestQueue_BrokerMetricsCollector(t *testing.T) {
+	queue := NewRequestQueue(log.NewNopLogger(), 1, 0,
+		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{})
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(queue.BrokerMetricsCollector()))
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+
+	queue.RegisterQuerierConnection("querier-1")
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", "request", 0, 1, nil))
+
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_scheduler_broker_queue_length Number of queued requests of all tenants.
+		# TYPE cortex_query_scheduler_broker_queue_length gauge
+		cortex_query_scheduler_broker_queue_length 1
+		# HELP cortex_query_scheduler_broker_tenant_queue_length Number of queued requests per tenant.
+		# TYPE cortex_query_scheduler_broker_tenant_queue_length gauge
+		cortex_query_scheduler_broker_tenant_queue_length{user="user-1"} 1
+	`), "cortex_query_scheduler_broker_queue_length", "cortex_query_scheduler_broker_tenant_queue_length"))
+
+	// Drain the queue so that the queue can stop.
+	_, _, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-1", "")
+	require.NoError(t, err)
+	queue.UnregisterQuerierConnection("querier-1")
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+
+	// nothing is collected once the queue is stopped
+	count, err := testutil.GatherAndCount(reg)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+// Under cache key affinity, each request with a cache key is routed to a target querier, chosen by rendezvous hashing
+// of the cache key over the connected queriers of the tenant's shard, so that the target of a cache key only changes
+// when its target querier leaves or a querier joins which the cache key hashes higher to.
+// A querier only takes the requests routed to it, requests without a cache key, and requests which have been queued
+// for cacheKeyAffinityMaxWait, so that requests are not held back indefinitely by a busy target querier.
+//
+// Finding the requests a querier can take visits the tenant queue and hashes cache keys over the tenant's shard,
+// which is only affordable for tenants with short queues or small shards.
+
+// cacheKeyTargetQuerier returns the querier of the shard which requests with the cache key are routed to,
+// or an empty querier ID if none of the queriers of the shard is connected.
+func (qb *queueBroker) cacheKeyTargetQuerier(shard querierIDSlice, cacheKey string) QuerierID {
+	var target QuerierID
+	var targetScore uint64
+	for _, querierID := range shard {
+		if q := qb.tenantQuerierAssignments.queriersByID[querierID]; q == nil || q.connections == 0 || q.shuttingDown {
+			continue
+		}
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(cacheKey))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write([]byte(querierID))
+		if score := h.Sum64(); target == "" || score > targetScore {
+			target, targetScore = querierID, score
+		}
+	}
+	return target
+}
+
+// querierCanTakeCacheAffineRequest returns true if the querier can take the request under cache key affinity.
+func (qb *queueBroker) querierCanTakeCacheAffineRequest(request *tenantRequest, shard querierIDSlice, querierID QuerierID, now time.Time) bool {
+	if request.cacheKey == "" || now.Sub(request.enqueueTime) >= qb.cacheKeyAffinityMaxWait {
+		return true
+	}
+	target := qb.cacheKeyTargetQuerier(shard, request.cacheKey)
+	return target == "" || target == querierID
+}
+
+// tenantHasCacheAffineRequestForQuerier returns true if the querier can take any of the tenant's queued requests
+// under cache key affinity; always true if cache key affinity is disabled or does not apply to the tenant.
+func (qb *queueBroker) tenantHasCacheAffineRequestForQuerier(tenantID TenantID, querierID QuerierID) bool {
+	if qb.cacheKeyAffinityMaxWait <= 0 {
+		return true
+	}
+	if tenant := qb.tenantQuerierAssignments.tenantsByID[tenantID]; tenant == nil || qb.tenantRequestOrdering(tenant) == RequestOrderingStrict {
+		return true
+	}
+	shard := qb.tenantShardQuerierIDs(tenantID)
+	now := qb.clock.Now()
+	found := false
+	qb.visitTenantRequests(tenantID, func(request *tenantRequest) bool {
+		found = qb.querierCanTakeCacheAffineRequest(request, shard, querierID, now)
+		return !found
+	})
+	return found
+}
+
+// cacheAffineRequestMatcher matches the tenant's requests the querier can take under cache key affinity.
+// If there is none, the request at the front of the tenant queue is dequeued instead.
+func (qb *queueBroker) cacheAffineRequestMatcher(tenant *queueTenant, querierID QuerierID) func(v any) bool {
+	shard := qb.tenantShardQuerierIDs(tenant.tenantID)
+	now := qb.clock.Now()
+	return func(v any) bool {
+		return qb.querierCanTakeCacheAffineRequest(v.(*tenantRequest), shard, querierID, now)
+	}
+}
@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_CacheKeyAffinity(t *testing.T) {
+	const numRequests = 40
+	// as many cache keys as queriers would cluster them even without affinity
+	cacheKeys := []string{"series-a", "series-b", "series-c", "series-d"}
+
+	tests := map[string]struct {
+		maxWait          time.Duration
+		expectClustering bool
+	}{
+		"disabled": {
+			maxWait:          0,
+			expectClustering: false,
+		},
+		"enabled": {
+			maxWait:          time.Minute,
+			expectClustering: true,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.clock = newManualClock()
+			qb.cacheKeyAffinityMaxWait = testData.maxWait
+			queriers := []QuerierID{"querier-1", "querier-2", "querier-3"}
+			for _, querierID := range queriers {
+				qb.addQuerierConnection(querierID)
+			}
+			for i := 0; i < numRequests; i++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i, cacheKey: cacheKeys[i%len(cacheKeys)]}, 0))
+			}
+
+			// the queriers poll in turn until the queue is drained
+			queriersByCacheKey := map[string]map[QuerierID]struct{}{}
+			for i := 0; !qb.isEmpty(); i++ {
+				querierID := queriers[i%len(queriers)]
+				req, _, _, err := qb.dequeueRequestForQuerier(-1, querierID)
+				require.NoError(t, err)
+				if req == nil {
+					continue
+				}
+				if queriersByCacheKey[req.cacheKey] == nil {
+					queriersByCacheKey[req.cacheKey] = map[QuerierID]struct{}{}
+				}
+				queriersByCacheKey[req.cacheKey][querierID] = struct{}{}
+			}
+
+			require.Len(t, queriersByCacheKey, len(cacheKeys))
+			for cacheKey, querierIDs := range queriersByCacheKey {
+				if testData.expectClustering {
+					assert.Len(t, querierIDs, 1, cacheKey)
+					for querierID := range querierIDs {
+						assert.Equal(t, qb.cacheKeyTargetQuerier(queriers, cacheKey), querierID)
+					}
+				} else {
+					assert.Greater(t, len(querierIDs), 1, cacheKey)
+				}
+			}
+			assert.NoError(t, isConsistent(qb))
+		})
+	}
+}
+
+func TestQueues_CacheKeyAffinity_Fallback(t *testing.T) {
+	// findCacheKey returns a cache key which is routed to the target querier
+	findCacheKey := func(t *testing.T, qb *queueBroker, shard querierIDSlice, target QuerierID) string {
+		for i := 0; i < 1000; i++ {
+			if cacheKey := fmt.Sprintf("key-%d", i); qb.cacheKeyTargetQuerier(shard, cacheKey) == target {
+				return cacheKey
+			}
+		}
+		require.FailNow(t, "no cache key routed to querier", target)
+		return ""
+	}
+
+	tests := map[string]struct {
+		// change applied after enqueuing a request routed to querier-1
+		change func(qb *queueBroker, clk *manualClock)
+	}{
+		"request waited for the maximum wait": {
+			change: func(_ *queueBroker, clk *manualClock) {
+				clk.Advance(time.Minute)
+			},
+		},
+		"target querier disconnected": {
+			change: func(qb *queueBroker, _ *manualClock) {
+				qb.removeQuerierConnection("querier-1", time.Now())
+			},
+		},
+		"target querier shutting down": {
+			change: func(qb *queueBroker, _ *manualClock) {
+				qb.notifyQuerierShutdown("querier-1")
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			clk := newManualClock()
+			qb := newQueueBroker(100, time.Hour)
+			qb.clock = clk
+			qb.cacheKeyAffinityMaxWait = time.Minute
+			shard := querierIDSlice{"querier-1", "querier-2"}
+			for _, querierID := range shard {
+				qb.addQuerierConnection(querierID)
+			}
+
+			cacheKey := findCacheKey(t, qb, shard, "querier-1")
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1", cacheKey: cacheKey}, 0))
+
+			// querier-2 does not take the request routed to querier-1
+			clk.Advance(time.Minute - time.Second)
+			req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-2")
+			require.NoError(t, err)
+			require.Nil(t, req)
+
+			testData.change(qb, clk)
+
+			req, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-2")
+			require.NoError(t, err)
+			require.NotNil(t, req)
+			assert.Equal(t, "req-1", req.req)
+			assert.True(t, qb.isEmpty())
+		})
+	}
+}
+
+func TestQueues_CacheKeyAffinity_RequestsWithoutCacheKey(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.clock = newManualClock()
+	qb.cacheKeyAffinityMaxWait = time.Minute
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+
+	cacheKey := "key"
+	target := qb.cacheKeyTargetQuerier(querierIDSlice{"querier-1", "querier-2"}, cacheKey)
+	other := QuerierID("querier-1")
+	if target == other {
+		other = "querier-2"
+	}
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1", cacheKey: cacheKey}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-2"}, 0))
+
+	// the other querier skips the request routed to the target querier and takes the request without cache key
+	assert.Equal(t, "req-2", dequeueN(t, qb, other, 1)[0].req)
+	assert.Equal(t, "req-1", dequeueN(t, qb, target, 1)[0].req)
+	assert.True(t, qb.isEmpty())
+	assert.NoError(t, isConsistent(qb))
+}
@@ -0,0 +1,23 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// clock provides the current time to all time-based logic of the queue broker,
+// allowing the time to be controlled for deterministic testing and simulation.
+type clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// setClock makes the broker use clk for all time-based logic, including the time it reports being created at.
+func (qb *queueBroker) setClock(clk clock) {
+	qb.clock = clk
+	qb.startedAt = clk.Now()
+}
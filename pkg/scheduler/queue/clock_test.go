@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manualClock is a clock which only moves when advanced by the test.
+type manualClock struct {
+	now time.Time
+}
+
+func newManualClock() *manualClock {
+	return &manualClock{now: time.Unix(1700000000, 0)}
+}
+
+func (c *manualClock) Now() time.Time {
+	return c.now
+}
+
+func (c *manualClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestQueues_InjectedClock(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, time.Minute)
+	qb.clock = clk
+	qb.tenantRemovalPolicy = tenantRemovalLazy
+	qb.tenantRemovalGracePeriod = 30 * time.Second
+
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+
+	// forget delay is measured with the injected clock
+	qb.removeQuerierConnection("querier-2", clk.Now())
+	clk.Advance(59 * time.Second)
+	assert.Equal(t, 0, qb.forgetDisconnectedQueriers(clk.Now()))
+	clk.Advance(2 * time.Second)
+	assert.Equal(t, 1, qb.forgetDisconnectedQueriers(clk.Now()))
+
+	// lazy tenant removal is measured with the injected clock
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 0))
+	req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	require.NotNil(t, req)
+	assert.Equal(t, clk.Now(), qb.tenantQuerierAssignments.tenantsByID["tenant-1"].emptySince)
+
+	clk.Advance(29 * time.Second)
+	assert.Equal(t, 0, qb.removeIdleTenants(clk.Now()))
+	clk.Advance(time.Second)
+	assert.Equal(t, 1, qb.removeIdleTenants(clk.Now()))
+	assert.NoError(t, isConsistent(qb))
+}
@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// coalesceQueuedDuplicate attaches the request to the tenant's queued request with the same key as a waiter, if any.
+// Returns true if the request has been coalesced and must not be enqueued.
+func (qb *queueBroker) coalesceQueuedDuplicate(tenant *queueTenant, request *tenantRequest) bool {
+	if qb.dedupMode != dedupCoalesce || request.key == "" {
+		return false
+	}
+	existing := tenant.queuedRequestsByKey[request.key]
+	if existing == nil {
+		return false
+	}
+	existing.waiters = append(existing.waiters, request.req)
+	return true
+}
+
+// tenantNextRequestHeldForCoalescing returns true if the request at the front of the tenant queue can be coalesced with
+// and was enqueued less than the tenant's CoalesceWindow ago.
+//
+// As with MinRequestAge, the tenant is skipped while its next request is held, keeping its dispatch order unchanged.
+func (qb *queueBroker) tenantNextRequestHeldForCoalescing(tenantID TenantID, now time.Time) bool {
+	if qb.dedupMode != dedupCoalesce {
+		return false
+	}
+	if tenant := qb.tenantQuerierAssignments.tenantsByID[tenantID]; tenant == nil || tenant.dedupOverflowed {
+		// nothing can be coalesced with the request
+		return false
+	}
+	window := qb.tenantQuerierAssignments.tenantConfigs[tenantID].CoalesceWindow
+	if window <= 0 {
+		return false
+	}
+	request := qb.tenantNextRequest(tenantID)
+	if request == nil {
+		return false
+	}
+	return request.key != "" && now.Sub(request.enqueueTime) < window
+}
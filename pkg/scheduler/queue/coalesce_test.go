@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_Coalesce(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.dedupMode = dedupCoalesce
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-held", TenantConfig{CoalesceWindow: time.Second}))
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-held", req: "a-1", key: "a"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-other", req: "b-1", key: "b"}, 0))
+	clk.Advance(500 * time.Millisecond)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-held", req: "a-2", key: "a"}, 0))
+
+	// the held request does not block requests of other tenants
+	dequeued := dequeueN(t, qb, "querier-1", 1)
+	assert.Equal(t, "b-1", dequeued[0].req)
+	req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+
+	// a duplicate enqueued once the window has passed still attaches while the request is queued
+	clk.Advance(500 * time.Millisecond)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-held", req: "a-3", key: "a"}, 0))
+	dequeued = dequeueN(t, qb, "querier-1", 1)
+	assert.Equal(t, "a-1", dequeued[0].req)
+	assert.Equal(t, []Request{"a-2", "a-3"}, dequeued[0].waiters)
+	assert.True(t, qb.isEmpty())
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_Coalesce_WithoutWindow(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.dedupMode = dedupCoalesce
+	qb.addQuerierConnection("querier-1")
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "a-1", key: "a"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "a-2", key: "a"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "b-1", key: "b"}, 0))
+
+	// duplicates of a queued request are coalesced even without a window, but nothing is held
+	dequeued := dequeueN(t, qb, "querier-1", 1)
+	assert.Equal(t, "a-1", dequeued[0].req)
+	assert.Equal(t, []Request{"a-2"}, dequeued[0].waiters)
+
+	// once dispatched, the key is released and a new duplicate is queued on its own
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "a-3", key: "a"}, 0))
+	dequeued = dequeueN(t, qb, "querier-1", 2)
+	assert.Equal(t, "b-1", dequeued[0].req)
+	assert.Equal(t, "a-3", dequeued[1].req)
+	assert.Empty(t, dequeued[1].waiters)
+	assert.NoError(t, isConsistent(qb))
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"sort"
+	"time"
+)
+
+// Under connection debouncing, a querier connection which goes away is only disconnected once it has stayed away
+// for connectionDebounce: a connection from the same querier within that window cancels the pending disconnect,
+// so that a querier flapping during a network blip does not change the connection counts, forget state or shards.
+// Only the net effect of the flap is applied, on the next check for disconnected queriers after the window.
+//
+// Connections of queriers which notified a graceful shutdown, and of overflow queriers, are not debounced.
+
+type debouncedDisconnect struct {
+	// number of connections of the querier which went away and have not been replaced yet
+	connections int
+	// when the first of them went away
+	since time.Time
+}
+
+// debounceQuerierDisconnect holds back the disconnect of one of the querier's connections, if connections are debounced.
+// Returns false if the disconnect must be applied right away.
+func (qb *queueBroker) debounceQuerierDisconnect(querierID QuerierID, now time.Time) bool {
+	if qb.connectionDebounce <= 0 {
+		return false
+	}
+	querier := qb.tenantQuerierAssignments.queriersByID[querierID]
+	if querier == nil || querier.shuttingDown || querier.overflow {
+		return false
+	}
+	pending := qb.debouncedDisconnects[querierID]
+	if pending != nil {
+		if pending.connections >= querier.connections {
+			return false
+		}
+		pending.connections++
+		return true
+	}
+	if qb.debouncedDisconnects == nil {
+		qb.debouncedDisconnects = map[QuerierID]*debouncedDisconnect{}
+	}
+	qb.debouncedDisconnects[querierID] = &debouncedDisconnect{connections: 1, since: now}
+	return true
+}
+
+// cancelDebouncedDisconnect offsets a new connection of the querier against one of its pending disconnects, if any.
+// Returns true if the connection replaces a connection which went away, and must not be applied.
+func (qb *queueBroker) cancelDebouncedDisconnect(querierID QuerierID) bool {
+	pending := qb.debouncedDisconnects[querierID]
+	if pending == nil {
+		return false
+	}
+	pending.connections--
+	if pending.connections <= 0 {
+		delete(qb.debouncedDisconnects, querierID)
+	}
+	return true
+}
+
+// applyDebouncedDisconnects applies the pending disconnects which have been held for connectionDebounce,
+// as of when the connections went away. Returns the number of queriers disconnects were applied for.
+func (qb *queueBroker) applyDebouncedDisconnects(now time.Time) int {
+	var expired []QuerierID
+	for querierID, pending := range qb.debouncedDisconnects {
+		if now.Sub(pending.since) >= qb.connectionDebounce {
+			expired = append(expired, querierID)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i] < expired[j] })
+	for _, querierID := range expired {
+		qb.applyDebouncedDisconnect(querierID)
+	}
+	return len(expired)
+}
+
+// applyDebouncedDisconnect applies the querier's pending disconnects right away, if any.
+func (qb *queueBroker) applyDebouncedDisconnect(querierID QuerierID) {
+	pending := qb.debouncedDisconnects[querierID]
+	if pending == nil {
+		return
+	}
+	delete(qb.debouncedDisconnects, querierID)
+	for i := 0; i < pending.connections; i++ {
+		if querier := qb.tenantQuerierAssignments.queriersByID[querierID]; querier == nil || querier.connections <= 0 {
+			return
+		}
+		qb.disconnectQuerierConnection(querierID, pending.since)
+	}
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ConnectionDebounce_Flap(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.connectionDebounce = 10 * time.Second
+	tqa := &qb.tenantQuerierAssignments
+	for _, querierID := range []QuerierID{"querier-0", "querier-1", "querier-2"} {
+		qb.addQuerierConnection(querierID)
+	}
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r"}, 2))
+	shard := getTenantsQueriers(qb, "tenant-1")
+	shuffles := tqa.tenantShuffles
+	fingerprint := qb.stateFingerprint()
+
+	// the querier flaps several times within the window
+	for i := 0; i < 3; i++ {
+		qb.removeQuerierConnection("querier-0", clk.Now())
+		assert.Equal(t, 1, tqa.queriersByID["querier-0"].connections)
+		clk.Advance(time.Second)
+		qb.addQuerierConnection("querier-0")
+	}
+
+	clk.Advance(time.Minute)
+	assert.Zero(t, qb.forgetDisconnectedQueriers(clk.Now()))
+	assert.Equal(t, fingerprint, qb.stateFingerprint())
+	assert.Equal(t, shuffles, tqa.tenantShuffles)
+	assert.Equal(t, shard, getTenantsQueriers(qb, "tenant-1"))
+	assert.Empty(t, qb.debouncedDisconnects)
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_ConnectionDebounce_NetDisconnect(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.connectionDebounce = 10 * time.Second
+	tqa := &qb.tenantQuerierAssignments
+	qb.addQuerierConnection("querier-0")
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-1")
+
+	// both connections of querier-1 go away, and only one comes back
+	qb.removeQuerierConnection("querier-1", clk.Now())
+	qb.removeQuerierConnection("querier-1", clk.Now())
+	qb.addQuerierConnection("querier-1")
+	// querier-0 goes away for good
+	qb.removeQuerierConnection("querier-0", clk.Now())
+
+	clk.Advance(5 * time.Second)
+	assert.Zero(t, qb.forgetDisconnectedQueriers(clk.Now()))
+	assert.Equal(t, 2, tqa.queriersByID["querier-1"].connections)
+	assert.Contains(t, tqa.queriersByID, QuerierID("querier-0"))
+
+	clk.Advance(5 * time.Second)
+	assert.Equal(t, 2, qb.forgetDisconnectedQueriers(clk.Now()))
+	assert.Equal(t, 1, tqa.queriersByID["querier-1"].connections)
+	assert.NotContains(t, tqa.queriersByID, QuerierID("querier-0"))
+	assert.Equal(t, querierIDSlice{"querier-1"}, tqa.querierIDsSorted)
+	assert.Empty(t, qb.debouncedDisconnects)
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_ConnectionDebounce_ForgetDelayFromDisconnect(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, time.Minute)
+	qb.clock = clk
+	qb.connectionDebounce = 10 * time.Second
+	tqa := &qb.tenantQuerierAssignments
+	qb.addQuerierConnection("querier-0")
+
+	disconnectedAt := clk.Now()
+	qb.removeQuerierConnection("querier-0", disconnectedAt)
+	clk.Advance(15 * time.Second)
+	assert.Equal(t, 1, qb.forgetDisconnectedQueriers(clk.Now()))
+	assert.Equal(t, disconnectedAt, tqa.queriersByID["querier-0"].disconnectedAt)
+
+	// the forget delay runs from when the connection went away
+	clk.Advance(40 * time.Second)
+	assert.Zero(t, qb.forgetDisconnectedQueriers(clk.Now()))
+	clk.Advance(10 * time.Second)
+	assert.Equal(t, 1, qb.forgetDisconnectedQueriers(clk.Now()))
+	assert.NotContains(t, tqa.queriersByID, QuerierID("querier-0"))
+}
+
+func TestQueues_ConnectionDebounce_Shutdown(t *testing.T) {
+	qb := newQueueBroker(100, time.Minute)
+	qb.connectionDebounce = 10 * time.Second
+	tqa := &qb.tenantQuerierAssignments
+	qb.addQuerierConnection("querier-0")
+	qb.addQuerierConnection("querier-1")
+
+	// a pending disconnect is applied when the querier notifies its shutdown
+	qb.removeQuerierConnection("querier-0", qb.clock.Now())
+	qb.notifyQuerierShutdown("querier-0")
+	assert.NotContains(t, tqa.queriersByID, QuerierID("querier-0"))
+	assert.Empty(t, qb.debouncedDisconnects)
+
+	// connections of a querier shutting down are not debounced
+	qb.notifyQuerierShutdown("querier-1")
+	qb.removeQuerierConnection("querier-1", qb.clock.Now())
+	assert.NotContains(t, tqa.queriersByID, QuerierID("querier-1"))
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_ConnectionDebounce_Disabled(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-0")
+	qb.removeQuerierConnection("querier-0", qb.clock.Now())
+	assert.NotContains(t, qb.tenantQuerierAssignments.queriersByID, QuerierID("querier-0"))
+	assert.Nil(t, qb.debouncedDisconnects)
+}
@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "sort"
+
+// coShardedTenants returns the other tenants whose querier shards overlap the tenant's shard,
+// meaning they share at least one querier. Tenants which can use all queriers overlap with every tenant.
+// The result is sorted and excludes the tenant itself; it is empty for an unknown tenant.
+func (tqa *tenantQuerierAssignments) coShardedTenants(tenantID TenantID) []TenantID {
+	if _, ok := tqa.tenantsByID[tenantID]; !ok {
+		return nil
+	}
+	tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]
+
+	var coSharded []TenantID
+	for otherTenantID := range tqa.tenantsByID {
+		if otherTenantID == tenantID {
+			continue
+		}
+		otherQuerierSet := tqa.tenantQuerierIDs[otherTenantID]
+		if tenantQuerierSet == nil || otherQuerierSet == nil || querierSetsIntersect(tenantQuerierSet, otherQuerierSet) {
+			coSharded = append(coSharded, otherTenantID)
+		}
+	}
+	sort.Slice(coSharded, func(i, j int) bool { return coSharded[i] < coSharded[j] })
+	return coSharded
+}
+
+func querierSetsIntersect(a, b map[QuerierID]struct{}) bool {
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	for querierID := range a {
+		if _, ok := b[querierID]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueues_CoShardedTenants(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"} {
+		qb.addQuerierConnection(querierID)
+	}
+
+	getOrAdd(t, qb, "tenant-a", 1)
+	getOrAdd(t, qb, "tenant-b", 1)
+	getOrAdd(t, qb, "tenant-c", 1)
+	getOrAdd(t, qb, "tenant-all", 0)
+	// pin the shards to known querier sets
+	tqa.setTenantQuerierIDs("tenant-a", map[QuerierID]struct{}{"querier-1": {}, "querier-2": {}})
+	tqa.setTenantQuerierIDs("tenant-b", map[QuerierID]struct{}{"querier-2": {}, "querier-3": {}})
+	tqa.setTenantQuerierIDs("tenant-c", map[QuerierID]struct{}{"querier-4": {}})
+
+	tests := map[string]struct {
+		tenantID TenantID
+		expected []TenantID
+	}{
+		"overlapping shards": {
+			tenantID: "tenant-a",
+			expected: []TenantID{"tenant-all", "tenant-b"},
+		},
+		"disjoint shard only overlaps with tenants using all queriers": {
+			tenantID: "tenant-c",
+			expected: []TenantID{"tenant-all"},
+		},
+		"tenant using all queriers overlaps with everyone": {
+			tenantID: "tenant-all",
+			expected: []TenantID{"tenant-a", "tenant-b", "tenant-c"},
+		},
+		"unknown tenant": {
+			tenantID: "tenant-unknown",
+			expected: nil,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, tqa.coShardedTenants(testData.tenantID))
+		})
+	}
+}
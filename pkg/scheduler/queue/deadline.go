@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// requestDeadlineExceeded returns true if the broker rejects expired requests and the request's deadline has passed.
+func (qb *queueBroker) requestDeadlineExceeded(request *tenantRequest, now time.Time) bool {
+	return qb.rejectExpiredRequests && !request.deadline.IsZero() && !now.Before(request.deadline)
+}
+
+// dropExpiredRequest returns true if the request just dequeued from the tenant is past its deadline, and the broker
+// evicts expired requests or the tenant's requests are ordered by least slack. The dropped request is reported to
+// the observer as expired, along with its waiters, to be cancelled.
+func (qb *queueBroker) dropExpiredRequest(tenant *queueTenant, request *tenantRequest, now time.Time) bool {
+	if request.deadline.IsZero() || now.Before(request.deadline) {
+		return false
+	}
+	if !qb.evictExpiredRequests && qb.tenantRequestOrdering(tenant) != RequestOrderingLeastSlack {
+		return false
+	}
+	qb.observer.requestExpired(request.tenantID, request.req)
+	for _, waiter := range request.waiters {
+		qb.observer.requestExpired(request.tenantID, waiter)
+	}
+	return true
+}
+
+// DeadlineRequest is implemented by requests which are no longer wanted past a deadline, such as the deadline of
+// the context of the client which issued them. RequestQueue drops them from the queue rather than dispatching them
+// once their deadline has passed.
+type DeadlineRequest interface {
+	Deadline() (deadline time.Time, ok bool)
+}
+
+// requestDeadline returns the deadline a request is enqueued with by RequestQueue, or zero if it has none.
+func requestDeadline(req Request) time.Time {
+	if r, ok := req.(DeadlineRequest); ok {
+		if deadline, ok := r.Deadline(); ok {
+			return deadline
+		}
+	}
+	return time.Time{}
+}
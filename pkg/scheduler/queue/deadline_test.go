@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_RejectExpiredRequests(t *testing.T) {
+	for testName, testData := range map[string]struct {
+		reject      bool
+		deadline    time.Duration
+		expectedErr error
+	}{
+		"expired request accepted by default": {
+			reject:   false,
+			deadline: -time.Second,
+		},
+		"expired request rejected": {
+			reject:      true,
+			deadline:    -time.Second,
+			expectedErr: ErrDeadlineAlreadyExceeded,
+		},
+		"request expiring now rejected": {
+			reject:      true,
+			deadline:    0,
+			expectedErr: ErrDeadlineAlreadyExceeded,
+		},
+		"request with a future deadline accepted": {
+			reject:   true,
+			deadline: time.Second,
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			clk := newManualClock()
+			qb := newQueueBroker(100, 0)
+			qb.clock = clk
+			qb.rejectExpiredRequests = testData.reject
+
+			err := qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req", deadline: clk.Now().Add(testData.deadline)}, 0)
+			if testData.expectedErr != nil {
+				require.ErrorIs(t, err, testData.expectedErr)
+				assert.True(t, qb.isEmpty())
+				assert.Empty(t, qb.tenantQuerierAssignments.tenantsByID)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, queuedRequests(qb, "tenant-1"), 1)
+		})
+	}
+}
+
+func TestQueues_RejectExpiredRequests_NoDeadline(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.rejectExpiredRequests = true
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req"}, 0))
+	assert.Len(t, queuedRequests(qb, "tenant-1"), 1)
+}
+
+func TestQueues_EvictExpiredRequests(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.evictExpiredRequests = true
+	qb.addQuerierConnection("querier-1")
+	var expired []any
+	qb.observer.OnRequestExpired = func(_ TenantID, req Request) { expired = append(expired, req) }
+	now := clk.Now()
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "expires-1s", deadline: now.Add(time.Second), waiters: []Request{"waiter"}}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "no-deadline"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "expires-1m", deadline: now.Add(time.Minute)}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "expires-2s", deadline: now.Add(2 * time.Second)}, 0))
+	clk.Advance(2 * time.Second)
+
+	// expired requests are dropped whatever the request ordering of their tenant
+	var dispatched []any
+	for {
+		request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+		require.NoError(t, err)
+		if request == nil {
+			break
+		}
+		dispatched = append(dispatched, request.req)
+	}
+	assert.ElementsMatch(t, []any{"no-deadline", "expires-1m"}, dispatched)
+	assert.ElementsMatch(t, []any{"expires-1s", "waiter", "expires-2s"}, expired)
+}
+
+type deadlineRequest struct {
+	name     string
+	deadline time.Time
+}
+
+func (r deadlineRequest) Deadline() (time.Time, bool) {
+	return r.deadline, !r.deadline.IsZero()
+}
+
+func TestRequestQueue_GetNextRequestForQuerier_ShouldNotDispatchExpiredRequests(t *testing.T) {
+	queueLength := promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"})
+	expiredRequests := promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"})
+	queue := NewRequestQueue(log.NewNopLogger(), 100, 0,
+		queueLength,
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{ExpiredRequests: expiredRequests})
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+	})
+
+	expiring := deadlineRequest{"expiring", time.Now().Add(50 * time.Millisecond)}
+	live := deadlineRequest{"live", time.Now().Add(time.Hour)}
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", expiring, 0, 1, nil))
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", live, 0, 1, nil))
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", "no-deadline", 0, 1, nil))
+	assert.Equal(t, 3.0, testutil.ToFloat64(queueLength.WithLabelValues("user-1")))
+	time.Sleep(100 * time.Millisecond)
+
+	queue.RegisterQuerierConnection("querier-1")
+	t.Cleanup(func() {
+		queue.UnregisterQuerierConnection("querier-1")
+	})
+
+	req, last, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-1", "")
+	require.NoError(t, err)
+	assert.Equal(t, live, req)
+	req, _, err = queue.GetNextRequestForQuerier(ctx, last, "querier-1", "")
+	require.NoError(t, err)
+	assert.Equal(t, "no-deadline", req)
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(queueLength.WithLabelValues("user-1")) == 0
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1.0, testutil.ToFloat64(expiredRequests.WithLabelValues("user-1")))
+}
@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// debugState is a point-in-time view of the broker for diagnostics. It never includes request payloads.
+type debugState struct {
+	Tenants  []debugTenant  `json:"tenants"`
+	Queriers []debugQuerier `json:"queriers"`
+	Stats    debugStats     `json:"stats"`
+}
+
+type debugTenant struct {
+	TenantID    TenantID `json:"tenant_id"`
+	Depth       int      `json:"depth"`
+	MaxQueriers int      `json:"max_queriers"`
+	// querier IDs of the tenant's shard, sorted; omitted if the tenant can use all queriers
+	Queriers           []QuerierID `json:"queriers,omitempty"`
+	Inflight           int         `json:"inflight"`
+	QueuedPayloadBytes int64       `json:"queued_payload_bytes"`
+	Tier               int         `json:"tier"`
+	EmptySince         *time.Time  `json:"empty_since,omitempty"`
+	PendingReshuffle   bool        `json:"pending_reshuffle"`
+	AboveHighWatermark bool        `json:"above_high_watermark"`
+}
+
+type debugQuerier struct {
+	QuerierID      QuerierID  `json:"querier_id"`
+	Connections    int        `json:"connections"`
+	ShuttingDown   bool       `json:"shutting_down"`
+	Overflow       bool       `json:"overflow,omitempty"`
+	DisconnectedAt *time.Time `json:"disconnected_at,omitempty"`
+	Inflight       int        `json:"inflight"`
+}
+
+type debugStats struct {
+	Tenants          int    `json:"tenants"`
+	Queriers         int    `json:"queriers"`
+	QueuedRequests   int    `json:"queued_requests"`
+	InflightRequests int    `json:"inflight_requests"`
+	ShardedTenants   int    `json:"sharded_tenants"`
+	TenantShuffles   uint64 `json:"tenant_shuffles"`
+	ShardingEnabled  bool   `json:"sharding_enabled"`
+}
+
+// MarshalDebugJSON serializes the tenants, queriers and global statistics of the broker to JSON,
+// for diagnostic endpoints. Tenants and queriers are sorted by ID.
+//
+// The broker is not safe for concurrent use: MarshalDebugJSON must be called from the goroutine
+// owning the broker, see RequestQueue.DebugJSON.
+func (qb *queueBroker) MarshalDebugJSON() ([]byte, error) {
+	tqa := &qb.tenantQuerierAssignments
+	state := debugState{
+		Tenants:  make([]debugTenant, 0, len(tqa.tenantsByID)),
+		Queriers: make([]debugQuerier, 0, len(tqa.queriersByID)),
+		Stats: debugStats{
+			Tenants:          len(tqa.tenantsByID),
+			Queriers:         len(tqa.queriersByID),
+			QueuedRequests:   qb.tenantQueuesTree.ItemCount(),
+			InflightRequests: len(qb.inflightRequests),
+			ShardedTenants:   tqa.shardedTenantCount,
+			TenantShuffles:   tqa.tenantShuffles,
+			ShardingEnabled:  !tqa.shardingDisabled,
+		},
+	}
+
+	for tenantID, tenant := range tqa.tenantsByID {
+		t := debugTenant{
+			TenantID:           tenantID,
+			MaxQueriers:        tenant.maxQueriers,
+			Inflight:           qb.inflightPerTenant[tenantID],
+			QueuedPayloadBytes: tenant.queuedPayloadBytes,
+			Tier:               tenant.tier,
+			AboveHighWatermark: tenant.aboveHighWatermark,
+		}
+		if queue := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}); queue != nil {
+			t.Depth = queue.ItemCount()
+		}
+		for querierID := range tqa.tenantQuerierIDs[tenantID] {
+			t.Queriers = append(t.Queriers, querierID)
+		}
+		sort.Slice(t.Queriers, func(i, j int) bool { return t.Queriers[i] < t.Queriers[j] })
+		if !tenant.emptySince.IsZero() {
+			emptySince := tenant.emptySince
+			t.EmptySince = &emptySince
+		}
+		_, t.PendingReshuffle = tqa.pendingTenantReshuffles[tenantID]
+		state.Tenants = append(state.Tenants, t)
+	}
+	sort.Slice(state.Tenants, func(i, j int) bool { return state.Tenants[i].TenantID < state.Tenants[j].TenantID })
+
+	for querierID, querier := range tqa.queriersByID {
+		q := debugQuerier{
+			QuerierID:    querierID,
+			Connections:  querier.connections,
+			ShuttingDown: querier.shuttingDown,
+			Overflow:     querier.overflow,
+			Inflight:     qb.inflightPerQuerier[querierID],
+		}
+		if !querier.disconnectedAt.IsZero() {
+			disconnectedAt := querier.disconnectedAt
+			q.DisconnectedAt = &disconnectedAt
+		}
+		state.Queriers = append(state.Queriers, q)
+	}
+	sort.Slice(state.Queriers, func(i, j int) bool { return state.Queriers[i].QuerierID < state.Queriers[j].QuerierID })
+
+	return json.Marshal(state)
+}
+
+// DebugJSON returns a consistent snapshot of the queue broker state serialized to JSON, see queueBroker.MarshalDebugJSON.
+// The snapshot is taken by the dispatcher, so it is safe to call concurrently with all other RequestQueue methods.
+func (q *RequestQueue) DebugJSON(ctx context.Context) ([]byte, error) {
+	type result struct {
+		data []byte
+		err  error
+	}
+	processed := make(chan result, 1)
+	inspect := func(qb *queueBroker) {
+		data, err := qb.MarshalDebugJSON()
+		processed <- result{data: data, err: err}
+	}
+
+	select {
+	case q.brokerInspections <- inspect:
+		r := <-processed
+		return r.data, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-q.stopCompleted:
+		return nil, ErrStopped
+	}
+}
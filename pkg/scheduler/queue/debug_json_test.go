@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_MarshalDebugJSON(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, time.Minute)
+	qb.clock = clk
+	qb.trackInflight = true
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+	qb.addQuerierConnection("querier-3")
+	qb.notifyQuerierShutdown("querier-3")
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-sharded", req: "secret-payload-1"}, 1))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-all", req: "secret-payload-2"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-all", req: "secret-payload-3"}, 0))
+
+	shardQueriers := getTenantsQueriers(qb, "tenant-sharded")
+	require.Len(t, shardQueriers, 1)
+
+	// Dispatch a request of tenant-all, which stays inflight.
+	request, tenant, _, err := qb.dequeueRequestForQuerier(qb.tenantQuerierAssignments.tenantsByID["tenant-sharded"].orderIndex, "querier-1")
+	require.NoError(t, err)
+	require.Equal(t, TenantID("tenant-all"), tenant.tenantID)
+	require.NotNil(t, request)
+
+	data, err := qb.MarshalDebugJSON()
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret-payload")
+
+	var state debugState
+	require.NoError(t, json.Unmarshal(data, &state))
+
+	assert.Equal(t, []debugTenant{
+		{TenantID: "tenant-all", Depth: 1, MaxQueriers: 0, Inflight: 1},
+		{TenantID: "tenant-sharded", Depth: 1, MaxQueriers: 1, Queriers: shardQueriers},
+	}, state.Tenants)
+
+	require.Len(t, state.Queriers, 3)
+	assert.Equal(t, debugQuerier{QuerierID: "querier-1", Connections: 1, Inflight: 1}, state.Queriers[0])
+	assert.Equal(t, debugQuerier{QuerierID: "querier-2", Connections: 1}, state.Queriers[1])
+	assert.Equal(t, debugQuerier{QuerierID: "querier-3", Connections: 1, ShuttingDown: true}, state.Queriers[2])
+
+	assert.Equal(t, debugStats{
+		Tenants:          2,
+		Queriers:         3,
+		QueuedRequests:   2,
+		InflightRequests: 1,
+		ShardedTenants:   1,
+		TenantShuffles:   qb.tenantQuerierAssignments.tenantShuffles,
+		ShardingEnabled:  true,
+	}, state.Stats)
+
+	// A disconnected querier reports when it disconnected.
+	qb.removeQuerierConnection("querier-2", clk.Now())
+	data, err = qb.MarshalDebugJSON()
+	require.NoError(t, err)
+	state = debugState{}
+	require.NoError(t, json.Unmarshal(data, &state))
+	require.NotNil(t, state.Queriers[1].DisconnectedAt)
+	assert.True(t, clk.Now().Equal(*state.Queriers[1].DisconnectedAt))
+	assert.Zero(t, state.Queriers[1].Connections)
+}
+
+func TestRequestQueue_DebugJSON(t *testing.T) {
+	queue := NewRequestQueue(log.NewNopLogger(), 1, 0,
+		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{})
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+
+	queue.RegisterQuerierConnection("querier-1")
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", "request", 0, 1, nil))
+
+	data, err := queue.DebugJSON(ctx)
+	require.NoError(t, err)
+
+	var state debugState
+	require.NoError(t, json.Unmarshal(data, &state))
+	assert.Equal(t, []debugTenant{{TenantID: "user-1", Depth: 1}}, state.Tenants)
+	assert.Equal(t, []debugQuerier{{QuerierID: "querier-1", Connections: 1}}, state.Queriers)
+
+	// Drain the queue so that the queue can stop.
+	_, _, err = queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-1", "")
+	require.NoError(t, err)
+	queue.UnregisterQuerierConnection("querier-1")
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+
+	cancelCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	_, err = queue.DebugJSON(cancelCtx)
+	assert.ErrorIs(t, err, ErrStopped)
+}
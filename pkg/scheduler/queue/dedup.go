@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+type dedupMode int
+
+const (
+	// dedupDisabled enqueues every request, regardless of its key.
+	dedupDisabled dedupMode = iota
+	// dedupReplaceWithLatest replaces a queued request with the latest submission of a request with the same key.
+	// The earlier submission is dropped from the queue and will not be dispatched.
+	dedupReplaceWithLatest
+	// dedupCoalesce attaches a request with the same key as a queued request to the queued request as a waiter,
+	// instead of enqueuing it. The waiters are dispatched along with the queued request, and share its result.
+	dedupCoalesce
+)
+
+// replaceQueuedDuplicate replaces the tenant's queued request with the same key as the given request, if any.
+// Returns true if a queued request has been replaced and the given request must not be enqueued.
+func (qb *queueBroker) replaceQueuedDuplicate(tenant *queueTenant, request *tenantRequest) bool {
+	if qb.dedupMode != dedupReplaceWithLatest || request.key == "" {
+		return false
+	}
+	existing := tenant.queuedRequestsByKey[request.key]
+	if existing == nil {
+		return false
+	}
+
+	tenant.queuedPayloadBytes += request.payloadBytes - existing.payloadBytes
+	qb.queuedPayloadBytes += request.payloadBytes - existing.payloadBytes
+	qb.countQueuedTags(existing, -1)
+	qb.countQueuedTags(request, 1)
+
+	if !qb.dedupReplaceMovesToBack {
+		// keep the queue position of the existing entry and only update its payload
+		existing.req = request.req
+		existing.payloadBytes = request.payloadBytes
+		existing.tags = request.tags
+		return true
+	}
+
+	// the request takes the place of the existing entry in its queue
+	request.class = existing.class
+	request.component = existing.component
+	queuePath := qb.requestQueuePath(existing)
+	queue := qb.tenantQueuesTree.getNode(queuePath)
+	for elem := queue.localQueue.Front(); elem != nil; elem = elem.Next() {
+		if elem.Value == existing {
+			queue.localQueue.Remove(elem)
+			break
+		}
+	}
+	qb.placeRequest(tenant, queuePath, queue.localQueue.PushBack(request))
+	tenant.queuedRequestsByKey[request.key] = request
+	return true
+}
+
+// trackQueuedKey records a request enqueued for the tenant by its deduplication key.
+//
+// If the tenant's keys would exceed the broker's dedupMaxKeysPerTenant, its keys are dropped instead
+// and deduplication is disabled for the tenant, accepting duplicates rather than growing the keys without bound.
+// Requests already coalesced with are still dispatched along with their waiters.
+func (qb *queueBroker) trackQueuedKey(tenant *queueTenant, request *tenantRequest) {
+	if qb.dedupMode == dedupDisabled || request.key == "" || tenant.dedupOverflowed {
+		return
+	}
+	if _, ok := tenant.queuedRequestsByKey[request.key]; ok {
+		return
+	}
+	if qb.dedupMaxKeysPerTenant > 0 && len(tenant.queuedRequestsByKey) >= qb.dedupMaxKeysPerTenant {
+		keys := len(tenant.queuedRequestsByKey)
+		tenant.dedupOverflowed = true
+		tenant.queuedRequestsByKey = nil
+		qb.observer.tenantDedupDisabled(tenant.tenantID, keys)
+		return
+	}
+	if tenant.queuedRequestsByKey == nil {
+		tenant.queuedRequestsByKey = map[string]*tenantRequest{}
+	}
+	tenant.queuedRequestsByKey[request.key] = request
+}
+
+// untrackQueuedKey removes a request dequeued for the tenant from the deduplication keys.
+func (qb *queueBroker) untrackQueuedKey(tenant *queueTenant, request *tenantRequest) {
+	if request.key == "" {
+		return
+	}
+	if tenant.queuedRequestsByKey[request.key] == request {
+		delete(tenant.queuedRequestsByKey, request.key)
+	}
+}
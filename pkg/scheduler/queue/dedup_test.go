@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_DedupReplaceWithLatest(t *testing.T) {
+	tests := map[string]struct {
+		mode          dedupMode
+		movesToBack   bool
+		expectedOrder []Request
+	}{
+		"dedup disabled enqueues duplicates": {
+			mode:          dedupDisabled,
+			expectedOrder: []Request{"a-v1", "b", "a-v2"},
+		},
+		"replace with latest keeps queue position": {
+			mode:          dedupReplaceWithLatest,
+			expectedOrder: []Request{"a-v2", "b"},
+		},
+		"replace with latest moves to back": {
+			mode:          dedupReplaceWithLatest,
+			movesToBack:   true,
+			expectedOrder: []Request{"b", "a-v2"},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.dedupMode = testData.mode
+			qb.dedupReplaceMovesToBack = testData.movesToBack
+			qb.addQuerierConnection("querier-1")
+
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "a-v1", key: "a"}, 0))
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "b", key: "b"}, 0))
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "a-v2", key: "a"}, 0))
+
+			var dequeued []Request
+			for {
+				req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+				require.NoError(t, err)
+				if req == nil {
+					break
+				}
+				dequeued = append(dequeued, req.req)
+			}
+			assert.Equal(t, testData.expectedOrder, dequeued)
+			assert.NoError(t, isConsistent(qb))
+		})
+	}
+}
+
+func TestQueues_DedupReplaceWithLatest_KeyReleasedOnDequeue(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.dedupMode = dedupReplaceWithLatest
+	qb.addQuerierConnection("querier-1")
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "a-v1", key: "a"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "other", key: "other"}, 0))
+	req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	require.Equal(t, "a-v1", req.req)
+
+	// the earlier submission is no longer queued, so the new submission is enqueued rather than replacing it
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "a-v2", key: "a"}, 0))
+	assert.Equal(t, 2, qb.tenantQueuesTree.ItemCount())
+	assert.Equal(t, "a-v1", req.req)
+}
+
+func TestQueues_DedupMaxKeysPerTenant(t *testing.T) {
+	for _, mode := range []dedupMode{dedupReplaceWithLatest, dedupCoalesce} {
+		t.Run(mode.name(), func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.dedupMode = mode
+			qb.dedupMaxKeysPerTenant = 2
+			qb.addQuerierConnection("querier-1")
+
+			type disabled struct {
+				tenantID TenantID
+				keys     int
+			}
+			var notified []disabled
+			qb.observer.OnTenantDedupDisabled = func(tenantID TenantID, keys int) {
+				notified = append(notified, disabled{tenantID, keys})
+			}
+
+			enqueue := func(tenantID TenantID, req, key string) {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: req, key: key}, 0))
+			}
+			enqueue("tenant-1", "a-v1", "a")
+			enqueue("tenant-1", "b", "b")
+			enqueue("tenant-1", "a-v2", "a")
+			assert.Len(t, queuedRequests(qb, "tenant-1"), 2)
+			assert.Empty(t, notified)
+
+			// a third key exceeds the cap, and duplicates are enqueued from then on
+			enqueue("tenant-1", "c", "c")
+			assert.Equal(t, []disabled{{"tenant-1", 2}}, notified)
+			assert.Nil(t, qb.tenantQuerierAssignments.tenantsByID["tenant-1"].queuedRequestsByKey)
+			enqueue("tenant-1", "b-v2", "b")
+			assert.Len(t, queuedRequests(qb, "tenant-1"), 4)
+
+			// other tenants keep deduplicating
+			enqueue("tenant-2", "a-v1", "a")
+			enqueue("tenant-2", "a-v2", "a")
+			assert.Len(t, queuedRequests(qb, "tenant-2"), 1)
+			assert.Len(t, notified, 1)
+
+			// the tenant deduplicates again once it has been removed from the broker
+			dequeueN(t, qb, "querier-1", 5)
+			require.True(t, qb.isEmpty())
+			enqueue("tenant-1", "a-v3", "a")
+			enqueue("tenant-1", "a-v4", "a")
+			assert.Len(t, queuedRequests(qb, "tenant-1"), 1)
+			assert.NoError(t, isConsistent(qb))
+		})
+	}
+}
@@ -0,0 +1,22 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// applyPendingTenantReshuffles computes the shards of all tenants whose reshuffle was deferred
+// from the enqueue path. Returns the number of reshuffled tenants.
+func (qb *queueBroker) applyPendingTenantReshuffles() int {
+	tqa := &qb.tenantQuerierAssignments
+	if len(tqa.pendingTenantReshuffles) == 0 {
+		return 0
+	}
+
+	defer qb.detectReshuffleStorm(tqa.tenantShuffles)
+
+	reshuffled := 0
+	var scratchpad querierIDSlice
+	for tenantID := range tqa.pendingTenantReshuffles {
+		scratchpad = tqa.shuffleTenantQueriers(tenantID, scratchpad)
+		reshuffled++
+	}
+	return reshuffled
+}
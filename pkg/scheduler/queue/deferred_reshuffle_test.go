@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_DeferredTenantReshuffle(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	tqa.deferTenantReshuffle = true
+	for i := 0; i < 10; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+
+	// a new tenant is served by all queriers until its reshuffle is applied
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 3))
+	assert.Equal(t, uint64(0), tqa.tenantShuffles, "no shuffle computation on the enqueue path")
+	assert.Nil(t, tqa.tenantQuerierIDs["tenant-1"])
+	assert.NoError(t, isConsistent(qb))
+
+	assert.Equal(t, 1, qb.applyPendingTenantReshuffles())
+	assert.Len(t, tqa.tenantQuerierIDs["tenant-1"], 3)
+	assert.Equal(t, 0, qb.applyPendingTenantReshuffles())
+	previousShard := tqa.tenantQuerierIDs["tenant-1"]
+
+	// an existing tenant keeps its previous shard until its reshuffle is applied
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 5))
+	assert.Equal(t, uint64(1), tqa.tenantShuffles, "no shuffle computation on the enqueue path")
+	assert.Equal(t, previousShard, tqa.tenantQuerierIDs["tenant-1"])
+
+	assert.Equal(t, 1, qb.applyPendingTenantReshuffles())
+	assert.Len(t, tqa.tenantQuerierIDs["tenant-1"], 5)
+	assert.NoError(t, isConsistent(qb))
+
+	// the deferred reshuffle produces the same shard as a synchronous reshuffle
+	synchronous := newQueueBroker(100, 0)
+	for i := 0; i < 10; i++ {
+		synchronous.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	require.NoError(t, synchronous.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 5))
+	assert.Equal(t, synchronous.tenantQuerierAssignments.tenantQuerierIDs["tenant-1"], tqa.tenantQuerierIDs["tenant-1"])
+
+	// a querier connection change recomputes all shards, including pending ones
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 2))
+	qb.addQuerierConnection("querier-new")
+	assert.Len(t, tqa.tenantQuerierIDs["tenant-1"], 2)
+	assert.Empty(t, tqa.pendingTenantReshuffles)
+	assert.NoError(t, isConsistent(qb))
+}
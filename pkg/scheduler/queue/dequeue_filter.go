@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// dequeueRequestForQuerierFiltered dequeues a request for the querier as dequeueRequestForQuerier does,
+// but only dequeues a request the accept predicate returns true for: requests it rejects are left in place
+// for other queriers, and tenants without any accepted request are skipped, so that the next accepted request
+// is served within the same call rather than by dequeuing and re-enqueuing rejected requests.
+//
+// The predicate may be called several times for the same request. Requests are not striped under a filtered dequeue,
+// and the predicate is not recorded for replay, so that the replay of a filtered dequeue may dequeue another request.
+func (qb *queueBroker) dequeueRequestForQuerierFiltered(lastTenantIndex int, querierID QuerierID, accept func(*tenantRequest) bool) (*tenantRequest, *queueTenant, int, error) {
+	qb.dequeueFilter = accept
+	defer func() { qb.dequeueFilter = nil }()
+
+	return qb.dequeueRequestForQuerier(lastTenantIndex, querierID)
+}
+
+// requestAcceptedForQuerier returns true if the filtered dequeue or the dequeue for a query component
+// accepts the request and the querier can take it under cache key affinity.
+func (qb *queueBroker) requestAcceptedForQuerier(request *tenantRequest, shard querierIDSlice, querierID QuerierID) bool {
+	if qb.dequeueComponent != "" && request.component != qb.dequeueComponent {
+		return false
+	}
+	if qb.dequeueFilter != nil && !qb.dequeueFilter(request) {
+		return false
+	}
+	return qb.cacheKeyAffinityMaxWait <= 0 || qb.querierCanTakeCacheAffineRequest(request, shard, querierID, qb.clock.Now())
+}
+
+// tenantHasAcceptedRequestForQuerier returns true if the filtered dequeue or the dequeue for a query component
+// accepts any of the tenant's queued requests for the querier; always true outside of such dequeues.
+//
+// A dequeue for a query component reads the tenant's queued requests of the component from counters,
+// and only walks them if cache key affinity may reject them.
+func (qb *queueBroker) tenantHasAcceptedRequestForQuerier(tenantID TenantID, querierID QuerierID) bool {
+	if qb.dequeueComponent != "" {
+		if !qb.tenantHasQueuedRequestsOfComponent(tenantID, qb.dequeueComponent) {
+			return false
+		}
+		if qb.dequeueFilter == nil && qb.cacheKeyAffinityMaxWait <= 0 {
+			return true
+		}
+	} else if qb.dequeueFilter == nil {
+		return true
+	}
+	shard := qb.tenantShardQuerierIDs(tenantID)
+	found := false
+	qb.visitTenantRequests(tenantID, func(request *tenantRequest) bool {
+		found = qb.requestAcceptedForQuerier(request, shard, querierID)
+		return !found
+	})
+	return found
+}
+
+// acceptedRequestMatcher matches the tenant's requests the filtered dequeue accepts for the querier.
+// Unlike other matchers, no other request is dequeued if none matches.
+func (qb *queueBroker) acceptedRequestMatcher(tenant *queueTenant, querierID QuerierID) func(v any) bool {
+	shard := qb.tenantShardQuerierIDs(tenant.tenantID)
+	return func(v any) bool {
+		return qb.requestAcceptedForQuerier(v.(*tenantRequest), shard, querierID)
+	}
+}
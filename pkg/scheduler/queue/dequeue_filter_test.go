@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_DequeueRequestForQuerierFiltered(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "inaccessible-1"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "accessible-1"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "inaccessible-2"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-3", req: "accessible-3"}, 0))
+
+	accessible := func(request *tenantRequest) bool {
+		return request.req != "inaccessible-1" && request.req != "inaccessible-2"
+	}
+
+	// the rejected head of the selected tenant is skipped for a later request of the tenant
+	req, tenant, lastTenantIndex, err := qb.dequeueRequestForQuerierFiltered(-1, "querier-1", accessible)
+	require.NoError(t, err)
+	require.NotNil(t, req)
+	assert.Equal(t, "accessible-1", req.req)
+	assert.Equal(t, TenantID("tenant-1"), tenant.tenantID)
+
+	// tenants without any accepted request are skipped
+	req, tenant, lastTenantIndex, err = qb.dequeueRequestForQuerierFiltered(lastTenantIndex, "querier-1", accessible)
+	require.NoError(t, err)
+	require.NotNil(t, req)
+	assert.Equal(t, "accessible-3", req.req)
+	assert.Equal(t, TenantID("tenant-3"), tenant.tenantID)
+
+	req, _, _, err = qb.dequeueRequestForQuerierFiltered(lastTenantIndex, "querier-1", accessible)
+	require.NoError(t, err)
+	assert.Nil(t, req)
+
+	// rejected requests are left in place for other dequeues
+	assert.Equal(t, []any{"inaccessible-1"}, queuedRequests(qb, "tenant-1"))
+	assert.Equal(t, []any{"inaccessible-2"}, queuedRequests(qb, "tenant-2"))
+	dequeued := dequeueN(t, qb, "querier-1", 2)
+	assert.ElementsMatch(t, []Request{"inaccessible-1", "inaccessible-2"}, []Request{dequeued[0].req, dequeued[1].req})
+	assert.NoError(t, isConsistent(qb))
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "sort"
+
+// SkipCause is the reason why a tenant was not selected by a dequeue.
+type SkipCause string
+
+const (
+	// SkipNotInShard: the querier is not part of the tenant's shard.
+	SkipNotInShard SkipCause = "not_in_shard"
+	// SkipNotBacklogged: the querier is an overflow querier, and the tenant's backlog is not above the overflow threshold.
+	SkipNotBacklogged SkipCause = "not_backlogged"
+	// SkipFrozen: the tenant's queue is frozen for inspection.
+	SkipFrozen SkipCause = "frozen"
+	// SkipErrorBudget: the tenant exhausted its error budget, and is paused for its cooldown.
+	SkipErrorBudget SkipCause = "error_budget"
+	// SkipEmpty: the tenant has no queued requests; it is only retained by lazy tenant removal or kept warm.
+	SkipEmpty SkipCause = "empty"
+	// SkipInflightCap: the tenant has reached its max inflight requests.
+	SkipInflightCap SkipCause = "inflight_cap"
+	// SkipBatchTenantCap: the batch dequeue in progress has taken as many requests from the tenant as the per-tenant cap.
+	SkipBatchTenantCap SkipCause = "batch_tenant_cap"
+	// SkipMinRequestAge: the next request of the tenant has not been queued for the tenant's MinRequestAge yet.
+	SkipMinRequestAge SkipCause = "min_request_age"
+	// SkipCoalescing: the next request of the tenant is held for the tenant's CoalesceWindow for duplicates to attach to it.
+	SkipCoalescing SkipCause = "coalescing"
+	// SkipQuerierOverloaded: the querier is overloaded compared to the other queriers of the tenant's shard.
+	SkipQuerierOverloaded SkipCause = "querier_overloaded"
+	// SkipQuerierCostBudget: the tenant's next request would take the estimated cost of the querier's inflight requests
+	// over the querier cost budget.
+	SkipQuerierCostBudget SkipCause = "querier_cost_budget"
+	// SkipPriorityInversion: the querier is held up by a long-running request of a lower priority than the tenant's
+	// next request, which is left to a free querier of the tenant's shard.
+	SkipPriorityInversion SkipCause = "priority_inversion"
+	// SkipPreferredQuerier: the tenant's dequeues are routed to another querier, which it prefers while available.
+	SkipPreferredQuerier SkipCause = "preferred_querier"
+	// SkipCacheKeyAffinity: all of the tenant's queued requests are routed to other queriers by their cache key.
+	SkipCacheKeyAffinity SkipCause = "cache_key_affinity"
+	// SkipRejectedByFilter: the predicate of a filtered dequeue rejects all of the tenant's queued requests.
+	SkipRejectedByFilter SkipCause = "rejected_by_filter"
+	// SkipBackpressure: the dispatch to the tenant was held back under downstream backpressure.
+	SkipBackpressure SkipCause = "backpressure"
+	// SkipNotSelected: the tenant was eligible, but another tenant was selected by weighted random or tiered selection.
+	SkipNotSelected SkipCause = "not_selected"
+)
+
+// SkipReason is a tenant considered by a traced dequeue which was not selected, and why.
+type SkipReason struct {
+	TenantID TenantID  `json:"tenant_id"`
+	Cause    SkipCause `json:"cause"`
+}
+
+// dequeueRequestForQuerierTraced dequeues a request for the querier as dequeueRequestForQuerier does,
+// additionally returning every tenant the dequeue considered and skipped, in the order they were considered.
+//
+// The trace is collected by the tenant selection itself, so it reflects the actual decision, with one difference:
+// the tenants of a querier are always found by scanning the tenant order rather than through the querier tenant index,
+// which finds the same tenant, so that the tenants the querier is not part of the shard of are reported too.
+// A tenant the broker sticks with is selected without considering other tenants.
+func (qb *queueBroker) dequeueRequestForQuerierTraced(lastTenantIndex int, querierID QuerierID) (*tenantRequest, *queueTenant, int, []SkipReason, error) {
+	tqa := &qb.tenantQuerierAssignments
+	trace := []SkipReason{}
+	tqa.dequeueTrace = &trace
+	defer func() { tqa.dequeueTrace = nil }()
+
+	request, tenant, tenantIndex, err := qb.dequeueRequestForQuerier(lastTenantIndex, querierID)
+	return request, tenant, tenantIndex, trace, err
+}
+
+func (tqa *tenantQuerierAssignments) traceSkip(tenantID TenantID, cause SkipCause) {
+	if tqa.dequeueTrace == nil {
+		return
+	}
+	*tqa.dequeueTrace = append(*tqa.dequeueTrace, SkipReason{TenantID: tenantID, Cause: cause})
+}
+
+// traceNotSelected traces the eligible tenants other than the selected one as not selected.
+func (tqa *tenantQuerierAssignments) traceNotSelected(eligible []*queueTenant, selected *queueTenant) {
+	if tqa.dequeueTrace == nil {
+		return
+	}
+	for _, tenant := range eligible {
+		if tenant != selected {
+			tqa.traceSkip(tenant.tenantID, SkipNotSelected)
+		}
+	}
+}
+
+// tenantsInOrder returns the tenants indexed by their position in the tenant order, in tenant order.
+func tenantsInOrder(tenantsByOrderIndex map[int]*queueTenant) []*queueTenant {
+	orderIndexes := make([]int, 0, len(tenantsByOrderIndex))
+	for i := range tenantsByOrderIndex {
+		orderIndexes = append(orderIndexes, i)
+	}
+	sort.Ints(orderIndexes)
+	tenants := make([]*queueTenant, 0, len(orderIndexes))
+	for _, i := range orderIndexes {
+		tenants = append(tenants, tenantsByOrderIndex[i])
+	}
+	return tenants
+}
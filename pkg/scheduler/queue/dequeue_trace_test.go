@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_DequeueRequestForQuerierTraced(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.trackInflight = true
+	qb.tenantRemovalPolicy = tenantRemovalLazy
+	qb.tenantRemovalGracePeriod = time.Hour
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+	tqa := &qb.tenantQuerierAssignments
+	require.NoError(t, tqa.setTenantConfig("tenant-capped", TenantConfig{MaxInflight: 1}))
+	require.NoError(t, tqa.setTenantConfig("tenant-young", TenantConfig{MinRequestAge: time.Minute}))
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-sharded", req: "req-1"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-empty", req: "req-2"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-capped", req: "req-3"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-capped", req: "req-4"}, 0))
+	tqa.setTenantQuerierIDs("tenant-sharded", map[QuerierID]struct{}{"querier-2": {}})
+
+	// empty tenant-empty, and get tenant-capped to its max inflight requests
+	req, _, lastTenantIndex, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	require.Equal(t, "req-2", req.req)
+	req, _, _, err = qb.dequeueRequestForQuerier(lastTenantIndex, "querier-1")
+	require.NoError(t, err)
+	require.Equal(t, "req-3", req.req)
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-young", req: "req-5"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-ready", req: "req-6"}, 0))
+
+	req, tenant, _, trace, err := qb.dequeueRequestForQuerierTraced(-1, "querier-1")
+	require.NoError(t, err)
+	require.NotNil(t, req)
+	assert.Equal(t, "req-6", req.req)
+	assert.Equal(t, TenantID("tenant-ready"), tenant.tenantID)
+	assert.Equal(t, []SkipReason{
+		{TenantID: "tenant-sharded", Cause: SkipNotInShard},
+		{TenantID: "tenant-empty", Cause: SkipEmpty},
+		{TenantID: "tenant-capped", Cause: SkipInflightCap},
+		{TenantID: "tenant-young", Cause: SkipMinRequestAge},
+	}, trace)
+
+	// no request for the querier: all the tenants are reported, and the rotation wraps around
+	// past tenant-sharded again before it gets back to the first tenant it considered
+	req, _, _, trace, err = qb.dequeueRequestForQuerierTraced(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+	assert.Equal(t, []SkipReason{
+		{TenantID: "tenant-sharded", Cause: SkipNotInShard},
+		{TenantID: "tenant-empty", Cause: SkipEmpty},
+		{TenantID: "tenant-capped", Cause: SkipInflightCap},
+		{TenantID: "tenant-young", Cause: SkipMinRequestAge},
+		{TenantID: "tenant-ready", Cause: SkipEmpty},
+		{TenantID: "tenant-sharded", Cause: SkipNotInShard},
+	}, trace)
+
+	// tracing stops with the traced dequeue
+	assert.Nil(t, tqa.dequeueTrace)
+}
+
+func TestQueues_DequeueRequestForQuerierTraced_WeightedRandom(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.tenantSelection = tenantSelectionWeightedRandom
+	qb.addQuerierConnection("querier-1")
+	for _, tenantID := range []TenantID{"tenant-1", "tenant-2", "tenant-3"} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "req"}, 0))
+	}
+
+	_, tenant, _, trace, err := qb.dequeueRequestForQuerierTraced(-1, "querier-1")
+	require.NoError(t, err)
+	require.NotNil(t, tenant)
+
+	// the eligible tenants which were not picked are reported in tenant order
+	var expected []SkipReason
+	for _, tenantID := range []TenantID{"tenant-1", "tenant-2", "tenant-3"} {
+		if tenantID != tenant.tenantID {
+			expected = append(expected, SkipReason{TenantID: tenantID, Cause: SkipNotSelected})
+		}
+	}
+	assert.Equal(t, expected, trace)
+}
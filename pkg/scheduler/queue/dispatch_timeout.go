@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"sort"
+	"time"
+)
+
+// DispatchInfo describes a request dispatched to a querier which has not been completed yet.
+type DispatchInfo struct {
+	TenantID     TenantID
+	QuerierID    QuerierID
+	Request      Request
+	DispatchedAt time.Time
+	Deadline     time.Time
+}
+
+// dispatchTimeout returns the dispatch timeout for the tenant: its configured DispatchTimeout if any,
+// otherwise the broker's default.
+func (qb *queueBroker) dispatchTimeout(tenantID TenantID) time.Duration {
+	if cfg, ok := qb.tenantQuerierAssignments.tenantConfigs[tenantID]; ok && cfg.DispatchTimeout > 0 {
+		return cfg.DispatchTimeout
+	}
+	return qb.defaultDispatchTimeout
+}
+
+// overdueDispatches lists the inflight requests whose dispatch deadline is before now,
+// ordered by the time they were dispatched, oldest first.
+//
+// Deadlines are computed at dispatch time; changing a tenant's timeout does not affect requests already inflight.
+// Requires inflight tracking to be enabled; otherwise no request is ever reported as overdue.
+func (qb *queueBroker) overdueDispatches(now time.Time) []DispatchInfo {
+	var overdue []DispatchInfo
+	for request, inflight := range qb.inflightRequests {
+		if inflight.deadline.IsZero() || !now.After(inflight.deadline) {
+			continue
+		}
+		overdue = append(overdue, DispatchInfo{
+			TenantID:     inflight.tenantID,
+			QuerierID:    inflight.querierID,
+			Request:      request.req,
+			DispatchedAt: inflight.dispatchedAt,
+			Deadline:     inflight.deadline,
+		})
+	}
+	sort.Slice(overdue, func(i, j int) bool {
+		return overdue[i].DispatchedAt.Before(overdue[j].DispatchedAt)
+	})
+	return overdue
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_OverdueDispatches(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.trackInflight = true
+	qb.defaultDispatchTimeout = time.Minute
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-fast", TenantConfig{DispatchTimeout: 10 * time.Second}))
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-default", req: "default-1"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-fast", req: "fast-1"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-fast", req: "fast-2"}, 0))
+
+	dispatchedAt := clk.Now()
+	dispatched := dequeueN(t, qb, "querier-1", 2)
+	assert.Empty(t, qb.overdueDispatches(clk.Now()))
+
+	clk.Advance(5 * time.Second)
+	dequeueN(t, qb, "querier-1", 1)
+
+	// only the first request of the tenant with the shorter timeout is overdue
+	clk.Advance(6 * time.Second)
+	assert.Equal(t, []DispatchInfo{
+		{TenantID: "tenant-fast", QuerierID: "querier-1", Request: "fast-1", DispatchedAt: dispatchedAt, Deadline: dispatchedAt.Add(10 * time.Second)},
+	}, qb.overdueDispatches(clk.Now()))
+
+	// all requests are overdue after the default timeout, oldest dispatches first
+	clk.Advance(time.Minute)
+	overdue := qb.overdueDispatches(clk.Now())
+	require.Len(t, overdue, 3)
+	assert.Equal(t, "fast-2", overdue[2].Request)
+	assert.Equal(t, dispatchedAt.Add(15*time.Second), overdue[2].Deadline)
+
+	// completed requests are no longer reported
+	qb.completeRequest(dispatched[0])
+	qb.completeRequest(dispatched[1])
+	overdue = qb.overdueDispatches(clk.Now())
+	require.Len(t, overdue, 1)
+	assert.Equal(t, "fast-2", overdue[0].Request)
+}
+
+func TestQueues_OverdueDispatches_NoTimeout(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.trackInflight = true
+	qb.addQuerierConnection("querier-1")
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 0))
+	dequeueN(t, qb, "querier-1", 1)
+
+	clk.Advance(24 * time.Hour)
+	assert.Empty(t, qb.overdueDispatches(clk.Now()))
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"math"
+	"time"
+)
+
+// simulateDrain estimates how long the currently queued requests would take to drain if the tenants were
+// served by the given number of queriers, each dispatching serviceRate requests per second, with no new enqueues.
+// Returns 0 if nothing is queued, and math.MaxInt64 if the backlog would never drain as no request is served.
+//
+// Tenants are assumed to keep their max queriers under the hypothetical fleet, so that a sharded tenant is only
+// served by its shard's queriers: the backlog drains no faster than the whole fleet drains the total backlog,
+// nor than any tenant's shard drains its queue. The estimate is the slowest of these, which is reached when
+// the shards spread the load evenly over the fleet; overlapping shards may take longer.
+//
+// The estimate does not modify the broker.
+func (qb *queueBroker) simulateDrain(queriers int, serviceRate float64) time.Duration {
+	tqa := &qb.tenantQuerierAssignments
+	var seconds float64
+	total := 0
+	for tenantID, tenant := range tqa.tenantsByID {
+		node := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)})
+		if node == nil {
+			continue
+		}
+		depth := node.ItemCount()
+		total += depth
+
+		shardSize := queriers
+		if pinned, ok := tqa.pinnedTenantShards[tenantID]; ok {
+			shardSize = min(len(pinned), queriers)
+		} else if !tqa.shardingDisabled && tenant.maxQueriers > 0 {
+			shardSize = min(tenant.maxQueriers, queriers)
+		}
+		if shardSize <= 0 || serviceRate <= 0 {
+			return math.MaxInt64
+		}
+		seconds = max(seconds, float64(depth)/(float64(shardSize)*serviceRate))
+	}
+	if total == 0 {
+		return 0
+	}
+	seconds = max(seconds, float64(total)/(float64(queriers)*serviceRate))
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
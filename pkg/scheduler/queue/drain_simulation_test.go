@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_SimulateDrain(t *testing.T) {
+	qb := newQueueBroker(1000, 0)
+	for i := 0; i < 4; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	assert.Zero(t, qb.simulateDrain(10, 1))
+
+	// tenant-sharded is served by at most 2 queriers, tenant-all by the whole fleet
+	for i := 0; i < 60; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-sharded", req: i}, 2))
+	}
+	for i := 0; i < 240; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-all", req: i}, 0))
+	}
+	fingerprint := qb.stateFingerprint()
+
+	tests := map[string]struct {
+		queriers    int
+		serviceRate float64
+		expected    time.Duration
+	}{
+		// 300 requests over 10 queriers at 2 req/s is 15s; 60 requests over a shard of 2 at 2 req/s is 15s too
+		"balanced": {queriers: 10, serviceRate: 2, expected: 15 * time.Second},
+		// the fleet drains 300 requests in 5s, but tenant-sharded's shard needs 60 / (2 * 2) = 15s
+		"bound by the shard": {queriers: 30, serviceRate: 2, expected: 15 * time.Second},
+		// 300 requests over 4 queriers at 0.5 req/s is 150s; the shard needs 60 / (2 * 0.5) = 60s
+		"bound by the fleet": {queriers: 4, serviceRate: 0.5, expected: 150 * time.Second},
+		// a single querier serves both tenants: 300 requests at 1 req/s
+		"fleet smaller than the shard": {queriers: 1, serviceRate: 1, expected: 300 * time.Second},
+		"no queriers":                  {queriers: 0, serviceRate: 1, expected: math.MaxInt64},
+		"no service":                   {queriers: 10, serviceRate: 0, expected: math.MaxInt64},
+	}
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			assert.Equal(t, testData.expected, qb.simulateDrain(testData.queriers, testData.serviceRate))
+			assert.Equal(t, fingerprint, qb.stateFingerprint())
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// SchedulingPolicy is the resolved scheduling policy of a tenant: its TenantConfig overrides merged with the broker's
+// defaults, with settings which the broker's configuration disables reported as disabled.
+type SchedulingPolicy struct {
+	RequestOrdering RequestOrdering `json:"request_ordering"`
+	// number of priority bands the tenant's request priorities are clamped to; 0 if they are not clamped
+	PriorityBands int `json:"priority_bands"`
+	// selection weight under weighted random and fair queuing tenant selection
+	Weight int `json:"weight"`
+	Tier   int `json:"tier"`
+	// maximum number of the tenant's requests served consecutively under round-robin tenant selection
+	DequeueBurst int `json:"dequeue_burst"`
+	// 0 if the tenant's inflight requests are not limited, or the broker does not track inflight requests
+	MaxInflight     int           `json:"max_inflight"`
+	DispatchTimeout time.Duration `json:"dispatch_timeout"`
+	MinRequestAge   time.Duration `json:"min_request_age"`
+	// 0 unless the broker coalesces duplicate requests
+	CoalesceWindow time.Duration `json:"coalesce_window"`
+	// how long a querier of the tenant's shard may be disconnected before the tenant stops being sharded across it
+	ForgetDelay  time.Duration `json:"forget_delay"`
+	KeepWarm     bool          `json:"keep_warm"`
+	MaxQueueSize int           `json:"max_queue_size"`
+	// all 0 if the tenant has no error budget
+	ErrorBudget         int           `json:"error_budget"`
+	ErrorBudgetWindow   time.Duration `json:"error_budget_window"`
+	ErrorBudgetCooldown time.Duration `json:"error_budget_cooldown"`
+}
+
+// effectivePolicy returns the scheduling policy the tenant is scheduled with as of the current configuration
+// of the broker and of the tenant, whether or not the tenant has a queue. The request ordering and priority bands
+// of a tenant with a queue are those it will have once it is next updated by an enqueue.
+func (qb *queueBroker) effectivePolicy(tenantID TenantID) SchedulingPolicy {
+	tqa := &qb.tenantQuerierAssignments
+	cfg := tqa.tenantConfigs[tenantID]
+	policy := SchedulingPolicy{
+		RequestOrdering: qb.tenantRequestOrdering(&queueTenant{requestOrdering: cfg.RequestOrdering}),
+		PriorityBands:   qb.priorityBands,
+		Weight:          tqa.tenantSelectionWeight(tenantID),
+		Tier:            cfg.Tier,
+		DequeueBurst:    max(qb.tenantDequeueBurst(tenantID), 1),
+		DispatchTimeout: qb.dispatchTimeout(tenantID),
+		MinRequestAge:   cfg.MinRequestAge,
+		ForgetDelay:     tqa.querierForgetDelay,
+		KeepWarm:        qb.keepWarm(tenantID),
+		MaxQueueSize:    qb.maxTenantQueueSize,
+	}
+	if cfg.PriorityBands > 0 {
+		policy.PriorityBands = cfg.PriorityBands
+	}
+	if qb.trackInflight {
+		policy.MaxInflight = cfg.MaxInflight
+	}
+	if qb.dedupMode == dedupCoalesce {
+		policy.CoalesceWindow = cfg.CoalesceWindow
+	}
+	if cfg.ForgetDelay > 0 && cfg.ForgetDelay < tqa.querierForgetDelay && tqa.authoritativeQuerierIDs == nil {
+		policy.ForgetDelay = cfg.ForgetDelay
+	}
+	if cfg.ErrorBudget > 0 && cfg.ErrorBudgetWindow > 0 {
+		policy.ErrorBudget = cfg.ErrorBudget
+		policy.ErrorBudgetWindow = cfg.ErrorBudgetWindow
+		policy.ErrorBudgetCooldown = cfg.ErrorBudgetCooldown
+	}
+	return policy
+}
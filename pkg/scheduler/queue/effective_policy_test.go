@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_EffectivePolicy(t *testing.T) {
+	qb := newQueueBroker(100, time.Minute)
+	tqa := &qb.tenantQuerierAssignments
+	qb.requestOrdering = RequestOrderingFIFO
+	qb.defaultDispatchTimeout = 10 * time.Second
+	qb.tenantStickiness = 4
+	require.NoError(t, qb.setPriorityBands(3))
+
+	// a tenant without overrides gets the broker's defaults
+	assert.Equal(t, SchedulingPolicy{
+		RequestOrdering: RequestOrderingFIFO,
+		PriorityBands:   3,
+		Weight:          1,
+		DequeueBurst:    4,
+		DispatchTimeout: 10 * time.Second,
+		ForgetDelay:     time.Minute,
+		MaxQueueSize:    100,
+	}, qb.effectivePolicy("tenant-default"))
+
+	require.NoError(t, tqa.setTenantConfig("tenant-1", TenantConfig{
+		RequestOrdering: RequestOrderingLeastSlack,
+		Weight:          5,
+		Tier:            2,
+		MinRequestAge:   time.Second,
+		ForgetDelay:     10 * time.Second,
+		KeepWarm:        true,
+		// not enforced unless the broker tracks inflight requests and coalesces duplicates
+		MaxInflight:    3,
+		CoalesceWindow: time.Second,
+		// a budget without a window is disabled
+		ErrorBudget: 2,
+	}))
+	assert.Equal(t, SchedulingPolicy{
+		RequestOrdering: RequestOrderingLeastSlack,
+		PriorityBands:   3,
+		Weight:          5,
+		Tier:            2,
+		DequeueBurst:    4,
+		DispatchTimeout: 10 * time.Second,
+		MinRequestAge:   time.Second,
+		ForgetDelay:     10 * time.Second,
+		KeepWarm:        true,
+		MaxQueueSize:    100,
+	}, qb.effectivePolicy("tenant-1"))
+
+	// runtime changes of the broker and of the tenant are reflected
+	qb.trackInflight = true
+	qb.dedupMode = dedupCoalesce
+	qb.setForgetDelay(5 * time.Second)
+	require.NoError(t, qb.setPriorityBands(0))
+	applied, err := qb.casTenantConfig("tenant-1", tqa.tenantConfigs["tenant-1"], TenantConfig{
+		PriorityBands:       2,
+		DequeueBurst:        8,
+		DispatchTimeout:     time.Minute,
+		ForgetDelay:         10 * time.Second,
+		MaxInflight:         3,
+		CoalesceWindow:      time.Second,
+		ErrorBudget:         2,
+		ErrorBudgetWindow:   time.Minute,
+		ErrorBudgetCooldown: 30 * time.Second,
+	})
+	require.NoError(t, err)
+	require.True(t, applied)
+	assert.Equal(t, SchedulingPolicy{
+		RequestOrdering:     RequestOrderingFIFO,
+		PriorityBands:       2,
+		Weight:              1,
+		DequeueBurst:        8,
+		MaxInflight:         3,
+		DispatchTimeout:     time.Minute,
+		CoalesceWindow:      time.Second,
+		ForgetDelay:         5 * time.Second,
+		MaxQueueSize:        100,
+		ErrorBudget:         2,
+		ErrorBudgetWindow:   time.Minute,
+		ErrorBudgetCooldown: 30 * time.Second,
+	}, qb.effectivePolicy("tenant-1"))
+
+	// the default burst serves one request per turn
+	qb.tenantStickiness = 0
+	assert.Equal(t, 1, qb.effectivePolicy("tenant-default").DequeueBurst)
+}
@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// Enqueue backpressure lets the clients enqueuing requests, such as the query-frontends, know that a tenant's queue
+// is nearly full, so that they can hold back the tenant's further requests early rather than have them rejected
+// with ErrTooManyRequests once the queue is full.
+//
+// A tenant is under enqueue backpressure from when the length of its queue reaches the configured backpressure
+// queue length, until it drops to half of it. The broker tracks this apart from its tenant watermarks,
+// which remain available to other observers.
+
+// checkTenantEnqueueBackpressure notifies the observer when the tenant's queue depth reaches the broker's
+// enqueue backpressure queue length, and when it falls back to half of it.
+func (qb *queueBroker) checkTenantEnqueueBackpressure(tenant *queueTenant) {
+	if qb.enqueueBackpressureQueueLength <= 0 {
+		return
+	}
+
+	depth := qb.tenantDepth(tenant.tenantID)
+	switch {
+	case !tenant.underEnqueueBackpressure && depth >= qb.enqueueBackpressureQueueLength:
+		tenant.underEnqueueBackpressure = true
+	case tenant.underEnqueueBackpressure && depth <= qb.enqueueBackpressureQueueLength/2:
+		tenant.underEnqueueBackpressure = false
+	default:
+		return
+	}
+	if qb.observer.OnTenantEnqueueBackpressure != nil {
+		qb.observer.OnTenantEnqueueBackpressure(tenant.tenantID, tenant.underEnqueueBackpressure)
+	}
+}
+
+// configureEnqueueBackpressure sets the broker to track the tenants under enqueue backpressure.
+func (q *RequestQueue) configureEnqueueBackpressure(broker *queueBroker) {
+	if q.backpressureQueueLength <= 0 {
+		return
+	}
+	broker.enqueueBackpressureQueueLength = q.backpressureQueueLength
+	broker.observer.OnTenantEnqueueBackpressure = q.setTenantUnderBackpressure
+}
+
+func (q *RequestQueue) setTenantUnderBackpressure(tenantID TenantID, underBackpressure bool) {
+	q.backpressureMtx.Lock()
+	defer q.backpressureMtx.Unlock()
+
+	if underBackpressure {
+		q.tenantsUnderBackpressure[tenantID] = struct{}{}
+	} else {
+		delete(q.tenantsUnderBackpressure, tenantID)
+	}
+}
+
+// TenantUnderBackpressure returns true if the tenant's queue is nearly full, in which case the tenant's further
+// requests should be held back. Always returns false unless a backpressure queue length is configured.
+func (q *RequestQueue) TenantUnderBackpressure(tenantID string) bool {
+	q.backpressureMtx.RLock()
+	defer q.backpressureMtx.RUnlock()
+
+	_, ok := q.tenantsUnderBackpressure[TenantID(tenantID)]
+	return ok
+}
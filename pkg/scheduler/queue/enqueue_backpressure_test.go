@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestQueue_TenantUnderBackpressure(t *testing.T) {
+	for testName, backpressureQueueLength := range map[string]int{
+		"disabled": 0,
+		"enabled":  4,
+	} {
+		t.Run(testName, func(t *testing.T) {
+			queue := NewRequestQueue(log.NewNopLogger(), 10, 0,
+				promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+				promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+				promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+				RequestQueueOptions{BackpressureQueueLength: backpressureQueueLength})
+
+			ctx := context.Background()
+			require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+			t.Cleanup(func() {
+				require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+			})
+
+			underBackpressure := func() bool {
+				return queue.TenantUnderBackpressure("user-1")
+			}
+
+			for i := 0; i < 4; i++ {
+				assert.False(t, underBackpressure(), "queue length %d", i)
+				require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", fmt.Sprintf("req-%d", i), 0, 1, nil))
+			}
+			require.NoError(t, queue.EnqueueRequestToDispatcher("user-2", "req", 0, 1, nil))
+			assert.Equal(t, backpressureQueueLength > 0, underBackpressure())
+			assert.False(t, queue.TenantUnderBackpressure("user-2"))
+
+			queue.RegisterQuerierConnection("querier-1")
+			t.Cleanup(func() {
+				queue.UnregisterQuerierConnection("querier-1")
+			})
+
+			// the backpressure is lifted once the queue length drops to half the backpressure queue length
+			last := FirstUser()
+			dequeue := func() {
+				var err error
+				_, last, err = queue.GetNextRequestForQuerier(ctx, last, "querier-1", "")
+				require.NoError(t, err)
+			}
+			dequeue() // user-1, 3 queued
+			dequeue() // user-2
+			assert.Equal(t, backpressureQueueLength > 0, underBackpressure())
+			dequeue() // user-1, 2 queued
+			assert.False(t, underBackpressure())
+			dequeue()
+			dequeue()
+		})
+	}
+}
+
+func TestQueues_EnqueueBackpressureIsTrackedApartFromWatermarks(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.tenantHighWatermark = 2
+	qb.tenantLowWatermark = 1
+	qb.enqueueBackpressureQueueLength = 4
+	qb.addQuerierConnection("querier-1")
+
+	var watermarks []string
+	qb.observer.OnTenantHighWatermark = func(_ TenantID, depth int) {
+		watermarks = append(watermarks, fmt.Sprintf("high %d", depth))
+	}
+	qb.observer.OnTenantLowWatermark = func(_ TenantID, depth int) {
+		watermarks = append(watermarks, fmt.Sprintf("low %d", depth))
+	}
+	var backpressure []bool
+	qb.observer.OnTenantEnqueueBackpressure = func(_ TenantID, underBackpressure bool) {
+		backpressure = append(backpressure, underBackpressure)
+	}
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: fmt.Sprintf("req-%d", i)}, 0))
+	}
+	assert.Equal(t, []string{"high 2"}, watermarks)
+	assert.Equal(t, []bool{true}, backpressure)
+	assert.Equal(t, 4, qb.config().EnqueueBackpressureQueueLength)
+
+	for i := 0; i < 3; i++ {
+		_, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"high 2", "low 1"}, watermarks)
+	assert.Equal(t, []bool{true, false}, backpressure)
+}
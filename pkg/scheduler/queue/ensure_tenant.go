@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// ensureTenant creates the tenant, or updates its max queriers, without enqueuing a request,
+// so that the tenant's querier shard is computed ahead of its first enqueue.
+//
+// A tenant created without queued requests is treated as if its queue had just been emptied:
+// it is removed once the tenant removal grace period passes, or right away with eager removal,
+// unless the tenant is configured with KeepWarm.
+func (qb *queueBroker) ensureTenant(tenantID TenantID, maxQueriers int) error {
+	if err := qb.tenantQuerierAssignments.createOrUpdateTenant(tenantID, maxQueriers); err != nil {
+		return err
+	}
+
+	tenant := qb.tenantQuerierAssignments.tenantsByID[tenantID]
+	if tenant.emptySince.IsZero() && qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}) == nil {
+		tenant.emptySince = qb.clock.Now()
+	}
+	return nil
+}
+
+// keepWarm returns true if the tenant is configured to be retained while its queue is empty.
+func (qb *queueBroker) keepWarm(tenantID TenantID) bool {
+	return qb.tenantQuerierAssignments.tenantConfigs[tenantID].KeepWarm
+}
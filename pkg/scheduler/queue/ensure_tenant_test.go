@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_EnsureTenant(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3"} {
+		qb.addQuerierConnection(querierID)
+	}
+
+	assert.ErrorIs(t, qb.ensureTenant(emptyTenantID, 0), ErrInvalidTenantID)
+
+	require.NoError(t, qb.ensureTenant("tenant-1", 2))
+	assert.Len(t, qb.tenantQuerierAssignments.tenantQuerierIDs["tenant-1"], 2)
+	assert.True(t, qb.isEmpty())
+	assert.NoError(t, isConsistent(qb))
+
+	// the first enqueue does not compute the shard again
+	shuffles := qb.tenantQuerierAssignments.tenantShuffles
+	shard := qb.tenantQuerierAssignments.tenantQuerierIDs["tenant-1"]
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 2))
+	assert.Equal(t, shuffles, qb.tenantQuerierAssignments.tenantShuffles)
+	assert.Equal(t, shard, qb.tenantQuerierAssignments.tenantQuerierIDs["tenant-1"])
+	assert.NoError(t, isConsistent(qb))
+
+	// ensuring a tenant with queued requests does not mark it as empty
+	require.NoError(t, qb.ensureTenant("tenant-1", 2))
+	assert.True(t, qb.tenantQuerierAssignments.tenantsByID["tenant-1"].emptySince.IsZero())
+}
+
+func TestQueues_EnsureTenant_Cleanup(t *testing.T) {
+	tests := map[string]struct {
+		policy          tenantRemovalPolicy
+		keepWarm        bool
+		expectedRemoved []bool // after 0s, after 30s, after 2m
+	}{
+		"eager removal": {
+			policy:          tenantRemovalEager,
+			expectedRemoved: []bool{true, true, true},
+		},
+		"lazy removal": {
+			policy:          tenantRemovalLazy,
+			expectedRemoved: []bool{false, false, true},
+		},
+		"eager removal, kept warm": {
+			policy:          tenantRemovalEager,
+			keepWarm:        true,
+			expectedRemoved: []bool{false, false, false},
+		},
+		"lazy removal, kept warm": {
+			policy:          tenantRemovalLazy,
+			keepWarm:        true,
+			expectedRemoved: []bool{false, false, false},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			clk := newManualClock()
+			qb := newQueueBroker(100, 0)
+			qb.clock = clk
+			qb.tenantRemovalPolicy = testData.policy
+			if testData.policy == tenantRemovalLazy {
+				qb.tenantRemovalGracePeriod = time.Minute
+			}
+			require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-1", TenantConfig{KeepWarm: testData.keepWarm}))
+			require.NoError(t, qb.ensureTenant("tenant-1", 0))
+
+			for i, advance := range []time.Duration{0, 30 * time.Second, 90 * time.Second} {
+				clk.Advance(advance)
+				qb.removeIdleTenants(clk.Now())
+				_, exists := qb.tenantQuerierAssignments.tenantsByID["tenant-1"]
+				assert.Equal(t, testData.expectedRemoved[i], !exists, "check %d", i)
+			}
+			assert.NoError(t, isConsistent(qb))
+		})
+	}
+}
+
+func TestQueues_KeepWarmRetainsEmptiedTenant(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-1", TenantConfig{KeepWarm: true}))
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 0))
+	dequeueN(t, qb, "querier-1", 1)
+
+	assert.True(t, qb.isEmpty())
+	assert.Contains(t, qb.tenantQuerierAssignments.tenantsByID, TenantID("tenant-1"))
+	assert.Zero(t, qb.removeIdleTenants(time.Now().Add(time.Hour)))
+	assert.NoError(t, isConsistent(qb))
+}
@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// A tenant configured with an error budget may have ErrorBudget of its requests re-enqueued after a failed dispatch
+// within any ErrorBudgetWindow. The failure which exceeds the budget pauses the dispatch of the tenant's requests
+// for ErrorBudgetCooldown, as a circuit breaker for tenants whose requests keep failing, after which the tenant
+// resumes with a fresh budget. A paused tenant still accepts enqueues.
+
+type tenantErrorBudget struct {
+	// times of the failures within the window, oldest first
+	failures []time.Time
+	// the tenant's requests are not dispatched before this time
+	pausedUntil time.Time
+}
+
+// spendErrorBudget counts a failed dispatch of the tenant's requests against its error budget,
+// and pauses the tenant if the failure exhausts it.
+func (qb *queueBroker) spendErrorBudget(tenantID TenantID, now time.Time) {
+	cfg := qb.tenantQuerierAssignments.tenantConfigs[tenantID]
+	if cfg.ErrorBudget <= 0 || cfg.ErrorBudgetWindow <= 0 {
+		return
+	}
+	budget := qb.errorBudgets[tenantID]
+	if budget == nil {
+		budget = &tenantErrorBudget{}
+		if qb.errorBudgets == nil {
+			qb.errorBudgets = map[TenantID]*tenantErrorBudget{}
+		}
+		qb.errorBudgets[tenantID] = budget
+	}
+	if now.Before(budget.pausedUntil) {
+		// failures of requests dispatched before the pause do not extend it
+		return
+	}
+
+	cutoff := now.Add(-cfg.ErrorBudgetWindow)
+	i := 0
+	for i < len(budget.failures) && !budget.failures[i].After(cutoff) {
+		i++
+	}
+	budget.failures = append(budget.failures[i:], now)
+	if len(budget.failures) <= cfg.ErrorBudget {
+		return
+	}
+
+	budget.failures = nil
+	budget.pausedUntil = now.Add(cfg.ErrorBudgetCooldown)
+	qb.observer.tenantErrorBudgetExhausted(tenantID, budget.pausedUntil)
+}
+
+// tenantPausedByErrorBudget returns true if the tenant exhausted its error budget and its cooldown has not elapsed yet.
+func (qb *queueBroker) tenantPausedByErrorBudget(tenantID TenantID, now time.Time) bool {
+	budget := qb.errorBudgets[tenantID]
+	return budget != nil && now.Before(budget.pausedUntil)
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ErrorBudget(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-1", TenantConfig{
+		ErrorBudget:         2,
+		ErrorBudgetWindow:   time.Minute,
+		ErrorBudgetCooldown: 30 * time.Second,
+	}))
+	var exhausted []time.Time
+	qb.observer.OnTenantErrorBudgetExhausted = func(tenantID TenantID, pausedUntil time.Time) {
+		assert.Equal(t, TenantID("tenant-1"), tenantID)
+		exhausted = append(exhausted, pausedUntil)
+	}
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r"}, 0))
+
+	fail := func() {
+		request, tenant, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+		require.NoError(t, err)
+		require.Equal(t, TenantID("tenant-1"), tenant.tenantID)
+		require.NoError(t, qb.enqueueRequestFront(request, 0))
+	}
+
+	// failures within the budget do not pause the tenant
+	fail()
+	clk.Advance(10 * time.Second)
+	fail()
+	assert.Empty(t, exhausted)
+
+	// the failure which exceeds the budget pauses the tenant for the cooldown
+	clk.Advance(10 * time.Second)
+	fail()
+	assert.Equal(t, []time.Time{clk.Now().Add(30 * time.Second)}, exhausted)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "other"}, 0))
+	request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Equal(t, "other", request.req)
+	request, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Nil(t, request)
+	assert.Equal(t, []TenantStatus{{TenantID: "tenant-1", State: TenantPaused, Depth: 1}}, qb.tenantDirectory())
+
+	// the tenant resumes with a fresh budget after the cooldown
+	clk.Advance(30 * time.Second)
+	fail()
+	fail()
+	assert.Len(t, exhausted, 1)
+	request, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Equal(t, "r", request.req)
+}
+
+func TestQueues_ErrorBudget_Window(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-1", TenantConfig{
+		ErrorBudget:         1,
+		ErrorBudgetWindow:   time.Minute,
+		ErrorBudgetCooldown: time.Minute,
+	}))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r"}, 0))
+
+	// failures further apart than the window never exhaust the budget
+	for i := 0; i < 5; i++ {
+		request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+		require.NoError(t, err)
+		require.NotNil(t, request)
+		require.NoError(t, qb.enqueueRequestFront(request, 0))
+		clk.Advance(time.Minute)
+	}
+	assert.False(t, qb.tenantPausedByErrorBudget("tenant-1", clk.Now()))
+	assert.Len(t, qb.errorBudgets["tenant-1"].failures, 1)
+}
+
+func TestQueues_ErrorBudget_Disabled(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r"}, 0))
+	for i := 0; i < 10; i++ {
+		request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+		require.NoError(t, err)
+		require.NotNil(t, request)
+		require.NoError(t, qb.enqueueRequestFront(request, 0))
+	}
+	assert.Nil(t, qb.errorBudgets)
+}
@@ -0,0 +1,267 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// Under fair queuing tenant selection, the broker keeps start-time fair queuing tags: a tenant's finish tag
+// advances by the inverse of its weight whenever a request is dispatched from it, and a querier is served
+// the eligible tenant with the lowest start tag, the greater of its finish tag and the virtual time, which is
+// the start tag of the last dispatched request. Tenants which go idle fall behind the virtual time and do not
+// accumulate credit.
+//
+// Exact finish tags cost memory proportional to the number of tenants. Beyond fairQueuingExactTenants tenants,
+// tenants are hashed into a fixed number of slots, which hold the finish tags instead, as in stochastic fair queuing.
+// Tenants sharing a slot share its tag and are rotated through in tenant order; so that a slot shared by several
+// tenants with queued requests is not served as a single tenant, a dispatch advances the tag of the slot by the
+// inverse of the number of eligible tenants of the slot as well. Memory stays fixed whatever the number
+// of tenants, at the cost of approximate fairness between tenants whose weights or eligibility differ
+// within a slot.
+
+const (
+	// default number of hashed slots holding the finish tags of tenants beyond fairQueuingExactTenants tenants
+	defaultFairQueuingSlots = 4096
+	// default number of tenants up to which exact finish tags are kept
+	defaultFairQueuingExactTenants = 10000
+)
+
+// fairQueuingTags holds the tags of fair queuing tenant selection.
+type fairQueuingTags struct {
+	// start tag of the last dispatched request
+	virtualTime float64
+	// exact finish tags of the tenants; nil while the finish tags are approximated
+	finishTags map[TenantID]float64
+	// finish tags of the hashed slots of tenants, and the tenant order index of the tenant of each slot
+	// last dispatched from; nil while the finish tags are exact
+	slots       []float64
+	slotCursors []int
+
+	// tenant last selected by getFairQueuingTenantWithRequestsForQuerier, and the number of eligible tenants
+	// of its slot, which the tag of the slot is advanced by when a request is dispatched from the tenant
+	selectedTenantID TenantID
+	selectedSharers  int
+
+	// scratch buffers of getFairQueuingTenantWithRequestsForQuerier: the eligible tenants, and the tenant
+	// of each slot with eligible tenants to consider while the finish tags are approximated
+	candidates       []*queueTenant
+	candidatesBySlot map[int]fairQueuingSlotCandidate
+}
+
+// fairQueuingSlotCandidate is the tenant to consider for a slot of eligible tenants, the rank of the tenant
+// in the tenant order rotated to start after the tenant of the slot last dispatched from, and the number
+// of eligible tenants of the slot.
+type fairQueuingSlotCandidate struct {
+	tenant  *queueTenant
+	rank    int
+	sharers int
+}
+
+// fairQueuingApproximate returns true if the broker has too many tenants to keep their exact finish tags.
+func (qb *queueBroker) fairQueuingApproximate() bool {
+	exactTenants := qb.fairQueuingExactTenants
+	if exactTenants <= 0 {
+		exactTenants = defaultFairQueuingExactTenants
+	}
+	return len(qb.tenantQuerierAssignments.tenantsByID) > exactTenants
+}
+
+func (qb *queueBroker) fairQueuingSlotCount() int {
+	if qb.fairQueuingSlots > 0 {
+		return qb.fairQueuingSlots
+	}
+	return defaultFairQueuingSlots
+}
+
+// fairQueuingSlot returns the index of the tenant's slot among the given number of hashed slots.
+func fairQueuingSlot(tenantID TenantID, slots int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(tenantID))
+	// the low bits of FNV hashes of similar tenant IDs are correlated, so they are mixed before reducing the hash
+	slot, _ := bits.Mul64(h.Sum64()*0x9e3779b97f4a7c15, uint64(slots))
+	return int(slot)
+}
+
+// fairQueuingStartTag returns the start tag of the tenant's next request.
+func (qb *queueBroker) fairQueuingStartTag(tenantID TenantID) float64 {
+	tags := &qb.fairQueuing
+	finishTag := tags.finishTags[tenantID]
+	if tags.slots != nil {
+		finishTag = tags.slots[fairQueuingSlot(tenantID, len(tags.slots))]
+	}
+	return math.Max(finishTag, tags.virtualTime)
+}
+
+// chargeFairQueuing advances the tags for a request dispatched from the tenant under fair queuing tenant selection.
+func (qb *queueBroker) chargeFairQueuing(tenantID TenantID) {
+	if qb.tenantSelection != tenantSelectionFairQueuing {
+		return
+	}
+	qb.syncFairQueuingMode()
+
+	tags := &qb.fairQueuing
+	start := qb.fairQueuingStartTag(tenantID)
+	cost := 1 / float64(qb.tenantQuerierAssignments.tenantSelectionWeight(tenantID))
+	tags.virtualTime = start
+	if tags.slots != nil {
+		if tags.selectedTenantID == tenantID && tags.selectedSharers > 1 {
+			cost /= float64(tags.selectedSharers)
+		}
+		slot := fairQueuingSlot(tenantID, len(tags.slots))
+		tags.slots[slot] = start + cost
+		if tenant := qb.tenantQuerierAssignments.tenantsByID[tenantID]; tenant != nil {
+			tags.slotCursors[slot] = tenant.orderIndex
+		}
+		return
+	}
+
+	tags.finishTags[tenantID] = start + cost
+	if tenantsByID := qb.tenantQuerierAssignments.tenantsByID; len(tags.finishTags) > len(tenantsByID) {
+		// finish tags behind the virtual time are equivalent to none, and removed tenants start over
+		for id, tag := range tags.finishTags {
+			if _, ok := tenantsByID[id]; !ok || tag <= tags.virtualTime {
+				delete(tags.finishTags, id)
+			}
+		}
+	}
+}
+
+// syncFairQueuingMode switches between exact and approximate finish tags as the number of tenants crosses
+// fairQueuingExactTenants. All tenants start over from the virtual time when switching.
+func (qb *queueBroker) syncFairQueuingMode() {
+	tags := &qb.fairQueuing
+	if !qb.fairQueuingApproximate() {
+		if tags.finishTags == nil {
+			tags.finishTags = map[TenantID]float64{}
+			tags.slots, tags.slotCursors = nil, nil
+		}
+		return
+	}
+	if len(tags.slots) != qb.fairQueuingSlotCount() {
+		tags.slots = make([]float64, qb.fairQueuingSlotCount())
+		tags.slotCursors = make([]int, len(tags.slots))
+		for slot := range tags.slotCursors {
+			tags.slotCursors[slot] = -1
+		}
+		tags.finishTags = nil
+	}
+}
+
+// getFairQueuingTenantWithRequestsForQuerier picks the tenant with queued requests which the querier can handle
+// with the lowest start tag. Among tenants with the same start tag, the first one after lastTenantIndex
+// in the tenant order is picked, so that tenants are rotated through as under round-robin selection.
+// While the finish tags are approximated, the eligible tenants of each slot are rotated through in tenant order
+// from the tenant of the slot last dispatched from.
+//
+// As under round-robin selection, the tenants the querier can handle are visited through the querier to tenant
+// reverse index rather than by scanning the tenant order when it is cheaper, and a querier none of whose tenants
+// has queued requests is told so without visiting any tenant.
+//
+// The returned tenant index is the tenant's index in the tenant order, so that a querier can move
+// between selection strategies without skipping tenants.
+func (qb *queueBroker) getFairQueuingTenantWithRequestsForQuerier(lastTenantIndex int, querierID QuerierID) (*queueTenant, int, error) {
+	tqa := &qb.tenantQuerierAssignments
+	if q := tqa.queriersByID[querierID]; q == nil || q.shuttingDown {
+		return nil, lastTenantIndex, ErrQuerierShuttingDown
+	}
+	if tqa.idleQuerierFastPath && tqa.querierHasNoQueuedRequests(querierID) {
+		return nil, lastTenantIndex, nil
+	}
+
+	tags := &qb.fairQueuing
+	// the scratch buffers are reused across calls, so that selecting a tenant does not allocate
+	tags.candidates = tags.candidates[:0]
+	if tags.slots != nil {
+		if tags.candidatesBySlot == nil {
+			tags.candidatesBySlot = map[int]fairQueuingSlotCandidate{}
+		}
+		clear(tags.candidatesBySlot)
+	}
+	orderLen := len(tqa.tenantIDOrder)
+	// rank returns the position of the tenant order index in the tenant order rotated to start after the given index
+	rank := func(orderIndex, after int) int {
+		if orderIndex <= after {
+			return orderIndex + orderLen
+		}
+		return orderIndex
+	}
+	visit := func(tenant *queueTenant) {
+		if qb.tenantQueuesTree.getNode(QueuePath{string(tenant.tenantID)}) == nil {
+			tqa.traceSkip(tenant.tenantID, SkipEmpty)
+			qb.removeTenantIfIdleExpired(tenant, qb.clock.Now())
+			return
+		}
+		if cause := qb.tenantDispatchBlocker(tenant.tenantID, querierID); cause != "" {
+			tqa.traceSkip(tenant.tenantID, cause)
+			return
+		}
+		tags.candidates = append(tags.candidates, tenant)
+
+		if tags.slots != nil {
+			slot := fairQueuingSlot(tenant.tenantID, len(tags.slots))
+			sharerRank := rank(tenant.orderIndex, tags.slotCursors[slot])
+			c, ok := tags.candidatesBySlot[slot]
+			if !ok {
+				c = fairQueuingSlotCandidate{tenant: tenant, rank: sharerRank}
+			} else if sharerRank < c.rank {
+				c.tenant, c.rank = tenant, sharerRank
+			}
+			c.sharers++
+			tags.candidatesBySlot[slot] = c
+		}
+	}
+
+	if tqa.dequeueTrace == nil && tqa.useQuerierTenantIndex(querierID) {
+		// tenants removed during the visit are deleted from the index, which is safe while ranging over it
+		for tenantID := range tqa.querierTenantIDs[querierID] {
+			visit(tqa.tenantsByID[tenantID])
+		}
+		for tenantID := range tqa.unshardedTenantIDs {
+			visit(tqa.tenantsByID[tenantID])
+		}
+	} else {
+		// tenants removed during the scan only shrink the tenant order behind the current index
+		for i := 0; i < len(tqa.tenantIDOrder); i++ {
+			tenantID := tqa.tenantIDOrder[i]
+			if tenantID == emptyTenantID {
+				continue
+			}
+			if tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]; tenantQuerierSet != nil {
+				if _, ok := tenantQuerierSet[querierID]; !ok {
+					tqa.traceSkip(tenantID, SkipNotInShard)
+					continue
+				}
+			}
+			visit(tqa.tenantsByID[tenantID])
+		}
+	}
+
+	var selected *queueTenant
+	var selectedTag float64
+	selectedRank, selectedSharers := 0, 1
+	consider := func(tenant *queueTenant, sharers int) {
+		tag, r := qb.fairQueuingStartTag(tenant.tenantID), rank(tenant.orderIndex, lastTenantIndex)
+		if selected == nil || tag < selectedTag || (tag == selectedTag && r < selectedRank) {
+			selected, selectedTag, selectedRank, selectedSharers = tenant, tag, r, sharers
+		}
+	}
+	if tags.slots != nil {
+		for _, c := range tags.candidatesBySlot {
+			consider(c.tenant, c.sharers)
+		}
+	} else {
+		for _, tenant := range tags.candidates {
+			consider(tenant, 1)
+		}
+	}
+	if selected == nil {
+		return nil, lastTenantIndex, nil
+	}
+
+	tags.selectedTenantID, tags.selectedSharers = selected.tenantID, selectedSharers
+	tqa.traceNotSelected(tags.candidates, selected)
+	return selected, selected.orderIndex, nil
+}
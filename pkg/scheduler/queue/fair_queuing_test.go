@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jainIndex computes Jain's fairness index of the numbers of requests the tenants were served.
+func jainIndex(served map[TenantID]int) float64 {
+	var sum, sumOfSquares float64
+	for _, n := range served {
+		sum += float64(n)
+		sumOfSquares += float64(n) * float64(n)
+	}
+	return (sum * sum) / (float64(len(served)) * sumOfSquares)
+}
+
+func TestQueues_FairQueuing_ApproximateVsExact(t *testing.T) {
+	const (
+		numTenants     = 500
+		servedByTenant = 3
+	)
+
+	serve := func(t *testing.T, exactTenants int) (*queueBroker, map[TenantID]int) {
+		qb := newQueueBroker(100, 0)
+		qb.tenantSelection = tenantSelectionFairQueuing
+		qb.fairQueuingSlots = 64
+		qb.fairQueuingExactTenants = exactTenants
+		require.NoError(t, qb.addQuerierConnection("querier-1"))
+		// requests of the first tenants are enqueued first, and the last tenants have deeper backlogs
+		for i := 0; i < 2*servedByTenant; i++ {
+			for tenant := 0; tenant < numTenants; tenant++ {
+				if i < servedByTenant || tenant >= numTenants/2 {
+					require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", tenant)), req: i}, 0))
+				}
+			}
+		}
+
+		served := map[TenantID]int{}
+		for _, request := range dequeueN(t, qb, "querier-1", numTenants*servedByTenant) {
+			served[request.tenantID]++
+		}
+		return qb, served
+	}
+
+	qb, exact := serve(t, numTenants)
+	assert.Nil(t, qb.fairQueuing.slots)
+	assert.InDelta(t, 1.0, jainIndex(exact), 1e-9)
+
+	qb, approximate := serve(t, 1)
+	assert.Nil(t, qb.fairQueuing.finishTags)
+	assert.Len(t, qb.fairQueuing.slots, 64)
+	// hashed slots shared by several tenants degrade fairness, within a tolerance
+	assert.Equal(t, numTenants, len(approximate))
+	assert.InDelta(t, 1.0, jainIndex(approximate), 0.05)
+}
+
+func TestQueues_FairQueuing_ExactBelowThreshold(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.tenantSelection = tenantSelectionFairQueuing
+	qb.fairQueuingExactTenants = 4
+	require.NoError(t, qb.addQuerierConnection("querier-1"))
+	enqueue := func(numTenants int) {
+		for tenant := 0; tenant < numTenants; tenant++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", tenant)), req: tenant}, 0))
+		}
+	}
+
+	enqueue(4)
+	dequeueN(t, qb, "querier-1", 1)
+	assert.NotNil(t, qb.fairQueuing.finishTags)
+	assert.Nil(t, qb.fairQueuing.slots)
+
+	// the finish tags are approximated while the broker has more tenants than the threshold
+	enqueue(8)
+	dequeueN(t, qb, "querier-1", 1)
+	assert.Nil(t, qb.fairQueuing.finishTags)
+	assert.NotNil(t, qb.fairQueuing.slots)
+
+	// and exact again once the number of tenants falls back below it
+	dequeueN(t, qb, "querier-1", 8)
+	assert.LessOrEqual(t, len(qb.tenantQuerierAssignments.tenantsByID), 4)
+	dequeueN(t, qb, "querier-1", 1)
+	assert.NotNil(t, qb.fairQueuing.finishTags)
+	assert.Nil(t, qb.fairQueuing.slots)
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_FairQueuing_Weights(t *testing.T) {
+	qb := newQueueBroker(1000, 0)
+	qb.tenantSelection = tenantSelectionFairQueuing
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-heavy", TenantConfig{Weight: 3}))
+	require.NoError(t, qb.addQuerierConnection("querier-1"))
+	for i := 0; i < 100; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-light", req: i}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-heavy", req: i}, 0))
+	}
+
+	served := map[TenantID]int{}
+	for _, request := range dequeueN(t, qb, "querier-1", 80) {
+		served[request.tenantID]++
+	}
+	assert.Equal(t, map[TenantID]int{"tenant-light": 20, "tenant-heavy": 60}, served)
+}
+
+func TestQueues_FairQueuing_IdleTenantDoesNotAccumulateCredit(t *testing.T) {
+	qb := newQueueBroker(1000, 0)
+	qb.tenantSelection = tenantSelectionFairQueuing
+	require.NoError(t, qb.addQuerierConnection("querier-1"))
+	for i := 0; i < 50; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-busy", req: i}, 0))
+	}
+	dequeueN(t, qb, "querier-1", 20)
+
+	// a tenant arriving after the busy tenant was served alone shares the querier with it from then on
+	for i := 0; i < 10; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-new", req: i}, 0))
+	}
+	served := map[TenantID]int{}
+	for _, request := range dequeueN(t, qb, "querier-1", 10) {
+		served[request.tenantID]++
+	}
+	assert.Equal(t, map[TenantID]int{"tenant-busy": 5, "tenant-new": 5}, served)
+}
+
+func TestQueues_FairQueuing_QuerierTenantIndex(t *testing.T) {
+	for name, exactTenants := range map[string]int{"exact": 0, "approximate": 1} {
+		t.Run(name, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.tenantSelection = tenantSelectionFairQueuing
+			qb.fairQueuingSlots = 16
+			qb.fairQueuingExactTenants = exactTenants
+			tqa := &qb.tenantQuerierAssignments
+			for querier := 0; querier < 16; querier++ {
+				require.NoError(t, qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", querier))))
+			}
+			for tenant := 0; tenant < 200; tenant++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", tenant)), req: tenant}, 1))
+			}
+			// serve a few requests, so that the tenants have different tags
+			for i := 0; i < 20; i++ {
+				_, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+				require.NoError(t, err)
+			}
+			qb.syncFairQueuingMode()
+			require.True(t, tqa.useQuerierTenantIndex("querier-1"))
+
+			for lastTenantIndex := -1; lastTenantIndex < 200; lastTenantIndex += 20 {
+				indexed, indexedIndex, err := qb.getFairQueuingTenantWithRequestsForQuerier(lastTenantIndex, "querier-1")
+				require.NoError(t, err)
+
+				// a dequeue trace disables the index
+				tqa.dequeueTrace = &[]SkipReason{}
+				scanned, scannedIndex, err := qb.getFairQueuingTenantWithRequestsForQuerier(lastTenantIndex, "querier-1")
+				tqa.dequeueTrace = nil
+				require.NoError(t, err)
+
+				assert.Equal(t, scanned, indexed)
+				assert.Equal(t, scannedIndex, indexedIndex)
+			}
+
+			allocs := testing.AllocsPerRun(10, func() {
+				_, _, _ = qb.getFairQueuingTenantWithRequestsForQuerier(-1, "querier-1")
+			})
+			assert.Zero(t, allocs)
+		})
+	}
+}
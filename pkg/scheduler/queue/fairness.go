@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// fairnessIndex computes Jain's fairness index over the per-tenant dequeue counts
+// within the recent service window: (Σx)² / (n·Σx²) for n tenants served x requests each.
+//
+// Tenants which currently have queued requests but were not served within the window are included with x=0.
+// The index ranges from 1/n when a single tenant was served, to 1 when all tenants were served equally.
+// Returns 1 if recent service tracking is disabled or there is nothing to compare.
+func (qb *queueBroker) fairnessIndex() float64 {
+	if qb.recentDequeues == nil {
+		return 1
+	}
+
+	served := qb.recentDequeues.counts(qb.clock.Now())
+	for tenantID := range qb.tenantQuerierAssignments.tenantsByID {
+		if _, ok := served[tenantID]; !ok && qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}) != nil {
+			served[tenantID] = 0
+		}
+	}
+
+	var sum, sumOfSquares float64
+	for _, n := range served {
+		sum += float64(n)
+		sumOfSquares += float64(n) * float64(n)
+	}
+	if sumOfSquares == 0 {
+		return 1
+	}
+	return (sum * sum) / (float64(len(served)) * sumOfSquares)
+}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_FairnessIndex(t *testing.T) {
+	const numTenants = 4
+
+	newBroker := func() (*queueBroker, *manualClock) {
+		clk := newManualClock()
+		qb := newQueueBroker(1000, 0)
+		qb.clock = clk
+		qb.recentDequeues = newWindowedTenantCounter(time.Minute, 6)
+		qb.addQuerierConnection("querier-1")
+		return qb, clk
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		qb := newQueueBroker(100, 0)
+		assert.Equal(t, 1.0, qb.fairnessIndex())
+	})
+
+	t.Run("perfectly fair service", func(t *testing.T) {
+		qb, _ := newBroker()
+		for i := 0; i < 10; i++ {
+			for tenant := 0; tenant < numTenants; tenant++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", tenant)), req: i}, 0))
+			}
+		}
+		dequeueN(t, qb, "querier-1", 40)
+		assert.InDelta(t, 1.0, qb.fairnessIndex(), 1e-9)
+	})
+
+	t.Run("heavily skewed service", func(t *testing.T) {
+		qb, _ := newBroker()
+		// only tenant-0 has been served, while other tenants are waiting
+		for i := 0; i < 20; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: i}, 0))
+		}
+		dequeueN(t, qb, "querier-1", 10)
+		for tenant := 1; tenant < numTenants; tenant++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", tenant)), req: "waiting"}, 0))
+		}
+		assert.InDelta(t, 1.0/numTenants, qb.fairnessIndex(), 1e-9)
+	})
+
+	t.Run("service outside the window is not considered", func(t *testing.T) {
+		qb, clk := newBroker()
+		for i := 0; i < 10; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: i}, 0))
+		}
+		dequeueN(t, qb, "querier-1", 10)
+		clk.Advance(2 * time.Minute)
+
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "a"}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "b"}, 0))
+		dequeueN(t, qb, "querier-1", 2)
+		assert.InDelta(t, 1.0, qb.fairnessIndex(), 1e-9)
+	})
+}
+
+// dequeueN dequeues n requests for the querier, rotating through tenants as a querier would.
+func dequeueN(t *testing.T, qb *queueBroker, querierID QuerierID, n int) []*tenantRequest {
+	var dequeued []*tenantRequest
+	lastTenantIndex := -1
+	for i := 0; i < n; i++ {
+		req, _, idx, err := qb.dequeueRequestForQuerier(lastTenantIndex, querierID)
+		require.NoError(t, err)
+		require.NotNil(t, req)
+		lastTenantIndex = idx
+		dequeued = append(dequeued, req)
+	}
+	return dequeued
+}
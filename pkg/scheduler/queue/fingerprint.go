@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// stateFingerprint returns a hash of the tenants, queriers and queued requests of the broker.
+// Brokers with the same fingerprint have the same scheduling state, regardless of the request payloads.
+func (qb *queueBroker) stateFingerprint() uint64 {
+	tqa := &qb.tenantQuerierAssignments
+	h := fnv.New64a()
+
+	fmt.Fprintf(h, "order %v\n", tqa.tenantIDOrder)
+
+	tenantIDs := make([]TenantID, 0, len(tqa.tenantsByID))
+	for tenantID := range tqa.tenantsByID {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Slice(tenantIDs, func(i, j int) bool { return tenantIDs[i] < tenantIDs[j] })
+	for _, tenantID := range tenantIDs {
+		tenant := tqa.tenantsByID[tenantID]
+		querierIDs := make(querierIDSlice, 0, len(tqa.tenantQuerierIDs[tenantID]))
+		for querierID := range tqa.tenantQuerierIDs[tenantID] {
+			querierIDs = append(querierIDs, querierID)
+		}
+		sort.Sort(querierIDs)
+		fmt.Fprintf(h, "tenant %s %d %d %v %d %d\n", tenantID, tenant.orderIndex, tenant.maxQueriers, querierIDs, tenant.emptySince.UnixNano(), tenant.nextSeq)
+		qb.visitTenantRequests(tenantID, func(request *tenantRequest) bool {
+			fmt.Fprintf(h, "request %d %d %q %d %d\n", request.seq, request.priority, request.key, request.payloadBytes, request.enqueueTime.UnixNano())
+			return true
+		})
+	}
+
+	fmt.Fprintf(h, "queriers %v\n", tqa.querierIDsSorted)
+	for _, querierID := range tqa.querierIDsSorted {
+		if querier := tqa.queriersByID[querierID]; querier != nil {
+			fmt.Fprintf(h, "querier %s %d %v %d %d\n", querierID, querier.connections, querier.shuttingDown, querier.disconnectedAt.UnixNano(), querier.lastDequeueAt.UnixNano())
+		}
+	}
+	return h.Sum64()
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+type frozenEnqueuePolicy int
+
+const (
+	// frozenEnqueueBuffer holds the enqueues to a frozen tenant aside, and applies them in order when it is unfrozen.
+	frozenEnqueueBuffer frozenEnqueuePolicy = iota
+	// frozenEnqueueReject rejects the enqueues to a frozen tenant with ErrTenantFrozen.
+	// Requests re-enqueued to the front are buffered regardless, as they have already been accepted.
+	frozenEnqueueReject
+)
+
+// frozenEnqueue is an enqueue to a frozen tenant, held aside until the tenant is unfrozen.
+type frozenEnqueue struct {
+	request     *tenantRequest
+	maxQueriers int
+	front       bool
+}
+
+// freezeTenant freezes the tenant's queue for inspection: no request is enqueued to or dequeued from it,
+// nor evicted, reprioritized or replaced, until unfreezeTenant is called, while the other tenants are served as usual.
+// Enqueues to the frozen tenant are handled according to the broker's frozenEnqueuePolicy.
+// Freezing a frozen tenant does nothing.
+func (qb *queueBroker) freezeTenant(tenantID TenantID) {
+	if qb.frozenTenants == nil {
+		qb.frozenTenants = map[TenantID][]frozenEnqueue{}
+	}
+	if _, ok := qb.frozenTenants[tenantID]; !ok {
+		qb.frozenTenants[tenantID] = nil
+	}
+}
+
+// unfreezeTenant unfreezes the tenant and applies the enqueues buffered while it was frozen, in order.
+// Buffered requests which cannot be enqueued any more, e.g. as the tenant queue is full, are reported
+// to the observer as evicted. Unfreezing a tenant which is not frozen does nothing.
+func (qb *queueBroker) unfreezeTenant(tenantID TenantID) {
+	buffered, ok := qb.frozenTenants[tenantID]
+	if !ok {
+		return
+	}
+	delete(qb.frozenTenants, tenantID)
+
+	for _, enqueue := range buffered {
+		var err error
+		if enqueue.front {
+			err = qb.enqueueRequestFront(enqueue.request, enqueue.maxQueriers)
+		} else {
+			err = qb.enqueueRequestBack(enqueue.request, enqueue.maxQueriers)
+		}
+		if err != nil {
+			qb.observer.requestEvicted(tenantID, enqueue.request.req)
+		}
+	}
+}
+
+// tenantFrozen returns true if the tenant is frozen.
+func (qb *queueBroker) tenantFrozen(tenantID TenantID) bool {
+	_, ok := qb.frozenTenants[tenantID]
+	return ok
+}
+
+// holdFrozenEnqueue buffers or rejects an enqueue to a frozen tenant according to the frozen enqueue policy.
+// Returns false if the tenant is not frozen and the request must be enqueued.
+func (qb *queueBroker) holdFrozenEnqueue(request *tenantRequest, maxQueriers int, front bool) (bool, error) {
+	buffered, ok := qb.frozenTenants[request.tenantID]
+	if !ok {
+		return false, nil
+	}
+	if qb.frozenEnqueuePolicy == frozenEnqueueReject && !front {
+		return true, ErrTenantFrozen
+	}
+	qb.frozenTenants[request.tenantID] = append(buffered, frozenEnqueue{request: request, maxQueriers: maxQueriers, front: front})
+	return true, nil
+}
+
+// frozenTenantSnapshot returns the metadata of all the requests queued for the frozen tenant, in dequeue order,
+// and the number of enqueues buffered since it was frozen. ok is false if the tenant is not frozen.
+func (qb *queueBroker) frozenTenantSnapshot(tenantID TenantID) (queued []RequestMeta, buffered int, ok bool) {
+	if !qb.tenantFrozen(tenantID) {
+		return nil, 0, false
+	}
+	total := 0
+	if node := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}); node != nil {
+		total = node.ItemCount()
+	}
+	queued, _ = qb.tenantQueuePage(tenantID, 0, total)
+	return queued, len(qb.frozenTenants[tenantID]), true
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_FreezeTenant(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.clock = newManualClock()
+	qb.addQuerierConnection("querier-1")
+	for i := 0; i < 3; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: fmt.Sprintf("frozen-%d", i), priority: i % 2}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: fmt.Sprintf("other-%d", i)}, 0))
+	}
+
+	qb.freezeTenant("tenant-1")
+	snapshot, buffered, ok := qb.frozenTenantSnapshot("tenant-1")
+	require.True(t, ok)
+	assert.Len(t, snapshot, 3)
+	assert.Zero(t, buffered)
+
+	// the other tenants proceed while the frozen queue is left untouched
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "frozen-3"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "other-3"}, 0))
+	var lowest *tenantRequest
+	qb.visitTenantRequests("tenant-1", func(request *tenantRequest) bool {
+		lowest = request
+		return true
+	})
+	assert.False(t, qb.reprioritizeRequest(lowest, 1))
+	for i := 0; i < 4; i++ {
+		req, tenant, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+		require.NoError(t, err)
+		require.NotNil(t, req)
+		assert.Equal(t, TenantID("tenant-2"), tenant.tenantID)
+	}
+	req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+
+	after, buffered, ok := qb.frozenTenantSnapshot("tenant-1")
+	require.True(t, ok)
+	assert.Equal(t, snapshot, after)
+	assert.Equal(t, 1, buffered)
+	assert.Equal(t, []any{"frozen-1", "frozen-0", "frozen-2"}, queuedRequests(qb, "tenant-1"))
+
+	// the buffered enqueue is applied on unfreeze
+	qb.unfreezeTenant("tenant-1")
+	_, _, ok = qb.frozenTenantSnapshot("tenant-1")
+	assert.False(t, ok)
+	assert.Equal(t, []any{"frozen-1", "frozen-0", "frozen-2", "frozen-3"}, queuedRequests(qb, "tenant-1"))
+	dequeueN(t, qb, "querier-1", 4)
+	assert.True(t, qb.isEmpty())
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_FreezeTenantRejectEnqueues(t *testing.T) {
+	qb := newQueueBroker(2, 0)
+	qb.frozenEnqueuePolicy = frozenEnqueueReject
+	qb.addQuerierConnection("querier-1")
+
+	var evicted []Request
+	qb.observer.OnRequestEvicted = func(_ TenantID, req Request) {
+		evicted = append(evicted, req)
+	}
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "first"}, 0))
+	dispatched, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "second"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "third"}, 0))
+
+	qb.freezeTenant("tenant-1")
+	assert.ErrorIs(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "rejected"}, 0), ErrTenantFrozen)
+
+	// a request failing dispatch was already accepted, and is buffered
+	require.NoError(t, qb.enqueueRequestFront(dispatched, 0))
+	_, buffered, _ := qb.frozenTenantSnapshot("tenant-1")
+	assert.Equal(t, 1, buffered)
+
+	qb.unfreezeTenant("tenant-1")
+	assert.Equal(t, []any{"first", "second", "third"}, queuedRequests(qb, "tenant-1"))
+	assert.Empty(t, evicted)
+
+	// a buffered request which no longer fits in the tenant queue when unfrozen is reported to the observer
+	qb.freezeTenant("tenant-1")
+	qb.frozenEnqueuePolicy = frozenEnqueueBuffer
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "overflowing"}, 0))
+	qb.unfreezeTenant("tenant-1")
+	assert.Equal(t, []Request{"overflowing"}, evicted)
+	assert.NoError(t, isConsistent(qb))
+}
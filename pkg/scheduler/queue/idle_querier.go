@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// setTenantHasQueuedRequests records whether the tenant has queued requests,
+// maintaining the number of tenants with queued requests each querier can handle.
+func (tqa *tenantQuerierAssignments) setTenantHasQueuedRequests(tenant *queueTenant, hasQueuedRequests bool) {
+	if tenant.hasQueuedRequests == hasQueuedRequests {
+		return
+	}
+	tenant.hasQueuedRequests = hasQueuedRequests
+	if hasQueuedRequests {
+		tqa.countTenantWithQueuedRequests(tqa.tenantQuerierIDs[tenant.tenantID], 1)
+	} else {
+		tqa.countTenantWithQueuedRequests(tqa.tenantQuerierIDs[tenant.tenantID], -1)
+	}
+}
+
+// updateTenantsWithQueuedRequests moves the count of a tenant with queued requests
+// from the queriers of its previous querier ID set to the queriers of the next one.
+func (tqa *tenantQuerierAssignments) updateTenantsWithQueuedRequests(tenantID TenantID, previous, next map[QuerierID]struct{}) {
+	if tenant := tqa.tenantsByID[tenantID]; tenant == nil || !tenant.hasQueuedRequests {
+		return
+	}
+	tqa.countTenantWithQueuedRequests(previous, -1)
+	tqa.countTenantWithQueuedRequests(next, 1)
+}
+
+// countTenantWithQueuedRequests adds delta to the number of tenants with queued requests of each querier in the set;
+// a nil set means the tenant can use all queriers.
+func (tqa *tenantQuerierAssignments) countTenantWithQueuedRequests(querierIDs map[QuerierID]struct{}, delta int) {
+	if querierIDs == nil {
+		tqa.unshardedTenantsWithQueuedRequests += delta
+		return
+	}
+	if tqa.querierTenantsWithQueuedRequests == nil {
+		tqa.querierTenantsWithQueuedRequests = map[QuerierID]int{}
+	}
+	for querierID := range querierIDs {
+		if tqa.querierTenantsWithQueuedRequests[querierID] += delta; tqa.querierTenantsWithQueuedRequests[querierID] <= 0 {
+			delete(tqa.querierTenantsWithQueuedRequests, querierID)
+		}
+	}
+}
+
+// querierHasNoQueuedRequests returns true if none of the tenants the querier can handle has queued requests.
+func (tqa *tenantQuerierAssignments) querierHasNoQueuedRequests(querierID QuerierID) bool {
+	return tqa.unshardedTenantsWithQueuedRequests == 0 && tqa.querierTenantsWithQueuedRequests[querierID] == 0
+}
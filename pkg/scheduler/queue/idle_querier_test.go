@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_IdleQuerierFastPathMatchesScan(t *testing.T) {
+	const (
+		numQueriers = 10
+		numTenants  = 30
+	)
+
+	rnd := rand.New(rand.NewSource(1))
+	clk := newManualClock()
+	qb := newQueueBroker(100, time.Minute)
+	qb.clock = clk
+	qb.tenantRemovalPolicy = tenantRemovalLazy
+	qb.tenantRemovalGracePeriod = 10 * time.Second
+	tqa := &qb.tenantQuerierAssignments
+	tqa.idleQuerierFastPath = true
+	for i := 0; i < numQueriers; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+
+	// hasWorkByScan finds whether any tenant the querier can handle has queued requests by scanning the tenant order.
+	hasWorkByScan := func(querierID QuerierID) bool {
+		for _, tenantID := range tqa.tenantIDOrder {
+			if tenantID == emptyTenantID || qb.getQueue(tenantID) == nil {
+				continue
+			}
+			querierSet := tqa.tenantQuerierIDs[tenantID]
+			if _, ok := querierSet[querierID]; querierSet == nil || ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	lastTenantIndexes := map[QuerierID]int{}
+	for i := 0; i < 5000; i++ {
+		querierID := QuerierID(fmt.Sprintf("querier-%d", rnd.Intn(numQueriers)))
+		switch op := rnd.Intn(10); {
+		case op < 4:
+			tenantID := TenantID(fmt.Sprintf("tenant-%d", rnd.Intn(numTenants)))
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: i}, rnd.Intn(4)))
+		case op < 8:
+			request, tenant, lastTenantIndex, err := qb.dequeueRequestForQuerier(lastTenantIndexes[querierID], querierID)
+			if err != nil {
+				require.ErrorIs(t, err, ErrQuerierShuttingDown)
+				continue
+			}
+			lastTenantIndexes[querierID] = lastTenantIndex
+			if request != nil && rnd.Intn(4) == 0 {
+				// dispatch failed, so the request goes back to the front of the queue
+				require.NoError(t, qb.enqueueRequestFront(request, tenant.maxQueriers))
+			}
+		case op < 9:
+			// the fleet changes, reshuffling the tenants
+			if querier := tqa.queriersByID[querierID]; querier != nil && querier.connections > 0 {
+				qb.removeQuerierConnection(querierID, clk.Now())
+			} else {
+				qb.addQuerierConnection(querierID)
+			}
+		default:
+			clk.Advance(5 * time.Second)
+			qb.forgetDisconnectedQueriers(clk.Now())
+			qb.removeIdleTenants(clk.Now())
+		}
+		require.NoError(t, isConsistent(qb))
+
+		for querierID := range tqa.queriersByID {
+			require.Equal(t, hasWorkByScan(querierID), !tqa.querierHasNoQueuedRequests(querierID), "querier %s after operation %d", querierID, i)
+		}
+	}
+}
+
+func TestQueues_IdleQuerierFastPath(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	tqa.idleQuerierFastPath = true
+	for i := 0; i < 4; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 1))
+	shardQueriers := getTenantsQueriers(qb, "tenant-1")
+	require.Len(t, shardQueriers, 1)
+
+	for querierID := range tqa.queriersByID {
+		tenant, lastTenantIndex, err := tqa.getNextTenantForQuerier(-1, querierID)
+		require.NoError(t, err)
+		if querierID == shardQueriers[0] {
+			require.NotNil(t, tenant)
+			assert.Equal(t, TenantID("tenant-1"), tenant.tenantID)
+			continue
+		}
+		assert.Nil(t, tenant, querierID)
+		assert.Equal(t, -1, lastTenantIndex)
+	}
+
+	// a querier shutting down is still told so
+	qb.notifyQuerierShutdown(shardQueriers[0])
+	for querierID := range tqa.queriersByID {
+		_, _, err := tqa.getNextTenantForQuerier(-1, querierID)
+		if querierID == shardQueriers[0] {
+			assert.ErrorIs(t, err, ErrQuerierShuttingDown)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func BenchmarkGetNextTenantForQuerier_IdleQuerier(b *testing.B) {
+	const (
+		numQueriers = 500
+		numTenants  = 10000
+	)
+
+	qb := newQueueBroker(100, 0)
+	qb.tenantRemovalPolicy = tenantRemovalLazy
+	qb.tenantRemovalGracePeriod = time.Hour
+	tqa := &qb.tenantQuerierAssignments
+	for i := 0; i < numQueriers; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	// all tenants are retained with empty queues
+	for i := 0; i < numTenants; i++ {
+		require.NoError(b, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", i)), req: i}, 0))
+	}
+	for !qb.isEmpty() {
+		_, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-0")
+		require.NoError(b, err)
+	}
+
+	for _, fastPath := range []bool{false, true} {
+		b.Run(fmt.Sprintf("fast-path=%v", fastPath), func(b *testing.B) {
+			tqa.idleQuerierFastPath = fastPath
+			for i := 0; i < b.N; i++ {
+				tenant, _, err := qb.getNextTenantWithRequestsForQuerier(-1, "querier-1")
+				if tenant != nil || err != nil {
+					b.Fatal("expected no tenant")
+				}
+			}
+		})
+	}
+}
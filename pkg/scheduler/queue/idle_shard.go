@@ -0,0 +1,28 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// collapseIdleShards collapses the shards of the tenants retained with an empty queue for at least the
+// idle shard collapse period, so that the tenants can use all queriers and no longer hold on to a shard.
+// The shard of a collapsed tenant is computed again when its next request is enqueued with its max queriers.
+// Returns the number of collapsed shards.
+func (qb *queueBroker) collapseIdleShards(now time.Time) int {
+	if qb.idleShardCollapsePeriod <= 0 {
+		return 0
+	}
+	tqa := &qb.tenantQuerierAssignments
+	collapsed := 0
+	for tenantID, tenant := range tqa.tenantsByID {
+		if tenant.maxQueriers == 0 || tenant.emptySince.IsZero() || now.Sub(tenant.emptySince) < qb.idleShardCollapsePeriod {
+			continue
+		}
+		// a tenant without max queriers can use all queriers, and any max queriers it is enqueued with
+		// next differs from it, which triggers computing its shard again
+		tenant.maxQueriers = 0
+		tqa.shuffleTenantQueriers(tenantID, nil)
+		collapsed++
+	}
+	return collapsed
+}
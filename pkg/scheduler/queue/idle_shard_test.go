@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_CollapseIdleShards(t *testing.T) {
+	for testName, testData := range map[string]struct {
+		collapsePeriod    time.Duration
+		expectedCollapsed bool
+	}{
+		"shard kept by default": {
+			collapsePeriod:    0,
+			expectedCollapsed: false,
+		},
+		"shard collapsed after the idle period": {
+			collapsePeriod:    10 * time.Minute,
+			expectedCollapsed: true,
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			clk := newManualClock()
+			qb := newQueueBroker(100, 0)
+			qb.clock = clk
+			qb.tenantRemovalPolicy = tenantRemovalLazy
+			qb.tenantRemovalGracePeriod = time.Hour
+			qb.idleShardCollapsePeriod = testData.collapsePeriod
+			for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"} {
+				qb.addQuerierConnection(querierID)
+			}
+
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-idle", req: "req-1"}, 2))
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-active", req: "req-2"}, 2))
+			idleShard := getTenantsQueriers(qb, "tenant-idle")
+			activeShard := getTenantsQueriers(qb, "tenant-active")
+			require.Len(t, idleShard, 2)
+
+			// empty the queue of tenant-idle, which is first in the tenant order and retained by lazy removal
+			dequeueN(t, qb, idleShard[0], 1)
+			require.Nil(t, qb.tenantQueuesTree.getNode(QueuePath{"tenant-idle"}))
+			require.Contains(t, qb.tenantQuerierAssignments.tenantsByID, TenantID("tenant-idle"))
+
+			clk.Advance(5 * time.Minute)
+			assert.Zero(t, qb.collapseIdleShards(clk.Now()))
+			assert.Equal(t, idleShard, getTenantsQueriers(qb, "tenant-idle"))
+
+			clk.Advance(5 * time.Minute)
+			collapsed := qb.collapseIdleShards(clk.Now())
+			if !testData.expectedCollapsed {
+				assert.Zero(t, collapsed)
+				assert.Equal(t, idleShard, getTenantsQueriers(qb, "tenant-idle"))
+				return
+			}
+			assert.Equal(t, 1, collapsed)
+			assert.Nil(t, qb.tenantQuerierAssignments.tenantQuerierIDs["tenant-idle"])
+			assert.Equal(t, activeShard, getTenantsQueriers(qb, "tenant-active"))
+			assert.NoError(t, isConsistent(qb))
+
+			// an already collapsed shard is not collapsed again
+			assert.Zero(t, qb.collapseIdleShards(clk.Now()))
+
+			// the shard is computed again when the tenant is reactivated
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-idle", req: "req-3"}, 2))
+			assert.Equal(t, idleShard, getTenantsQueriers(qb, "tenant-idle"))
+			assert.NoError(t, isConsistent(qb))
+		})
+	}
+}
@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"sort"
+	"time"
+)
+
+// imbalancedTenantRatio is how many times more requests a tenant must have enqueued than dequeued within the window
+// to be reported as imbalanced.
+const imbalancedTenantRatio = 2
+
+// imbalancedTenants returns the tenants with queued requests which enqueued more than imbalancedTenantRatio times
+// as many requests as were dequeued for them within the window ending now, sorted by tenant ID.
+// Such tenants have a growing backlog, and will eventually reach the max tenant queue size and have enqueues rejected.
+//
+// The window is rounded up to the bucket width of the recent enqueue and dequeue counters, and capped at their window.
+// Returns nil unless the broker counts both recent enqueues and dequeues.
+func (qb *queueBroker) imbalancedTenants(window time.Duration) []TenantID {
+	if qb.recentEnqueues == nil || qb.recentDequeues == nil {
+		return nil
+	}
+	now := qb.clock.Now()
+	enqueued := qb.recentEnqueues.countsWithin(now, window)
+	dequeued := qb.recentDequeues.countsWithin(now, window)
+
+	var imbalanced []TenantID
+	for tenantID, n := range enqueued {
+		if n <= imbalancedTenantRatio*dequeued[tenantID] {
+			continue
+		}
+		if qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}) == nil {
+			// the backlog is already cleared
+			continue
+		}
+		imbalanced = append(imbalanced, tenantID)
+	}
+	sort.Slice(imbalanced, func(i, j int) bool { return imbalanced[i] < imbalanced[j] })
+	return imbalanced
+}
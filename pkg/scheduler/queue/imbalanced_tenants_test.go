@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ImbalancedTenants(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(1000, 0)
+	qb.clock = clk
+	qb.addQuerierConnection("querier-1")
+	assert.Nil(t, qb.imbalancedTenants(time.Minute), "disabled by default")
+
+	qb.recentEnqueues = newWindowedTenantCounter(10*time.Minute, 10)
+	qb.recentDequeues = newWindowedTenantCounter(10*time.Minute, 10)
+
+	// each minute, tenant-flooding enqueues 10 requests and tenant-steady 2, while the querier dequeues 6 requests,
+	// which rotate between the tenants
+	for minute := 0; minute < 5; minute++ {
+		for i := 0; i < 10; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-flooding", req: i}, 0))
+		}
+		for i := 0; i < 2; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-steady", req: i}, 0))
+		}
+		lastTenantIndex := -1
+		for i := 0; i < 6; i++ {
+			req, _, tenantIndex, err := qb.dequeueRequestForQuerier(lastTenantIndex, "querier-1")
+			require.NoError(t, err)
+			require.NotNil(t, req)
+			lastTenantIndex = tenantIndex
+		}
+		clk.Advance(time.Minute)
+	}
+
+	assert.Equal(t, []TenantID{"tenant-flooding"}, qb.imbalancedTenants(5*time.Minute))
+	assert.Equal(t, []TenantID{"tenant-flooding"}, qb.imbalancedTenants(time.Hour))
+
+	// once the flood stops and its backlog is drained, the tenant is no longer reported
+	clk.Advance(10 * time.Minute)
+	for !qb.isEmpty() {
+		dequeueN(t, qb, "querier-1", 1)
+	}
+	assert.Empty(t, qb.imbalancedTenants(5*time.Minute))
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// inflightRequest records which querier a dispatched request was handed to, and when.
+type inflightRequest struct {
+	tenantID     TenantID
+	querierID    QuerierID
+	dispatchedAt time.Time
+	// deadline is zero if no dispatch timeout applies to the tenant
+	deadline time.Time
+	// priority of the request when it was dispatched
+	priority int
+	// estimated cost of the request
+	cost int64
+}
+
+func (qb *queueBroker) newInflightRequest(tenantID TenantID, querierID QuerierID, now time.Time) inflightRequest {
+	inflight := inflightRequest{tenantID: tenantID, querierID: querierID, dispatchedAt: now}
+	if timeout := qb.dispatchTimeout(tenantID); timeout > 0 {
+		inflight.deadline = now.Add(timeout)
+	}
+	return inflight
+}
+
+// completeRequest marks a request previously dispatched by dequeueRequestForQuerier as completed,
+// removing it from inflight tracking. Completing an untracked request is a no-op.
+func (qb *queueBroker) completeRequest(request *tenantRequest) {
+	qb.untrackInflight(request)
+}
+
+func (qb *queueBroker) trackInflightRequest(request *tenantRequest, inflight inflightRequest) {
+	inflight.priority = request.priority
+	inflight.cost = request.cost
+	qb.inflightRequests[request] = inflight
+	qb.inflightPerTenant[inflight.tenantID]++
+	qb.inflightPerQuerier[inflight.querierID]++
+	if inflight.cost > 0 {
+		qb.inflightCostPerQuerier[inflight.querierID] += inflight.cost
+	}
+}
+
+func (qb *queueBroker) untrackInflight(request *tenantRequest) {
+	inflight, ok := qb.inflightRequests[request]
+	if !ok {
+		return
+	}
+	delete(qb.inflightRequests, request)
+	if qb.inflightPerTenant[inflight.tenantID]--; qb.inflightPerTenant[inflight.tenantID] <= 0 {
+		delete(qb.inflightPerTenant, inflight.tenantID)
+	}
+	if qb.inflightPerQuerier[inflight.querierID]--; qb.inflightPerQuerier[inflight.querierID] <= 0 {
+		delete(qb.inflightPerQuerier, inflight.querierID)
+	}
+	if inflight.cost > 0 {
+		if qb.inflightCostPerQuerier[inflight.querierID] -= inflight.cost; qb.inflightCostPerQuerier[inflight.querierID] <= 0 {
+			delete(qb.inflightCostPerQuerier, inflight.querierID)
+		}
+	}
+}
+
+// inflightStats returns the number of dispatched but not yet completed requests,
+// aggregated per tenant and per querier. Both maps are built in a single pass
+// over the inflight requests and are therefore consistent with each other.
+func (qb *queueBroker) inflightStats() (perTenant map[TenantID]int, perQuerier map[QuerierID]int) {
+	perTenant = make(map[TenantID]int, len(qb.inflightRequests))
+	perQuerier = make(map[QuerierID]int, len(qb.inflightRequests))
+	for _, inflight := range qb.inflightRequests {
+		perTenant[inflight.tenantID]++
+		perQuerier[inflight.querierID]++
+	}
+	return perTenant, perQuerier
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+type inflightFullPolicy int
+
+const (
+	// inflightFullQueue keeps queuing requests of a tenant which has reached its max inflight requests.
+	inflightFullQueue inflightFullPolicy = iota
+	// inflightFullReject rejects enqueues with ErrTenantInflightFull while the tenant is at its max inflight requests,
+	// applying backpressure to clients instead of building a backlog behind a saturated tenant.
+	inflightFullReject
+)
+
+// tenantDispatchableToQuerier returns true unless the tenant is frozen or at its inflight cap, its next request
+// is too recent to be dispatched, the querier is overloaded compared to the other queriers of the tenant's shard
+// or held up by a lower priority request, the tenant's dequeues are routed to another preferred querier,
+// all of the tenant's requests are routed to other queriers by their cache key,
+// or a filtered dequeue rejects all of the tenant's requests.
+func (qb *queueBroker) tenantDispatchableToQuerier(tenantID TenantID, querierID QuerierID) bool {
+	return qb.tenantDispatchBlocker(tenantID, querierID) == ""
+}
+
+// tenantDispatchBlocker returns the first reason why the tenant is not dispatchable to the querier,
+// as checked by tenantDispatchableToQuerier, or an empty reason if it is dispatchable.
+func (qb *queueBroker) tenantDispatchBlocker(tenantID TenantID, querierID QuerierID) SkipCause {
+	switch {
+	case qb.tenantFrozen(tenantID):
+		return SkipFrozen
+	case qb.tenantPausedByErrorBudget(tenantID, qb.clock.Now()):
+		return SkipErrorBudget
+	case qb.tenantAtInflightCap(tenantID):
+		return SkipInflightCap
+	case qb.tenantAtBatchCap(tenantID):
+		return SkipBatchTenantCap
+	case qb.tenantNextRequestTooRecent(tenantID, qb.clock.Now()):
+		return SkipMinRequestAge
+	case qb.tenantNextRequestHeldForCoalescing(tenantID, qb.clock.Now()):
+		return SkipCoalescing
+	case qb.querierOverloadedForTenant(querierID, tenantID):
+		return SkipQuerierOverloaded
+	case qb.querierOverCostBudget(querierID, tenantID):
+		return SkipQuerierCostBudget
+	case qb.querierStuckOnLowerPriority(querierID, tenantID):
+		return SkipPriorityInversion
+	case qb.tenantReservedForPreferredQuerier(tenantID, querierID):
+		return SkipPreferredQuerier
+	case !qb.tenantHasCacheAffineRequestForQuerier(tenantID, querierID):
+		return SkipCacheKeyAffinity
+	case !qb.tenantHasAcceptedRequestForQuerier(tenantID, querierID):
+		return SkipRejectedByFilter
+	case qb.throttledByBackpressure(tenantID):
+		return SkipBackpressure
+	}
+	return ""
+}
+
+// tenantAtInflightCap returns true if the tenant has as many inflight requests as its configured MaxInflight.
+func (qb *queueBroker) tenantAtInflightCap(tenantID TenantID) bool {
+	if !qb.trackInflight {
+		return false
+	}
+	maxInflight := qb.tenantQuerierAssignments.tenantConfigs[tenantID].MaxInflight
+	return maxInflight > 0 && qb.inflightPerTenant[tenantID] >= maxInflight
+}
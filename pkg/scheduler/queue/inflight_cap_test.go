@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_TenantInflightCap(t *testing.T) {
+	tests := map[string]struct {
+		policy             inflightFullPolicy
+		expectedEnqueueErr error
+	}{
+		"keep queuing": {
+			policy:             inflightFullQueue,
+			expectedEnqueueErr: nil,
+		},
+		"reject": {
+			policy:             inflightFullReject,
+			expectedEnqueueErr: ErrTenantInflightFull,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.trackInflight = true
+			qb.inflightFullPolicy = testData.policy
+			qb.addQuerierConnection("querier-1")
+			require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-capped", TenantConfig{MaxInflight: 2}))
+
+			for i := 0; i < 3; i++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-capped", req: i}, 0))
+			}
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-other", req: "other"}, 0))
+
+			// drive the tenant to its inflight cap; the capped tenant is then skipped for dispatch
+			dispatched := dequeueN(t, qb, "querier-1", 3)
+			assert.Equal(t, []any{0, "other", 1}, []any{dispatched[0].req, dispatched[1].req, dispatched[2].req})
+			req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+			require.NoError(t, err)
+			assert.Nil(t, req)
+			assert.True(t, qb.tenantAtInflightCap("tenant-capped"))
+
+			err = qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-capped", req: "new"}, 0)
+			if testData.expectedEnqueueErr != nil {
+				assert.ErrorIs(t, err, testData.expectedEnqueueErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			// tenants below their cap are not affected
+			assert.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-other", req: "other"}, 0))
+
+			// completing a request makes room for dispatch and enqueues
+			qb.completeRequest(dispatched[0])
+			assert.False(t, qb.tenantAtInflightCap("tenant-capped"))
+			assert.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-capped", req: "after-complete"}, 0))
+			req, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-1")
+			require.NoError(t, err)
+			assert.Equal(t, 2, req.req)
+			assert.NoError(t, isConsistent(qb))
+		})
+	}
+}
+
+func TestQueues_TenantInflightCap_TrackingDisabled(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.inflightFullPolicy = inflightFullReject
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-1", TenantConfig{MaxInflight: 1}))
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+	}
+	dequeueN(t, qb, "querier-1", 3)
+	assert.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 0))
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_InflightStats(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.trackInflight = true
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+
+	for _, tenantID := range []TenantID{"tenant-a", "tenant-a", "tenant-a", "tenant-b"} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "request"}, 0))
+	}
+
+	perTenant, perQuerier := qb.inflightStats()
+	assert.Empty(t, perTenant)
+	assert.Empty(t, perQuerier)
+
+	// dispatch requests without completing them
+	lastTenantIndex := -1
+	var dispatched []*tenantRequest
+	for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-1"} {
+		req, _, idx, err := qb.dequeueRequestForQuerier(lastTenantIndex, querierID)
+		require.NoError(t, err)
+		require.NotNil(t, req)
+		lastTenantIndex = idx
+		dispatched = append(dispatched, req)
+	}
+
+	perTenant, perQuerier = qb.inflightStats()
+	assert.Equal(t, map[TenantID]int{"tenant-a": 2, "tenant-b": 1}, perTenant)
+	assert.Equal(t, map[QuerierID]int{"querier-1": 2, "querier-2": 1}, perQuerier)
+
+	// completing a request removes it from the inflight stats
+	qb.completeRequest(dispatched[0])
+	perTenant, perQuerier = qb.inflightStats()
+	assert.Equal(t, map[TenantID]int{"tenant-a": 1, "tenant-b": 1}, perTenant)
+	assert.Equal(t, map[QuerierID]int{"querier-1": 1, "querier-2": 1}, perQuerier)
+
+	// re-enqueueing a request after a failed dispatch removes it from the inflight stats
+	require.NoError(t, qb.enqueueRequestFront(dispatched[1], 0))
+	perTenant, perQuerier = qb.inflightStats()
+	assert.Equal(t, map[TenantID]int{"tenant-a": 1}, perTenant)
+	assert.Equal(t, map[QuerierID]int{"querier-1": 1}, perQuerier)
+}
+
+func TestQueues_InflightStats_TrackingDisabled(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-a", req: "request"}, 0))
+
+	req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	require.NotNil(t, req)
+
+	perTenant, perQuerier := qb.inflightStats()
+	assert.Empty(t, perTenant)
+	assert.Empty(t, perQuerier)
+}
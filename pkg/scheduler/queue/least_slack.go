@@ -0,0 +1,11 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// latestStart returns the latest time the request can be dispatched at to complete by its deadline,
+// given its estimated duration; its slack is the time left until then.
+func (r *tenantRequest) latestStart() time.Time {
+	return r.deadline.Add(-r.estimatedDuration)
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_RequestOrderingLeastSlack(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.requestOrdering = RequestOrderingLeastSlack
+	qb.addQuerierConnection("querier-1")
+	now := clk.Now()
+
+	for _, request := range []*tenantRequest{
+		{req: "no-deadline-1"},
+		{req: "deadline-30s", deadline: now.Add(30 * time.Second)},
+		// the earliest deadline, but the most slack
+		{req: "deadline-10s", deadline: now.Add(10 * time.Second)},
+		// a later deadline, but its estimated duration leaves it the least slack
+		{req: "deadline-20s-cost-15s", deadline: now.Add(20 * time.Second), estimatedDuration: 15 * time.Second},
+		{req: "no-deadline-2"},
+		{req: "deadline-10s-again", deadline: now.Add(10 * time.Second)},
+		{req: "high-priority", priority: 1},
+	} {
+		request.tenantID = "tenant-1"
+		require.NoError(t, qb.enqueueRequestBack(request, 0))
+	}
+
+	assert.Equal(t, []any{
+		"high-priority",
+		"deadline-20s-cost-15s",
+		"deadline-10s",
+		"deadline-10s-again",
+		"deadline-30s",
+		"no-deadline-1",
+		"no-deadline-2",
+	}, queuedRequests(qb, "tenant-1"))
+}
+
+func TestQueues_RequestOrderingLeastSlack_DropsExpiredRequests(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-slack", TenantConfig{RequestOrdering: RequestOrderingLeastSlack}))
+	var expired []any
+	qb.observer.OnRequestExpired = func(_ TenantID, req Request) { expired = append(expired, req) }
+	now := clk.Now()
+
+	for _, tenantID := range []TenantID{"tenant-slack", "tenant-fifo"} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "expires-1s", deadline: now.Add(time.Second)}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "expires-2s", deadline: now.Add(2 * time.Second)}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "expires-1m", deadline: now.Add(time.Minute)}, 0))
+	}
+	clk.Advance(2 * time.Second)
+
+	// the expired requests of the least-slack tenant are dropped rather than dispatched first,
+	// while the requests of other tenants are still dispatched whatever their deadline
+	request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Equal(t, "expires-1m", request.req)
+	assert.Equal(t, []any{"expires-1s", "expires-2s"}, expired)
+	assert.Equal(t, uint64(1), qb.dequeuedTotal)
+	assert.Empty(t, queuedRequests(qb, "tenant-slack"))
+
+	for _, expected := range []any{"expires-1s", "expires-2s", "expires-1m"} {
+		request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+		require.NoError(t, err)
+		assert.Equal(t, expected, request.req)
+	}
+	assert.Len(t, expired, 2)
+}
@@ -0,0 +1,15 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// logicalQuerierID returns the ID of the logical querier the querier ID belongs to, as mapped by the
+// querier ID normalizer; without a normalizer, every querier ID is a logical querier of its own.
+//
+// Connections, shutdown notifications and dequeues of all the variants of a logical querier's ID are applied
+// to the logical querier, which the tenant shards, inflight requests and statistics refer to.
+func (qb *queueBroker) logicalQuerierID(querierID QuerierID) QuerierID {
+	if qb.querierIDNormalizer == nil {
+		return querierID
+	}
+	return qb.querierIDNormalizer(querierID)
+}
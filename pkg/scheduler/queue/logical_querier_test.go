@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_LogicalQuerierID(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.querierIDNormalizer = func(querierID QuerierID) QuerierID {
+		id, _, _ := strings.Cut(string(querierID), "-restart-")
+		return QuerierID(id)
+	}
+
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-1-restart-2")
+	qb.addQuerierConnection("querier-2")
+
+	// the variants of querier-1 are accounted for as one querier
+	tqa := &qb.tenantQuerierAssignments
+	assert.Equal(t, querierIDSlice{"querier-1", "querier-2"}, tqa.querierIDsSorted)
+	require.Contains(t, tqa.queriersByID, QuerierID("querier-1"))
+	assert.Equal(t, 2, tqa.queriersByID["querier-1"].connections)
+
+	// the tenant is sharded over the logical queriers only
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1"}, 1))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-2"}, 1))
+	require.NoError(t, isConsistent(qb))
+	shard := getTenantsQueriers(qb, "tenant-1")
+	require.Len(t, shard, 1)
+
+	// dequeues of all the variants have the eligibility of the logical querier
+	for _, querierID := range []QuerierID{"querier-1", "querier-1-restart-2", "querier-2"} {
+		req, _, _, err := qb.dequeueRequestForQuerier(-1, querierID)
+		require.NoError(t, err)
+		assert.Equal(t, qb.logicalQuerierID(querierID) == shard[0], req != nil, querierID)
+	}
+
+	// the logical querier stays connected until all of its variants disconnect
+	shuffles := tqa.tenantShuffles
+	qb.removeQuerierConnection("querier-1-restart-2", qb.clock.Now())
+	assert.Equal(t, 1, tqa.queriersByID["querier-1"].connections)
+	assert.Equal(t, shuffles, tqa.tenantShuffles)
+	qb.removeQuerierConnection("querier-1", qb.clock.Now())
+	assert.Equal(t, querierIDSlice{"querier-2"}, tqa.querierIDsSorted)
+	assert.NoError(t, isConsistent(qb))
+}
@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// dequeueNextRequestForQuerier dequeues a request for the querier as dequeueRequestForQuerier does,
+// using the last tenant index kept by the broker for the querier instead of one tracked by the caller,
+// and advancing it after each dequeue so that the querier rotates fairly through the tenants.
+//
+// The index is kept for as long as the querier is known to the broker, and shared by all of its connections;
+// a querier which is forgotten and connects again starts over from the beginning of the tenant order.
+func (qb *queueBroker) dequeueNextRequestForQuerier(querierID QuerierID) (*tenantRequest, *queueTenant, error) {
+	querierID = qb.logicalQuerierID(querierID)
+	lastTenantIndex := -1
+	querier := qb.tenantQuerierAssignments.queriersByID[querierID]
+	if querier != nil {
+		lastTenantIndex = querier.lastTenantIndex
+	}
+
+	request, tenant, tenantIndex, err := qb.dequeueRequestForQuerier(lastTenantIndex, querierID)
+	if err == nil && querier != nil {
+		querier.lastTenantIndex = tenantIndex
+	}
+	return request, tenant, err
+}
@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_DequeueNextRequestForQuerier(t *testing.T) {
+	qb := newQueueBroker(1000, 0)
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+
+	tenantIDs := []TenantID{"tenant-1", "tenant-2", "tenant-3"}
+	for i := 0; i < 100; i++ {
+		for _, tenantID := range tenantIDs {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: fmt.Sprintf("%s-%d", tenantID, i)}, 0))
+		}
+	}
+
+	dequeuedPerTenant := map[TenantID]int{}
+	tenantsPerQuerier := map[QuerierID][]TenantID{}
+	for i := 0; i < 150; i++ {
+		for _, querierID := range []QuerierID{"querier-1", "querier-2"} {
+			req, tenant, err := qb.dequeueNextRequestForQuerier(querierID)
+			require.NoError(t, err)
+			require.NotNil(t, req)
+			dequeuedPerTenant[tenant.tenantID]++
+			tenantsPerQuerier[querierID] = append(tenantsPerQuerier[querierID], tenant.tenantID)
+		}
+	}
+
+	// each querier rotates through all the tenants in turn
+	for querierID, tenants := range tenantsPerQuerier {
+		for i, tenantID := range tenants {
+			assert.Equal(t, tenantIDs[i%len(tenantIDs)], tenantID, "querier %s, dequeue %d", querierID, i)
+		}
+	}
+	assert.Equal(t, map[TenantID]int{"tenant-1": 100, "tenant-2": 100, "tenant-3": 100}, dequeuedPerTenant)
+	assert.True(t, qb.isEmpty())
+
+	_, _, err := qb.dequeueNextRequestForQuerier("unknown-querier")
+	assert.ErrorIs(t, err, ErrQuerierShuttingDown)
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"errors"
+	"sort"
+)
+
+type globalMemoryPolicy int
+
+const (
+	// globalMemoryRejectIncoming rejects enqueues with ErrQueueMemoryFull which would take the payload of all queued
+	// requests above the broker's memory ceiling.
+	globalMemoryRejectIncoming globalMemoryPolicy = iota
+	// globalEvictLowestPriority evicts the queued requests of the lowest priority, oldest first, across all tenants
+	// to admit an enqueue which would take the payload of all queued requests above the broker's memory ceiling.
+	// Requests are ranked by priority class first, and then by priority within a class.
+	// Only requests of a lower priority than the incoming request are evicted; if evicting all of them would not
+	// make room for the incoming request, the incoming request is rejected and nothing is evicted.
+	globalEvictLowestPriority
+)
+
+// admitUnderMemoryCeiling makes room for the request under the broker's memory ceiling according to the
+// global memory policy, evicting queued requests if needed, or returns ErrQueueMemoryFull if it cannot be admitted.
+func (qb *queueBroker) admitUnderMemoryCeiling(request *tenantRequest) error {
+	if qb.maxQueuedPayloadBytes <= 0 {
+		return nil
+	}
+	excess := qb.queuedPayloadBytes + request.payloadBytes - qb.maxQueuedPayloadBytes
+	if excess <= 0 {
+		return nil
+	}
+	if qb.globalMemoryPolicy != globalEvictLowestPriority {
+		return errors.Join(ErrQueueMemoryFull, ErrTooManyRequests)
+	}
+
+	var candidates []*tenantRequest
+	var candidateBytes int64
+	qb.visitAllRequests(func(tenantID TenantID, queued *tenantRequest) bool {
+		if lowerPriority(queued, request) && queued.payloadBytes > 0 && !qb.tenantFrozen(tenantID) {
+			candidates = append(candidates, queued)
+			candidateBytes += queued.payloadBytes
+		}
+		return true
+	})
+	if candidateBytes < excess {
+		return errors.Join(ErrQueueMemoryFull, ErrTooManyRequests)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if lowerPriority(candidates[i], candidates[j]) || lowerPriority(candidates[j], candidates[i]) {
+			return lowerPriority(candidates[i], candidates[j])
+		}
+		return candidates[i].enqueueTime.Before(candidates[j].enqueueTime)
+	})
+	for _, evicted := range candidates {
+		if excess <= 0 {
+			break
+		}
+		qb.evictQueuedRequest(evicted, request.tenantID)
+		excess -= evicted.payloadBytes
+	}
+	return nil
+}
+
+// evictQueuedRequest removes a queued request from its tenant queue and reports it to the observer,
+// so that it can be cancelled. A tenant whose queue is emptied is removed according to the tenant removal policy,
+// unless it is the tenant of the incoming request being admitted.
+func (qb *queueBroker) evictQueuedRequest(request *tenantRequest, admittedTenantID TenantID) {
+	tenant := qb.tenantQuerierAssignments.tenantsByID[request.tenantID]
+	queuePath := QueuePath{string(request.tenantID)}
+	qb.tenantQueuesTree.dequeueMatchingByPath(queuePath, func(v any) bool { return v == request })
+
+	tenant.queuedPayloadBytes -= request.payloadBytes
+	qb.queuedPayloadBytes -= request.payloadBytes
+	qb.countQueuedTags(request, -1)
+	qb.countQueuedComponent(tenant, request, -1)
+	qb.untrackQueuedKey(tenant, request)
+	qb.checkTenantWatermarks(tenant)
+	qb.checkTenantEnqueueBackpressure(tenant)
+	qb.updateTenantOverflowBacklog(tenant)
+	if qb.tenantQueuesTree.getNode(queuePath) == nil {
+		qb.tenantQuerierAssignments.setTenantHasQueuedRequests(tenant, false)
+		if tenant.tenantID != admittedTenantID {
+			qb.onTenantQueueEmptied(tenant, qb.clock.Now())
+		}
+	}
+	qb.observer.requestEvicted(request.tenantID, request.req)
+}
+
+// lowerPriority returns true if request a is of a lower priority class than request b,
+// or of the same class and a lower priority.
+func lowerPriority(a, b *tenantRequest) bool {
+	if a.class != b.class {
+		return a.class < b.class
+	}
+	return a.priority < b.priority
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMemoryCeilingBroker(policy globalMemoryPolicy) (*queueBroker, *[]Request) {
+	qb := newQueueBroker(100, 0)
+	qb.clock = newManualClock()
+	qb.addQuerierConnection("querier-1")
+	qb.payloadSizer = func(Request) int64 { return 10 }
+	qb.maxQueuedPayloadBytes = 30
+	qb.globalMemoryPolicy = policy
+
+	evicted := &[]Request{}
+	qb.observer.OnRequestEvicted = func(_ TenantID, req Request) {
+		*evicted = append(*evicted, req)
+	}
+	return qb, evicted
+}
+
+func TestQueues_MemoryCeiling_RejectIncoming(t *testing.T) {
+	qb, evicted := newMemoryCeilingBroker(globalMemoryRejectIncoming)
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "low-1", priority: 0}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "low-2", priority: 0}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "low-3", priority: 0}, 0))
+
+	err := qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-3", req: "high", priority: 5}, 0)
+	assert.ErrorIs(t, err, ErrQueueMemoryFull)
+	assert.ErrorIs(t, err, ErrTooManyRequests)
+	assert.Empty(t, *evicted)
+	assert.Equal(t, int64(30), qb.queuedPayloadBytes)
+	// the tenant created for the rejected request is not left behind
+	assert.NotContains(t, qb.tenantQuerierAssignments.tenantsByID, TenantID("tenant-3"))
+	assert.NoError(t, isConsistent(qb))
+
+	// room is made by dequeuing
+	dequeueN(t, qb, "querier-1", 1)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-3", req: "high", priority: 5}, 0))
+	assert.Equal(t, int64(30), qb.queuedPayloadBytes)
+}
+
+func TestQueues_MemoryCeiling_EvictLowestPriority(t *testing.T) {
+	qb, evicted := newMemoryCeilingBroker(globalEvictLowestPriority)
+	clk := qb.clock.(*manualClock)
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "medium", priority: 1}, 0))
+	clk.Advance(1)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "low-oldest", priority: 0}, 0))
+	clk.Advance(1)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "low-newest", priority: 0}, 0))
+	clk.Advance(1)
+
+	// the oldest of the lowest priority requests is evicted, emptying tenant-2
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-3", req: "high-1", priority: 5}, 0))
+	assert.Equal(t, []Request{"low-oldest"}, *evicted)
+	assert.NotContains(t, qb.tenantQuerierAssignments.tenantsByID, TenantID("tenant-2"))
+	assert.NoError(t, isConsistent(qb))
+
+	// the next lowest priority request is evicted, even from the tenant of the incoming request
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "high-2", priority: 5}, 0))
+	assert.Equal(t, []Request{"low-oldest", "low-newest"}, *evicted)
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-3", req: "high-3", priority: 5}, 0))
+	assert.Equal(t, []Request{"low-oldest", "low-newest", "medium"}, *evicted)
+	assert.NoError(t, isConsistent(qb))
+
+	// requests of the same priority are not evicted
+	err := qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-4", req: "high-4", priority: 5}, 0)
+	assert.ErrorIs(t, err, ErrQueueMemoryFull)
+	assert.Len(t, *evicted, 3)
+
+	assert.Equal(t, int64(30), qb.queuedPayloadBytes)
+	var dequeued []any
+	for _, req := range dequeueN(t, qb, "querier-1", 3) {
+		dequeued = append(dequeued, req.req)
+	}
+	assert.ElementsMatch(t, []any{"high-1", "high-2", "high-3"}, dequeued)
+	assert.Zero(t, qb.queuedPayloadBytes)
+	assert.True(t, qb.isEmpty())
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_MemoryCeiling_EvictLowestPriority_NotEnoughRoom(t *testing.T) {
+	qb, evicted := newMemoryCeilingBroker(globalEvictLowestPriority)
+	qb.payloadSizer = func(req Request) int64 {
+		if req == "large" {
+			return 25
+		}
+		return 10
+	}
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "low", priority: 0}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "high-1", priority: 9}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "high-2", priority: 9}, 0))
+
+	// evicting the only lower priority request does not make enough room, so nothing is evicted
+	err := qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "large", priority: 9}, 0)
+	assert.ErrorIs(t, err, ErrQueueMemoryFull)
+	assert.Empty(t, *evicted)
+	assert.Equal(t, int64(30), qb.queuedPayloadBytes)
+	assert.Len(t, queuedRequests(qb, "tenant-1"), 3)
+}
@@ -0,0 +1,22 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// tenantNextRequestTooRecent returns true if the request at the front of the tenant queue
+// was enqueued less than the tenant's MinRequestAge ago.
+//
+// The request at the front is the next request to be dispatched for the tenant; holding the tenant
+// until it has aged keeps the tenant's dispatch order unchanged.
+func (qb *queueBroker) tenantNextRequestTooRecent(tenantID TenantID, now time.Time) bool {
+	minAge := qb.tenantQuerierAssignments.tenantConfigs[tenantID].MinRequestAge
+	if minAge <= 0 {
+		return false
+	}
+	request := qb.tenantNextRequest(tenantID)
+	if request == nil {
+		return false
+	}
+	return now.Sub(request.enqueueTime) < minAge
+}
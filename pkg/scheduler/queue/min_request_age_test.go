@@ -0,0 +1,49 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_MinRequestAge(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-batched", TenantConfig{MinRequestAge: time.Second}))
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-batched", req: "batched-1"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-immediate", req: "immediate"}, 0))
+	clk.Advance(500 * time.Millisecond)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-batched", req: "batched-2"}, 0))
+
+	// the fresh request is held, without blocking requests of other tenants
+	dequeued := dequeueN(t, qb, "querier-1", 1)
+	assert.Equal(t, "immediate", dequeued[0].req)
+	req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+
+	// each request is dispatched once it has aged enough
+	clk.Advance(500 * time.Millisecond)
+	dequeued = dequeueN(t, qb, "querier-1", 1)
+	assert.Equal(t, "batched-1", dequeued[0].req)
+	req, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+
+	clk.Advance(500 * time.Millisecond)
+	dequeued = dequeueN(t, qb, "querier-1", 1)
+	assert.Equal(t, "batched-2", dequeued[0].req)
+	assert.True(t, qb.isEmpty())
+
+	// requests re-enqueued after a failed dispatch have already aged and are not held again
+	require.NoError(t, qb.enqueueRequestFront(dequeued[0], 0))
+	dequeued = dequeueN(t, qb, "querier-1", 1)
+	assert.Equal(t, "batched-2", dequeued[0].req)
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "sort"
+
+// assignNewQuerierToBackloggedTenants puts a newly connected querier into the shards of the most backlogged
+// sharded tenants, so that its capacity goes to relieving the largest backlogs first.
+//
+// Tenants are ranked by queue depth, then by tenant ID, so the assignment is deterministic. To keep its shard size,
+// each tenant the querier is assigned to gives up the querier of its shard which is in the most tenant shards,
+// the lowest querier ID first. The assignment lasts until the tenant's shard is next computed by shuffle sharding.
+// Only applies when shards are computed from the connected queriers; pinned tenants are left alone.
+func (qb *queueBroker) assignNewQuerierToBackloggedTenants(querierID QuerierID) {
+	tqa := &qb.tenantQuerierAssignments
+	if qb.newQuerierBacklogTenants <= 0 || tqa.authoritativeQuerierIDs != nil {
+		return
+	}
+
+	type backlog struct {
+		tenantID TenantID
+		depth    int
+	}
+	var backlogs []backlog
+	for tenantID, querierIDs := range tqa.tenantQuerierIDs {
+		if _, pinned := tqa.pinnedTenantShards[tenantID]; pinned {
+			continue
+		}
+		if _, ok := querierIDs[querierID]; ok || len(querierIDs) == 0 {
+			continue
+		}
+		node := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)})
+		if node == nil {
+			continue
+		}
+		backlogs = append(backlogs, backlog{tenantID: tenantID, depth: node.ItemCount()})
+	}
+	sort.Slice(backlogs, func(i, j int) bool {
+		if backlogs[i].depth != backlogs[j].depth {
+			return backlogs[i].depth > backlogs[j].depth
+		}
+		return backlogs[i].tenantID < backlogs[j].tenantID
+	})
+	if len(backlogs) > qb.newQuerierBacklogTenants {
+		backlogs = backlogs[:qb.newQuerierBacklogTenants]
+	}
+
+	for _, b := range backlogs {
+		current := tqa.tenantQuerierIDs[b.tenantID]
+		var replaced QuerierID
+		for member := range current {
+			if replaced == "" || len(tqa.querierTenantIDs[member]) > len(tqa.querierTenantIDs[replaced]) ||
+				(len(tqa.querierTenantIDs[member]) == len(tqa.querierTenantIDs[replaced]) && member < replaced) {
+				replaced = member
+			}
+		}
+		querierIDs := make(map[QuerierID]struct{}, len(current))
+		for member := range current {
+			if member != replaced {
+				querierIDs[member] = struct{}{}
+			}
+		}
+		querierIDs[querierID] = struct{}{}
+		tqa.setTenantQuerierIDs(b.tenantID, querierIDs)
+	}
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_AssignNewQuerierToBackloggedTenants(t *testing.T) {
+	setup := func(backlogTenants int) *queueBroker {
+		qb := newQueueBroker(100, 0)
+		qb.newQuerierBacklogTenants = backlogTenants
+		for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"} {
+			qb.addQuerierConnection(querierID)
+		}
+		for tenantID, depth := range map[TenantID]int{"tenant-large": 10, "tenant-medium": 5, "tenant-small": 1} {
+			for i := 0; i < depth; i++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "r"}, 2))
+			}
+		}
+		qb.addQuerierConnection("querier-5")
+		return qb
+	}
+
+	shuffled := setup(0).tenantQuerierAssignments.tenantQuerierIDs
+	qb := setup(2)
+	tqa := &qb.tenantQuerierAssignments
+
+	// the new querier lands in the shards of the most backlogged tenants, which keep their size
+	for _, tenantID := range []TenantID{"tenant-large", "tenant-medium"} {
+		assert.Contains(t, tqa.tenantQuerierIDs[tenantID], QuerierID("querier-5"))
+		assert.Len(t, tqa.tenantQuerierIDs[tenantID], 2)
+	}
+	// other tenants keep the shard computed by shuffle sharding
+	assert.Equal(t, shuffled["tenant-small"], tqa.tenantQuerierIDs["tenant-small"])
+
+	// the assignment is deterministic
+	assert.Equal(t, tqa.tenantQuerierIDs, setup(2).tenantQuerierAssignments.tenantQuerierIDs)
+
+	// reconnecting queriers are not assigned again
+	before := map[TenantID]map[QuerierID]struct{}{}
+	for tenantID, querierIDs := range tqa.tenantQuerierIDs {
+		before[tenantID] = querierIDs
+	}
+	qb.addQuerierConnection("querier-5")
+	assert.Equal(t, before, tqa.tenantQuerierIDs)
+	assert.NoError(t, isConsistent(qb))
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// nextBandForQuerier returns the priority band of the request the querier would be served next, and its tenant,
+// if the querier dequeued from the tenant index kept by the broker (see dequeueNextRequestForQuerier).
+// ok is false if the querier would not be served any request, or if the next request is only decided on dequeue,
+// as under weighted random tenant selection.
+//
+// The tenant and request are selected as a dequeue selects them, without dequeuing the request or advancing
+// the querier's tenant index. As when dequeuing, tenants retained by the lazy tenant removal policy are
+// removed if they have expired.
+func (qb *queueBroker) nextBandForQuerier(querierID QuerierID) (band int, tenantID TenantID, ok bool) {
+	querierID = qb.logicalQuerierID(querierID)
+	querier := qb.tenantQuerierAssignments.queriersByID[querierID]
+	if querier == nil || qb.tenantSelection == tenantSelectionWeightedRandom {
+		return 0, "", false
+	}
+
+	// tiered selection accounts for the dequeues it selects tenants for
+	contended, lowerTier, lowerTierIndex := qb.tierContendedDequeues, qb.tierLowerTierDequeues, qb.tierLowerTierIndex
+	tenant, _, err := qb.getNextTenantWithRequestsForQuerier(querier.lastTenantIndex, querierID)
+	qb.tierContendedDequeues, qb.tierLowerTierDequeues, qb.tierLowerTierIndex = contended, lowerTier, lowerTierIndex
+	if err != nil || tenant == nil {
+		return 0, "", false
+	}
+
+	request := qb.peekRequestForQuerier(tenant, querierID)
+	if request == nil {
+		return 0, "", false
+	}
+	return request.priority, tenant.tenantID, true
+}
+
+// peekRequestForQuerier returns the tenant's request which dequeueRequestForQuerier would dequeue for the querier,
+// without dequeuing it, or nil if it would dequeue none.
+func (qb *queueBroker) peekRequestForQuerier(tenant *queueTenant, querierID QuerierID) *tenantRequest {
+	match, frontIfNoMatch := qb.requestMatcherForQuerier(tenant, querierID)
+	var matched, front *tenantRequest
+	qb.visitTenantRequests(tenant.tenantID, func(request *tenantRequest) bool {
+		if front == nil {
+			front = request
+		}
+		if match == nil || match(request) {
+			matched = request
+			return false
+		}
+		return true
+	})
+	if matched == nil && frontIfNoMatch {
+		matched = front
+	}
+	return matched
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_NextBandForQuerier(t *testing.T) {
+	for name, setup := range map[string]func(qb *queueBroker){
+		"round-robin":          func(*queueBroker) {},
+		"tiered":               func(qb *queueBroker) { qb.tenantSelection = tenantSelectionTiered },
+		"striping":             func(qb *queueBroker) { qb.stripeTenantRequests = true },
+		"cache key affinity":   func(qb *queueBroker) { qb.cacheKeyAffinityMaxWait = time.Hour },
+		"fifo tenant ordering": func(qb *queueBroker) { qb.requestOrdering = RequestOrderingFIFO },
+	} {
+		t.Run(name, func(t *testing.T) {
+			qb := newQueueBroker(1000, 0)
+			setup(qb)
+			require.NoError(t, qb.setPriorityBands(3))
+			tqa := &qb.tenantQuerierAssignments
+			require.NoError(t, tqa.setTenantConfig("tenant-sharded", TenantConfig{Tier: 1}))
+			for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3"} {
+				qb.addQuerierConnection(querierID)
+			}
+
+			// tenants hold requests in mixed bands: only low, only high, and all of them in turn
+			for i := 0; i < 6; i++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-low", req: fmt.Sprintf("low-%d", i), priority: 0}, 0))
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-high", req: fmt.Sprintf("high-%d", i), priority: 2}, 0))
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-sharded", req: fmt.Sprintf("sharded-%d", i), priority: i % 3, cacheKey: fmt.Sprintf("key-%d", i%2)}, 2))
+			}
+
+			bands := map[int]bool{}
+			for dequeues := 0; !qb.isEmpty(); dequeues++ {
+				require.Less(t, dequeues, 100)
+				querierID := QuerierID(fmt.Sprintf("querier-%d", dequeues%3+1))
+				band, tenantID, ok := qb.nextBandForQuerier(querierID)
+
+				req, tenant, err := qb.dequeueNextRequestForQuerier(querierID)
+				require.NoError(t, err)
+				if req == nil {
+					assert.False(t, ok, "querier %s", querierID)
+					continue
+				}
+				require.True(t, ok, "querier %s", querierID)
+				assert.Equal(t, tenant.tenantID, tenantID, "querier %s", querierID)
+				assert.Equal(t, req.priority, band, "querier %s", querierID)
+				bands[band] = true
+				qb.completeRequest(req)
+			}
+			assert.Equal(t, map[int]bool{0: true, 1: true, 2: true}, bands)
+
+			_, _, ok := qb.nextBandForQuerier("querier-1")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestQueues_NextBandForQuerierUndecided(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 0))
+
+	_, _, ok := qb.nextBandForQuerier("unknown-querier")
+	assert.False(t, ok)
+
+	// the request is reported without being dequeued
+	band, tenantID, ok := qb.nextBandForQuerier("querier-1")
+	assert.True(t, ok)
+	assert.Equal(t, 0, band)
+	assert.Equal(t, TenantID("tenant-1"), tenantID)
+	assert.Equal(t, []any{"request"}, queuedRequests(qb, "tenant-1"))
+
+	// weighted random selection only draws the tenant on dequeue
+	qb.tenantSelection = tenantSelectionWeightedRandom
+	_, _, ok = qb.nextBandForQuerier("querier-1")
+	assert.False(t, ok)
+}
@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// brokerObserver receives notifications about queue broker state changes.
+// Callbacks are invoked synchronously by the broker and must not call back into it.
+// Callbacks left nil are not invoked.
+type brokerObserver struct {
+	// OnTenantUnsharded is called when a sharded tenant is assigned all queriers
+	// because the number of queriers shrank to or below the tenant's max queriers.
+	OnTenantUnsharded func(tenantID TenantID)
+
+	// OnEnqueueLatency is called with the time spent enqueueing a request for the tenant,
+	// whether or not the request was successfully enqueued.
+	OnEnqueueLatency func(tenantID TenantID, d time.Duration)
+
+	// OnTenantHighWatermark is called when the tenant's queue depth rises to the broker's high watermark.
+	// It is not called again for the tenant until OnTenantLowWatermark has been called.
+	OnTenantHighWatermark func(tenantID TenantID, depth int)
+
+	// OnTenantLowWatermark is called when the queue depth of a tenant which reached the high watermark
+	// falls back to the broker's low watermark.
+	OnTenantLowWatermark func(tenantID TenantID, depth int)
+
+	// OnTenantEnqueueBackpressure is called when the tenant's queue depth rises to the broker's enqueue backpressure
+	// queue length, and when it falls back to half of it, see checkTenantEnqueueBackpressure.
+	OnTenantEnqueueBackpressure func(tenantID TenantID, underBackpressure bool)
+
+	// OnRequestEvicted is called with each queued request evicted to admit a higher priority request
+	// under the broker's memory ceiling. The evicted request will not be dispatched and should be cancelled.
+	OnRequestEvicted func(tenantID TenantID, req Request)
+
+	// OnRequestExpired is called with each queued request dropped past its deadline on dequeue, see dropExpiredRequest.
+	// The expired request will not be dispatched and should be cancelled.
+	OnRequestExpired func(tenantID TenantID, req Request)
+
+	// OnTenantDedupDisabled is called when deduplication is disabled for the tenant because its deduplication keys
+	// reached the broker's cap. Duplicate requests of the tenant are enqueued from then on.
+	OnTenantDedupDisabled func(tenantID TenantID, keys int)
+
+	// OnTenantErrorBudgetExhausted is called when the tenant exhausts its error budget,
+	// with the time until which the dispatch of its requests is paused.
+	OnTenantErrorBudgetExhausted func(tenantID TenantID, pausedUntil time.Time)
+
+	// eventStream streams the state changes of the broker to its subscribers; nil until the first subscription.
+	eventStream *brokerEventStream
+}
+
+func (o *brokerObserver) requestEvicted(tenantID TenantID, req Request) {
+	if o != nil && o.OnRequestEvicted != nil {
+		o.OnRequestEvicted(tenantID, req)
+	}
+}
+
+func (o *brokerObserver) requestExpired(tenantID TenantID, req Request) {
+	if o != nil && o.OnRequestExpired != nil {
+		o.OnRequestExpired(tenantID, req)
+	}
+}
+
+func (o *brokerObserver) tenantDedupDisabled(tenantID TenantID, keys int) {
+	if o != nil && o.OnTenantDedupDisabled != nil {
+		o.OnTenantDedupDisabled(tenantID, keys)
+	}
+}
+
+func (o *brokerObserver) tenantErrorBudgetExhausted(tenantID TenantID, pausedUntil time.Time) {
+	if o != nil && o.OnTenantErrorBudgetExhausted != nil {
+		o.OnTenantErrorBudgetExhausted(tenantID, pausedUntil)
+	}
+}
+
+func (o *brokerObserver) tenantUnsharded(tenantID TenantID) {
+	if o != nil && o.OnTenantUnsharded != nil {
+		o.OnTenantUnsharded(tenantID)
+	}
+}
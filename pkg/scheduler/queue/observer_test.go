@@ -0,0 +1,40 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ObserverEnqueueLatency(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(1, 0)
+	qb.clock = clk
+
+	// artificially slow enqueue for tenant-slow
+	qb.payloadSizer = func(req Request) int64 {
+		if req == "slow" {
+			clk.Advance(50 * time.Millisecond)
+		}
+		return 0
+	}
+
+	latencies := map[TenantID][]time.Duration{}
+	qb.observer.OnEnqueueLatency = func(tenantID TenantID, d time.Duration) {
+		latencies[tenantID] = append(latencies[tenantID], d)
+	}
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-fast", req: "fast"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-slow", req: "slow"}, 0))
+	// rejected enqueues are measured too
+	require.ErrorIs(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-slow", req: "slow"}, 0), ErrTooManyRequests)
+
+	assert.Equal(t, map[TenantID][]time.Duration{
+		"tenant-fast": {0},
+		"tenant-slow": {50 * time.Millisecond, 50 * time.Millisecond},
+	}, latencies)
+}
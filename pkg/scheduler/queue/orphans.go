@@ -0,0 +1,238 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "sort"
+
+// OrphanReport enumerates the broker state which is not consistently referenced across
+// the tenant-querier assignments and the tenant queues. An empty report means no orphans were found.
+type OrphanReport struct {
+	// Querier IDs in a tenant querier ID set which are neither connected nor part of the
+	// authoritative querier set, by tenant.
+	DanglingTenantQueriers map[TenantID][]QuerierID
+	// Tenants whose slot in the tenant order does not point back to them; they are never dequeued from.
+	TenantsWithoutOrderSlot []TenantID
+	// Positions in the tenant order of tenant IDs which are not known tenants.
+	OrderSlotsWithoutTenant []int
+	// Tenant queues for which there is no known tenant.
+	QueuesWithoutTenant []TenantID
+	// Connected queriers missing from the sorted querier IDs, and sorted querier IDs which are not connected.
+	QueriersMissingFromSorted       []QuerierID
+	SortedQueriersWithoutConnection []QuerierID
+	// True if the sorted querier IDs are out of order or contain duplicates.
+	QuerierIDsNotSorted bool
+}
+
+// Empty returns true if the report contains no orphans.
+func (r OrphanReport) Empty() bool {
+	return len(r.DanglingTenantQueriers) == 0 &&
+		len(r.TenantsWithoutOrderSlot) == 0 &&
+		len(r.OrderSlotsWithoutTenant) == 0 &&
+		len(r.QueuesWithoutTenant) == 0 &&
+		len(r.QueriersMissingFromSorted) == 0 &&
+		len(r.SortedQueriersWithoutConnection) == 0 &&
+		!r.QuerierIDsNotSorted
+}
+
+// findOrphans scans the broker state for references which are not backed by the state they refer to,
+// as could be left behind by bugs, and reports all of them without modifying the state.
+func (qb *queueBroker) findOrphans() OrphanReport {
+	tqa := &qb.tenantQuerierAssignments
+	var report OrphanReport
+
+	authoritative := make(map[QuerierID]struct{}, len(tqa.authoritativeQuerierIDs))
+	for _, querierID := range tqa.authoritativeQuerierIDs {
+		authoritative[querierID] = struct{}{}
+	}
+	for tenantID, querierSet := range tqa.tenantQuerierIDs {
+		for querierID := range querierSet {
+			if _, ok := tqa.queriersByID[querierID]; ok {
+				continue
+			}
+			if _, ok := authoritative[querierID]; ok {
+				continue
+			}
+			if report.DanglingTenantQueriers == nil {
+				report.DanglingTenantQueriers = map[TenantID][]QuerierID{}
+			}
+			report.DanglingTenantQueriers[tenantID] = append(report.DanglingTenantQueriers[tenantID], querierID)
+		}
+	}
+	for _, querierIDs := range report.DanglingTenantQueriers {
+		sort.Sort(querierIDSlice(querierIDs))
+	}
+
+	for tenantID, tenant := range tqa.tenantsByID {
+		if tenant.orderIndex < 0 || tenant.orderIndex >= len(tqa.tenantIDOrder) || tqa.tenantIDOrder[tenant.orderIndex] != tenantID {
+			report.TenantsWithoutOrderSlot = append(report.TenantsWithoutOrderSlot, tenantID)
+		}
+	}
+	sort.Slice(report.TenantsWithoutOrderSlot, func(i, j int) bool {
+		return report.TenantsWithoutOrderSlot[i] < report.TenantsWithoutOrderSlot[j]
+	})
+
+	for i, tenantID := range tqa.tenantIDOrder {
+		if tenantID == emptyTenantID {
+			continue
+		}
+		if _, ok := tqa.tenantsByID[tenantID]; !ok {
+			report.OrderSlotsWithoutTenant = append(report.OrderSlotsWithoutTenant, i)
+		}
+	}
+
+	for _, name := range qb.tenantQueuesTree.childQueueOrder {
+		if _, ok := tqa.tenantsByID[TenantID(name)]; !ok {
+			report.QueuesWithoutTenant = append(report.QueuesWithoutTenant, TenantID(name))
+		}
+	}
+
+	sorted := make(map[QuerierID]struct{}, len(tqa.querierIDsSorted))
+	for i, querierID := range tqa.querierIDsSorted {
+		sorted[querierID] = struct{}{}
+		if i > 0 && tqa.querierIDsSorted[i-1] >= querierID {
+			report.QuerierIDsNotSorted = true
+		}
+		if _, ok := tqa.queriersByID[querierID]; !ok {
+			report.SortedQueriersWithoutConnection = append(report.SortedQueriersWithoutConnection, querierID)
+		}
+	}
+	for querierID, querier := range tqa.queriersByID {
+		if _, ok := sorted[querierID]; !ok && !querier.overflow {
+			report.QueriersMissingFromSorted = append(report.QueriersMissingFromSorted, querierID)
+		}
+	}
+	sort.Sort(querierIDSlice(report.QueriersMissingFromSorted))
+
+	return report
+}
+
+// RepairReport enumerates the actions taken by repairOrphans. An empty report means nothing needed repair.
+type RepairReport struct {
+	// Querier IDs removed from tenant querier ID sets by reshuffling the tenants, by tenant.
+	RemovedTenantQueriers map[TenantID][]QuerierID
+	// Tenants without an order slot which were removed, as their queue was empty.
+	RemovedTenants []TenantID
+	// Tenants without an order slot which were given a new slot, as they have queued requests.
+	ReinsertedTenants []TenantID
+	// Positions in the tenant order which were cleared, as they did not reference a known tenant.
+	ClearedOrderSlots []int
+	// Tenants re-created for tenant queues without a tenant, so that their queued requests can be dequeued;
+	// they can use all queriers until their next enqueue.
+	RecreatedTenants []TenantID
+	// True if the sorted querier IDs were rebuilt from the querier connections.
+	RebuiltSortedQuerierIDs bool
+}
+
+// Empty returns true if the report contains no repair actions.
+func (r RepairReport) Empty() bool {
+	return len(r.RemovedTenantQueriers) == 0 &&
+		len(r.RemovedTenants) == 0 &&
+		len(r.ReinsertedTenants) == 0 &&
+		len(r.ClearedOrderSlots) == 0 &&
+		len(r.RecreatedTenants) == 0 &&
+		!r.RebuiltSortedQuerierIDs
+}
+
+// repairOrphans brings the broker state back to a consistent one by repairing the orphans reported by findOrphans,
+// keeping queued requests wherever possible. Repair is idempotent: a consistent broker is left unchanged.
+func (qb *queueBroker) repairOrphans() RepairReport {
+	tqa := &qb.tenantQuerierAssignments
+	orphans := qb.findOrphans()
+	var report RepairReport
+
+	recomputed := false
+	if len(orphans.QueriersMissingFromSorted) > 0 || len(orphans.SortedQueriersWithoutConnection) > 0 || orphans.QuerierIDsNotSorted {
+		tqa.querierIDsSorted = make(querierIDSlice, 0, len(tqa.queriersByID))
+		for querierID, querier := range tqa.queriersByID {
+			if !querier.overflow {
+				tqa.querierIDsSorted = append(tqa.querierIDsSorted, querierID)
+			}
+		}
+		sort.Sort(tqa.querierIDsSorted)
+		report.RebuiltSortedQuerierIDs = true
+
+		if tqa.authoritativeQuerierIDs == nil {
+			// the tenant shards were computed from the diverged querier IDs
+			tqa.recomputeTenantQueriers()
+			recomputed = true
+		}
+	}
+
+	for _, i := range orphans.OrderSlotsWithoutTenant {
+		tqa.tenantIDOrder[i] = emptyTenantID
+		report.ClearedOrderSlots = append(report.ClearedOrderSlots, i)
+	}
+	tqa.shrinkTenantOrder()
+
+	for _, tenantID := range orphans.TenantsWithoutOrderSlot {
+		tenant := tqa.tenantsByID[tenantID]
+		if qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}) != nil {
+			tqa.insertTenantInOrder(tenant)
+			report.ReinsertedTenants = append(report.ReinsertedTenants, tenantID)
+			continue
+		}
+		// unlike removeTenant, do not clear the slot the tenant points to, which belongs to another tenant
+		tqa.setTenantHasQueuedRequests(tenant, false)
+		delete(tqa.tenantsByID, tenantID)
+		tqa.setTenantQuerierIDs(tenantID, nil)
+		delete(tqa.unshardedTenantIDs, tenantID)
+		delete(tqa.pendingTenantReshuffles, tenantID)
+		report.RemovedTenants = append(report.RemovedTenants, tenantID)
+	}
+
+	for _, tenantID := range orphans.QueuesWithoutTenant {
+		if err := tqa.createOrUpdateTenant(tenantID, 0); err != nil {
+			continue
+		}
+		tqa.setTenantHasQueuedRequests(tqa.tenantsByID[tenantID], true)
+		report.RecreatedTenants = append(report.RecreatedTenants, tenantID)
+	}
+
+	for tenantID, querierIDs := range orphans.DanglingTenantQueriers {
+		if _, ok := tqa.tenantsByID[tenantID]; !ok {
+			continue
+		}
+		if report.RemovedTenantQueriers == nil {
+			report.RemovedTenantQueriers = map[TenantID][]QuerierID{}
+		}
+		report.RemovedTenantQueriers[tenantID] = querierIDs
+	}
+	if len(report.RemovedTenantQueriers) > 0 && !recomputed {
+		// the queriers went away without the tenants being reshuffled, as removing them would have done
+		tqa.recomputeTenantQueriers()
+	}
+
+	if !report.Empty() {
+		qb.rebuildAssignmentIndexes()
+	}
+	return report
+}
+
+// rebuildAssignmentIndexes rebuilds the state derived from the tenants, their querier ID sets and their queues,
+// which orphans may have left stale.
+func (qb *queueBroker) rebuildAssignmentIndexes() {
+	tqa := &qb.tenantQuerierAssignments
+	for tenantID := range tqa.tenantQuerierIDs {
+		if _, ok := tqa.tenantsByID[tenantID]; !ok {
+			delete(tqa.tenantQuerierIDs, tenantID)
+		}
+	}
+
+	tqa.querierTenantIDs = map[QuerierID]map[TenantID]struct{}{}
+	tqa.unshardedTenantIDs = map[TenantID]struct{}{}
+	tqa.querierTenantsWithQueuedRequests = map[QuerierID]int{}
+	tqa.unshardedTenantsWithQueuedRequests = 0
+	tqa.shardedTenantCount, tqa.shardedQuerierEntries = 0, 0
+	for tenantID, tenant := range tqa.tenantsByID {
+		querierIDs := tqa.tenantQuerierIDs[tenantID]
+		tqa.updateQuerierTenantIndex(tenantID, nil, querierIDs)
+		if querierIDs != nil {
+			tqa.shardedTenantCount++
+			tqa.shardedQuerierEntries += len(querierIDs)
+		}
+		tenant.hasQueuedRequests = qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}) != nil
+		if tenant.hasQueuedRequests {
+			tqa.countTenantWithQueuedRequests(querierIDs, 1)
+		}
+	}
+}
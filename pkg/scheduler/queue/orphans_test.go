@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_FindOrphans(t *testing.T) {
+	newBroker := func(t *testing.T) *queueBroker {
+		qb := newQueueBroker(100, 0)
+		for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3"} {
+			qb.addQuerierConnection(querierID)
+		}
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1"}, 1))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "req-2"}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-3", req: "req-3"}, 2))
+		require.NoError(t, isConsistent(qb))
+		require.True(t, qb.findOrphans().Empty())
+		return qb
+	}
+
+	for testName, testData := range map[string]struct {
+		corrupt  func(qb *queueBroker)
+		expected OrphanReport
+	}{
+		"querier removed without reshuffling its tenants": {
+			corrupt: func(qb *queueBroker) {
+				tqa := &qb.tenantQuerierAssignments
+				tqa.tenantQuerierIDs["tenant-1"] = map[QuerierID]struct{}{"querier-gone": {}}
+				tqa.tenantQuerierIDs["tenant-3"] = map[QuerierID]struct{}{"querier-1": {}, "querier-gone": {}, "querier-lost": {}}
+			},
+			expected: OrphanReport{
+				DanglingTenantQueriers: map[TenantID][]QuerierID{
+					"tenant-1": {"querier-gone"},
+					"tenant-3": {"querier-gone", "querier-lost"},
+				},
+			},
+		},
+		"tenant without order slot": {
+			corrupt: func(qb *queueBroker) {
+				tqa := &qb.tenantQuerierAssignments
+				tqa.tenantIDOrder[tqa.tenantsByID["tenant-2"].orderIndex] = emptyTenantID
+				tqa.tenantsByID["tenant-3"].orderIndex = 10
+			},
+			expected: OrphanReport{
+				TenantsWithoutOrderSlot: []TenantID{"tenant-2", "tenant-3"},
+			},
+		},
+		"order slot and queue without tenant": {
+			corrupt: func(qb *queueBroker) {
+				delete(qb.tenantQuerierAssignments.tenantsByID, "tenant-2")
+			},
+			expected: OrphanReport{
+				OrderSlotsWithoutTenant: []int{1},
+				QueuesWithoutTenant:     []TenantID{"tenant-2"},
+			},
+		},
+		"sorted querier IDs diverged from querier connections": {
+			corrupt: func(qb *queueBroker) {
+				qb.tenantQuerierAssignments.querierIDsSorted = querierIDSlice{"querier-3", "querier-1", "querier-stale"}
+			},
+			expected: OrphanReport{
+				QueriersMissingFromSorted:       []QuerierID{"querier-2"},
+				SortedQueriersWithoutConnection: []QuerierID{"querier-stale"},
+				QuerierIDsNotSorted:             true,
+			},
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			qb := newBroker(t)
+			testData.corrupt(qb)
+
+			report := qb.findOrphans()
+			assert.Equal(t, testData.expected, report)
+			assert.False(t, report.Empty())
+		})
+	}
+}
+
+func TestQueues_FindOrphans_AuthoritativeQueriersAreNotDangling(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	qb.tenantQuerierAssignments.setAuthoritativeQueriers([]QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"})
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1"}, 2))
+	require.NotNil(t, qb.tenantQuerierAssignments.tenantQuerierIDs["tenant-1"])
+
+	assert.True(t, qb.findOrphans().Empty())
+}
+
+func TestQueues_RepairOrphans(t *testing.T) {
+	newBroker := func(t *testing.T) *queueBroker {
+		qb := newQueueBroker(100, 0)
+		for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3"} {
+			qb.addQuerierConnection(querierID)
+		}
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1"}, 1))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "req-2"}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-3", req: "req-3"}, 2))
+		require.True(t, qb.repairOrphans().Empty())
+		return qb
+	}
+
+	for testName, testData := range map[string]struct {
+		corrupt          func(qb *queueBroker)
+		expected         func(qb *queueBroker) RepairReport
+		expectedRequests int
+	}{
+		"querier forgotten without reshuffling its tenants": {
+			corrupt: func(qb *queueBroker) {
+				tqa := &qb.tenantQuerierAssignments
+				querierID := getTenantsQueriers(qb, "tenant-1")[0]
+				delete(tqa.queriersByID, querierID)
+				tqa.querierIDsSorted = nil
+				for id := range tqa.queriersByID {
+					tqa.querierIDsSorted = append(tqa.querierIDsSorted, id)
+				}
+				sort.Sort(tqa.querierIDsSorted)
+			},
+			expected: func(qb *queueBroker) RepairReport {
+				return RepairReport{RemovedTenantQueriers: qb.findOrphans().DanglingTenantQueriers}
+			},
+			expectedRequests: 3,
+		},
+		"tenant without order slot and with an empty queue": {
+			corrupt: func(qb *queueBroker) {
+				qb.tenantQuerierAssignments.tenantIDOrder[1] = emptyTenantID
+				qb.tenantQueuesTree.deleteNode(QueuePath{"tenant-2"})
+			},
+			expected: func(*queueBroker) RepairReport {
+				return RepairReport{RemovedTenants: []TenantID{"tenant-2"}}
+			},
+			expectedRequests: 2,
+		},
+		"tenant without order slot and with queued requests": {
+			corrupt: func(qb *queueBroker) {
+				qb.tenantQuerierAssignments.tenantIDOrder[1] = emptyTenantID
+			},
+			expected: func(*queueBroker) RepairReport {
+				return RepairReport{ReinsertedTenants: []TenantID{"tenant-2"}}
+			},
+			expectedRequests: 3,
+		},
+		"order slot and queue without tenant": {
+			corrupt: func(qb *queueBroker) {
+				delete(qb.tenantQuerierAssignments.tenantsByID, "tenant-2")
+			},
+			expected: func(*queueBroker) RepairReport {
+				return RepairReport{ClearedOrderSlots: []int{1}, RecreatedTenants: []TenantID{"tenant-2"}}
+			},
+			expectedRequests: 3,
+		},
+		"sorted querier IDs diverged from querier connections": {
+			corrupt: func(qb *queueBroker) {
+				qb.tenantQuerierAssignments.querierIDsSorted = querierIDSlice{"querier-3", "querier-1", "querier-stale"}
+			},
+			expected: func(*queueBroker) RepairReport {
+				return RepairReport{RebuiltSortedQuerierIDs: true}
+			},
+			expectedRequests: 3,
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			qb := newBroker(t)
+			testData.corrupt(qb)
+			expected := testData.expected(qb)
+
+			assert.Equal(t, expected, qb.repairOrphans())
+			require.NoError(t, isConsistent(qb))
+			assert.True(t, qb.findOrphans().Empty())
+
+			// repair is idempotent
+			assert.True(t, qb.repairOrphans().Empty())
+
+			// queued requests kept by the repair can be dequeued
+			dequeued := 0
+			for _, querierID := range qb.tenantQuerierAssignments.querierIDsSorted {
+				for {
+					req, _, _, err := qb.dequeueRequestForQuerier(-1, querierID)
+					require.NoError(t, err)
+					if req == nil {
+						break
+					}
+					dequeued++
+				}
+			}
+			assert.Equal(t, testData.expectedRequests, dequeued)
+			assert.True(t, qb.isEmpty())
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// Overflow queriers are a pool of queriers set aside to absorb bursts: they are not part of shuffle sharding,
+// so that the shards of the tenants are the same with or without them, and they only serve the tenants whose
+// queue depth exceeds the broker's overflowBacklogThreshold, rotating through them in tenant order.
+
+// addOverflowQuerierConnection registers a connection of the querier to the overflow pool, or returns
+// ErrInvalidQuerierID if the querier ID is rejected under the strict querier ID validation policy.
+// A connection of a querier already known to the broker is added to the querier in its current pool.
+func (qb *queueBroker) addOverflowQuerierConnection(querierID QuerierID) error {
+	if ok, err := qb.admitQuerierID(querierID); !ok {
+		return err
+	}
+	querierID = qb.logicalQuerierID(querierID)
+	qb.recorder.record(Event{Type: EventConnectOverflow, QuerierID: querierID})
+	qb.tenantQuerierAssignments.addOverflowQuerierConnection(querierID)
+	if querier := qb.tenantQuerierAssignments.queriersByID[querierID]; querier.lastDequeueAt.IsZero() {
+		querier.lastDequeueAt = qb.clock.Now()
+	}
+	return nil
+}
+
+// updateTenantOverflowBacklog records whether the tenant's queue depth exceeds the overflow threshold.
+func (qb *queueBroker) updateTenantOverflowBacklog(tenant *queueTenant) {
+	depth := 0
+	if queue := qb.tenantQueuesTree.getNode(QueuePath{string(tenant.tenantID)}); queue != nil {
+		depth = queue.ItemCount()
+	}
+	tenant.overflowBacklogged = depth > qb.overflowBacklogThreshold
+}
+
+func (tqa *tenantQuerierAssignments) addOverflowQuerierConnection(querierID QuerierID) {
+	if tqa.queriersByID[querierID] != nil {
+		tqa.addQuerierConnection(querierID)
+		return
+	}
+	// not added to the sorted querier IDs, so that the tenant shards are left unchanged
+	tqa.queriersByID[querierID] = &querierConn{connections: 1, lastTenantIndex: -1, overflow: true}
+	tqa.publish(BrokerEvent{Type: BrokerEventQuerierConnected, QuerierID: querierID})
+}
+
+// isOverflowQuerier returns true if the querier is connected as part of the overflow pool.
+func (tqa *tenantQuerierAssignments) isOverflowQuerier(querierID QuerierID) bool {
+	querier := tqa.queriersByID[querierID]
+	return querier != nil && querier.overflow
+}
+
+// overflowNextTenantForQuerier finds the next backlogged tenant after lastTenantIndex in the tenant order,
+// for an overflow querier.
+func (tqa *tenantQuerierAssignments) overflowNextTenantForQuerier(lastTenantIndex int) (*queueTenant, int) {
+	tenantOrderIndex := lastTenantIndex
+	for iters := 0; iters < len(tqa.tenantIDOrder); iters++ {
+		tenantOrderIndex++
+		if tenantOrderIndex >= len(tqa.tenantIDOrder) {
+			// do not wrap with modulo; see scanNextTenantForQuerier
+			tenantOrderIndex = 0
+		}
+
+		tenantID := tqa.tenantIDOrder[tenantOrderIndex]
+		if tenantID == emptyTenantID {
+			continue
+		}
+		if tenant := tqa.tenantsByID[tenantID]; tenant.overflowBacklogged {
+			return tenant, tenantOrderIndex
+		}
+		tqa.traceSkip(tenantID, SkipNotBacklogged)
+	}
+	return nil, lastTenantIndex
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_OverflowQueriers(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.overflowBacklogThreshold = 3
+	for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3"} {
+		qb.addQuerierConnection(querierID)
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-busy", req: fmt.Sprintf("busy-%d", i)}, 1))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-quiet", req: fmt.Sprintf("quiet-%d", i)}, 1))
+	}
+	busyShard := getTenantsQueriers(qb, "tenant-busy")
+	quietShard := getTenantsQueriers(qb, "tenant-quiet")
+
+	// overflow queriers leave the shards unchanged
+	qb.addOverflowQuerierConnection("overflow-1")
+	assert.Equal(t, busyShard, getTenantsQueriers(qb, "tenant-busy"))
+	assert.Equal(t, quietShard, getTenantsQueriers(qb, "tenant-quiet"))
+	assert.NoError(t, isConsistent(qb))
+	assert.True(t, qb.findOrphans().Empty())
+
+	// neither tenant is over the threshold yet
+	req, _, err := qb.dequeueNextRequestForQuerier("overflow-1")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+
+	// tenant-busy crosses the threshold and is served by the overflow querier until it falls back to it
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-busy", req: "busy-3"}, 1))
+	req, tenant, err := qb.dequeueNextRequestForQuerier("overflow-1")
+	require.NoError(t, err)
+	require.NotNil(t, req)
+	assert.Equal(t, TenantID("tenant-busy"), tenant.tenantID)
+	assert.Equal(t, "busy-0", req.req)
+
+	req, _, err = qb.dequeueNextRequestForQuerier("overflow-1")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+
+	// the overflow querier is removed without reshuffling the tenants
+	shuffles := qb.tenantQuerierAssignments.tenantShuffles
+	qb.removeQuerierConnection("overflow-1", time.Now())
+	assert.NotContains(t, qb.tenantQuerierAssignments.queriersByID, QuerierID("overflow-1"))
+	assert.Equal(t, shuffles, qb.tenantQuerierAssignments.tenantShuffles)
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_OverflowQueriersIgnoreTenantSelection(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.tenantSelection = tenantSelectionWeightedRandom
+	qb.overflowBacklogThreshold = 1
+	qb.addQuerierConnection("querier-1")
+	qb.addOverflowQuerierConnection("overflow-1")
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-quiet", req: "quiet-0"}, 0))
+	for i := 0; i < 2; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-busy", req: fmt.Sprintf("busy-%d", i)}, 0))
+	}
+
+	// the trace reports why tenants are left to the queriers of their shard
+	var skipped []SkipReason
+	qb.tenantQuerierAssignments.dequeueTrace = &skipped
+	req, tenant, err := qb.dequeueNextRequestForQuerier("overflow-1")
+	qb.tenantQuerierAssignments.dequeueTrace = nil
+	require.NoError(t, err)
+	require.NotNil(t, req)
+	assert.Equal(t, TenantID("tenant-busy"), tenant.tenantID)
+	assert.Equal(t, []SkipReason{{TenantID: "tenant-quiet", Cause: SkipNotBacklogged}}, skipped)
+
+	// back at the threshold
+	req, _, err = qb.dequeueNextRequestForQuerier("overflow-1")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+
+	dequeueN(t, qb, "querier-1", 2)
+	assert.True(t, qb.isEmpty())
+}
@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// tenantPayloadBytes returns the approximate total payload size of the tenant's queued requests,
+// as measured by the broker payload sizer on enqueue.
+// Returns false if no payload sizer is configured or the tenant is not known to the broker.
+func (qb *queueBroker) tenantPayloadBytes(tenantID TenantID) (int64, bool) {
+	if qb.payloadSizer == nil {
+		return 0, false
+	}
+	tenant := qb.tenantQuerierAssignments.tenantsByID[tenantID]
+	if tenant == nil {
+		return 0, false
+	}
+	return tenant.queuedPayloadBytes, true
+}
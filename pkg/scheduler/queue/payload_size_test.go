@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_TenantPayloadBytes(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+
+	// disabled by default
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "abc"}, 0))
+	_, ok := qb.tenantPayloadBytes("tenant-1")
+	assert.False(t, ok)
+	_, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+
+	qb.payloadSizer = func(req Request) int64 {
+		return int64(len(req.(string)))
+	}
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "abc"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "defgh"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "ij"}, 0))
+
+	size, ok := qb.tenantPayloadBytes("tenant-1")
+	assert.True(t, ok)
+	assert.Equal(t, int64(8), size)
+	size, ok = qb.tenantPayloadBytes("tenant-2")
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), size)
+	_, ok = qb.tenantPayloadBytes("tenant-unknown")
+	assert.False(t, ok)
+
+	// dequeue tenant-1, then tenant-2
+	req, _, idx, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	size, _ = qb.tenantPayloadBytes("tenant-1")
+	assert.Equal(t, int64(5), size)
+
+	// a request re-enqueued to the front is accounted again
+	require.NoError(t, qb.enqueueRequestFront(req, 0))
+	size, _ = qb.tenantPayloadBytes("tenant-1")
+	assert.Equal(t, int64(8), size)
+
+	_, _, _, err = qb.dequeueRequestForQuerier(idx, "querier-1")
+	require.NoError(t, err)
+	_, ok = qb.tenantPayloadBytes("tenant-2")
+	assert.False(t, ok, "tenant-2 is removed once its queue is emptied")
+}
+
+func TestQueues_TenantPayloadBytes_DedupReplace(t *testing.T) {
+	for _, movesToBack := range []bool{false, true} {
+		qb := newQueueBroker(100, 0)
+		qb.dedupMode = dedupReplaceWithLatest
+		qb.dedupReplaceMovesToBack = movesToBack
+		qb.payloadSizer = func(req Request) int64 {
+			return int64(len(req.(string)))
+		}
+
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "abc", key: "a"}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "abcdefg", key: "a"}, 0))
+
+		size, ok := qb.tenantPayloadBytes("tenant-1")
+		assert.True(t, ok)
+		assert.Equal(t, int64(7), size)
+	}
+}
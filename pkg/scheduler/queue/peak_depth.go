@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// recordPeakDepth raises the tenant's peak queue depth to its current queue depth, if higher.
+func (qb *queueBroker) recordPeakDepth(tenant *queueTenant) {
+	if depth := qb.tenantDepth(tenant.tenantID); depth > tenant.peakDepth {
+		tenant.peakDepth = depth
+	}
+}
+
+// tenantPeakDepth returns the highest queue depth the tenant reached since it was added to the broker, or since
+// the peak depths were last reset. Returns false if the tenant is unknown; the peak depth of a removed tenant is lost.
+func (qb *queueBroker) tenantPeakDepth(tenantID TenantID) (int, bool) {
+	tenant := qb.tenantQuerierAssignments.tenantsByID[tenantID]
+	if tenant == nil {
+		return 0, false
+	}
+	return tenant.peakDepth, true
+}
+
+// resetPeakDepths starts a new measurement window of the peak queue depths, from the current queue depth of each tenant.
+func (qb *queueBroker) resetPeakDepths() {
+	for tenantID, tenant := range qb.tenantQuerierAssignments.tenantsByID {
+		tenant.peakDepth = qb.tenantDepth(tenantID)
+	}
+}
+
+func (qb *queueBroker) tenantDepth(tenantID TenantID) int {
+	if node := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}); node != nil {
+		return node.ItemCount()
+	}
+	return 0
+}
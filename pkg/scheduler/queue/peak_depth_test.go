@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_TenantPeakDepth(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+
+	_, ok := qb.tenantPeakDepth("tenant-1")
+	assert.False(t, ok)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+	}
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: 0}, 0))
+	dequeued := dequeueN(t, qb, "querier-1", 4)
+
+	// the peak is the maximum depth reached, not the current depth
+	peak, ok := qb.tenantPeakDepth("tenant-1")
+	require.True(t, ok)
+	assert.Equal(t, 5, peak)
+	assert.Len(t, queuedRequests(qb, "tenant-1"), 2)
+
+	// requeueing to the front and enqueueing up to the previous peak leave the peak unchanged
+	for _, request := range dequeued {
+		if request.tenantID == "tenant-1" {
+			require.NoError(t, qb.enqueueRequestFront(request, 0))
+			break
+		}
+	}
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: 5}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: 6}, 0))
+	peak, _ = qb.tenantPeakDepth("tenant-1")
+	assert.Equal(t, 5, peak)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: 7}, 0))
+	peak, _ = qb.tenantPeakDepth("tenant-1")
+	assert.Equal(t, 6, peak)
+
+	// the peak depth of a removed tenant is lost
+	_, ok = qb.tenantPeakDepth("tenant-2")
+	assert.False(t, ok)
+}
+
+func TestQueues_TenantPeakDepth_Reset(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	for i := 0; i < 10; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+	}
+	dequeueN(t, qb, "querier-1", 7)
+
+	// a new measurement window starts from the current depth
+	qb.resetPeakDepths()
+	peak, ok := qb.tenantPeakDepth("tenant-1")
+	require.True(t, ok)
+	assert.Equal(t, 3, peak)
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: 10}, 0))
+	dequeueN(t, qb, "querier-1", 3)
+	peak, _ = qb.tenantPeakDepth("tenant-1")
+	assert.Equal(t, 4, peak)
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// pinTenantShard overrides shuffle sharding for the tenant, restricting it to exactly the given queriers
+// until unpinTenantShard is called. The queriers must currently be connected.
+//
+// This is a manual override meant for tests and incident response, and it bypasses every safeguard of shuffle sharding:
+// the pin is kept regardless of the tenant's max queriers, whether sharding is disabled, the assignment memory limit
+// and the sharded tenant cap, and it is not recorded for replay. Pinned queriers which go away are dropped from the
+// tenant's shard without replacement; once all of them are gone, the tenant's requests are not dispatched to any querier
+// until the tenant is unpinned or re-pinned. Pinning many tenants to the same queriers also defeats the isolation
+// shuffle sharding provides between tenants.
+func (tqa *tenantQuerierAssignments) pinTenantShard(tenantID TenantID, queriers []QuerierID) error {
+	if tenantID == emptyTenantID {
+		return ErrInvalidTenantID
+	}
+	if len(queriers) == 0 {
+		return ErrInvalidPinnedShard
+	}
+	pinned := make(map[QuerierID]struct{}, len(queriers))
+	for _, querierID := range queriers {
+		if _, ok := tqa.queriersByID[querierID]; !ok {
+			return ErrInvalidPinnedShard
+		}
+		pinned[querierID] = struct{}{}
+	}
+	tqa.pinnedTenantShards[tenantID] = pinned
+	tqa.shuffleTenantQueriers(tenantID, nil)
+	return nil
+}
+
+// unpinTenantShard removes the tenant's pinned shard, if any, and restores its shuffle shard.
+func (tqa *tenantQuerierAssignments) unpinTenantShard(tenantID TenantID) {
+	if _, ok := tqa.pinnedTenantShards[tenantID]; !ok {
+		return
+	}
+	delete(tqa.pinnedTenantShards, tenantID)
+	tqa.shuffleTenantQueriers(tenantID, nil)
+}
+
+// livePinnedQuerierIDs returns the pinned queriers which are still known, as a new set.
+func (tqa *tenantQuerierAssignments) livePinnedQuerierIDs(pinned map[QuerierID]struct{}) map[QuerierID]struct{} {
+	querierIDs := make(map[QuerierID]struct{}, len(pinned))
+	for querierID := range pinned {
+		if _, ok := tqa.queriersByID[querierID]; ok {
+			querierIDs[querierID] = struct{}{}
+		}
+	}
+	return querierIDs
+}
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_PinTenantShard(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"} {
+		qb.addQuerierConnection(querierID)
+	}
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r1"}, 2))
+	shuffled := tqa.tenantQuerierIDs["tenant-1"]
+	require.Len(t, shuffled, 2)
+
+	assert.ErrorIs(t, tqa.pinTenantShard("tenant-1", nil), ErrInvalidPinnedShard)
+	assert.ErrorIs(t, tqa.pinTenantShard("tenant-1", []QuerierID{"querier-1", "unknown"}), ErrInvalidPinnedShard)
+	assert.Equal(t, shuffled, tqa.tenantQuerierIDs["tenant-1"])
+
+	pinned := map[QuerierID]struct{}{"querier-1": {}, "querier-2": {}, "querier-3": {}}
+	require.NoError(t, tqa.pinTenantShard("tenant-1", []QuerierID{"querier-1", "querier-2", "querier-3"}))
+	assert.Equal(t, pinned, tqa.tenantQuerierIDs["tenant-1"])
+	assert.NoError(t, isConsistent(qb))
+
+	// the pinned shard survives reshuffles caused by queriers joining and the tenant's max queriers changing
+	qb.addQuerierConnection("querier-5")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r2"}, 1))
+	assert.Equal(t, pinned, tqa.tenantQuerierIDs["tenant-1"])
+
+	// pinned queriers which go away are dropped without replacement
+	qb.removeQuerierConnection("querier-3", qb.clock.Now())
+	assert.Equal(t, map[QuerierID]struct{}{"querier-1": {}, "querier-2": {}}, tqa.tenantQuerierIDs["tenant-1"])
+
+	// the pin is retained when the tenant is removed and re-created
+	dequeueN(t, qb, "querier-1", 2)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r3"}, 1))
+	assert.Equal(t, map[QuerierID]struct{}{"querier-1": {}, "querier-2": {}}, tqa.tenantQuerierIDs["tenant-1"])
+	assert.NoError(t, isConsistent(qb))
+
+	// unpinning restores the shuffle shard
+	tqa.unpinTenantShard("tenant-1")
+	assert.Len(t, tqa.tenantQuerierIDs["tenant-1"], 1)
+	assert.NoError(t, isConsistent(qb))
+}
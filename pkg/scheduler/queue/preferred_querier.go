@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// setTenantPreferredQuerier routes the tenant's dequeues preferentially to the querier, e.g. to migrate the tenant's
+// work to a querier with warm state: while the preferred querier is available, it is offered the tenant first
+// whenever it asks for a request, and the other queriers of the tenant's shard skip the tenant.
+// The preferred querier is available while it is connected, not shutting down, and part of the tenant's shard;
+// otherwise the tenant is dequeued as usual. An empty querier ID clears the preference.
+func (qb *queueBroker) setTenantPreferredQuerier(tenantID TenantID, querierID QuerierID) {
+	if querierID == "" {
+		delete(qb.tenantPreferredQueriers, tenantID)
+		return
+	}
+	if qb.tenantPreferredQueriers == nil {
+		qb.tenantPreferredQueriers = map[TenantID]QuerierID{}
+	}
+	qb.tenantPreferredQueriers[tenantID] = qb.logicalQuerierID(querierID)
+}
+
+// availablePreferredQuerier returns the preferred querier of the tenant if it is available,
+// or an empty querier ID if the tenant has no preferred querier or it is unavailable.
+func (qb *queueBroker) availablePreferredQuerier(tenantID TenantID) QuerierID {
+	querierID, ok := qb.tenantPreferredQueriers[tenantID]
+	if !ok {
+		return ""
+	}
+	tqa := &qb.tenantQuerierAssignments
+	if q := tqa.queriersByID[querierID]; q == nil || q.connections == 0 || q.shuttingDown || q.overflow {
+		return ""
+	}
+	if tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]; tenantQuerierSet != nil {
+		if _, ok := tenantQuerierSet[querierID]; !ok {
+			return ""
+		}
+	}
+	return querierID
+}
+
+// tenantReservedForPreferredQuerier returns true if the tenant's dequeues are routed to another available querier.
+func (qb *queueBroker) tenantReservedForPreferredQuerier(tenantID TenantID, querierID QuerierID) bool {
+	preferred := qb.availablePreferredQuerier(tenantID)
+	return preferred != "" && preferred != querierID
+}
+
+// preferredTenantForQuerier returns the dispatchable tenant with queued requests which prefers the querier,
+// first in the tenant order, or nil if there is none.
+func (qb *queueBroker) preferredTenantForQuerier(querierID QuerierID) *queueTenant {
+	var preferred *queueTenant
+	for tenantID := range qb.tenantPreferredQueriers {
+		if qb.availablePreferredQuerier(tenantID) != querierID {
+			continue
+		}
+		tenant := qb.tenantQuerierAssignments.tenantsByID[tenantID]
+		if tenant == nil || (preferred != nil && preferred.orderIndex < tenant.orderIndex) {
+			continue
+		}
+		if qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}) == nil || !qb.tenantDispatchableToQuerier(tenantID, querierID) {
+			continue
+		}
+		preferred = tenant
+	}
+	return preferred
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_PreferredQuerier(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3"} {
+		require.NoError(t, qb.addQuerierConnection(querierID))
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: i}, 0))
+	}
+	qb.setTenantPreferredQuerier("tenant-2", "querier-3")
+
+	// the other queriers skip the tenant while its preferred querier is available
+	for _, request := range dequeueN(t, qb, "querier-1", 3) {
+		assert.Equal(t, TenantID("tenant-1"), request.tenantID)
+	}
+	request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-2")
+	require.NoError(t, err)
+	assert.Nil(t, request)
+
+	// the preferred querier is offered the tenant first
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: 3}, 0))
+	request, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-3")
+	require.NoError(t, err)
+	require.NotNil(t, request)
+	assert.Equal(t, TenantID("tenant-2"), request.tenantID)
+
+	// clearing the preference restores the normal behavior
+	qb.setTenantPreferredQuerier("tenant-2", "")
+	assert.Empty(t, qb.tenantPreferredQueriers)
+	var tenantIDs []TenantID
+	for _, request := range dequeueN(t, qb, "querier-1", 3) {
+		tenantIDs = append(tenantIDs, request.tenantID)
+	}
+	assert.ElementsMatch(t, []TenantID{"tenant-1", "tenant-2", "tenant-2"}, tenantIDs)
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_PreferredQuerier_Unavailable(t *testing.T) {
+	for name, makeUnavailable := range map[string]func(qb *queueBroker){
+		"disconnected": func(qb *queueBroker) {
+			qb.removeQuerierConnection("querier-2", time.Now())
+		},
+		"shutting down": func(qb *queueBroker) {
+			qb.notifyQuerierShutdown("querier-2")
+		},
+		"outside the shard": func(qb *queueBroker) {
+			tqa := &qb.tenantQuerierAssignments
+			tqa.tenantQuerierIDs["tenant-1"] = map[QuerierID]struct{}{"querier-1": {}}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			qb := newQueueBroker(100, time.Minute)
+			require.NoError(t, qb.addQuerierConnection("querier-1"))
+			require.NoError(t, qb.addQuerierConnection("querier-2"))
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r"}, 0))
+			qb.setTenantPreferredQuerier("tenant-1", "querier-2")
+			assert.True(t, qb.tenantReservedForPreferredQuerier("tenant-1", "querier-1"))
+
+			// the tenant falls back to the normal behavior while its preferred querier is unavailable
+			makeUnavailable(qb)
+			assert.False(t, qb.tenantReservedForPreferredQuerier("tenant-1", "querier-1"))
+			dequeueN(t, qb, "querier-1", 1)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "container/list"
+
+// The sub-queues of tenant queues are ordered by descending request priority, unless the tenant's request ordering
+// says otherwise.
+// Within a priority, requests enqueued to the back keep their FIFO order, while requests re-enqueued to the front
+// go ahead of the other requests of their priority. When all requests have the same priority,
+// the tenant queue is a plain FIFO queue.
+
+// placeRequest moves a request just pushed to the back or the front of the tenant queue
+// to its place according to the tenant's request ordering.
+func (qb *queueBroker) placeRequest(tenant *queueTenant, queuePath QueuePath, elem *list.Element) {
+	ordering := qb.tenantRequestOrdering(tenant)
+	if ordering == RequestOrderingFIFO {
+		return
+	}
+	queue := qb.tenantQueuesTree.getNode(queuePath).localQueue
+	request := elem.Value.(*tenantRequest)
+
+	// pushed to the back: move ahead of the requests it is ordered before
+	for prev := elem.Prev(); prev != nil && orderedBefore(ordering, request, prev.Value.(*tenantRequest)); prev = elem.Prev() {
+		queue.MoveBefore(elem, prev)
+	}
+	// pushed to the front: move behind the requests ordered before it
+	for next := elem.Next(); next != nil && orderedBefore(ordering, next.Value.(*tenantRequest), request); next = elem.Next() {
+		queue.MoveAfter(elem, next)
+	}
+}
+
+// reprioritizeRequest changes the priority of a queued request, moving it within its tenant queue.
+//
+// Reclassification is stable: the request is placed among the requests of its new priority
+// according to its enqueue sequence number, so that requests which end up at the same priority
+// keep the order in which they were enqueued, however they got there.
+// Under FIFO request ordering, the request keeps its place. Returns false if the request is not queued
+// or its tenant is frozen.
+func (qb *queueBroker) reprioritizeRequest(request *tenantRequest, priority int) bool {
+	queue := qb.tenantQueuesTree.getNode(qb.requestQueuePath(request))
+	tenant := qb.tenantQuerierAssignments.tenantsByID[request.tenantID]
+	if queue == nil || queue.localQueue == nil || tenant == nil || qb.tenantFrozen(request.tenantID) {
+		return false
+	}
+	ordering := qb.tenantRequestOrdering(tenant)
+
+	var elem *list.Element
+	for e := queue.localQueue.Front(); e != nil; e = e.Next() {
+		if e.Value == request {
+			elem = e
+			break
+		}
+	}
+	if elem == nil {
+		return false
+	}
+
+	if ordering == RequestOrderingFIFO {
+		request.priority = priority
+		return true
+	}
+
+	queue.localQueue.Remove(elem)
+	request.priority = priority
+	for e := queue.localQueue.Front(); e != nil; e = e.Next() {
+		other := e.Value.(*tenantRequest)
+		if orderedBefore(ordering, request, other) || (!orderedBefore(ordering, other, request) && other.seq > request.seq) {
+			queue.localQueue.InsertBefore(request, e)
+			return true
+		}
+	}
+	queue.localQueue.PushBack(request)
+	return true
+}
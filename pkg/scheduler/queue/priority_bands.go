@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "fmt"
+
+// defaultMaxPriorityBands is the maximum number of priority bands when the broker does not configure one.
+const defaultMaxPriorityBands = 16
+
+// setPriorityBands configures the number of priority bands of the broker; 0 configures a single band,
+// so that all requests have the same priority.
+// Returns ErrInvalidPriorityBands if the number of bands is negative or exceeds the maximum number of priority bands.
+func (qb *queueBroker) setPriorityBands(bands int) error {
+	if err := qb.tenantQuerierAssignments.validatePriorityBands(bands); err != nil {
+		return err
+	}
+	if bands == 0 {
+		bands = 1
+	}
+	qb.priorityBands = bands
+	return nil
+}
+
+// validatePriorityBands checks a configured number of priority bands against the maximum number of priority bands.
+func (tqa *tenantQuerierAssignments) validatePriorityBands(bands int) error {
+	maxBands := tqa.maxPriorityBands
+	if maxBands <= 0 {
+		maxBands = defaultMaxPriorityBands
+	}
+	if bands < 0 || bands > maxBands {
+		return fmt.Errorf("%w: %d bands configured, must be between 0 and %d", ErrInvalidPriorityBands, bands, maxBands)
+	}
+	return nil
+}
+
+// priorityBand clamps a request priority to the priority bands of the tenant.
+func (qb *queueBroker) priorityBand(tenant *queueTenant, priority int) int {
+	bands := qb.priorityBands
+	if tenant.priorityBands > 0 {
+		bands = tenant.priorityBands
+	}
+	if bands <= 0 {
+		return priority
+	}
+	return min(max(priority, 0), bands-1)
+}
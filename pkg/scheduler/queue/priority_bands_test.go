@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_SetPriorityBands(t *testing.T) {
+	for testName, testData := range map[string]struct {
+		maxPriorityBands int
+		bands            int
+		expectedBands    int
+		expectedErr      bool
+	}{
+		"valid band count": {
+			bands:         4,
+			expectedBands: 4,
+		},
+		"zero defaults to a single band": {
+			bands:         0,
+			expectedBands: 1,
+		},
+		"default maximum": {
+			bands:         defaultMaxPriorityBands,
+			expectedBands: defaultMaxPriorityBands,
+		},
+		"over the default maximum": {
+			bands:       defaultMaxPriorityBands + 1,
+			expectedErr: true,
+		},
+		"over a configured maximum": {
+			maxPriorityBands: 3,
+			bands:            4,
+			expectedErr:      true,
+		},
+		"negative": {
+			bands:       -1,
+			expectedErr: true,
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.tenantQuerierAssignments.maxPriorityBands = testData.maxPriorityBands
+
+			err := qb.setPriorityBands(testData.bands)
+			if testData.expectedErr {
+				require.ErrorIs(t, err, ErrInvalidPriorityBands)
+				assert.Zero(t, qb.priorityBands)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectedBands, qb.priorityBands)
+		})
+	}
+}
+
+func TestQueues_PriorityBandsClampRequestPriorities(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	require.NoError(t, qb.setPriorityBands(0))
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-banded", TenantConfig{PriorityBands: 3}))
+
+	for _, priority := range []int{-1, 0, 1, 2, 5} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-single", req: priority, priority: priority}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-banded", req: priority, priority: priority}, 0))
+	}
+
+	// a single band keeps the queue FIFO
+	assert.Equal(t, []any{-1, 0, 1, 2, 5}, queuedRequests(qb, "tenant-single"))
+	// the tenant override has bands 0 to 2
+	assert.Equal(t, []any{2, 5, 1, -1, 0}, queuedRequests(qb, "tenant-banded"))
+}
+
+func TestQueues_TenantPriorityBandsOverMaximum(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.tenantQuerierAssignments.maxPriorityBands = 4
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-1", TenantConfig{PriorityBands: 5}))
+
+	err := qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req"}, 0)
+	require.ErrorIs(t, err, ErrInvalidPriorityBands)
+	assert.Nil(t, qb.tenantQuerierAssignments.tenantsByID["tenant-1"])
+
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-1", TenantConfig{PriorityBands: 4}))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req"}, 0))
+	assert.NoError(t, isConsistent(qb))
+}
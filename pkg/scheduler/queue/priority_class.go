@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/grafana/dskit/httpgrpc"
+)
+
+// PriorityClassHeader is the HTTP header query requests set their priority class with, see ParsePriorityClass.
+const PriorityClassHeader = "Query-Priority"
+
+// PriorityClass is the priority of a query request within its tenant's queue: each class has its own sub-queue
+// of the tenant queue, and a tenant's queued requests of a higher class are dequeued before its requests
+// of a lower class, unless the lower class has waited longer than the broker's priority class max wait.
+// The class does not change how the queriers are shared between tenants.
+type PriorityClass int
+
+const (
+	PriorityClassBackground PriorityClass = iota - 1
+	PriorityClassNormal
+	PriorityClassInteractive
+)
+
+// priorityClasses lists the priority classes from the highest down.
+var priorityClasses = [...]PriorityClass{PriorityClassInteractive, PriorityClassNormal, PriorityClassBackground}
+
+func (c PriorityClass) String() string {
+	switch c {
+	case PriorityClassBackground:
+		return "background"
+	case PriorityClassInteractive:
+		return "interactive"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriorityClass returns the priority class named by s, case-insensitively.
+// Empty or unknown names are the normal class, so that a request never gains priority by mistake.
+func ParsePriorityClass(s string) PriorityClass {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "background":
+		return PriorityClassBackground
+	case "interactive":
+		return PriorityClassInteractive
+	default:
+		return PriorityClassNormal
+	}
+}
+
+// PriorityClassFromHTTPGRPCRequest returns the priority class set by the request's PriorityClassHeader.
+func PriorityClassFromHTTPGRPCRequest(req *httpgrpc.HTTPRequest) PriorityClass {
+	if req == nil {
+		return PriorityClassNormal
+	}
+	for _, h := range req.Headers {
+		if http.CanonicalHeaderKey(h.Key) == PriorityClassHeader && len(h.Values) > 0 {
+			return ParsePriorityClass(h.Values[0])
+		}
+	}
+	return PriorityClassNormal
+}
+
+// PrioritizedRequest is implemented by requests which carry a priority class. RequestQueue enqueues them
+// in the sub-queue of their class, and other requests in the sub-queue of the normal class.
+type PrioritizedRequest interface {
+	PriorityClass() PriorityClass
+}
+
+// requestPriorityClass returns the priority class a request is enqueued with by RequestQueue.
+func requestPriorityClass(req Request) PriorityClass {
+	if r, ok := req.(PrioritizedRequest); ok {
+		return r.PriorityClass()
+	}
+	return PriorityClassNormal
+}
+
+// tenantPriorityClassOrder returns the priority classes the tenant has queued requests of, in the order they are
+// dequeued from: the classes whose front request has waited longer than the broker's priorityClassMaxWait,
+// from the highest class down, then the other classes from the highest class down. Bounding the wait this way
+// keeps a steady stream of higher class requests from starving the lower classes.
+//
+// The classes are returned in an array, the first n of which are set, so that dequeues do not allocate.
+func (qb *queueBroker) tenantPriorityClassOrder(tenantID TenantID) (order [len(priorityClasses)]PriorityClass, n int) {
+	tenantQueue := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)})
+	if tenantQueue == nil {
+		return order, 0
+	}
+	var queued, overdue [len(priorityClasses)]bool
+	for i, class := range priorityClasses {
+		classQueue := tenantQueue.childQueueMap[class.String()]
+		if classQueue == nil {
+			continue
+		}
+		queued[i] = true
+		if qb.priorityClassMaxWait > 0 && i > 0 {
+			front, ok := classQueue.front().(*tenantRequest)
+			overdue[i] = ok && qb.clock.Now().Sub(front.enqueueTime) > qb.priorityClassMaxWait
+		}
+	}
+	for i, class := range priorityClasses {
+		if overdue[i] {
+			order[n] = class
+			n++
+		}
+	}
+	for i, class := range priorityClasses {
+		if queued[i] && !overdue[i] {
+			order[n] = class
+			n++
+		}
+	}
+	return order, n
+}
+
+// dequeueMatchingFromTenantQueue removes and returns the first of the tenant's requests for which match returns true,
+// searching its priority class sub-queues in the order they are dequeued from, or nil if no request matches.
+func (qb *queueBroker) dequeueMatchingFromTenantQueue(tenantID TenantID, match func(v any) bool) any {
+	order, n := qb.tenantPriorityClassOrder(tenantID)
+	for _, class := range order[:n] {
+		if v := qb.tenantQueuesTree.dequeueMatchingByPath(QueuePath{string(tenantID), class.String()}, match); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+type priorityClassContextKey struct{}
+
+// ContextWithPriorityClass returns a context carrying the priority class of the request being handled,
+// so that it can be propagated to the requests it is split into, see InjectPriorityClassIntoHTTPRequest.
+func ContextWithPriorityClass(ctx context.Context, c PriorityClass) context.Context {
+	return context.WithValue(ctx, priorityClassContextKey{}, c)
+}
+
+// PriorityClassFromContext returns the priority class carried by the context, if any.
+func PriorityClassFromContext(ctx context.Context) (PriorityClass, bool) {
+	c, ok := ctx.Value(priorityClassContextKey{}).(PriorityClass)
+	return c, ok
+}
+
+// InjectPriorityClassIntoHTTPRequest sets the request's PriorityClassHeader to the priority class carried by the context,
+// if any.
+func InjectPriorityClassIntoHTTPRequest(ctx context.Context, r *http.Request) {
+	if c, ok := PriorityClassFromContext(ctx); ok {
+		r.Header.Set(PriorityClassHeader, c.String())
+	}
+}
+
+// InjectPriorityClassIntoHTTPGRPCRequest sets the request's PriorityClassHeader to the priority class carried by the context,
+// if any, replacing the class the request was set before.
+func InjectPriorityClassIntoHTTPGRPCRequest(ctx context.Context, req *httpgrpc.HTTPRequest) {
+	c, ok := PriorityClassFromContext(ctx)
+	if !ok {
+		return
+	}
+	headers := req.Headers[:0]
+	for _, h := range req.Headers {
+		if http.CanonicalHeaderKey(h.Key) != PriorityClassHeader {
+			headers = append(headers, h)
+		}
+	}
+	req.Headers = append(headers, &httpgrpc.Header{Key: PriorityClassHeader, Values: []string{c.String()}})
+}
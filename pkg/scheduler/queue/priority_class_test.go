@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
+)
+
+type prioritizedRequest struct {
+	name  string
+	class PriorityClass
+}
+
+func (r prioritizedRequest) PriorityClass() PriorityClass {
+	return r.class
+}
+
+func TestParsePriorityClass(t *testing.T) {
+	for s, expected := range map[string]PriorityClass{
+		"background":    PriorityClassBackground,
+		"Interactive":   PriorityClassInteractive,
+		" normal ":      PriorityClassNormal,
+		"":              PriorityClassNormal,
+		"most-urgent!!": PriorityClassNormal,
+	} {
+		assert.Equal(t, expected, ParsePriorityClass(s), s)
+	}
+
+	for _, c := range []PriorityClass{PriorityClassBackground, PriorityClassNormal, PriorityClassInteractive} {
+		assert.Equal(t, c, ParsePriorityClass(c.String()))
+	}
+}
+
+func TestPriorityClassFromHTTPGRPCRequest(t *testing.T) {
+	assert.Equal(t, PriorityClassNormal, PriorityClassFromHTTPGRPCRequest(nil))
+	assert.Equal(t, PriorityClassNormal, PriorityClassFromHTTPGRPCRequest(&httpgrpc.HTTPRequest{}))
+	assert.Equal(t, PriorityClassBackground, PriorityClassFromHTTPGRPCRequest(&httpgrpc.HTTPRequest{
+		Headers: []*httpgrpc.Header{{Key: "X-Scope-OrgID", Values: []string{"user-1"}}, {Key: "query-priority", Values: []string{"background"}}},
+	}))
+}
+
+func TestInjectPriorityClassIntoHTTPRequest(t *testing.T) {
+	req, err := http.NewRequest(http.MethodGet, "/api/v1/query", nil)
+	require.NoError(t, err)
+
+	InjectPriorityClassIntoHTTPRequest(context.Background(), req)
+	assert.Empty(t, req.Header.Get(PriorityClassHeader))
+
+	InjectPriorityClassIntoHTTPRequest(ContextWithPriorityClass(context.Background(), PriorityClassInteractive), req)
+	assert.Equal(t, "interactive", req.Header.Get(PriorityClassHeader))
+}
+
+func TestInjectPriorityClassIntoHTTPGRPCRequest(t *testing.T) {
+	req := &httpgrpc.HTTPRequest{
+		Headers: []*httpgrpc.Header{{Key: "X-Scope-OrgID", Values: []string{"user-1"}}, {Key: "query-priority", Values: []string{"background"}}},
+	}
+
+	InjectPriorityClassIntoHTTPGRPCRequest(context.Background(), req)
+	assert.Equal(t, PriorityClassBackground, PriorityClassFromHTTPGRPCRequest(req))
+
+	InjectPriorityClassIntoHTTPGRPCRequest(ContextWithPriorityClass(context.Background(), PriorityClassInteractive), req)
+	assert.Equal(t, PriorityClassInteractive, PriorityClassFromHTTPGRPCRequest(req))
+	assert.Len(t, req.Headers, 2)
+}
+
+func TestRequestQueue_GetNextRequestForQuerier_ShouldDispatchHigherPriorityClassesFirst(t *testing.T) {
+	queue := NewRequestQueue(log.NewNopLogger(), 100, 0,
+		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{})
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+	})
+
+	for _, req := range []Request{
+		prioritizedRequest{"background-1", PriorityClassBackground},
+		prioritizedRequest{"normal-1", PriorityClassNormal},
+		"unclassified",
+		prioritizedRequest{"interactive-1", PriorityClassInteractive},
+		prioritizedRequest{"background-2", PriorityClassBackground},
+		prioritizedRequest{"interactive-2", PriorityClassInteractive},
+	} {
+		require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", req, 0, 1, nil))
+	}
+
+	queue.RegisterQuerierConnection("querier-1")
+	t.Cleanup(func() {
+		queue.UnregisterQuerierConnection("querier-1")
+	})
+
+	var dispatched []string
+	last := FirstUser()
+	for i := 0; i < 6; i++ {
+		req, idx, err := queue.GetNextRequestForQuerier(ctx, last, "querier-1", "")
+		require.NoError(t, err)
+		last = idx
+		if r, ok := req.(prioritizedRequest); ok {
+			dispatched = append(dispatched, r.name)
+		} else {
+			dispatched = append(dispatched, req.(string))
+		}
+	}
+	// requests without a priority class are normal requests, and requests of the same class stay in FIFO order
+	assert.Equal(t, []string{"interactive-1", "interactive-2", "normal-1", "unclassified", "background-1", "background-2"}, dispatched)
+}
+
+func TestQueues_PriorityClassSubQueues(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.queryComponentQueues = true
+	qb.addQuerierConnection("querier-1")
+
+	enqueue := func(name string, class PriorityClass, component querycomponent.Component) {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: name, class: class, component: component}, 0))
+	}
+	enqueue("normal-ingester", PriorityClassNormal, querycomponent.Ingester)
+	enqueue("background", PriorityClassBackground, "")
+	enqueue("interactive-store-gateway", PriorityClassInteractive, querycomponent.StoreGateway)
+	enqueue("interactive-ingester", PriorityClassInteractive, querycomponent.Ingester)
+
+	// each class has its own sub-queue, split by query component
+	assert.NotNil(t, qb.tenantQueuesTree.getNode(QueuePath{"tenant-1", "interactive", string(querycomponent.Ingester)}))
+	assert.NotNil(t, qb.tenantQueuesTree.getNode(QueuePath{"tenant-1", "normal", string(querycomponent.Ingester)}))
+	assert.Equal(t, 1, qb.tenantQueuesTree.getNode(QueuePath{"tenant-1", "background"}).LocalQueueLen())
+
+	// the component is dequeued from the highest class which has requests of the component
+	request, _, _, err := qb.dequeueRequestForQuerierComponent(-1, "querier-1", querycomponent.Ingester)
+	require.NoError(t, err)
+	assert.Equal(t, "interactive-ingester", request.req)
+	request, _, _, err = qb.dequeueRequestForQuerierComponent(-1, "querier-1", querycomponent.Ingester)
+	require.NoError(t, err)
+	assert.Equal(t, "normal-ingester", request.req)
+	assert.Nil(t, qb.tenantQueuesTree.getNode(QueuePath{"tenant-1", "normal"}), "the emptied class sub-queue is deleted")
+
+	var dispatched []Request
+	for !qb.isEmpty() {
+		request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+		require.NoError(t, err)
+		dispatched = append(dispatched, request.req)
+	}
+	assert.Equal(t, []Request{"interactive-store-gateway", "background"}, dispatched)
+	assert.True(t, qb.tenantQueuesTree.IsEmpty())
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_PriorityClassMaxWait(t *testing.T) {
+	for name, maxWait := range map[string]time.Duration{"disabled": 0, "enabled": time.Minute} {
+		t.Run(name, func(t *testing.T) {
+			clk := newManualClock()
+			qb := newQueueBroker(100, 0)
+			qb.clock = clk
+			qb.priorityClassMaxWait = maxWait
+			qb.addQuerierConnection("querier-1")
+
+			enqueue := func(name string, class PriorityClass) {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: name, class: class}, 0))
+			}
+			enqueue("background-1", PriorityClassBackground)
+			enqueue("normal-1", PriorityClassNormal)
+			clk.Advance(30 * time.Second)
+			enqueue("background-2", PriorityClassBackground)
+			clk.Advance(31 * time.Second)
+			enqueue("interactive-1", PriorityClassInteractive)
+			enqueue("interactive-2", PriorityClassInteractive)
+
+			var dispatched []Request
+			for !qb.isEmpty() {
+				request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+				require.NoError(t, err)
+				dispatched = append(dispatched, request.req)
+			}
+			if maxWait == 0 {
+				assert.Equal(t, []Request{"interactive-1", "interactive-2", "normal-1", "background-1", "background-2"}, dispatched)
+				return
+			}
+			// the overdue front requests of the lower classes go first, the highest class first,
+			// and then the classes are served by priority again
+			assert.Equal(t, []Request{"normal-1", "background-1", "interactive-1", "interactive-2", "background-2"}, dispatched)
+		})
+	}
+}
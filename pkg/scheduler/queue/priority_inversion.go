@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// querierStuckOnLowerPriority returns true if the querier holds an inflight request of a lower priority than
+// the tenant's next request, dispatched at least priorityInversionAge ago, while another live querier of the
+// tenant's shard has no inflight requests. Skipping the tenant for the querier leaves the tenant's higher priority
+// work to the free querier, rather than queuing it behind the querier's long-running lower priority work.
+//
+// Only applies when the broker tracks inflight requests and priorityInversionAge is set.
+// Finding the querier's inflight requests visits all inflight requests, so it is only done for queriers
+// with inflight requests.
+func (qb *queueBroker) querierStuckOnLowerPriority(querierID QuerierID, tenantID TenantID) bool {
+	if !qb.trackInflight || qb.priorityInversionAge <= 0 || qb.inflightPerQuerier[querierID] == 0 {
+		return false
+	}
+	next := qb.tenantNextRequest(tenantID)
+	if next == nil {
+		return false
+	}
+	// tenant queues are ordered by descending priority
+	priority := next.priority
+
+	now := qb.clock.Now()
+	stuck := false
+	for _, inflight := range qb.inflightRequests {
+		if inflight.querierID == querierID && inflight.priority < priority && now.Sub(inflight.dispatchedAt) >= qb.priorityInversionAge {
+			stuck = true
+			break
+		}
+	}
+	if !stuck {
+		return false
+	}
+
+	tqa := &qb.tenantQuerierAssignments
+	tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]
+	for otherQuerierID, querier := range tqa.queriersByID {
+		if otherQuerierID == querierID || querier.connections == 0 || querier.shuttingDown || qb.inflightPerQuerier[otherQuerierID] > 0 {
+			continue
+		}
+		if _, ok := tenantQuerierSet[otherQuerierID]; tenantQuerierSet == nil || ok {
+			return true
+		}
+	}
+	// there is no free querier to steer the work to
+	return false
+}
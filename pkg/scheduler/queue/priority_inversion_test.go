@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_PriorityInversionPrevention(t *testing.T) {
+	for testName, testData := range map[string]struct {
+		inversionAge    time.Duration
+		expectedSteered bool
+		elapsed         time.Duration
+		shutdownOther   bool
+	}{
+		"disabled by default": {
+			inversionAge:    0,
+			elapsed:         time.Hour,
+			expectedSteered: false,
+		},
+		"querier held up by a long lower priority request": {
+			inversionAge:    time.Minute,
+			elapsed:         time.Minute,
+			expectedSteered: true,
+		},
+		"lower priority request not running long enough": {
+			inversionAge:    time.Minute,
+			elapsed:         time.Second,
+			expectedSteered: false,
+		},
+		"no free querier to steer to": {
+			inversionAge:    time.Minute,
+			elapsed:         time.Minute,
+			shutdownOther:   true,
+			expectedSteered: false,
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			clk := newManualClock()
+			qb := newQueueBroker(100, 0)
+			qb.clock = clk
+			qb.trackInflight = true
+			qb.priorityInversionAge = testData.inversionAge
+			qb.addQuerierConnection("querier-busy")
+			qb.addQuerierConnection("querier-free")
+
+			// querier-busy takes a long-running low priority request
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "low", priority: 0}, 0))
+			req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-busy")
+			require.NoError(t, err)
+			require.Equal(t, "low", req.req)
+
+			clk.Advance(testData.elapsed)
+			if testData.shutdownOther {
+				qb.notifyQuerierShutdown("querier-free")
+			}
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "high", priority: 5}, 0))
+
+			req, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-busy")
+			require.NoError(t, err)
+			if !testData.expectedSteered {
+				require.NotNil(t, req)
+				assert.Equal(t, "high", req.req)
+				return
+			}
+			assert.Nil(t, req)
+
+			// the free querier takes the high priority request instead
+			req, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-free")
+			require.NoError(t, err)
+			require.NotNil(t, req)
+			assert.Equal(t, "high", req.req)
+		})
+	}
+}
+
+func TestQueues_PriorityInversionPrevention_SamePriority(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.trackInflight = true
+	qb.priorityInversionAge = time.Minute
+	qb.addQuerierConnection("querier-busy")
+	qb.addQuerierConnection("querier-free")
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1", priority: 1}, 0))
+	dequeueN(t, qb, "querier-busy", 1)
+	clk.Advance(time.Hour)
+
+	// work of the same or a lower priority is not steered away from the busy querier
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "req-2", priority: 1}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "req-3", priority: 0}, 0))
+	dequeueN(t, qb, "querier-busy", 2)
+	assert.True(t, qb.isEmpty())
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func queuedRequests(qb *queueBroker, tenantID TenantID) []any {
+	var reqs []any
+	qb.visitTenantRequests(tenantID, func(request *tenantRequest) bool {
+		reqs = append(reqs, request.req)
+		return true
+	})
+	return reqs
+}
+
+func TestQueues_EnqueueByPriority(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+
+	for _, r := range []struct {
+		req      string
+		priority int
+	}{
+		{"low-1", 0}, {"high-1", 1}, {"low-2", 0}, {"high-2", 1}, {"urgent", 2},
+	} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: r.req, priority: r.priority}, 0))
+	}
+	assert.Equal(t, []any{"urgent", "high-1", "high-2", "low-1", "low-2"}, queuedRequests(qb, "tenant-1"))
+
+	// a request re-enqueued to the front goes ahead of the requests of its priority only
+	dequeued := dequeueN(t, qb, "querier-1", 3)
+	require.NoError(t, qb.enqueueRequestFront(dequeued[2], 0))
+	assert.Equal(t, []any{"high-2", "low-1", "low-2"}, queuedRequests(qb, "tenant-1"))
+	require.NoError(t, qb.enqueueRequestFront(dequeued[0], 0))
+	assert.Equal(t, []any{"urgent", "high-2", "low-1", "low-2"}, queuedRequests(qb, "tenant-1"))
+	require.NoError(t, qb.enqueueRequestFront(dequeued[1], 0))
+	assert.Equal(t, []any{"urgent", "high-1", "high-2", "low-1", "low-2"}, queuedRequests(qb, "tenant-1"))
+}
+
+func TestQueues_ReprioritizeRequestIsStable(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+
+	requests := map[string]*tenantRequest{}
+	for _, req := range []string{"a", "b", "c", "d", "e", "f"} {
+		requests[req] = &tenantRequest{tenantID: "tenant-1", req: req}
+		require.NoError(t, qb.enqueueRequestBack(requests[req], 0))
+	}
+
+	// reclassify out of enqueue order; requests ending up at the same priority keep their enqueue order
+	for _, req := range []string{"e", "b", "d"} {
+		require.True(t, qb.reprioritizeRequest(requests[req], 1))
+	}
+	assert.Equal(t, []any{"b", "d", "e", "a", "c", "f"}, queuedRequests(qb, "tenant-1"))
+
+	// moving back to a lower priority restores the request's place among that priority
+	require.True(t, qb.reprioritizeRequest(requests["d"], 0))
+	assert.Equal(t, []any{"b", "e", "a", "c", "d", "f"}, queuedRequests(qb, "tenant-1"))
+
+	// aging several requests to the same higher priority, in any order
+	for _, req := range []string{"f", "a", "e"} {
+		require.True(t, qb.reprioritizeRequest(requests[req], 2))
+	}
+	assert.Equal(t, []any{"a", "e", "f", "b", "c", "d"}, queuedRequests(qb, "tenant-1"))
+
+	// reclassifying to the same priority does not move the request
+	require.True(t, qb.reprioritizeRequest(requests["e"], 2))
+	assert.Equal(t, []any{"a", "e", "f", "b", "c", "d"}, queuedRequests(qb, "tenant-1"))
+
+	assert.False(t, qb.reprioritizeRequest(&tenantRequest{tenantID: "tenant-1", req: "not queued"}, 1))
+	assert.False(t, qb.reprioritizeRequest(&tenantRequest{tenantID: "tenant-unknown", req: "not queued"}, 1))
+}
+
+func TestQueues_EnqueueClassifiedByPriority(t *testing.T) {
+	type classifiedRequest struct {
+		name   string
+		header string
+	}
+
+	qb := newQueueBroker(100, 0)
+	qb.classifier = func(req Request) int {
+		switch req.(classifiedRequest).header {
+		case "high":
+			return 1
+		case "low":
+			return -1
+		}
+		return 0
+	}
+	qb.addQuerierConnection("querier-1")
+
+	for _, req := range []classifiedRequest{
+		{"default-1", ""}, {"low-1", "low"}, {"high-1", "high"}, {"default-2", ""}, {"high-2", "high"},
+	} {
+		// the classifier overrides the priority the request was enqueued with
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: req, priority: 5}, 0))
+	}
+
+	var names []string
+	for _, req := range queuedRequests(qb, "tenant-1") {
+		names = append(names, req.(classifiedRequest).name)
+	}
+	assert.Equal(t, []string{"high-1", "high-2", "default-1", "default-2", "low-1"}, names)
+
+	// requests re-enqueued to the front keep their class
+	dequeued := dequeueN(t, qb, "querier-1", 1)
+	assert.Equal(t, 1, dequeued[0].priority)
+	require.NoError(t, qb.enqueueRequestFront(dequeued[0], 0))
+	assert.Equal(t, "high-1", queuedRequests(qb, "tenant-1")[0].(classifiedRequest).name)
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/grafana/dskit/httpgrpc"
+)
+
+// CostEstimateHeader is the HTTP header carrying the estimated cost of executing a query request in a querier,
+// as a non-negative integer in arbitrary units which only need to be comparable between requests.
+const CostEstimateHeader = "Query-Cost-Estimate"
+
+// CostEstimateFromHTTPGRPCRequest returns the cost set by the request's CostEstimateHeader,
+// or 0 if the request carries no valid estimate.
+func CostEstimateFromHTTPGRPCRequest(req *httpgrpc.HTTPRequest) int64 {
+	if req == nil {
+		return 0
+	}
+	for _, h := range req.Headers {
+		if http.CanonicalHeaderKey(h.Key) == CostEstimateHeader && len(h.Values) > 0 {
+			cost, err := strconv.ParseInt(h.Values[0], 10, 64)
+			if err != nil || cost < 0 {
+				return 0
+			}
+			return cost
+		}
+	}
+	return 0
+}
+
+// CostEstimatedRequest is implemented by requests which carry an estimate of their cost. RequestQueue counts
+// the estimated cost of the requests dispatched to a querier against the querier cost budget until they are completed.
+type CostEstimatedRequest interface {
+	EstimatedCost() int64
+}
+
+// RequestKey identifies a request among the requests dispatched by a RequestQueue.
+type RequestKey struct {
+	Source string
+	ID     uint64
+}
+
+// KeyedRequest is implemented by requests which expose a RequestKey. Under a querier cost budget, RequestQueue
+// only counts a KeyedRequest against the budget of the querier it is dispatched to until CompleteRequest is called
+// for it: the key, rather than the request itself, identifies the completed request, so that requests don't need
+// to be comparable. Other requests are considered completed as soon as they are dispatched.
+type KeyedRequest interface {
+	RequestKey() RequestKey
+}
+
+// requestCost returns the estimated cost a request is enqueued with by RequestQueue.
+func requestCost(req Request) int64 {
+	if r, ok := req.(CostEstimatedRequest); ok {
+		return max(r.EstimatedCost(), 0)
+	}
+	return 0
+}
+
+// querierOverCostBudget returns true if dispatching the tenant's next request to the querier would take
+// the estimated cost of the querier's inflight requests over querierCostBudget. Skipping the tenant leaves
+// its request to a querier with more room in its budget, so that no querier is handed several expensive
+// requests at once.
+//
+// A querier without inflight cost is dispatched the request whatever its cost, so that requests estimated
+// to cost more than the budget are still dispatched, one at a time.
+// Only applies when the broker tracks inflight requests and querierCostBudget is set.
+func (qb *queueBroker) querierOverCostBudget(querierID QuerierID, tenantID TenantID) bool {
+	if !qb.trackInflight || qb.querierCostBudget <= 0 {
+		return false
+	}
+	inflightCost := qb.inflightCostPerQuerier[querierID]
+	if inflightCost == 0 {
+		return false
+	}
+	if inflightCost >= qb.querierCostBudget {
+		return true
+	}
+
+	tenant := qb.tenantQuerierAssignments.tenantsByID[tenantID]
+	if tenant == nil {
+		return false
+	}
+	next := qb.peekRequestForQuerier(tenant, querierID)
+	return next != nil && inflightCost+next.cost > qb.querierCostBudget
+}
@@ -0,0 +1,191 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type costedRequest struct {
+	name string
+	cost int64
+}
+
+func (r *costedRequest) EstimatedCost() int64 {
+	return r.cost
+}
+
+func (r *costedRequest) RequestKey() RequestKey {
+	return RequestKey{Source: r.name}
+}
+
+// uncomparableRequest is a request which would make the queue panic if it were used as a map key.
+type uncomparableRequest struct {
+	cost   int64
+	series []string
+}
+
+func (r uncomparableRequest) EstimatedCost() int64 {
+	return r.cost
+}
+
+func TestCostEstimateFromHTTPGRPCRequest(t *testing.T) {
+	header := func(v string) *httpgrpc.HTTPRequest {
+		return &httpgrpc.HTTPRequest{Headers: []*httpgrpc.Header{{Key: "query-cost-estimate", Values: []string{v}}}}
+	}
+
+	assert.Zero(t, CostEstimateFromHTTPGRPCRequest(nil))
+	assert.Zero(t, CostEstimateFromHTTPGRPCRequest(&httpgrpc.HTTPRequest{}))
+	assert.Equal(t, int64(1200), CostEstimateFromHTTPGRPCRequest(header("1200")))
+	assert.Zero(t, CostEstimateFromHTTPGRPCRequest(header("-5")))
+	assert.Zero(t, CostEstimateFromHTTPGRPCRequest(header("expensive")))
+}
+
+func TestQueues_QuerierCostBudget(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.trackInflight = true
+	qb.querierCostBudget = 10
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+
+	for _, cost := range []int64{8, 8, 1, 50} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: cost, cost: cost}, 0))
+	}
+
+	first, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	require.Equal(t, int64(8), first.req)
+
+	// the next request would take querier-1 over its budget, so it is left to querier-2
+	req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+	second, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-2")
+	require.NoError(t, err)
+	require.Equal(t, int64(8), second.req)
+
+	// a request within the remaining budget is dispatched
+	third, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), third.req)
+	assert.Equal(t, map[QuerierID]int64{"querier-1": 9, "querier-2": 8}, qb.inflightCostPerQuerier)
+
+	// a request over the budget waits for a querier to be idle
+	req, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-2")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+	qb.completeRequest(second)
+	req, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-2")
+	require.NoError(t, err)
+	require.NotNil(t, req)
+	assert.Equal(t, int64(50), req.req)
+
+	qb.completeRequest(first)
+	qb.completeRequest(third)
+	qb.completeRequest(req)
+	assert.Empty(t, qb.inflightCostPerQuerier)
+}
+
+func TestQueues_QuerierCostBudget_Disabled(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.trackInflight = true
+	qb.addQuerierConnection("querier-1")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i, cost: 100}, 0))
+	}
+	assert.Len(t, dequeueN(t, qb, "querier-1", 3), 3)
+}
+
+func TestRequestQueue_CompleteRequest_ShouldReleaseQuerierCostBudget(t *testing.T) {
+	queue := NewRequestQueue(log.NewNopLogger(), 100, 0,
+		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{QuerierCostBudget: 10})
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+	})
+
+	expensive1, expensive2 := &costedRequest{"expensive-1", 8}, &costedRequest{"expensive-2", 8}
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", expensive1, 0, 1, nil))
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", expensive2, 0, 1, nil))
+
+	queue.RegisterQuerierConnection("querier-1")
+	t.Cleanup(func() {
+		queue.UnregisterQuerierConnection("querier-1")
+	})
+
+	req, last, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-1", "")
+	require.NoError(t, err)
+	require.Equal(t, expensive1, req)
+
+	// the querier is not dispatched the second expensive request while it runs the first one
+	shortCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, _, err = queue.GetNextRequestForQuerier(shortCtx, last, "querier-1", "")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	waitingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	next := make(chan Request, 1)
+	go func() {
+		req, _, err := queue.GetNextRequestForQuerier(waitingCtx, last, "querier-1", "")
+		if err == nil {
+			next <- req
+		}
+		close(next)
+	}()
+
+	queue.CompleteRequest(expensive1)
+	assert.Equal(t, expensive2, <-next)
+}
+
+func TestRequestQueue_CompleteRequest_ShouldNotHoldQuerierCostBudgetForUnkeyedRequests(t *testing.T) {
+	queue := NewRequestQueue(log.NewNopLogger(), 100, 0,
+		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{QuerierCostBudget: 10})
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+	})
+
+	expensive1 := uncomparableRequest{cost: 8, series: []string{"series-1"}}
+	expensive2 := uncomparableRequest{cost: 8, series: []string{"series-2"}}
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", expensive1, 0, 1, nil))
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", expensive2, 0, 1, nil))
+
+	queue.RegisterQuerierConnection("querier-1")
+	t.Cleanup(func() {
+		queue.UnregisterQuerierConnection("querier-1")
+	})
+
+	req, last, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-1", "")
+	require.NoError(t, err)
+	require.Equal(t, expensive1, req)
+	queue.CompleteRequest(req)
+
+	// the queue can't tell when the request is completed, so it doesn't count it against the budget
+	shortCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	req, _, err = queue.GetNextRequestForQuerier(shortCtx, last, "querier-1", "")
+	require.NoError(t, err)
+	require.Equal(t, expensive2, req)
+}
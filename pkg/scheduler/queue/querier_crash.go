@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "sort"
+
+// recoverQuerierInflight re-enqueues to the front of their tenant queues all the requests dispatched to the querier
+// which have not been completed, as if their dispatch had failed, and returns the number of requests recovered.
+// The requests keep their enqueue time and their order within each tenant queue.
+//
+// Recovered requests are no longer inflight, so completing them is a no-op until they are dispatched again;
+// a late completion reported by the crashed querier after the request is dispatched again
+// would complete the new dispatch instead, so callers must discard completions from a querier once it is recovered.
+// A tenant whose queue was removed in the meantime is re-created with no max queriers, so that it can use
+// all queriers until its next enqueue. Requires inflight tracking to be enabled; otherwise nothing is recovered.
+func (qb *queueBroker) recoverQuerierInflight(querierID QuerierID) int {
+	querierID = qb.logicalQuerierID(querierID)
+	if qb.inflightPerQuerier[querierID] == 0 {
+		return 0
+	}
+
+	var requests []*tenantRequest
+	for request, inflight := range qb.inflightRequests {
+		if inflight.querierID == querierID {
+			requests = append(requests, request)
+		}
+	}
+	// re-enqueue the newest requests first, so that the oldest end up at the front of their tenant queue
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].tenantID != requests[j].tenantID {
+			return requests[i].tenantID < requests[j].tenantID
+		}
+		return requests[i].seq > requests[j].seq
+	})
+
+	recovered := 0
+	for _, request := range requests {
+		maxQueriers := 0
+		if tenant := qb.tenantQuerierAssignments.tenantsByID[request.tenantID]; tenant != nil {
+			maxQueriers = tenant.maxQueriers
+		}
+		if err := qb.enqueueRequestFront(request, maxQueriers); err != nil {
+			continue
+		}
+		recovered++
+	}
+	return recovered
+}
+
+// crashedQuerierCandidates returns the given queriers, or all queriers if none is given, which hold inflight requests
+// and have not notified a graceful shutdown, so that their inflight requests are recovered if they go away.
+func (qb *queueBroker) crashedQuerierCandidates(querierIDs ...QuerierID) []QuerierID {
+	if !qb.recoverCrashedQuerierInflight || len(qb.inflightPerQuerier) == 0 {
+		return nil
+	}
+	var candidates []QuerierID
+	if len(querierIDs) == 0 {
+		for querierID := range qb.inflightPerQuerier {
+			querierIDs = append(querierIDs, querierID)
+		}
+	}
+	for _, querierID := range querierIDs {
+		querier := qb.tenantQuerierAssignments.queriersByID[querierID]
+		if querier != nil && !querier.shuttingDown && qb.inflightPerQuerier[querierID] > 0 {
+			candidates = append(candidates, querierID)
+		}
+	}
+	return candidates
+}
+
+// recoverCrashedQueriers recovers the inflight requests of the candidate queriers which are no longer known.
+func (qb *queueBroker) recoverCrashedQueriers(candidates []QuerierID) {
+	for _, querierID := range candidates {
+		if _, ok := qb.tenantQuerierAssignments.queriersByID[querierID]; !ok {
+			qb.recoverQuerierInflight(querierID)
+		}
+	}
+}
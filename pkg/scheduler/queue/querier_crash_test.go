@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_RecoverQuerierInflight(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.trackInflight = true
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+
+	for _, req := range []string{"r1", "r2", "r3", "r4"} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: req, enqueueTime: clk.Now()}, 0))
+		clk.Advance(time.Second)
+	}
+	crashed := dequeueN(t, qb, "querier-1", 2)
+	completed := dequeueN(t, qb, "querier-2", 1)
+	qb.completeRequest(completed[0])
+
+	assert.Zero(t, qb.recoverQuerierInflight("querier-2"))
+	assert.Equal(t, 2, qb.recoverQuerierInflight("querier-1"))
+
+	// the recovered requests are back at the front of the queue in their original order, with their enqueue time
+	assert.Equal(t, []any{"r1", "r2", "r4"}, queuedRequests(qb, "tenant-1"))
+	assert.Equal(t, clk.Now().Add(-4*time.Second), crashed[0].enqueueTime)
+	perTenant, perQuerier := qb.inflightStats()
+	assert.Empty(t, perTenant)
+	assert.Empty(t, perQuerier)
+
+	// completing a recovered request is a no-op
+	qb.completeRequest(crashed[0])
+	assert.Zero(t, qb.recoverQuerierInflight("querier-1"))
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_RecoverCrashedQuerierInflight(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, time.Minute)
+	qb.clock = clk
+	qb.trackInflight = true
+	qb.recoverCrashedQuerierInflight = true
+	for _, querierID := range []QuerierID{"querier-crashed", "querier-graceful", "querier-reconnected"} {
+		qb.addQuerierConnection(querierID)
+	}
+
+	for _, req := range []string{"r1", "r2", "r3"} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: req}, 0))
+	}
+	dequeueN(t, qb, "querier-crashed", 1)
+	dequeueN(t, qb, "querier-graceful", 1)
+	dequeueN(t, qb, "querier-reconnected", 1)
+	assert.True(t, qb.isEmpty())
+
+	// a querier which notified a graceful shutdown is expected to complete its requests
+	qb.notifyQuerierShutdown("querier-graceful")
+	qb.removeQuerierConnection("querier-graceful", clk.Now())
+	assert.True(t, qb.isEmpty())
+
+	// queriers which went away are only recovered once forgotten, in case they reconnect
+	qb.removeQuerierConnection("querier-crashed", clk.Now())
+	qb.removeQuerierConnection("querier-reconnected", clk.Now())
+	qb.addQuerierConnection("querier-reconnected")
+	assert.True(t, qb.isEmpty())
+
+	clk.Advance(2 * time.Minute)
+	assert.Equal(t, 1, qb.forgetDisconnectedQueriers(clk.Now()))
+	assert.Equal(t, []any{"r1"}, queuedRequests(qb, "tenant-1"))
+	_, perQuerier := qb.inflightStats()
+	assert.Equal(t, map[QuerierID]int{"querier-graceful": 1, "querier-reconnected": 1}, perQuerier)
+	assert.NoError(t, isConsistent(qb))
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+type querierIDValidationPolicy int
+
+const (
+	// querierIDValidationStrict rejects the registration of an invalid querier ID with ErrInvalidQuerierID.
+	querierIDValidationStrict querierIDValidationPolicy = iota
+	// querierIDValidationLenient logs the registration of an invalid querier ID and ignores it.
+	querierIDValidationLenient
+)
+
+// validQuerierID is the default querier ID validator, which only rejects empty querier IDs.
+func validQuerierID(querierID QuerierID) bool {
+	return querierID != ""
+}
+
+// admitQuerierID validates the querier ID of a connection being registered, so that invalid querier IDs never enter
+// the querier set, and returns true if the connection can be registered. An invalid querier ID is rejected
+// with ErrInvalidQuerierID under the strict policy, and logged and ignored under the lenient policy.
+func (qb *queueBroker) admitQuerierID(querierID QuerierID) (bool, error) {
+	if !qb.rejectsQuerierID(querierID) {
+		return true, nil
+	}
+	if qb.querierIDValidationPolicy == querierIDValidationStrict {
+		return false, ErrInvalidQuerierID
+	}
+	logger := qb.tenantQuerierAssignments.logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	level.Warn(logger).Log("msg", "ignoring connection of querier with invalid id", "querier", querierID)
+	return false, nil
+}
+
+// rejectsQuerierID returns true if the querier ID fails validation. The disconnects and shutdowns of such
+// queriers are ignored, as their connections were never registered.
+func (qb *queueBroker) rejectsQuerierID(querierID QuerierID) bool {
+	if qb.validateQuerierID != nil {
+		return !qb.validateQuerierID(querierID)
+	}
+	return !validQuerierID(querierID)
+}
+
+func (p querierIDValidationPolicy) name() string {
+	switch p {
+	case querierIDValidationStrict:
+		return "strict"
+	case querierIDValidationLenient:
+		return "lenient"
+	default:
+		return "unknown"
+	}
+}
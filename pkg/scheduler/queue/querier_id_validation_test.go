@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_QuerierIDValidation(t *testing.T) {
+	noWhitespace := func(querierID QuerierID) bool {
+		return querierID != "" && !strings.ContainsAny(string(querierID), " \t\n")
+	}
+
+	for name, tc := range map[string]struct {
+		policy      querierIDValidationPolicy
+		validator   func(QuerierID) bool
+		querierID   QuerierID
+		expectedErr error
+	}{
+		"strict, empty querier ID": {
+			policy:      querierIDValidationStrict,
+			querierID:   "",
+			expectedErr: ErrInvalidQuerierID,
+		},
+		"lenient, empty querier ID": {
+			policy:    querierIDValidationLenient,
+			querierID: "",
+		},
+		"strict, malformed querier ID": {
+			policy:      querierIDValidationStrict,
+			validator:   noWhitespace,
+			querierID:   "querier 1",
+			expectedErr: ErrInvalidQuerierID,
+		},
+		"lenient, malformed querier ID": {
+			policy:    querierIDValidationLenient,
+			validator: noWhitespace,
+			querierID: "querier 1",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.querierIDValidationPolicy = tc.policy
+			qb.validateQuerierID = tc.validator
+			require.NoError(t, qb.addQuerierConnection("querier-1"))
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r"}, 1))
+			fingerprint := qb.stateFingerprint()
+
+			assert.Equal(t, tc.expectedErr, qb.addQuerierConnection(tc.querierID))
+			assert.Equal(t, tc.expectedErr, qb.addOverflowQuerierConnection(tc.querierID))
+			assert.Equal(t, fingerprint, qb.stateFingerprint())
+			assert.Equal(t, querierIDSlice{"querier-1"}, qb.tenantQuerierAssignments.querierIDsSorted)
+			assert.NotContains(t, qb.tenantQuerierAssignments.queriersByID, tc.querierID)
+
+			// the disconnects and shutdowns of the rejected querier are ignored
+			qb.removeQuerierConnection(tc.querierID, time.Now())
+			qb.notifyQuerierShutdown(tc.querierID)
+			assert.Equal(t, fingerprint, qb.stateFingerprint())
+			assert.NoError(t, isConsistent(qb))
+		})
+	}
+}
+
+func TestQueues_QuerierIDValidation_ValidIDs(t *testing.T) {
+	for _, policy := range []querierIDValidationPolicy{querierIDValidationStrict, querierIDValidationLenient} {
+		qb := newQueueBroker(100, 0)
+		qb.querierIDValidationPolicy = policy
+		require.NoError(t, qb.addQuerierConnection("querier-2"))
+		require.NoError(t, qb.addQuerierConnection("querier-1"))
+		require.NoError(t, qb.addOverflowQuerierConnection("querier-overflow"))
+		assert.Equal(t, querierIDSlice{"querier-1", "querier-2"}, qb.tenantQuerierAssignments.querierIDsSorted)
+		assert.Contains(t, qb.tenantQuerierAssignments.queriersByID, QuerierID("querier-overflow"))
+
+		qb.removeQuerierConnection("querier-1", time.Now())
+		assert.Equal(t, querierIDSlice{"querier-2"}, qb.tenantQuerierAssignments.querierIDsSorted)
+	}
+}
@@ -0,0 +1,19 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// querierIdleTimes returns how long each connected querier has gone without a request being dequeued for it,
+// or since it connected if no request has been dequeued for it yet.
+// Queriers which stay idle hint at an over-provisioned fleet, or at shards excluding them from busy tenants.
+func (qb *queueBroker) querierIdleTimes(now time.Time) map[QuerierID]time.Duration {
+	idleTimes := make(map[QuerierID]time.Duration, len(qb.tenantQuerierAssignments.queriersByID))
+	for querierID, querier := range qb.tenantQuerierAssignments.queriersByID {
+		if querier.connections == 0 {
+			continue
+		}
+		idleTimes[querierID] = now.Sub(querier.lastDequeueAt)
+	}
+	return idleTimes
+}
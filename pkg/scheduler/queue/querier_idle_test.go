@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_QuerierIdleTimes(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, time.Minute)
+	qb.clock = clk
+
+	qb.addQuerierConnection("querier-busy")
+	qb.addQuerierConnection("querier-idle")
+	qb.addQuerierConnection("querier-disconnected")
+	clk.Advance(10 * time.Second)
+	qb.addQuerierConnection("querier-late")
+	// reconnecting does not reset the idle time
+	qb.addQuerierConnection("querier-idle")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+	}
+	clk.Advance(5 * time.Second)
+	dequeueN(t, qb, "querier-busy", 1)
+	clk.Advance(5 * time.Second)
+	dequeueN(t, qb, "querier-busy", 1)
+	dequeueN(t, qb, "querier-disconnected", 1)
+	qb.removeQuerierConnection("querier-disconnected", clk.Now())
+	clk.Advance(3 * time.Second)
+
+	assert.Equal(t, map[QuerierID]time.Duration{
+		"querier-busy": 3 * time.Second,
+		"querier-idle": 23 * time.Second,
+		"querier-late": 13 * time.Second,
+	}, qb.querierIdleTimes(clk.Now()))
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// querierOverloadedForTenant returns true if the querier's inflight requests exceed querierOverloadFactor times
+// the average inflight requests of the live queriers in the tenant's shard, including the querier itself.
+// Skipping the tenant for an overloaded querier leaves the tenant's backlog to the lighter queriers of the shard.
+//
+// Only applies when the broker tracks inflight requests and querierOverloadFactor is set.
+func (qb *queueBroker) querierOverloadedForTenant(querierID QuerierID, tenantID TenantID) bool {
+	if !qb.trackInflight || qb.querierOverloadFactor <= 0 {
+		return false
+	}
+	querierInflight := qb.inflightPerQuerier[querierID]
+	if querierInflight == 0 {
+		return false
+	}
+
+	tqa := &qb.tenantQuerierAssignments
+	shardInflight, shardQueriers := 0, 0
+	if tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]; tenantQuerierSet != nil {
+		for shardQuerierID := range tenantQuerierSet {
+			if querier := tqa.queriersByID[shardQuerierID]; querier != nil && querier.connections > 0 && !querier.shuttingDown {
+				shardInflight += qb.inflightPerQuerier[shardQuerierID]
+				shardQueriers++
+			}
+		}
+	} else {
+		for shardQuerierID, querier := range tqa.queriersByID {
+			if querier.connections > 0 && !querier.shuttingDown {
+				shardInflight += qb.inflightPerQuerier[shardQuerierID]
+				shardQueriers++
+			}
+		}
+	}
+	if shardQueriers <= 1 {
+		// there is no lighter querier to steer work to
+		return false
+	}
+
+	average := float64(shardInflight) / float64(shardQueriers)
+	return float64(querierInflight) > qb.querierOverloadFactor*average
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_QuerierOverloadRebalancing(t *testing.T) {
+	tests := map[string]struct {
+		overloadFactor       float64
+		expectHeavyThrottled bool
+	}{
+		"rebalancing disabled": {
+			overloadFactor:       0,
+			expectHeavyThrottled: false,
+		},
+		"rebalancing enabled": {
+			overloadFactor:       1.5,
+			expectHeavyThrottled: true,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.trackInflight = true
+			for _, querierID := range []QuerierID{"querier-heavy", "querier-light-1", "querier-light-2"} {
+				qb.addQuerierConnection(querierID)
+			}
+
+			for i := 0; i < 20; i++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+			}
+
+			// imbalanced shard: the heavy querier holds all inflight requests
+			dequeueN(t, qb, "querier-heavy", 4)
+			dequeueN(t, qb, "querier-light-1", 1)
+			qb.querierOverloadFactor = testData.overloadFactor
+
+			req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-heavy")
+			require.NoError(t, err)
+			assert.Equal(t, testData.expectHeavyThrottled, req == nil)
+
+			// lighter queriers of the shard are still given work
+			req, _, _, err = qb.dequeueRequestForQuerier(-1, "querier-light-2")
+			require.NoError(t, err)
+			assert.NotNil(t, req)
+		})
+	}
+}
+
+func TestQueues_QuerierOverloadRebalancing_WithinShard(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.trackInflight = true
+	for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"} {
+		qb.addQuerierConnection(querierID)
+	}
+
+	// load a single querier of the shard of a sharded tenant
+	for i := 0; i < 20; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 2))
+	}
+	shard := getTenantsQueriers(qb, "tenant-1")
+	require.Len(t, shard, 2)
+	heavy, light := shard[0], shard[1]
+	dequeueN(t, qb, heavy, 2)
+	qb.querierOverloadFactor = 1.5
+
+	// the heavy querier is overloaded compared to the other querier of the shard, and is throttled
+	req, _, _, err := qb.dequeueRequestForQuerier(-1, heavy)
+	require.NoError(t, err)
+	assert.Nil(t, req)
+
+	// once the light querier catches up, the heavy querier is given work again
+	dequeueN(t, qb, light, 2)
+	req, _, _, err = qb.dequeueRequestForQuerier(-1, heavy)
+	require.NoError(t, err)
+	assert.NotNil(t, req)
+}
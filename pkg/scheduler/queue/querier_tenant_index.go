@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "sort"
+
+// querierTenantIndexScanFactor is how many times fewer tenants a querier must be able to handle
+// than there are entries in the tenant order, for the reverse index to be used instead of scanning the order;
+// looking up the next tenant through the index sorts the querier's tenants on each call.
+const querierTenantIndexScanFactor = 8
+
+// updateQuerierTenantIndex updates the querier to tenant reverse index for the change of the tenant querier ID set.
+func (tqa *tenantQuerierAssignments) updateQuerierTenantIndex(tenantID TenantID, previous, next map[QuerierID]struct{}) {
+	for querierID := range previous {
+		if _, ok := next[querierID]; ok {
+			continue
+		}
+		delete(tqa.querierTenantIDs[querierID], tenantID)
+		if len(tqa.querierTenantIDs[querierID]) == 0 {
+			delete(tqa.querierTenantIDs, querierID)
+		}
+	}
+	for querierID := range next {
+		if tqa.querierTenantIDs[querierID] == nil {
+			tqa.querierTenantIDs[querierID] = map[TenantID]struct{}{}
+		}
+		tqa.querierTenantIDs[querierID][tenantID] = struct{}{}
+	}
+
+	if next != nil {
+		delete(tqa.unshardedTenantIDs, tenantID)
+	} else if _, ok := tqa.tenantsByID[tenantID]; ok {
+		tqa.unshardedTenantIDs[tenantID] = struct{}{}
+	}
+}
+
+// useQuerierTenantIndex returns true if the querier can handle few enough tenants compared to the size of the tenant order
+// that finding its next tenant through the reverse index is cheaper than scanning the tenant order.
+func (tqa *tenantQuerierAssignments) useQuerierTenantIndex(querierID QuerierID) bool {
+	eligible := len(tqa.querierTenantIDs[querierID]) + len(tqa.unshardedTenantIDs)
+	return eligible*querierTenantIndexScanFactor < len(tqa.tenantIDOrder)
+}
+
+// indexedNextTenantForQuerier finds the same tenant as scanNextTenantForQuerier, the first tenant assigned
+// to the querier after lastTenantIndex in the tenant order, wrapping around to the start of the order,
+// while only visiting the tenants the querier can handle.
+func (tqa *tenantQuerierAssignments) indexedNextTenantForQuerier(lastTenantIndex int, querierID QuerierID) (*queueTenant, int) {
+	sharded := tqa.querierTenantIDs[querierID]
+	orderIndexes := make([]int, 0, len(sharded)+len(tqa.unshardedTenantIDs))
+	for tenantID := range sharded {
+		orderIndexes = append(orderIndexes, tqa.tenantsByID[tenantID].orderIndex)
+	}
+	for tenantID := range tqa.unshardedTenantIDs {
+		orderIndexes = append(orderIndexes, tqa.tenantsByID[tenantID].orderIndex)
+	}
+	if len(orderIndexes) == 0 {
+		return nil, lastTenantIndex
+	}
+	sort.Ints(orderIndexes)
+
+	next := sort.SearchInts(orderIndexes, lastTenantIndex+1)
+	if next == len(orderIndexes) || orderIndexes[next] >= len(tqa.tenantIDOrder) {
+		// wrap around to the start of the tenant order
+		next = 0
+	}
+	tenantOrderIndex := orderIndexes[next]
+	return tqa.tenantsByID[tqa.tenantIDOrder[tenantOrderIndex]], tenantOrderIndex
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_IndexedNextTenantForQuerierMatchesScan(t *testing.T) {
+	const (
+		numQueriers = 20
+		numTenants  = 200
+	)
+
+	rnd := rand.New(rand.NewSource(1))
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	for i := 0; i < numQueriers; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	for i := 0; i < numTenants; i++ {
+		maxQueriers := 1 + rnd.Intn(2)
+		if i%50 == 0 {
+			maxQueriers = 0 // a few tenants use all queriers
+		}
+		getOrAdd(t, qb, TenantID(fmt.Sprintf("tenant-%d", i)), maxQueriers)
+	}
+	// leave gaps in the tenant order
+	for i := 0; i < numTenants; i += 7 {
+		qb.removeTenantQueue(TenantID(fmt.Sprintf("tenant-%d", i)))
+	}
+	// changing the fleet reshuffles all tenants
+	qb.addQuerierConnection("querier-new")
+	qb.removeQuerierConnection("querier-3", qb.clock.Now())
+	qb.forgetDisconnectedQueriers(qb.clock.Now())
+	require.NoError(t, isConsistent(qb))
+
+	for querierID := range tqa.queriersByID {
+		for lastTenantIndex := -1; lastTenantIndex <= len(tqa.tenantIDOrder)+1; lastTenantIndex++ {
+			expectedTenant, expectedIndex := tqa.scanNextTenantForQuerier(lastTenantIndex, querierID)
+			tenant, index := tqa.indexedNextTenantForQuerier(lastTenantIndex, querierID)
+			require.Equal(t, expectedTenant, tenant, "querier %s, last tenant index %d", querierID, lastTenantIndex)
+			require.Equal(t, expectedIndex, index, "querier %s, last tenant index %d", querierID, lastTenantIndex)
+		}
+	}
+}
+
+func TestQueues_QuerierTenantIndexDequeue(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	for i := 0; i < 10; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	for i := 0; i < 100; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", i)), req: i}, 1))
+	}
+
+	// each querier only has a few tenants, so the dequeue path uses the index
+	require.True(t, qb.tenantQuerierAssignments.useQuerierTenantIndex("querier-0"))
+	for i := 0; i < 10; i++ {
+		querierID := QuerierID(fmt.Sprintf("querier-%d", i))
+		var expected []TenantID
+		for _, tenantID := range getTenantsByQuerier(qb, querierID) {
+			if tenantID != emptyTenantID {
+				expected = append(expected, tenantID)
+			}
+		}
+		var dequeued []TenantID
+		lastTenantIndex := -1
+		for {
+			req, _, idx, err := qb.dequeueRequestForQuerier(lastTenantIndex, querierID)
+			require.NoError(t, err)
+			if req == nil {
+				break
+			}
+			lastTenantIndex = idx
+			dequeued = append(dequeued, req.tenantID)
+		}
+		assert.Equal(t, expected, dequeued, querierID)
+	}
+	assert.True(t, qb.isEmpty())
+	assert.NoError(t, isConsistent(qb))
+}
+
+func BenchmarkGetNextTenantForQuerier_FewEligibleTenants(b *testing.B) {
+	const (
+		numQueriers = 500
+		numTenants  = 50000
+	)
+
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	for i := 0; i < numQueriers; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	for i := 0; i < numTenants; i++ {
+		require.NoError(b, tqa.createOrUpdateTenant(TenantID(fmt.Sprintf("tenant-%d", i)), 1))
+	}
+
+	for _, indexed := range []bool{false, true} {
+		b.Run(fmt.Sprintf("indexed=%v", indexed), func(b *testing.B) {
+			lastTenantIndex := -1
+			for i := 0; i < b.N; i++ {
+				var tenant *queueTenant
+				if indexed {
+					tenant, lastTenantIndex = tqa.indexedNextTenantForQuerier(lastTenantIndex, "querier-0")
+				} else {
+					tenant, lastTenantIndex = tqa.scanNextTenantForQuerier(lastTenantIndex, "querier-0")
+				}
+				if tenant == nil {
+					b.Fatal("expected a tenant")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"net/http"
+
+	"github.com/grafana/dskit/httpgrpc"
+
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
+)
+
+// QueryComponentFromHTTPGRPCRequest returns the component set by the request's querycomponent.Header,
+// or an empty component if the request carries none.
+func QueryComponentFromHTTPGRPCRequest(req *httpgrpc.HTTPRequest) querycomponent.Component {
+	if req == nil {
+		return ""
+	}
+	for _, h := range req.Headers {
+		if http.CanonicalHeaderKey(h.Key) == querycomponent.Header && len(h.Values) > 0 {
+			return querycomponent.Parse(h.Values[0])
+		}
+	}
+	return ""
+}
+
+// QueryComponentRequest is implemented by requests which know the component expected to serve them.
+// RequestQueue queues them in the sub-queue of their component when query component queues are enabled,
+// see querycomponent.Component.
+type QueryComponentRequest interface {
+	ExpectedQueryComponent() querycomponent.Component
+}
+
+// requestQueryComponent returns the query component a request is enqueued with by RequestQueue.
+func requestQueryComponent(req Request) querycomponent.Component {
+	if r, ok := req.(QueryComponentRequest); ok {
+		return r.ExpectedQueryComponent()
+	}
+	return ""
+}
+
+// requestQueuePath returns the path of the tree queue node the request is queued in: the sub-queue of its component
+// under query component queues, or else the sub-queue of its priority class of the tenant queue.
+func (qb *queueBroker) requestQueuePath(request *tenantRequest) QueuePath {
+	if !qb.queryComponentQueues || request.component == "" {
+		return QueuePath{string(request.tenantID), request.class.String()}
+	}
+	return QueuePath{string(request.tenantID), request.class.String(), string(request.component)}
+}
+
+// tenantQueueFull returns true if the tenant queue holds maxTenantQueueSize requests. The tree queue only bounds
+// the length of each node's own queue, so the length of a tenant queue split into sub-queues is bounded here.
+func (qb *queueBroker) tenantQueueFull(tenantID TenantID) bool {
+	return qb.tenantDepth(tenantID) >= qb.maxTenantQueueSize
+}
+
+// countQueuedComponent adds delta to the tenant's queued request count of the request's query component.
+func (qb *queueBroker) countQueuedComponent(tenant *queueTenant, request *tenantRequest, delta int) {
+	if request.component == "" {
+		return
+	}
+	if tenant.queuedByComponent == nil {
+		tenant.queuedByComponent = map[querycomponent.Component]int{}
+	}
+	if tenant.queuedByComponent[request.component] += delta; tenant.queuedByComponent[request.component] <= 0 {
+		delete(tenant.queuedByComponent, request.component)
+	}
+}
+
+// tenantHasQueuedRequestsOfComponent returns true if the tenant has queued requests expected to be served by component.
+func (qb *queueBroker) tenantHasQueuedRequestsOfComponent(tenantID TenantID, component querycomponent.Component) bool {
+	tenant := qb.tenantQuerierAssignments.tenantsByID[tenantID]
+	return tenant != nil && tenant.queuedByComponent[component] > 0
+}
+
+// dequeueRequestForQuerierComponent dequeues a request for a worker of the querier reserved for the query component,
+// which only takes the requests expected to be served by that component. As under a filtered dequeue, other requests
+// are left in place for other queriers, and tenants without any request of the component are skipped.
+// Workers reserved for no component take any request.
+//
+// Tenants are skipped by their count of queued requests of the component, so that the dequeue does not walk
+// the queued requests of every tenant. Under query component queues, the request is dequeued from the front
+// of the component's sub-queue rather than searched for in the tenant queue.
+func (qb *queueBroker) dequeueRequestForQuerierComponent(lastTenantIndex int, querierID QuerierID, component querycomponent.Component) (*tenantRequest, *queueTenant, int, error) {
+	if component == "" {
+		return qb.dequeueRequestForQuerier(lastTenantIndex, querierID)
+	}
+	qb.dequeueComponent = component
+	defer func() { qb.dequeueComponent = "" }()
+
+	return qb.dequeueRequestForQuerier(lastTenantIndex, querierID)
+}
+
+// dequeueFrontOfTenantQueue dequeues the request at the front of the tenant's first priority class sub-queue
+// in dequeue order or, during a dequeue for a query component under query component queues, at the front
+// of the component's sub-queue of the first priority class which has one. The emptied nodes are deleted.
+func (qb *queueBroker) dequeueFrontOfTenantQueue(tenantID TenantID) any {
+	order, n := qb.tenantPriorityClassOrder(tenantID)
+	for _, class := range order[:n] {
+		queuePath := QueuePath{string(tenantID), class.String()}
+		if qb.dequeueComponent != "" && qb.queryComponentQueues {
+			queuePath = append(queuePath, string(qb.dequeueComponent))
+		}
+		if v := qb.tenantQueuesTree.DequeueByPath(queuePath); v != nil {
+			return v
+		}
+	}
+	return nil
+}
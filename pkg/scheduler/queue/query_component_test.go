@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/httpgrpc"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
+)
+
+type componentRequest struct {
+	name      string
+	component querycomponent.Component
+}
+
+func (r componentRequest) ExpectedQueryComponent() querycomponent.Component {
+	return r.component
+}
+
+func TestQueryComponentFromHTTPGRPCRequest(t *testing.T) {
+	assert.Equal(t, querycomponent.Component(""), QueryComponentFromHTTPGRPCRequest(nil))
+	assert.Equal(t, querycomponent.Component(""), QueryComponentFromHTTPGRPCRequest(&httpgrpc.HTTPRequest{}))
+	assert.Equal(t, querycomponent.StoreGateway, QueryComponentFromHTTPGRPCRequest(&httpgrpc.HTTPRequest{
+		Headers: []*httpgrpc.Header{{Key: "X-Scope-OrgID", Values: []string{"user-1"}}, {Key: "query-component", Values: []string{"store-gateway"}}},
+	}))
+	assert.Equal(t, querycomponent.Component(""), QueryComponentFromHTTPGRPCRequest(&httpgrpc.HTTPRequest{
+		Headers: []*httpgrpc.Header{{Key: "Query-Component", Values: []string{"querier"}}},
+	}))
+}
+
+func TestQueues_QueryComponentQueues_ShouldNotStarveIngesterQueries(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.queryComponentQueues = true
+	qb.addQuerierConnection("querier-1")
+
+	enqueue := func(name string, component querycomponent.Component) {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: name, component: component}, 0))
+	}
+	for i := 0; i < 10; i++ {
+		enqueue(fmt.Sprintf("store-gateway-%d", i), querycomponent.StoreGateway)
+	}
+	enqueue("ingester-0", querycomponent.Ingester)
+	enqueue("ingester-1", querycomponent.Ingester)
+	enqueue("unknown-0", "")
+
+	var dispatched []Request
+	for i := 0; i < 6; i++ {
+		request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+		require.NoError(t, err)
+		dispatched = append(dispatched, request.req)
+	}
+	assert.Equal(t, []Request{"unknown-0", "store-gateway-0", "ingester-0", "store-gateway-1", "ingester-1", "store-gateway-2"}, dispatched)
+	assert.Equal(t, 7, qb.tenantDepth("tenant-1"))
+}
+
+func TestQueues_QueryComponentQueues_ShouldBoundTheTenantQueueLength(t *testing.T) {
+	qb := newQueueBroker(3, 0)
+	qb.queryComponentQueues = true
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1", component: querycomponent.Ingester}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-2", component: querycomponent.StoreGateway}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-3"}, 0))
+	assert.ErrorIs(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-4", component: querycomponent.IngesterAndStoreGateway}, 0), ErrMaxQueueLengthExceeded)
+
+	// other tenants have their own bound
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "req-5", component: querycomponent.Ingester}, 0))
+}
+
+func TestQueues_QueryComponentQueues_Disabled(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1", component: querycomponent.StoreGateway}, 0))
+
+	node := qb.tenantQueuesTree.getNode(QueuePath{"tenant-1", PriorityClassNormal.String()})
+	require.NotNil(t, node)
+	assert.Empty(t, node.childQueueOrder, "requests are queued in the priority class sub-queue itself")
+}
+
+func TestRequestQueryComponent(t *testing.T) {
+	assert.Equal(t, querycomponent.Component(""), requestQueryComponent("request"))
+	assert.Equal(t, querycomponent.Ingester, requestQueryComponent(componentRequest{"req", querycomponent.Ingester}))
+}
+
+func TestTreeQueue_DequeueMatching(t *testing.T) {
+	root := NewTreeQueue("root", maxTestQueueLen)
+	require.NoError(t, root.EnqueueBackByPath(QueuePath{"a"}, "a-1"))
+	require.NoError(t, root.EnqueueBackByPath(QueuePath{"a"}, "a-2"))
+	require.NoError(t, root.EnqueueBackByPath(QueuePath{"b"}, "b-1"))
+	require.NoError(t, root.EnqueueBackByPath(QueuePath{}, "root-1"))
+
+	assert.Equal(t, "root-1", root.front())
+	assert.Equal(t, "a-2", root.dequeueMatching(func(v any) bool { return v == "a-2" }))
+	assert.Nil(t, root.dequeueMatching(func(v any) bool { return v == "c-1" }))
+
+	// the round-robin order carries on after the child queue the item was removed from
+	assert.Equal(t, "b-1", root.front())
+	assert.Equal(t, "b-1", root.dequeueMatching(func(any) bool { return true }))
+	assert.Nil(t, root.getNode(QueuePath{"b"}), "empty child queues are deleted")
+	assert.Equal(t, "root-1", root.Dequeue())
+	assert.Equal(t, "a-1", root.Dequeue())
+	assert.True(t, root.IsEmpty())
+	assert.Nil(t, root.front())
+}
+
+func TestQueues_DequeueRequestForQuerierComponent(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "store-gateway-1", component: querycomponent.StoreGateway}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "unknown-1"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "ingester-1", component: querycomponent.Ingester}, 0))
+
+	// a worker reserved for the ingester queries skips the other requests, which are left in place
+	request, _, _, err := qb.dequeueRequestForQuerierComponent(-1, "querier-1", querycomponent.Ingester)
+	require.NoError(t, err)
+	require.NotNil(t, request)
+	assert.Equal(t, "ingester-1", request.req)
+
+	request, _, _, err = qb.dequeueRequestForQuerierComponent(-1, "querier-1", querycomponent.Ingester)
+	require.NoError(t, err)
+	assert.Nil(t, request)
+
+	// other workers take any request
+	lastTenantIndex := -1
+	var dequeued []Request
+	for i := 0; i < 2; i++ {
+		request, _, lastTenantIndex, err = qb.dequeueRequestForQuerierComponent(lastTenantIndex, "querier-1", "")
+		require.NoError(t, err)
+		require.NotNil(t, request)
+		dequeued = append(dequeued, request.req)
+	}
+	assert.Equal(t, []Request{"store-gateway-1", "unknown-1"}, dequeued)
+}
+
+func TestQueues_DequeueRequestForQuerierComponent_QueryComponentQueues(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.queryComponentQueues = true
+	qb.addQuerierConnection("querier-1")
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "store-gateway-1", component: querycomponent.StoreGateway}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "store-gateway-2", component: querycomponent.StoreGateway}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "ingester-1", component: querycomponent.Ingester}, 0))
+	assert.Equal(t, map[querycomponent.Component]int{querycomponent.StoreGateway: 1, querycomponent.Ingester: 1}, qb.tenantQuerierAssignments.tenantsByID["tenant-2"].queuedByComponent)
+	assert.False(t, qb.tenantHasQueuedRequestsOfComponent("tenant-1", querycomponent.Ingester))
+
+	request, tenant, _, err := qb.dequeueRequestForQuerierComponent(-1, "querier-1", querycomponent.Ingester)
+	require.NoError(t, err)
+	require.NotNil(t, request)
+	assert.Equal(t, "ingester-1", request.req)
+	assert.Nil(t, qb.tenantQueuesTree.getNode(QueuePath{"tenant-2", PriorityClassNormal.String(), string(querycomponent.Ingester)}), "the emptied sub-queue is deleted")
+	assert.Equal(t, map[querycomponent.Component]int{querycomponent.StoreGateway: 1}, tenant.queuedByComponent)
+
+	request, _, _, err = qb.dequeueRequestForQuerierComponent(-1, "querier-1", querycomponent.StoreGateway)
+	require.NoError(t, err)
+	require.NotNil(t, request)
+	request, tenant, _, err = qb.dequeueRequestForQuerierComponent(-1, "querier-1", querycomponent.StoreGateway)
+	require.NoError(t, err)
+	require.NotNil(t, request)
+	assert.Empty(t, tenant.queuedByComponent)
+	assert.Nil(t, qb.tenantQueuesTree.getNode(QueuePath{string(tenant.tenantID)}), "the emptied tenant queue is deleted")
+	assert.True(t, qb.tenantQueuesTree.IsEmpty())
+}
+
+func TestRequestQueue_GetNextRequestForQuerier_ShouldOnlyDispatchTheQueryComponentOfReservedWorkers(t *testing.T) {
+	queue := NewRequestQueue(log.NewNopLogger(), 100, 0,
+		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{})
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+	})
+	queue.RegisterQuerierConnection("querier-1")
+	t.Cleanup(func() {
+		queue.UnregisterQuerierConnection("querier-1")
+	})
+
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", componentRequest{"store-gateway-1", querycomponent.StoreGateway}, 0, 1, nil))
+
+	// the reserved worker isn't dispatched the store-gateway query
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, _, err := queue.GetNextRequestForQuerier(timeoutCtx, FirstUser(), "querier-1", querycomponent.Ingester)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// it waits for an ingester query instead
+	ingesterReq := make(chan Request, 1)
+	go func() {
+		req, _, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-1", querycomponent.Ingester)
+		assert.NoError(t, err)
+		ingesterReq <- req
+	}()
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", componentRequest{"ingester-1", querycomponent.Ingester}, 0, 1, nil))
+	select {
+	case req := <-ingesterReq:
+		assert.Equal(t, componentRequest{"ingester-1", querycomponent.Ingester}, req)
+	case <-time.After(time.Second):
+		require.Fail(t, "the reserved worker wasn't dispatched the ingester query")
+	}
+
+	// other workers are dispatched any query
+	req, _, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-1", "")
+	require.NoError(t, err)
+	assert.Equal(t, componentRequest{"store-gateway-1", querycomponent.StoreGateway}, req)
+}
@@ -9,6 +9,7 @@ import (
 	"container/list"
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/go-kit/log"
@@ -17,6 +18,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/atomic"
+
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
 )
 
 const (
@@ -25,10 +28,20 @@ const (
 )
 
 var (
-	ErrInvalidTenantID     = errors.New("invalid tenant id")
-	ErrTooManyRequests     = errors.New("too many outstanding requests")
-	ErrStopped             = errors.New("queue is stopped")
-	ErrQuerierShuttingDown = errors.New("querier has informed the scheduler it is shutting down")
+	ErrInvalidTenantID         = errors.New("invalid tenant id")
+	ErrTooManyRequests         = errors.New("too many outstanding requests")
+	ErrStopped                 = errors.New("queue is stopped")
+	ErrQuerierShuttingDown     = errors.New("querier has informed the scheduler it is shutting down")
+	ErrSchedulerBusy           = errors.New("scheduler is busy reshuffling tenant queriers")
+	ErrTenantInflightFull      = errors.New("tenant has reached its max inflight requests")
+	ErrInvalidPriorityBands    = errors.New("invalid number of priority bands")
+	ErrQueueMemoryFull         = errors.New("queued requests have reached the memory ceiling")
+	ErrDeadlineAlreadyExceeded = errors.New("request deadline already exceeded at enqueue")
+	ErrInvalidPinnedShard      = errors.New("pinned shard must be a non-empty set of known queriers")
+	ErrInvalidRequestOrdering  = errors.New("invalid request ordering")
+	ErrTenantFrozen            = errors.New("tenant queue is frozen")
+	ErrQueueCapacityReserved   = errors.New("remaining tenant queue capacity is reserved for high-priority requests")
+	ErrInvalidQuerierID        = errors.New("invalid querier id")
 )
 
 // UserIndex is opaque type that allows to resume iteration over users between successive calls
@@ -62,6 +75,10 @@ type RequestQueue struct {
 
 	maxOutstandingPerTenant int
 	forgetDelay             time.Duration
+	querierCostBudget       int64
+	backpressureQueueLength int
+	queryComponentQueues    bool
+	priorityClassMaxWait    time.Duration
 
 	connectedQuerierWorkers *atomic.Int32
 
@@ -70,11 +87,29 @@ type RequestQueue struct {
 	querierOperations          chan querierOperation
 	requestsToEnqueue          chan requestToEnqueue
 	nextRequestForQuerierCalls chan *nextRequestForQuerierCall
+	brokerInspections          chan func(*queueBroker) // Functions run by dispatcherLoop() to read or restore the broker state, see DebugJSON().
+	completedRequests          chan RequestKey
+
+	// Requests dispatched to queriers and not completed yet, only tracked under a querier cost budget.
+	// Only accessed by dispatcherLoop().
+	dispatchedRequests map[RequestKey]*tenantRequest
 
 	queueLength       *prometheus.GaugeVec   // Per user and reason.
 	discardedRequests *prometheus.CounterVec // Per user.
+	expiredRequests   *prometheus.CounterVec // Per user. Optional.
+	onRequestExpired  func(req Request)      // Optional.
 
 	enqueueDuration prometheus.Histogram
+
+	tenantHistograms *TenantQueueHistograms // Nil unless per-tenant queue histograms are enabled.
+
+	// Tenants whose queue is nearly full, see TenantUnderBackpressure.
+	backpressureMtx          sync.RWMutex
+	tenantsUnderBackpressure map[TenantID]struct{}
+
+	// Write the snapshot of the requests left in the queue when the dispatcher stops, if set; see SnapshotOnStop().
+	stopSnapshotCodec RequestCodec
+	stopSnapshotWrite func([]byte) error
 }
 
 type querierOperation struct {
@@ -95,10 +130,38 @@ type requestToEnqueue struct {
 	tenantID    TenantID
 	req         Request
 	maxQueriers int
+	weight      int
 	successFn   func()
 	processed   chan error
 }
 
+// RequestQueueOptions configures the optional features of a RequestQueue. The zero value disables all of them.
+type RequestQueueOptions struct {
+	// QuerierCostBudget is the maximum estimated cost of the requests a querier executes at once, see CostEstimateRequest.
+	QuerierCostBudget int64
+
+	// BackpressureQueueLength is the length of a tenant's queue from which the tenant is under backpressure,
+	// see TenantUnderBackpressure.
+	BackpressureQueueLength int
+
+	// QueryComponentQueues splits each tenant's queue into sub-queues by query component, see querycomponent.Component.
+	QueryComponentQueues bool
+
+	// PriorityClassMaxWait is how long a tenant's requests of a lower priority class wait for its requests
+	// of the higher classes before they are dequeued ahead of them, see PriorityClass; 0 to wait indefinitely.
+	PriorityClassMaxWait time.Duration
+
+	// ExpiredRequests counts the requests evicted from the queue once expired, per user.
+	ExpiredRequests *prometheus.CounterVec
+
+	// OnRequestExpired is called with each request evicted from the queue once expired, see DeadlineRequest,
+	// for the caller to cancel it. It is called by the dispatcher, so it must not block.
+	OnRequestExpired func(req Request)
+
+	// TenantHistograms tracks the per-tenant queue wait time and queue depth histograms.
+	TenantHistograms *TenantQueueHistograms
+}
+
 func NewRequestQueue(
 	log log.Logger,
 	maxOutstandingPerTenant int,
@@ -106,15 +169,23 @@ func NewRequestQueue(
 	queueLength *prometheus.GaugeVec,
 	discardedRequests *prometheus.CounterVec,
 	enqueueDuration prometheus.Histogram,
+	opts RequestQueueOptions,
 ) *RequestQueue {
 	q := &RequestQueue{
 		log:                     log,
 		maxOutstandingPerTenant: maxOutstandingPerTenant,
 		forgetDelay:             forgetDelay,
+		querierCostBudget:       opts.QuerierCostBudget,
+		backpressureQueueLength: opts.BackpressureQueueLength,
+		queryComponentQueues:    opts.QueryComponentQueues,
+		priorityClassMaxWait:    opts.PriorityClassMaxWait,
 		connectedQuerierWorkers: atomic.NewInt32(0),
 		queueLength:             queueLength,
 		discardedRequests:       discardedRequests,
+		expiredRequests:         opts.ExpiredRequests,
+		onRequestExpired:        opts.OnRequestExpired,
 		enqueueDuration:         enqueueDuration,
+		tenantHistograms:        opts.TenantHistograms,
 
 		stopRequested: make(chan struct{}),
 		stopCompleted: make(chan struct{}),
@@ -123,6 +194,10 @@ func NewRequestQueue(
 		querierOperations:          make(chan querierOperation),
 		requestsToEnqueue:          make(chan requestToEnqueue),
 		nextRequestForQuerierCalls: make(chan *nextRequestForQuerierCall),
+		brokerInspections:          make(chan func(*queueBroker)),
+		completedRequests:          make(chan RequestKey),
+		dispatchedRequests:         map[RequestKey]*tenantRequest{},
+		tenantsUnderBackpressure:   map[TenantID]struct{}{},
 	}
 
 	q.Service = services.NewTimerService(forgetCheckPeriod, q.starting, q.forgetDisconnectedQueriers, q.stop).WithName("request queue")
@@ -140,6 +215,27 @@ func (q *RequestQueue) starting(_ context.Context) error {
 func (q *RequestQueue) dispatcherLoop() {
 	stopping := false
 	queueBroker := newQueueBroker(q.maxOutstandingPerTenant, q.forgetDelay)
+	queueBroker.tenantQuerierAssignments.logger = q.log
+	queueBroker.evictExpiredRequests = true
+	queueBroker.queryComponentQueues = q.queryComponentQueues
+	queueBroker.priorityClassMaxWait = q.priorityClassMaxWait
+	queueBroker.observer.OnRequestEvicted = func(tenantID TenantID, _ Request) {
+		q.queueLength.WithLabelValues(string(tenantID)).Dec()
+	}
+	queueBroker.observer.OnRequestExpired = func(tenantID TenantID, req Request) {
+		q.queueLength.WithLabelValues(string(tenantID)).Dec()
+		if q.expiredRequests != nil {
+			q.expiredRequests.WithLabelValues(string(tenantID)).Inc()
+		}
+		if q.onRequestExpired != nil {
+			q.onRequestExpired(req)
+		}
+	}
+	if q.querierCostBudget > 0 {
+		queueBroker.trackInflight = true
+		queueBroker.querierCostBudget = q.querierCostBudget
+	}
+	q.configureEnqueueBackpressure(queueBroker)
 	waitingGetNextRequestForQuerierCalls := list.New()
 
 	for {
@@ -155,11 +251,13 @@ func (q *RequestQueue) dispatcherLoop() {
 			switch qe.operation {
 			case registerConnection:
 				q.connectedQuerierWorkers.Inc()
-				queueBroker.addQuerierConnection(qe.querierID)
+				if err := queueBroker.addQuerierConnection(qe.querierID); err != nil {
+					level.Warn(q.log).Log("msg", "rejected querier connection", "querier", qe.querierID, "err", err)
+				}
 				needToDispatchQueries = true
 			case unregisterConnection:
 				q.connectedQuerierWorkers.Dec()
-				queueBroker.removeQuerierConnection(qe.querierID, time.Now())
+				queueBroker.removeQuerierConnection(qe.querierID, queueBroker.clock.Now())
 				needToDispatchQueries = true
 			case notifyShutdown:
 				queueBroker.notifyQuerierShutdown(qe.querierID)
@@ -169,10 +267,17 @@ func (q *RequestQueue) dispatcherLoop() {
 				// this querier, getNextQueueForQuerier will return ErrQuerierShuttingDown and we'll remove the waiting
 				// GetNextRequestForQuerier call from our list.
 			case forgetDisconnected:
-				if queueBroker.forgetDisconnectedQueriers(time.Now()) > 0 {
+				if queueBroker.forgetDisconnectedQueriers(queueBroker.clock.Now()) > 0 {
 					// Removing some queriers may have caused a resharding.
 					needToDispatchQueries = true
 				}
+				if queueBroker.applyPendingTenantReshuffles() > 0 {
+					needToDispatchQueries = true
+				}
+				queueBroker.collapseIdleShards(queueBroker.clock.Now())
+				if queueBroker.expandBackloggedShards(queueBroker.clock.Now()) > 0 {
+					needToDispatchQueries = true
+				}
 			default:
 				panic(fmt.Sprintf("received unknown querier event %v for querier ID %v", qe.operation, qe.querierID))
 			}
@@ -188,6 +293,17 @@ func (q *RequestQueue) dispatcherLoop() {
 				// No requests available for this querier connection right now. Add it to the list to try later.
 				waitingGetNextRequestForQuerierCalls.PushBack(call)
 			}
+		case inspect := <-q.brokerInspections:
+			inspect(queueBroker)
+			// A restored snapshot may have enqueued requests.
+			needToDispatchQueries = true
+		case key := <-q.completedRequests:
+			if tr, ok := q.dispatchedRequests[key]; ok {
+				delete(q.dispatchedRequests, key)
+				queueBroker.completeRequest(tr)
+				// The querier may have room in its cost budget for requests it was skipped for.
+				needToDispatchQueries = true
+			}
 		}
 
 		if needToDispatchQueries {
@@ -222,6 +338,7 @@ func (q *RequestQueue) dispatcherLoop() {
 				// But if this does happen, we want to know about it.
 				level.Warn(q.log).Log("msg", "shutting down dispatcher loop: have no connected querier workers, but request queue is not empty, so these requests will be abandoned")
 			}
+			q.writeStopSnapshot(queueBroker)
 
 			// We are done.
 			close(q.stopCompleted)
@@ -237,9 +354,16 @@ func (q *RequestQueue) dispatcherLoop() {
 //
 // If request is successfully enqueued, successFn is called before any querier can receive the request.
 func (q *RequestQueue) enqueueRequestToBroker(broker *queueBroker, r requestToEnqueue) error {
+	if err := broker.setTenantWeight(r.tenantID, r.weight); err != nil {
+		return err
+	}
 	tr := tenantRequest{
-		tenantID: r.tenantID,
-		req:      r.req,
+		tenantID:  r.tenantID,
+		req:       r.req,
+		class:     requestPriorityClass(r.req),
+		cost:      requestCost(r.req),
+		deadline:  requestDeadline(r.req),
+		component: requestQueryComponent(r.req),
 	}
 	err := broker.enqueueRequestBack(&tr, r.maxQueriers)
 	if err != nil {
@@ -249,6 +373,7 @@ func (q *RequestQueue) enqueueRequestToBroker(broker *queueBroker, r requestToEn
 		return err
 	}
 	q.queueLength.WithLabelValues(string(r.tenantID)).Inc()
+	q.tenantHistograms.observeDepth(r.tenantID, broker.tenantDepth(r.tenantID))
 
 	// Call the successFn here to ensure we call it before sending this request to a waiting querier.
 	if r.successFn != nil {
@@ -261,7 +386,7 @@ func (q *RequestQueue) enqueueRequestToBroker(broker *queueBroker, r requestToEn
 // tryDispatchRequestToQuerier finds and forwards a request to a waiting GetNextRequestForQuerier call, if a suitable request is available.
 // Returns true if call should be removed from the list of waiting calls (eg. because a request has been forwarded to it), false otherwise.
 func (q *RequestQueue) tryDispatchRequestToQuerier(broker *queueBroker, call *nextRequestForQuerierCall) bool {
-	req, tenant, idx, err := broker.dequeueRequestForQuerier(call.lastUserIndex.last, call.querierID)
+	req, tenant, idx, err := broker.dequeueRequestForQuerierComponent(call.lastUserIndex.last, call.querierID, call.queryComponent)
 	if err != nil {
 		// If this querier has told us it's shutting down, terminate GetNextRequestForQuerier with an error now...
 		call.sendError(err)
@@ -284,6 +409,15 @@ func (q *RequestQueue) tryDispatchRequestToQuerier(broker *queueBroker, call *ne
 
 	if requestSent {
 		q.queueLength.WithLabelValues(string(tenant.tenantID)).Dec()
+		q.tenantHistograms.observeWaitTime(tenant.tenantID, broker.clock.Now().Sub(req.enqueueTime))
+		if broker.trackInflight {
+			if keyed, ok := req.req.(KeyedRequest); ok {
+				q.dispatchedRequests[keyed.RequestKey()] = req
+			} else {
+				// CompleteRequest can't identify the request, so it doesn't count against the querier cost budget.
+				broker.completeRequest(req)
+			}
+		}
 	} else {
 		// should never error; any item previously in the queue already passed validation
 		err := broker.enqueueRequestFront(req, tenant.maxQueriers)
@@ -300,10 +434,15 @@ func (q *RequestQueue) tryDispatchRequestToQuerier(broker *queueBroker, call *ne
 // EnqueueRequestToDispatcher handles a request from the query frontend and submits it to the initial dispatcher queue
 //
 // maxQueries is tenant-specific value to compute which queriers should handle requests for this tenant.
-// It is passed to each EnqueueRequestToDispatcher, because it can change between calls.
+// weight is the tenant-specific weight of the tenant's queue, which queriers are dispatched requests in proportion to
+// once any tenant has a weight other than 1; 0 is the same as 1.
+// They are passed to each EnqueueRequestToDispatcher, because they can change between calls.
+//
+// Requests implementing PrioritizedRequest are dequeued before the tenant's requests of a lower priority class,
+// unless those waited longer than RequestQueueOptions.PriorityClassMaxWait, see PriorityClass.
 //
 // If request is successfully enqueued, successFn is called before any querier can receive the request.
-func (q *RequestQueue) EnqueueRequestToDispatcher(tenantID string, req Request, maxQueriers int, successFn func()) error {
+func (q *RequestQueue) EnqueueRequestToDispatcher(tenantID string, req Request, maxQueriers, weight int, successFn func()) error {
 	start := time.Now()
 	defer func() {
 		q.enqueueDuration.Observe(time.Since(start).Seconds())
@@ -313,6 +452,7 @@ func (q *RequestQueue) EnqueueRequestToDispatcher(tenantID string, req Request,
 		tenantID:    TenantID(tenantID),
 		req:         req,
 		maxQueriers: maxQueriers,
+		weight:      weight,
 		successFn:   successFn,
 		processed:   make(chan error),
 	}
@@ -328,12 +468,16 @@ func (q *RequestQueue) EnqueueRequestToDispatcher(tenantID string, req Request,
 // GetNextRequestForQuerier find next user queue and takes the next request off of it. Will block if there are no requests.
 // By passing user index from previous call of this method, querier guarantees that it iterates over all users fairly.
 // If querier finds that request from the user is already expired, it can get a request for the same user by using UserIndex.ReuseLastUser.
-func (q *RequestQueue) GetNextRequestForQuerier(ctx context.Context, last UserIndex, querierID string) (Request, UserIndex, error) {
+//
+// A querier worker reserved for a query component passes it as queryComponent, and is only returned the requests
+// expected to be served by that component; it is empty for workers which take any request.
+func (q *RequestQueue) GetNextRequestForQuerier(ctx context.Context, last UserIndex, querierID string, queryComponent querycomponent.Component) (Request, UserIndex, error) {
 	call := &nextRequestForQuerierCall{
-		ctx:           ctx,
-		querierID:     QuerierID(querierID),
-		lastUserIndex: last,
-		processed:     make(chan nextRequestForQuerier),
+		ctx:            ctx,
+		querierID:      QuerierID(querierID),
+		queryComponent: queryComponent,
+		lastUserIndex:  last,
+		processed:      make(chan nextRequestForQuerier),
 	}
 
 	select {
@@ -352,6 +496,24 @@ func (q *RequestQueue) GetNextRequestForQuerier(ctx context.Context, last UserIn
 	}
 }
 
+// CompleteRequest reports that the querier is done with a request returned by GetNextRequestForQuerier,
+// which then no longer counts against the querier cost budget. Under a querier cost budget, it must be called
+// for every returned KeyedRequest; otherwise it is a no-op.
+func (q *RequestQueue) CompleteRequest(req Request) {
+	if q.querierCostBudget <= 0 {
+		return
+	}
+	keyed, ok := req.(KeyedRequest)
+	if !ok {
+		return
+	}
+
+	select {
+	case q.completedRequests <- keyed.RequestKey():
+	case <-q.stopCompleted:
+	}
+}
+
 func (q *RequestQueue) stop(_ error) error {
 	q.stopRequested <- struct{}{} // Why not close the channel? We only want to trigger dispatcherLoop() once.
 	<-q.stopCompleted
@@ -396,10 +558,11 @@ func (q *RequestQueue) GetConnectedQuerierWorkersMetric() float64 {
 }
 
 type nextRequestForQuerierCall struct {
-	ctx           context.Context
-	querierID     QuerierID
-	lastUserIndex UserIndex
-	processed     chan nextRequestForQuerier
+	ctx            context.Context
+	querierID      QuerierID
+	queryComponent querycomponent.Component
+	lastUserIndex  UserIndex
+	processed      chan nextRequestForQuerier
 
 	haveUsed bool // Must be set to true after sending a message to processed, to ensure we only ever try to send one message to processed.
 }
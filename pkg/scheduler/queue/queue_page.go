@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// RequestMeta describes a queued request without exposing its payload.
+type RequestMeta struct {
+	// how long the request has been queued since it was enqueued to the back of the tenant queue
+	Age      time.Duration
+	Priority int
+	// deduplication key of the request; empty if the request is not deduplicated
+	Key string
+}
+
+// tenantQueuePage returns the metadata of up to limit requests queued for the tenant, in dequeue order,
+// starting at offset, along with the total number of requests queued for the tenant.
+// Offsets beyond the end of the queue return an empty page.
+func (qb *queueBroker) tenantQueuePage(tenantID TenantID, offset, limit int) ([]RequestMeta, int) {
+	total := 0
+	if node := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}); node != nil {
+		total = node.ItemCount()
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || offset >= total {
+		return nil, total
+	}
+
+	now := qb.clock.Now()
+	page := make([]RequestMeta, 0, min(limit, total-offset))
+	i := 0
+	qb.visitTenantRequests(tenantID, func(request *tenantRequest) bool {
+		if i >= offset {
+			page = append(page, RequestMeta{
+				Age:      now.Sub(request.enqueueTime),
+				Priority: request.priority,
+				Key:      request.key,
+			})
+		}
+		i++
+		return len(page) < limit
+	})
+	return page, total
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_TenantQueuePage(t *testing.T) {
+	const numRequests = 23
+
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.addQuerierConnection("querier-1")
+
+	for i := 0; i < numRequests; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i, key: fmt.Sprintf("key-%d", i), priority: i % 2}, 0))
+		clk.Advance(time.Second)
+	}
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "other"}, 0))
+
+	var expected []RequestMeta
+	qb.visitTenantRequests("tenant-1", func(request *tenantRequest) bool {
+		expected = append(expected, RequestMeta{Age: clk.Now().Sub(request.enqueueTime), Priority: request.priority, Key: request.key})
+		return true
+	})
+	require.Len(t, expected, numRequests)
+
+	// pages are contiguous and do not overlap
+	var paged []RequestMeta
+	for offset := 0; offset < numRequests; offset += 5 {
+		page, total := qb.tenantQueuePage("tenant-1", offset, 5)
+		assert.Equal(t, numRequests, total)
+		assert.Equal(t, expected[offset:min(offset+5, numRequests)], page)
+		paged = append(paged, page...)
+	}
+	assert.Equal(t, expected, paged)
+
+	// requests are paged in dequeue order, by descending priority
+	assert.Equal(t, RequestMeta{Age: 22 * time.Second, Priority: 1, Key: "key-1"}, paged[0])
+	assert.Equal(t, RequestMeta{Age: time.Second, Priority: 0, Key: "key-22"}, paged[numRequests-1])
+
+	page, total := qb.tenantQueuePage("tenant-1", numRequests, 5)
+	assert.Empty(t, page)
+	assert.Equal(t, numRequests, total)
+
+	page, total = qb.tenantQueuePage("tenant-unknown", 0, 5)
+	assert.Empty(t, page)
+	assert.Zero(t, total)
+
+	// paging is read-only
+	assert.Equal(t, numRequests+1, qb.tenantQueuesTree.ItemCount())
+	assert.NoError(t, isConsistent(qb))
+}
@@ -41,8 +41,9 @@ func BenchmarkConcurrentQueueOperations(b *testing.B) {
 						b.Run(fmt.Sprintf("%v concurrent consumers", numConsumers), func(b *testing.B) {
 							queueLength := promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"})
 							discardedRequests := promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"})
+							expiredRequests := promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"})
 							enqueueDuration := promauto.With(nil).NewHistogram(prometheus.HistogramOpts{})
-							queue := NewRequestQueue(log.NewNopLogger(), 100, 0, queueLength, discardedRequests, enqueueDuration)
+							queue := NewRequestQueue(log.NewNopLogger(), 100, 0, queueLength, discardedRequests, enqueueDuration, RequestQueueOptions{ExpiredRequests: expiredRequests})
 
 							start := make(chan struct{})
 							producersAndConsumers, ctx := errgroup.WithContext(context.Background())
@@ -76,7 +77,7 @@ func BenchmarkConcurrentQueueOperations(b *testing.B) {
 
 								for i := 0; i < requestCount; i++ {
 									for {
-										err := queue.EnqueueRequestToDispatcher(strconv.Itoa(tenantID), req, maxQueriers, func() {})
+										err := queue.EnqueueRequestToDispatcher(strconv.Itoa(tenantID), req, maxQueriers, 1, func() {})
 										if err == nil {
 											break
 										}
@@ -110,7 +111,7 @@ func BenchmarkConcurrentQueueOperations(b *testing.B) {
 								<-start
 
 								for i := 0; i < requestCount; i++ {
-									_, idx, err := queue.GetNextRequestForQuerier(ctx, lastTenantIndex, querierID)
+									_, idx, err := queue.GetNextRequestForQuerier(ctx, lastTenantIndex, querierID, "")
 									if err != nil {
 										return err
 									}
@@ -148,7 +149,8 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBe
 	queue := NewRequestQueue(log.NewNopLogger(), 1, forgetDelay,
 		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
 		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
-		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}))
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{})
 
 	// Start the queue service.
 	ctx := context.Background()
@@ -166,7 +168,7 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBe
 	querier2wg.Add(1)
 	go func() {
 		defer querier2wg.Done()
-		_, _, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-2")
+		_, _, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-2", "")
 		require.NoError(t, err)
 	}()
 
@@ -175,7 +177,7 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBe
 
 	// Enqueue a request from an user which would be assigned to querier-1.
 	// NOTE: "user-1" hash falls in the querier-1 shard.
-	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", "request", 1, nil))
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", "request", 1, 1, nil))
 
 	startTime := time.Now()
 	querier2wg.Wait()
@@ -185,6 +187,46 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldGetRequestAfterReshardingBe
 	assert.GreaterOrEqual(t, waitTime.Milliseconds(), forgetDelay.Milliseconds())
 }
 
+func TestRequestQueue_GetNextRequestForQuerier_ShouldDispatchInProportionToTenantWeights(t *testing.T) {
+	const requestsPerTenant = 100
+
+	queue := NewRequestQueue(log.NewNopLogger(), requestsPerTenant, 0,
+		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{})
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+	})
+
+	weights := map[string]int{"user-trial": 1, "user-standard": 2, "user-paid": 10}
+	for i := 0; i < requestsPerTenant; i++ {
+		for tenantID, weight := range weights {
+			require.NoError(t, queue.EnqueueRequestToDispatcher(tenantID, tenantID, 0, weight, nil))
+		}
+	}
+
+	queue.RegisterQuerierConnection("querier-1")
+	t.Cleanup(func() {
+		queue.UnregisterQuerierConnection("querier-1")
+	})
+
+	// the paid tenant is dispatched 10 requests for each request of the trial tenant until it is drained
+	const dispatched = 13 * 7
+	counts := map[string]int{}
+	last := FirstUser()
+	for i := 0; i < dispatched; i++ {
+		req, idx, err := queue.GetNextRequestForQuerier(ctx, last, "querier-1", "")
+		require.NoError(t, err)
+		last = idx
+		counts[req.(string)]++
+	}
+	assert.Equal(t, map[string]int{"user-trial": 7, "user-standard": 14, "user-paid": 70}, counts)
+}
+
 func TestRequestQueue_GetNextRequestForQuerier_ShouldReturnAfterContextCancelled(t *testing.T) {
 	const forgetDelay = 3 * time.Second
 	const querierID = "querier-1"
@@ -192,7 +234,8 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldReturnAfterContextCancelled
 	queue := NewRequestQueue(log.NewNopLogger(), 1, forgetDelay,
 		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
 		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
-		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}))
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{})
 
 	require.NoError(t, services.StartAndAwaitRunning(context.Background(), queue))
 	t.Cleanup(func() {
@@ -204,7 +247,7 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldReturnAfterContextCancelled
 	ctx, cancel := context.WithCancel(context.Background())
 
 	go func() {
-		_, _, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), querierID)
+		_, _, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), querierID, "")
 		errChan <- err
 	}()
 
@@ -226,7 +269,8 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldReturnImmediatelyIfQuerierI
 	queue := NewRequestQueue(log.NewNopLogger(), 1, forgetDelay,
 		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
 		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
-		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}))
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{})
 
 	ctx := context.Background()
 	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
@@ -237,7 +281,7 @@ func TestRequestQueue_GetNextRequestForQuerier_ShouldReturnImmediatelyIfQuerierI
 	queue.RegisterQuerierConnection(querierID)
 	queue.NotifyQuerierShutdown(querierID)
 
-	_, _, err := queue.GetNextRequestForQuerier(context.Background(), FirstUser(), querierID)
+	_, _, err := queue.GetNextRequestForQuerier(context.Background(), FirstUser(), querierID, "")
 	require.EqualError(t, err, "querier has informed the scheduler it is shutting down")
 }
 
@@ -248,7 +292,8 @@ func TestRequestQueue_tryDispatchRequestToQuerier_ShouldReEnqueueAfterFailedSend
 	queue := NewRequestQueue(log.NewNopLogger(), 1, forgetDelay,
 		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
 		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
-		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}))
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{})
 
 	// bypassing queue dispatcher loop for direct usage of the queueBroker and
 	// passing a nextRequestForQuerierCall for a canceled querier connection
@@ -0,0 +1,155 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"math"
+	"time"
+)
+
+// EventType identifies a broker operation recorded for replay.
+type EventType string
+
+const (
+	// EventStart is recorded when recording starts, with the configuration needed to create an equivalent broker.
+	EventStart           EventType = "start"
+	EventEnqueue         EventType = "enqueue"
+	EventEnqueueFront    EventType = "enqueue_front"
+	EventDequeue         EventType = "dequeue"
+	EventConnect         EventType = "connect"
+	EventConnectOverflow EventType = "connect_overflow"
+	EventDisconnect      EventType = "disconnect"
+	EventShutdown        EventType = "shutdown"
+	EventForgetQueriers  EventType = "forget_queriers"
+	EventSetTenantConfig EventType = "set_tenant_config"
+)
+
+// Event is a broker operation recorded for replay. Request payloads are not recorded.
+type Event struct {
+	Type EventType `json:"type"`
+	// time of the broker clock when the operation was applied
+	Time time.Time `json:"time"`
+
+	TenantID    TenantID  `json:"tenant_id,omitempty"`
+	QuerierID   QuerierID `json:"querier_id,omitempty"`
+	MaxQueriers int       `json:"max_queriers,omitempty"`
+
+	// enqueued request; a request re-enqueued to the front is identified by its tenant and sequence number
+	Seq           uint64        `json:"seq,omitempty"`
+	PriorityClass PriorityClass `json:"priority_class,omitempty"`
+	Priority      int           `json:"priority,omitempty"`
+	Key           string        `json:"key,omitempty"`
+	CacheKey      string        `json:"cache_key,omitempty"`
+	PayloadBytes  int64         `json:"payload_bytes,omitempty"`
+
+	LastTenantIndex int           `json:"last_tenant_index,omitempty"`
+	TenantConfig    *TenantConfig `json:"tenant_config,omitempty"`
+
+	// broker configuration recorded by EventStart
+	MaxTenantQueueSize int           `json:"max_tenant_queue_size,omitempty"`
+	ForgetDelay        time.Duration `json:"forget_delay,omitempty"`
+}
+
+// eventRecorder captures the operations applied to a broker, shared with its tenant-querier assignments.
+type eventRecorder struct {
+	clock  clock
+	events []Event
+}
+
+func (r *eventRecorder) record(event Event) {
+	if r == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = r.clock.Now()
+	}
+	r.events = append(r.events, event)
+}
+
+// startRecording starts recording the operations applied to the broker, for replay into a fresh broker.
+// Recording must start while the broker is still empty for the replay to reproduce its state.
+func (qb *queueBroker) startRecording() {
+	qb.recorder = &eventRecorder{clock: qb.clock}
+	qb.tenantQuerierAssignments.recorder = qb.recorder
+	qb.recorder.record(Event{
+		Type:               EventStart,
+		MaxTenantQueueSize: qb.maxTenantQueueSize,
+		ForgetDelay:        qb.tenantQuerierAssignments.querierForgetDelay,
+	})
+}
+
+// recordedEvents returns the operations recorded since recording started.
+func (qb *queueBroker) recordedEvents() []Event {
+	if qb.recorder == nil {
+		return nil
+	}
+	return append([]Event(nil), qb.recorder.events...)
+}
+
+// replayClock is a clock set to the time of each replayed event.
+type replayClock struct {
+	now time.Time
+}
+
+func (c *replayClock) Now() time.Time {
+	return c.now
+}
+
+// replay applies recorded events to a fresh broker and returns it. The broker has the configuration recorded
+// by the EventStart event and otherwise default scheduling options; without an EventStart event,
+// the tenant queue size is unlimited and disconnected queriers are forgotten immediately.
+// Its clock is set to the time of each event before the event is applied.
+func replay(events []Event) *queueBroker {
+	clk := &replayClock{}
+	qb := newQueueBroker(math.MaxInt, 0)
+	qb.setClock(clk)
+
+	// requests dequeued during the replay, which may be re-enqueued to the front
+	dequeued := map[TenantID]map[uint64]*tenantRequest{}
+
+	for _, event := range events {
+		clk.now = event.Time
+		switch event.Type {
+		case EventStart:
+			qb = newQueueBroker(event.MaxTenantQueueSize, event.ForgetDelay)
+			qb.setClock(clk)
+		case EventEnqueue:
+			_ = qb.enqueueRequestBack(&tenantRequest{
+				tenantID:     event.TenantID,
+				key:          event.Key,
+				cacheKey:     event.CacheKey,
+				class:        event.PriorityClass,
+				priority:     event.Priority,
+				payloadBytes: event.PayloadBytes,
+			}, event.MaxQueriers)
+		case EventEnqueueFront:
+			if request := dequeued[event.TenantID][event.Seq]; request != nil {
+				delete(dequeued[event.TenantID], event.Seq)
+				_ = qb.enqueueRequestFront(request, event.MaxQueriers)
+			}
+		case EventDequeue:
+			request, _, _, _ := qb.dequeueRequestForQuerier(event.LastTenantIndex, event.QuerierID)
+			if request != nil {
+				if dequeued[request.tenantID] == nil {
+					dequeued[request.tenantID] = map[uint64]*tenantRequest{}
+				}
+				dequeued[request.tenantID][request.seq] = request
+			}
+		case EventConnect:
+			_ = qb.addQuerierConnection(event.QuerierID)
+		case EventConnectOverflow:
+			_ = qb.addOverflowQuerierConnection(event.QuerierID)
+		case EventDisconnect:
+			qb.removeQuerierConnection(event.QuerierID, event.Time)
+		case EventShutdown:
+			qb.notifyQuerierShutdown(event.QuerierID)
+		case EventForgetQueriers:
+			qb.forgetDisconnectedQueriers(event.Time)
+		case EventSetTenantConfig:
+			if event.TenantConfig != nil {
+				_ = qb.tenantQuerierAssignments.setTenantConfig(event.TenantID, *event.TenantConfig)
+			}
+		}
+	}
+	return qb
+}
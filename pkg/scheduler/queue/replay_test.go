@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_RecordAndReplay(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(10, 5*time.Second)
+	qb.clock = clk
+	qb.startRecording()
+
+	rnd := rand.New(rand.NewSource(1))
+	querierIDs := []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"}
+	for _, querierID := range querierIDs {
+		qb.addQuerierConnection(querierID)
+	}
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-0", TenantConfig{PriorityBands: 2}))
+
+	lastTenantIndexes := map[QuerierID]int{}
+	for i := 0; i < 1000; i++ {
+		clk.Advance(time.Duration(rnd.Intn(1000)) * time.Millisecond)
+		querierID := querierIDs[rnd.Intn(len(querierIDs))]
+		switch op := rnd.Intn(20); {
+		case op < 9:
+			tenantID := TenantID(fmt.Sprintf("tenant-%d", rnd.Intn(5)))
+			// enqueues over the max queue size fail, and are replayed as such
+			_ = qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: i, priority: rnd.Intn(3), key: fmt.Sprintf("key-%d", i)}, rnd.Intn(3))
+		case op < 17:
+			request, tenant, lastTenantIndex, err := qb.dequeueRequestForQuerier(lastTenantIndexes[querierID], querierID)
+			if err != nil {
+				continue
+			}
+			lastTenantIndexes[querierID] = lastTenantIndex
+			if request != nil && rnd.Intn(3) == 0 {
+				require.NoError(t, qb.enqueueRequestFront(request, tenant.maxQueriers))
+			}
+		case op < 18:
+			if querier := qb.tenantQuerierAssignments.queriersByID[querierID]; querier != nil && querier.connections > 0 {
+				qb.removeQuerierConnection(querierID, clk.Now())
+			} else {
+				qb.addQuerierConnection(querierID)
+			}
+		case op < 19:
+			qb.notifyQuerierShutdown(querierID)
+		default:
+			qb.forgetDisconnectedQueriers(clk.Now())
+		}
+	}
+
+	events := qb.recordedEvents()
+	require.Equal(t, EventStart, events[0].Type)
+
+	replayed := replay(events)
+	require.NoError(t, isConsistent(replayed))
+	assert.Equal(t, qb.stateFingerprint(), replayed.stateFingerprint())
+	assert.Equal(t, qb.tenantQueuesTree.ItemCount(), replayed.tenantQueuesTree.ItemCount())
+
+	// recorded events can be persisted, e.g. from a production scheduler, and replayed later
+	data, err := json.Marshal(events)
+	require.NoError(t, err)
+	var decoded []Event
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, qb.stateFingerprint(), replay(decoded).stateFingerprint())
+
+	// a partial replay ends in a different state
+	assert.NotEqual(t, qb.stateFingerprint(), replay(events[:len(events)-10]).stateFingerprint())
+}
+
+func TestQueues_RecordingDisabledByDefault(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req"}, 0))
+
+	assert.Nil(t, qb.recordedEvents())
+}
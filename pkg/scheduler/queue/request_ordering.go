@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// RequestOrdering is the order in which the queued requests of a tenant are dispatched.
+type RequestOrdering string
+
+const (
+	// RequestOrderingDefault uses the broker's request ordering for a tenant, and orders by priority for the broker.
+	RequestOrderingDefault RequestOrdering = ""
+	// RequestOrderingPriority dispatches requests by descending priority, and in FIFO order within a priority.
+	RequestOrderingPriority RequestOrdering = "priority"
+	// RequestOrderingFIFO dispatches requests in the order they were enqueued, regardless of their priority;
+	// requests re-enqueued after a failed dispatch go to the front of the queue.
+	RequestOrderingFIFO RequestOrdering = "fifo"
+	// RequestOrderingSmallestFirst dispatches requests by descending priority, and by ascending payload size
+	// within a priority, as an approximation of shortest job first; it relies on the broker's payload sizer.
+	// Requests of the same size are dispatched in FIFO order.
+	RequestOrderingSmallestFirst RequestOrdering = "smallest_first"
+	// RequestOrderingStrict dispatches requests by descending priority, and within a priority in the order
+	// they were first enqueued, including requests re-enqueued after a failed dispatch and requests enqueued
+	// before the tenant was last removed. The tenant's requests are always dispatched from the head of its queue,
+	// so neither striping nor cache key affinity apply to the tenant; a filtered dequeue still skips rejected requests.
+	RequestOrderingStrict RequestOrdering = "strict"
+	// RequestOrderingLeastSlack dispatches requests by descending priority, and within a priority by ascending slack:
+	// the time left before a request must start to complete by its deadline, given its estimated duration if known.
+	// Requests without a deadline are dispatched after those with one, and requests of the same slack in FIFO order.
+	// Requests dequeued past their deadline are dropped rather than dispatched, see dropExpiredRequest.
+	RequestOrderingLeastSlack RequestOrdering = "least_slack"
+)
+
+func (o RequestOrdering) valid() bool {
+	switch o {
+	case RequestOrderingDefault, RequestOrderingPriority, RequestOrderingFIFO, RequestOrderingSmallestFirst, RequestOrderingStrict,
+		RequestOrderingLeastSlack:
+		return true
+	}
+	return false
+}
+
+// tenantRequestOrdering returns the effective request ordering of the tenant, falling back to the broker's.
+func (qb *queueBroker) tenantRequestOrdering(tenant *queueTenant) RequestOrdering {
+	if tenant.requestOrdering != RequestOrderingDefault {
+		return tenant.requestOrdering
+	}
+	if qb.requestOrdering != RequestOrderingDefault {
+		return qb.requestOrdering
+	}
+	return RequestOrderingPriority
+}
+
+// orderedBefore returns true if request a is dispatched before request b under the ordering,
+// irrespective of their enqueue order.
+func orderedBefore(ordering RequestOrdering, a, b *tenantRequest) bool {
+	switch ordering {
+	case RequestOrderingFIFO:
+		return false
+	case RequestOrderingSmallestFirst:
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.payloadBytes < b.payloadBytes
+	case RequestOrderingStrict:
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.globalSeq < b.globalSeq
+	case RequestOrderingLeastSlack:
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		if a.deadline.IsZero() || b.deadline.IsZero() {
+			return !a.deadline.IsZero() && b.deadline.IsZero()
+		}
+		// the slack of both requests is measured from the same time, so it orders them as their latest start does
+		return a.latestStart().Before(b.latestStart())
+	}
+	return a.priority > b.priority
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestQueues_RequestOrderingStrict_Property performs random operations on a broker serving tenants under strict
+// request ordering, and checks after each operation that every tenant queue is ordered by descending priority
+// and then by first enqueue, and that every dequeue serves the head of the tenant queue.
+func TestQueues_RequestOrderingStrict_Property(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		t.Run(fmt.Sprintf("seed %d", seed), func(t *testing.T) {
+			testStrictRequestOrdering(t, rand.New(rand.NewSource(seed)), 500)
+		})
+	}
+}
+
+func testStrictRequestOrdering(t *testing.T, rnd *rand.Rand, operations int) {
+	clk := newManualClock()
+	qb := newQueueBroker(1000, 0)
+	qb.clock = clk
+	qb.requestOrdering = RequestOrderingStrict
+	qb.trackInflight = true
+	// neither applies to tenants under strict ordering
+	qb.stripeTenantRequests = true
+	qb.cacheKeyAffinityMaxWait = time.Hour
+
+	tenantIDs := []TenantID{"tenant-1", "tenant-2", "tenant-3"}
+	querierIDs := []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"}
+	connected := map[QuerierID]bool{}
+	for _, querierID := range querierIDs[:2] {
+		qb.addQuerierConnection(querierID)
+		connected[querierID] = true
+	}
+
+	var dispatched []*tenantRequest
+	takeDispatched := func() *tenantRequest {
+		i := rnd.Intn(len(dispatched))
+		request := dispatched[i]
+		dispatched = append(dispatched[:i], dispatched[i+1:]...)
+		return request
+	}
+	nextReq := 0
+
+	for op := 0; op < operations; op++ {
+		clk.Advance(time.Duration(rnd.Intn(3)) * time.Millisecond)
+
+		switch n := rnd.Intn(10); {
+		case n < 4:
+			tenantID := tenantIDs[rnd.Intn(len(tenantIDs))]
+			request := &tenantRequest{
+				tenantID: tenantID,
+				req:      fmt.Sprintf("r%d", nextReq),
+				priority: rnd.Intn(3),
+				cacheKey: fmt.Sprintf("key-%d", rnd.Intn(4)),
+			}
+			nextReq++
+			require.NoError(t, qb.enqueueRequestBack(request, rnd.Intn(3)))
+
+		case n < 7:
+			querierID := querierIDs[rnd.Intn(len(querierIDs))]
+			if !connected[querierID] {
+				continue
+			}
+			heads := map[TenantID]*tenantRequest{}
+			for _, tenantID := range tenantIDs {
+				qb.visitTenantRequests(tenantID, func(request *tenantRequest) bool {
+					heads[tenantID] = request
+					return false
+				})
+			}
+			request, _, _, err := qb.dequeueRequestForQuerier(-1, querierID)
+			require.NoError(t, err)
+			if request != nil {
+				require.Same(t, heads[request.tenantID], request, "request dequeued out of order")
+				dispatched = append(dispatched, request)
+			}
+
+		case n < 8:
+			if len(dispatched) > 0 {
+				request := takeDispatched()
+				require.NoError(t, qb.enqueueRequestFront(request, rnd.Intn(3)))
+			}
+
+		case n < 9:
+			if len(dispatched) > 0 {
+				qb.completeRequest(takeDispatched())
+			}
+
+		default:
+			querierID := querierIDs[rnd.Intn(len(querierIDs))]
+			if !connected[querierID] {
+				qb.addQuerierConnection(querierID)
+				connected[querierID] = true
+			} else if len(connected) > 1 {
+				qb.removeQuerierConnection(querierID, clk.Now())
+				delete(connected, querierID)
+			}
+		}
+
+		for _, tenantID := range tenantIDs {
+			requireStrictlyOrdered(t, qb, tenantID)
+		}
+		require.NoError(t, isConsistent(qb))
+	}
+}
+
+func requireStrictlyOrdered(t *testing.T, qb *queueBroker, tenantID TenantID) {
+	var prev *tenantRequest
+	qb.visitTenantRequests(tenantID, func(request *tenantRequest) bool {
+		if prev != nil {
+			require.True(t, prev.priority >= request.priority, "tenant %s: %s queued ahead of higher priority %s", tenantID, prev.req, request.req)
+			if prev.priority == request.priority {
+				require.False(t, prev.enqueueTime.After(request.enqueueTime), "tenant %s: %s queued ahead of earlier %s", tenantID, prev.req, request.req)
+				require.Less(t, prev.globalSeq, request.globalSeq, "tenant %s: %s queued ahead of earlier %s", tenantID, prev.req, request.req)
+			}
+		}
+		prev = request
+		return true
+	})
+}
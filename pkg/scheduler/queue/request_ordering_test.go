@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_RequestOrderingPerTenant(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, tqa.setTenantConfig("tenant-fifo", TenantConfig{RequestOrdering: RequestOrderingFIFO}))
+	require.NoError(t, tqa.setTenantConfig("tenant-smallest", TenantConfig{RequestOrdering: RequestOrderingSmallestFirst}))
+
+	for _, tenantID := range []TenantID{"tenant-default", "tenant-fifo", "tenant-smallest"} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "low-large", priority: 0, payloadBytes: 300}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "high-large", priority: 1, payloadBytes: 200}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "high-small", priority: 1, payloadBytes: 100}, 0))
+	}
+
+	// tenants without their own ordering keep the broker's priority ordering
+	assert.Equal(t, []any{"high-large", "high-small", "low-large"}, queuedRequests(qb, "tenant-default"))
+	assert.Equal(t, []any{"low-large", "high-large", "high-small"}, queuedRequests(qb, "tenant-fifo"))
+	assert.Equal(t, []any{"high-small", "high-large", "low-large"}, queuedRequests(qb, "tenant-smallest"))
+
+	// reprioritized requests move under priority orderings, and keep their place under FIFO ordering
+	for _, tenantID := range []TenantID{"tenant-default", "tenant-fifo", "tenant-smallest"} {
+		var lowLarge *tenantRequest
+		qb.visitTenantRequests(tenantID, func(request *tenantRequest) bool {
+			if request.req == "low-large" {
+				lowLarge = request
+			}
+			return true
+		})
+		require.True(t, qb.reprioritizeRequest(lowLarge, 2))
+	}
+	assert.Equal(t, []any{"low-large", "high-large", "high-small"}, queuedRequests(qb, "tenant-default"))
+	assert.Equal(t, []any{"low-large", "high-large", "high-small"}, queuedRequests(qb, "tenant-fifo"))
+	assert.Equal(t, []any{"low-large", "high-small", "high-large"}, queuedRequests(qb, "tenant-smallest"))
+
+	assert.ErrorIs(t, tqa.setTenantConfig("tenant-invalid", TenantConfig{RequestOrdering: "lifo"}), ErrInvalidRequestOrdering)
+}
+
+func TestQueues_RequestOrderingBrokerDefault(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.requestOrdering = RequestOrderingFIFO
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-priority", TenantConfig{RequestOrdering: RequestOrderingPriority}))
+
+	for _, tenantID := range []TenantID{"tenant-default", "tenant-priority"} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "low", priority: 0}, 0))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "high", priority: 1}, 0))
+	}
+	assert.Equal(t, []any{"low", "high"}, queuedRequests(qb, "tenant-default"))
+	assert.Equal(t, []any{"high", "low"}, queuedRequests(qb, "tenant-priority"))
+}
@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// countQueuedTags adds delta to the queued request count of each of the request's tags,
+// if the broker tracks the queue depth by tag.
+func (qb *queueBroker) countQueuedTags(request *tenantRequest, delta int) {
+	if !qb.trackTagDepths || len(request.tags) == 0 {
+		return
+	}
+	if qb.queuedByTag == nil {
+		qb.queuedByTag = map[string]int{}
+	}
+	for _, tag := range request.tags {
+		if qb.queuedByTag[tag] += delta; qb.queuedByTag[tag] <= 0 {
+			delete(qb.queuedByTag, tag)
+		}
+	}
+}
+
+// depthByTag returns the number of queued requests carrying each tag, across all tenants; a request with several tags
+// is counted once for each of them. Tags without queued requests are omitted.
+//
+// The depths are read from counters maintained on enqueue and dequeue if the broker tracks them,
+// which keeps frequent scrapes cheap; otherwise all queued requests are walked.
+func (qb *queueBroker) depthByTag() map[string]int {
+	depths := make(map[string]int, len(qb.queuedByTag))
+	if qb.trackTagDepths {
+		for tag, depth := range qb.queuedByTag {
+			depths[tag] = depth
+		}
+		return depths
+	}
+	qb.visitAllRequests(func(_ TenantID, request *tenantRequest) bool {
+		for _, tag := range request.tags {
+			depths[tag]++
+		}
+		return true
+	})
+	return depths
+}
@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_DepthByTag(t *testing.T) {
+	for _, trackTagDepths := range []bool{false, true} {
+		qb := newQueueBroker(100, 0)
+		qb.trackTagDepths = trackTagDepths
+		qb.dedupMode = dedupReplaceWithLatest
+		qb.addQuerierConnection("querier-1")
+		assert.Empty(t, qb.depthByTag())
+
+		enqueue := func(tenantID TenantID, req string, key string, tags ...string) {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: req, key: key, tags: tags}, 0))
+		}
+		enqueue("tenant-1", "gpu-1", "", "gpu")
+		enqueue("tenant-1", "gpu-large-mem", "", "gpu", "large-memory")
+		enqueue("tenant-1", "untagged", "")
+		enqueue("tenant-2", "gpu-2", "", "gpu")
+		enqueue("tenant-2", "large-mem", "a", "large-memory")
+		assert.Equal(t, map[string]int{"gpu": 3, "large-memory": 2}, qb.depthByTag(), "track tag depths: %v", trackTagDepths)
+
+		// a replaced request carries the tags of its latest submission
+		enqueue("tenant-2", "no-longer-large-mem", "a", "gpu")
+		assert.Equal(t, map[string]int{"gpu": 4, "large-memory": 1}, qb.depthByTag(), "track tag depths: %v", trackTagDepths)
+
+		dequeueN(t, qb, "querier-1", 3)
+		assert.Equal(t, map[string]int{"gpu": 1}, qb.depthByTag(), "track tag depths: %v", trackTagDepths)
+		dequeueN(t, qb, "querier-1", 2)
+		assert.Empty(t, qb.depthByTag(), "track tag depths: %v", trackTagDepths)
+	}
+}
+
+func TestQueues_DepthByTagMetrics(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.trackTagDepths = true
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r1", tags: []string{"gpu"}}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "r2", tags: []string{"gpu", "large-memory"}}, 0))
+
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(qb))
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+		# HELP cortex_query_scheduler_broker_queue_length_by_tag Number of queued requests of all tenants carrying each request tag. Only exported if the broker tracks the queue depth by tag.
+		# TYPE cortex_query_scheduler_broker_queue_length_by_tag gauge
+		cortex_query_scheduler_broker_queue_length_by_tag{tag="gpu"} 2
+		cortex_query_scheduler_broker_queue_length_by_tag{tag="large-memory"} 1
+	`), "cortex_query_scheduler_broker_queue_length_by_tag"))
+}
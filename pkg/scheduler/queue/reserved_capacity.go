@@ -0,0 +1,22 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "errors"
+
+// admitUnderReservedCapacity returns ErrQueueCapacityReserved if the request is not of a high enough priority
+// to take one of the slots reserved at the end of the tenant queue, and only reserved slots are left.
+// The tenant queue size limit itself is enforced by the tenant queue.
+func (qb *queueBroker) admitUnderReservedCapacity(tenant *queueTenant, request *tenantRequest) error {
+	if qb.reservedQueueSlots <= 0 || request.priority > qb.reservedSlotsPriorityThreshold {
+		return nil
+	}
+	depth := 0
+	if node := qb.tenantQueuesTree.getNode(QueuePath{string(tenant.tenantID)}); node != nil {
+		depth = node.ItemCount()
+	}
+	if depth < qb.maxTenantQueueSize-qb.reservedQueueSlots {
+		return nil
+	}
+	return errors.Join(ErrQueueCapacityReserved, ErrTooManyRequests)
+}
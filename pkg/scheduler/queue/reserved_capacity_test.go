@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ReservedQueueCapacity(t *testing.T) {
+	qb := newQueueBroker(5, 0)
+	qb.reservedQueueSlots = 2
+	qb.reservedSlotsPriorityThreshold = 1
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i, priority: 1}, 0))
+	}
+
+	// only the reserved slots are left: requests at or below the threshold are rejected
+	err := qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "low", priority: 1}, 0)
+	assert.ErrorIs(t, err, ErrQueueCapacityReserved)
+	assert.ErrorIs(t, err, ErrTooManyRequests)
+
+	// while requests above the threshold are admitted, up to the tenant queue size
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "high-1", priority: 2}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "high-2", priority: 3}, 0))
+	err = qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "high-3", priority: 2}, 0)
+	assert.ErrorIs(t, err, ErrMaxQueueLengthExceeded)
+	assert.NotErrorIs(t, err, ErrQueueCapacityReserved)
+
+	// low priority requests are admitted again once the queue drains below the reserved slots
+	qb.addQuerierConnection("querier-1")
+	dequeueN(t, qb, "querier-1", 3)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "low", priority: 1}, 0))
+
+	// the reservation applies to each tenant queue
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "low", priority: 0}, 0))
+}
+
+func TestQueues_ReservedQueueCapacity_AllSlotsReserved(t *testing.T) {
+	qb := newQueueBroker(2, 0)
+	qb.reservedQueueSlots = 2
+
+	// a tenant is not left behind by a rejected request
+	assert.ErrorIs(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "low"}, 0), ErrQueueCapacityReserved)
+	assert.NotContains(t, qb.tenantQuerierAssignments.tenantsByID, TenantID("tenant-1"))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "high", priority: 1}, 0))
+}
+
+func TestQueues_ReservedQueueCapacity_Disabled(t *testing.T) {
+	qb := newQueueBroker(5, 0)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+	}
+	assert.ErrorIs(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "high", priority: 1}, 0), ErrMaxQueueLengthExceeded)
+}
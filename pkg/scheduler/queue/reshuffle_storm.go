@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// detectReshuffleStorm starts the busy period if at least reshuffleStormThreshold tenant shards
+// were computed since the tenant shuffle count was shufflesBefore.
+func (qb *queueBroker) detectReshuffleStorm(shufflesBefore uint64) {
+	if qb.reshuffleStormThreshold <= 0 {
+		return
+	}
+	if qb.tenantQuerierAssignments.tenantShuffles-shufflesBefore >= uint64(qb.reshuffleStormThreshold) {
+		qb.busyUntil = qb.clock.Now().Add(qb.reshuffleStormBusyPeriod)
+	}
+}
+
+// schedulerBusy returns true if enqueues should be shed because a large reshuffle has just been computed
+// and the busy period has not passed yet, or because a large reshuffle is pending.
+func (qb *queueBroker) schedulerBusy(now time.Time) bool {
+	if qb.reshuffleStormThreshold <= 0 {
+		return false
+	}
+	return now.Before(qb.busyUntil) || len(qb.tenantQuerierAssignments.pendingTenantReshuffles) >= qb.reshuffleStormThreshold
+}
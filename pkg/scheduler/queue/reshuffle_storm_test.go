@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ShedEnqueuesDuringReshuffleStorm(t *testing.T) {
+	const numTenants = 20
+
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.reshuffleStormThreshold = numTenants / 2
+	qb.reshuffleStormBusyPeriod = 10 * time.Second
+
+	for i := 0; i < 5; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	// a fleet change which reshuffles only a few tenants does not shed enqueues
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "request"}, 2))
+	qb.addQuerierConnection("querier-5")
+	assert.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "request"}, 2))
+
+	for i := 1; i < numTenants; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", i)), req: "request"}, 2))
+	}
+
+	// a fleet change which reshuffles all tenants starts the busy period
+	qb.addQuerierConnection("querier-6")
+	err := qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "shed"}, 2)
+	assert.ErrorIs(t, err, ErrSchedulerBusy)
+
+	// re-enqueues of dispatched requests are not shed
+	req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-6")
+	require.NoError(t, err)
+	require.NotNil(t, req)
+	assert.NoError(t, qb.enqueueRequestFront(req, 2))
+
+	clk.Advance(5 * time.Second)
+	assert.ErrorIs(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "shed"}, 2), ErrSchedulerBusy)
+
+	// the busy period clears by itself
+	clk.Advance(5 * time.Second)
+	assert.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "request"}, 2))
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_ShedEnqueuesWhileLargeReshufflePending(t *testing.T) {
+	const numTenants = 10
+
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.reshuffleStormThreshold = numTenants
+	qb.reshuffleStormBusyPeriod = time.Second
+	qb.tenantQuerierAssignments.deferTenantReshuffle = true
+	for i := 0; i < 5; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+
+	// sharding every tenant queues a large deferred reshuffle
+	for i := 0; i < numTenants; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", i)), req: "request"}, 3))
+	}
+	assert.Len(t, qb.tenantQuerierAssignments.pendingTenantReshuffles, numTenants)
+	assert.ErrorIs(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "shed"}, 3), ErrSchedulerBusy)
+
+	// applying the pending reshuffles is itself a large reshuffle
+	assert.Equal(t, numTenants, qb.applyPendingTenantReshuffles())
+	assert.ErrorIs(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "shed"}, 3), ErrSchedulerBusy)
+
+	clk.Advance(time.Second)
+	assert.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "request"}, 3))
+}
+
+func TestQueues_NeverBusyByDefault(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", i)), req: "request"}, 1))
+	}
+	for i := 0; i < 10; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	assert.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "request"}, 1))
+}
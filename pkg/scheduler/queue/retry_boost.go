@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// boostRetriedRequest raises the priority of a request re-enqueued after a failed dispatch by one band
+// for every retryBoostInterval it has been queued across all its attempts, so that retries which have already
+// waited once are not made to wait again from scratch. The boost is recomputed on every retry, replacing
+// the boost of the previous attempt, and the boosted priority is clamped to the priority bands of the tenant.
+//
+// Requests past their deadline are not boosted, as the broker drops them rather than dispatching them.
+func (qb *queueBroker) boostRetriedRequest(tenant *queueTenant, request *tenantRequest) {
+	request.retries++
+	if qb.retryBoostInterval <= 0 {
+		return
+	}
+	now := qb.clock.Now()
+	if qb.requestDeadlineExceeded(request, now) {
+		return
+	}
+
+	basePriority := request.priority - request.retryBoost
+	boost := int(now.Sub(request.enqueueTime) / qb.retryBoostInterval)
+	request.priority = qb.priorityBand(tenant, basePriority+boost)
+	request.retryBoost = request.priority - basePriority
+}
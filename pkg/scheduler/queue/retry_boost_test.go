@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_RetryBoost(t *testing.T) {
+	tests := map[string]struct {
+		retryBoostInterval time.Duration
+		expectedOrder      []any
+	}{
+		"retried requests are not boosted by default": {
+			expectedOrder: []any{"fresh-1", "fresh-2", "retried"},
+		},
+		"retried requests are served ahead of fresh requests of equal priority": {
+			retryBoostInterval: time.Minute,
+			expectedOrder:      []any{"retried", "fresh-1", "fresh-2"},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			clk := newManualClock()
+			qb := newQueueBroker(100, 0)
+			qb.clock = clk
+			qb.retryBoostInterval = testData.retryBoostInterval
+			qb.requestOrdering = RequestOrderingSmallestFirst
+			require.NoError(t, qb.setPriorityBands(3))
+			qb.addQuerierConnection("querier-1")
+
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "retried", payloadBytes: 300}, 0))
+			retried, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+			require.NoError(t, err)
+
+			clk.Advance(2 * time.Minute)
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "fresh-1", payloadBytes: 100}, 0))
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "fresh-2", payloadBytes: 200}, 0))
+			require.NoError(t, qb.enqueueRequestFront(retried, 0))
+
+			assert.Equal(t, testData.expectedOrder, queuedRequests(qb, "tenant-1"))
+			assert.Equal(t, 1, retried.retries)
+		})
+	}
+}
+
+func TestQueues_RetryBoostLimits(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.retryBoostInterval = time.Minute
+	qb.rejectExpiredRequests = true
+	require.NoError(t, qb.setPriorityBands(3))
+	qb.addQuerierConnection("querier-1")
+
+	retry := func() *tenantRequest {
+		request, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+		require.NoError(t, err)
+		require.NotNil(t, request)
+		require.NoError(t, qb.enqueueRequestFront(request, 0))
+		return request
+	}
+
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, 0))
+	clk.Advance(time.Minute)
+	assert.Equal(t, 1, retry().priority)
+
+	// the boost follows the total age of the request rather than adding up across retries
+	clk.Advance(30 * time.Second)
+	assert.Equal(t, 1, retry().priority)
+
+	// and is clamped to the priority bands
+	clk.Advance(time.Hour)
+	request := retry()
+	assert.Equal(t, 2, request.priority)
+	assert.Equal(t, 3, request.retries)
+	dequeueN(t, qb, "querier-1", 1)
+
+	// requests past their deadline are about to be dropped, and are not boosted
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "expiring", deadline: clk.Now().Add(time.Minute)}, 0))
+	clk.Advance(2 * time.Minute)
+	assert.Equal(t, 0, retry().priority)
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// maxShardChurnEventsPerTenant bounds the shard changes retained for a tenant whose shard changes more often
+// than the retention allows for; the oldest changes are dropped first.
+const maxShardChurnEventsPerTenant = 1024
+
+// shardChanged returns true if a tenant's querier set changed from previous to current.
+// A tenant going from all queriers to its first shard is a change.
+func shardChanged(previous, current map[QuerierID]struct{}) bool {
+	return (previous == nil) != (current == nil) || !sameQuerierSet(previous, current)
+}
+
+// recordShardChurn records a change of the tenant's shard, if shard churn is tracked.
+func (tqa *tenantQuerierAssignments) recordShardChurn(tenantID TenantID) {
+	if tqa.shardChurnRetention <= 0 {
+		return
+	}
+	if tqa.shardChurnEvents == nil {
+		tqa.shardChurnEvents = map[TenantID][]time.Time{}
+	}
+
+	now := tqa.now()
+	events := tqa.pruneShardChurn(tenantID, now)
+	if len(events) >= maxShardChurnEventsPerTenant {
+		events = events[1:]
+	}
+	tqa.shardChurnEvents[tenantID] = append(events, now)
+}
+
+// shardChurn returns the number of times the shard of each tenant changed within the window, omitting tenants
+// whose shard did not change. The window is capped at the shard churn retention; nil if shard churn is not tracked.
+// High churn indicates a tenant whose queriers keep changing, losing their cache locality.
+//
+// Tenants remain in the churn counts after they are removed, until their shard changes fall out of the retention.
+func (tqa *tenantQuerierAssignments) shardChurn(window time.Duration) map[TenantID]int {
+	if tqa.shardChurnRetention <= 0 {
+		return nil
+	}
+	now := tqa.now()
+	since := now.Add(-window)
+	churn := map[TenantID]int{}
+	for tenantID := range tqa.shardChurnEvents {
+		events := tqa.pruneShardChurn(tenantID, now)
+		count := 0
+		for i := len(events) - 1; i >= 0 && events[i].After(since); i-- {
+			count++
+		}
+		if count > 0 {
+			churn[tenantID] = count
+		}
+	}
+	return churn
+}
+
+// pruneShardChurn drops the tenant's shard changes older than the retention, and returns the ones left.
+func (tqa *tenantQuerierAssignments) pruneShardChurn(tenantID TenantID, now time.Time) []time.Time {
+	events := tqa.shardChurnEvents[tenantID]
+	cutoff := now.Add(-tqa.shardChurnRetention)
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	if i == len(events) {
+		delete(tqa.shardChurnEvents, tenantID)
+		return nil
+	}
+	events = events[i:]
+	tqa.shardChurnEvents[tenantID] = events
+	return events
+}
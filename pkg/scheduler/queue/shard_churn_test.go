@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ShardChurn(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	tqa := &qb.tenantQuerierAssignments
+	tqa.shardChurnRetention = 10 * time.Minute
+	for _, querierID := range []QuerierID{"querier-0", "querier-1", "querier-2", "querier-3"} {
+		qb.addQuerierConnection(querierID)
+	}
+
+	// the first shard of a sharded tenant is a change, while an unsharded tenant has none
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-a", req: "a"}, 2))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-b", req: "b"}, 0))
+	assert.Equal(t, map[TenantID]int{"tenant-a": 1}, tqa.shardChurn(10*time.Minute))
+
+	clk.Advance(time.Minute)
+	require.NoError(t, tqa.pinTenantShard("tenant-a", []QuerierID{"querier-0"}))
+	// recomputing the same shard is not a change
+	require.NoError(t, tqa.pinTenantShard("tenant-a", []QuerierID{"querier-0"}))
+	clk.Advance(time.Minute)
+	require.NoError(t, tqa.pinTenantShard("tenant-b", []QuerierID{"querier-1"}))
+	clk.Advance(time.Minute)
+	tqa.unpinTenantShard("tenant-a")
+
+	assert.Equal(t, map[TenantID]int{"tenant-a": 3, "tenant-b": 1}, tqa.shardChurn(10*time.Minute))
+	assert.Equal(t, map[TenantID]int{"tenant-a": 1, "tenant-b": 1}, tqa.shardChurn(90*time.Second))
+	assert.Equal(t, map[TenantID]int{}, tqa.shardChurn(0))
+
+	// removing a tenant is not a change
+	dequeueN(t, qb, "querier-1", 2)
+	require.Nil(t, tqa.tenantsByID["tenant-b"])
+	assert.Equal(t, map[TenantID]int{"tenant-a": 3, "tenant-b": 1}, tqa.shardChurn(10*time.Minute))
+
+	// changes older than the retention are dropped, even within the window
+	clk.Advance(8*time.Minute + 30*time.Second)
+	assert.Equal(t, map[TenantID]int{"tenant-a": 1, "tenant-b": 1}, tqa.shardChurn(time.Hour))
+	clk.Advance(10 * time.Minute)
+	assert.Equal(t, map[TenantID]int{}, tqa.shardChurn(time.Hour))
+	assert.Empty(t, tqa.shardChurnEvents)
+}
+
+func TestQueues_ShardChurn_Bounded(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	tqa := &qb.tenantQuerierAssignments
+	tqa.shardChurnRetention = time.Hour
+	qb.addQuerierConnection("querier-0")
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-a", req: "a"}, 0))
+
+	for i := 0; i < 2*maxShardChurnEventsPerTenant; i++ {
+		clk.Advance(time.Millisecond)
+		require.NoError(t, tqa.pinTenantShard("tenant-a", []QuerierID{[]QuerierID{"querier-0", "querier-1"}[i%2]}))
+	}
+	assert.Equal(t, map[TenantID]int{"tenant-a": maxShardChurnEventsPerTenant}, tqa.shardChurn(time.Hour))
+	assert.Len(t, tqa.shardChurnEvents["tenant-a"], maxShardChurnEventsPerTenant)
+}
+
+func TestQueues_ShardChurn_Disabled(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	qb.addQuerierConnection("querier-0")
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-a", req: "a"}, 1))
+	require.NoError(t, tqa.pinTenantShard("tenant-a", []QuerierID{"querier-0", "querier-1"}))
+
+	assert.Nil(t, tqa.shardChurn(time.Hour))
+	assert.Nil(t, tqa.shardChurnEvents)
+}
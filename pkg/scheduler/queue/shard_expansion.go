@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// Shard expansion temporarily widens the shard of a tenant whose backlog keeps growing while all the queriers
+// of its shard are busy, so that the tenant can catch up. The expansion is added to the max queriers the tenant
+// is enqueued with, and is reverted once the tenant's queue is empty.
+//
+// Shuffle sharding picks the queriers of a tenant's shard in an order determined by the tenant's seed,
+// so a wider shard keeps all the queriers of the narrower one: expanding and contracting a shard only adds
+// and removes queriers, without moving the tenant's requests off the queriers already serving it.
+
+// expandBackloggedShards samples the queue depth of the sharded tenants, expanding the shard of the tenants
+// whose depth rose over the shard expansion window while all the queriers of their shard were busy,
+// and contracting the expanded shards of the tenants whose queue is empty.
+// Returns the number of shards expanded or contracted. Requires inflight tracking to tell whether queriers are busy.
+func (qb *queueBroker) expandBackloggedShards(now time.Time) int {
+	if qb.shardExpansionWindow <= 0 {
+		return 0
+	}
+	tqa := &qb.tenantQuerierAssignments
+	step := qb.shardExpansionStep
+	if step <= 0 {
+		step = 1
+	}
+
+	changed := 0
+	for tenantID, tenant := range tqa.tenantsByID {
+		depth := 0
+		if node := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}); node != nil {
+			depth = node.ItemCount()
+		}
+
+		if depth == 0 {
+			tenant.backlogSampledAt = time.Time{}
+			if tenant.shardExpansion > 0 {
+				if tenant.maxQueriers > 0 {
+					tenant.maxQueriers -= tenant.shardExpansion
+					tqa.shuffleTenantQueriers(tenantID, nil)
+				}
+				tenant.shardExpansion = 0
+				changed++
+			}
+			continue
+		}
+
+		if tenant.backlogSampledAt.IsZero() {
+			tenant.backlogSampleDepth, tenant.backlogSampledAt = depth, now
+			continue
+		}
+		if now.Sub(tenant.backlogSampledAt) < qb.shardExpansionWindow {
+			continue
+		}
+		rising := depth > tenant.backlogSampleDepth
+		tenant.backlogSampleDepth, tenant.backlogSampledAt = depth, now
+		if !rising || tqa.tenantQuerierIDs[tenantID] == nil || !qb.tenantShardBusy(tenantID) {
+			// only sharded tenants can be given more queriers
+			continue
+		}
+
+		expanded := tenant.maxQueriers + step
+		if qb.shardExpansionMaxQueriers > 0 && expanded > qb.shardExpansionMaxQueriers {
+			expanded = qb.shardExpansionMaxQueriers
+		}
+		if expanded <= tenant.maxQueriers {
+			continue
+		}
+		tenant.shardExpansion += expanded - tenant.maxQueriers
+		tenant.maxQueriers = expanded
+		tqa.shuffleTenantQueriers(tenantID, nil)
+		changed++
+	}
+	return changed
+}
+
+// tenantShardBusy returns true if every connected querier of the tenant's shard has inflight requests.
+func (qb *queueBroker) tenantShardBusy(tenantID TenantID) bool {
+	if !qb.trackInflight {
+		return false
+	}
+	tqa := &qb.tenantQuerierAssignments
+	for querierID := range tqa.tenantQuerierIDs[tenantID] {
+		if querier := tqa.queriersByID[querierID]; querier != nil && querier.connections > 0 && qb.inflightPerQuerier[querierID] == 0 {
+			return false
+		}
+	}
+	return true
+}
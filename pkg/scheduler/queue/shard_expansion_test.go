@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ExpandBackloggedShards(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, 0)
+	qb.clock = clk
+	qb.trackInflight = true
+	qb.tenantRemovalPolicy = tenantRemovalLazy
+	qb.tenantRemovalGracePeriod = time.Hour
+	qb.shardExpansionWindow = time.Minute
+	qb.shardExpansionMaxQueriers = 4
+	tqa := &qb.tenantQuerierAssignments
+	for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4", "querier-5", "querier-6"} {
+		qb.addQuerierConnection(querierID)
+	}
+
+	enqueue := func(n int) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r"}, 2))
+		}
+	}
+	// keeps every querier of the tenant's shard busy with one of the tenant's requests
+	var inflight []*tenantRequest
+	occupyShard := func() {
+		for querierID := range tqa.tenantQuerierIDs["tenant-1"] {
+			if qb.inflightPerQuerier[querierID] == 0 {
+				inflight = append(inflight, dequeueN(t, qb, querierID, 1)...)
+			}
+		}
+	}
+
+	enqueue(10)
+	occupyShard()
+	initialShard := tqa.tenantQuerierIDs["tenant-1"]
+	require.Len(t, initialShard, 2)
+	assert.Zero(t, qb.expandBackloggedShards(clk.Now()))
+
+	// the backlog rose over the window while the shard was busy: the shard gains a querier, keeping the others
+	clk.Advance(time.Minute)
+	enqueue(5)
+	assert.Equal(t, 1, qb.expandBackloggedShards(clk.Now()))
+	expandedShard := tqa.tenantQuerierIDs["tenant-1"]
+	require.Len(t, expandedShard, 3)
+	for querierID := range initialShard {
+		assert.Contains(t, expandedShard, querierID)
+	}
+
+	// the expansion is kept by enqueues with the tenant's max queriers
+	enqueue(5)
+	assert.Equal(t, expandedShard, tqa.tenantQuerierIDs["tenant-1"])
+
+	// no expansion while a querier of the shard is idle
+	clk.Advance(time.Minute)
+	enqueue(5)
+	assert.Zero(t, qb.expandBackloggedShards(clk.Now()))
+
+	// the shard expands up to the ceiling
+	occupyShard()
+	for i := 0; i < 3; i++ {
+		clk.Advance(time.Minute)
+		enqueue(5)
+		occupyShard()
+		qb.expandBackloggedShards(clk.Now())
+	}
+	assert.Len(t, tqa.tenantQuerierIDs["tenant-1"], 4)
+	assert.NoError(t, isConsistent(qb))
+
+	// the expansion is reverted once the backlog clears
+	for !qb.isEmpty() {
+		for querierID := range tqa.tenantQuerierIDs["tenant-1"] {
+			req, _, _, err := qb.dequeueRequestForQuerier(-1, querierID)
+			require.NoError(t, err)
+			if req != nil {
+				qb.completeRequest(req)
+			}
+		}
+	}
+	assert.Equal(t, 1, qb.expandBackloggedShards(clk.Now()))
+	assert.Equal(t, initialShard, tqa.tenantQuerierIDs["tenant-1"])
+	enqueue(1)
+	assert.Equal(t, initialShard, tqa.tenantQuerierIDs["tenant-1"])
+	assert.NoError(t, isConsistent(qb))
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"strconv"
+
+	"github.com/grafana/mimir/pkg/util"
+)
+
+type tenantShardFailures struct {
+	// requests re-enqueued after failed dispatch since the tenant shard was last randomized
+	failures int
+	// number of times the tenant shard has been re-randomized due to dispatch failures
+	perturbation int
+}
+
+// shuffleShardSeed computes the tenant's shuffle shard seed from the tenant ID
+// and the number of times the tenant shard has been re-randomized, if any.
+func (tqa *tenantQuerierAssignments) shuffleShardSeed(tenantID TenantID) int64 {
+	if sf := tqa.tenantShardFailures[tenantID]; sf != nil && sf.perturbation > 0 {
+		return util.ShuffleShardSeed(string(tenantID), strconv.Itoa(sf.perturbation))
+	}
+	return util.ShuffleShardSeed(string(tenantID), "")
+}
+
+// recordDispatchFailure counts a request re-enqueued for the tenant after a failed dispatch to a querier.
+//
+// Once the configured threshold of failures is reached, the tenant's shard is re-randomized
+// onto a fresh set of queriers, in case the current shard's queriers are unhealthy for this tenant.
+// The new shuffle shard seed is derived from the tenant ID and the number of re-randomizations only,
+// so that it remains consistent between frontends observing the same failures.
+func (qb *queueBroker) recordDispatchFailure(tenantID TenantID) {
+	if qb.shardRerandomizeThreshold <= 0 {
+		return
+	}
+
+	tqa := &qb.tenantQuerierAssignments
+	sf := tqa.tenantShardFailures[tenantID]
+	if sf == nil {
+		sf = &tenantShardFailures{}
+		tqa.tenantShardFailures[tenantID] = sf
+	}
+
+	sf.failures++
+	if sf.failures < qb.shardRerandomizeThreshold {
+		return
+	}
+
+	sf.failures = 0
+	sf.perturbation++
+	if tenant := tqa.tenantsByID[tenantID]; tenant != nil {
+		tenant.shuffleShardSeed = tqa.shuffleShardSeed(tenantID)
+		tqa.shuffleTenantQueriers(tenantID, nil)
+	}
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ShardRerandomizeOnDispatchFailures(t *testing.T) {
+	const (
+		threshold   = 3
+		maxQueriers = 2
+	)
+
+	newBroker := func(threshold int) *queueBroker {
+		qb := newQueueBroker(100, 0)
+		qb.shardRerandomizeThreshold = threshold
+		for i := 0; i < 10; i++ {
+			qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+		}
+		return qb
+	}
+
+	// failDispatch dequeues a request for the tenant and re-enqueues it as a failed dispatch
+	failDispatch := func(t *testing.T, qb *queueBroker) {
+		querierID := getTenantsQueriers(qb, "tenant-1")[0]
+		req, _, _, err := qb.dequeueRequestForQuerier(-1, querierID)
+		require.NoError(t, err)
+		require.NotNil(t, req)
+		require.NoError(t, qb.enqueueRequestFront(req, maxQueriers))
+	}
+
+	qb := newBroker(threshold)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, maxQueriers))
+	originalShard := getTenantsQueriers(qb, "tenant-1")
+	require.Len(t, originalShard, maxQueriers)
+
+	// shard is kept until the threshold is reached
+	for i := 0; i < threshold-1; i++ {
+		failDispatch(t, qb)
+		assert.Equal(t, originalShard, getTenantsQueriers(qb, "tenant-1"))
+	}
+
+	failDispatch(t, qb)
+	rerandomizedShard := getTenantsQueriers(qb, "tenant-1")
+	assert.Len(t, rerandomizedShard, maxQueriers)
+	assert.NotEqual(t, originalShard, rerandomizedShard)
+	assert.NoError(t, isConsistent(qb))
+
+	// re-randomization is deterministic given the same failures, so another broker agrees
+	other := newBroker(threshold)
+	require.NoError(t, other.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, maxQueriers))
+	for i := 0; i < threshold; i++ {
+		failDispatch(t, other)
+	}
+	assert.Equal(t, rerandomizedShard, getTenantsQueriers(other, "tenant-1"))
+
+	// the re-randomized shard is kept across reshuffles
+	qb.addQuerierConnection("querier-new")
+	qb.tenantQuerierAssignments.removeQuerier("querier-new")
+	assert.Equal(t, rerandomizedShard, getTenantsQueriers(qb, "tenant-1"))
+
+	// disabled by default
+	disabled := newBroker(0)
+	require.NoError(t, disabled.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "request"}, maxQueriers))
+	for i := 0; i < 2*threshold; i++ {
+		failDispatch(t, disabled)
+	}
+	assert.Equal(t, originalShard, getTenantsQueriers(disabled, "tenant-1"))
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// admitShardedTenant returns true if the tenant may be sharded under the cap on the number of sharded tenants.
+//
+// When the cap is reached, the tenant takes the place of the sharded tenant which ranks lowest,
+// if the tenant ranks higher; the displaced tenant is left unsharded and can use all queriers.
+// Tenants rank by descending selection weight, then by ascending tenant ID, so that the tenants left
+// unsharded do not depend on the order in which tenants are sharded: they are the lowest ranked of the tenants
+// considered for sharding, until a tenant is removed or its shard is computed again.
+func (tqa *tenantQuerierAssignments) admitShardedTenant(tenantID TenantID) bool {
+	if tqa.maxShardedTenants <= 0 || tqa.tenantQuerierIDs[tenantID] != nil || tqa.shardedTenantCount < tqa.maxShardedTenants {
+		return true
+	}
+
+	lowest := emptyTenantID
+	for shardedTenantID := range tqa.tenantQuerierIDs {
+		if lowest == emptyTenantID || tqa.shardRanksHigher(lowest, shardedTenantID) {
+			lowest = shardedTenantID
+		}
+	}
+	if !tqa.shardRanksHigher(tenantID, lowest) {
+		return false
+	}
+	tqa.setTenantQuerierIDs(lowest, nil)
+	return true
+}
+
+// shardRanksHigher returns true if tenant a ranks higher than tenant b to be sharded under the sharded tenant cap.
+func (tqa *tenantQuerierAssignments) shardRanksHigher(a, b TenantID) bool {
+	if weightA, weightB := tqa.tenantSelectionWeight(a), tqa.tenantSelectionWeight(b); weightA != weightB {
+		return weightA > weightB
+	}
+	return a < b
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_MaxShardedTenants(t *testing.T) {
+	tenantIDs := []TenantID{"tenant-a", "tenant-b", "tenant-c", "tenant-d", "tenant-e"}
+	weights := map[TenantID]int{"tenant-a": 1, "tenant-b": 5, "tenant-c": 1, "tenant-d": 3, "tenant-e": 0}
+
+	// the two lowest weights are left unsharded; of tenant-a, tenant-c and tenant-e, which all weigh 1,
+	// tenant-a ranks highest by tenant ID
+	expectedSharded := []TenantID{"tenant-a", "tenant-b", "tenant-d"}
+
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 5; i++ {
+		t.Run(fmt.Sprintf("enqueue order %d", i), func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			tqa := &qb.tenantQuerierAssignments
+			tqa.maxShardedTenants = 3
+			for q := 0; q < 6; q++ {
+				qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", q)))
+			}
+			for tenantID, weight := range weights {
+				require.NoError(t, tqa.setTenantConfig(tenantID, TenantConfig{Weight: weight}))
+			}
+
+			order := append([]TenantID(nil), tenantIDs...)
+			rnd.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+			for _, tenantID := range order {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "req"}, 2))
+			}
+
+			var sharded []TenantID
+			for _, tenantID := range tenantIDs {
+				if tqa.tenantQuerierIDs[tenantID] != nil {
+					sharded = append(sharded, tenantID)
+				}
+			}
+			assert.Equal(t, expectedSharded, sharded, "enqueue order: %v", order)
+			assert.Equal(t, 3, tqa.shardedTenantCount)
+			assert.NoError(t, isConsistent(qb))
+
+			// recomputing all shards keeps the same tenants sharded
+			tqa.recomputeTenantQueriers()
+			assert.Equal(t, 3, tqa.shardedTenantCount)
+			for _, tenantID := range expectedSharded {
+				assert.NotNil(t, tqa.tenantQuerierIDs[tenantID], tenantID)
+			}
+		})
+	}
+}
+
+func TestQueues_MaxShardedTenants_Uncapped(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	for q := 0; q < 6; q++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", q)))
+	}
+	for i := 0; i < 10; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", i)), req: "req"}, 2))
+	}
+	assert.Equal(t, 10, qb.tenantQuerierAssignments.shardedTenantCount)
+}
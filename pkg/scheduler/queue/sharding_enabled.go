@@ -0,0 +1,17 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// setShardingEnabled enables or disables shuffle sharding globally. While disabled, all tenants can use all queriers,
+// regardless of their max queriers. Tenants keep their max queriers and shuffle shard seeds,
+// so re-enabling sharding restores the shards the tenants had before it was disabled.
+func (qb *queueBroker) setShardingEnabled(enabled bool) {
+	tqa := &qb.tenantQuerierAssignments
+	if tqa.shardingDisabled == !enabled {
+		return
+	}
+	defer qb.detectReshuffleStorm(tqa.tenantShuffles)
+
+	tqa.shardingDisabled = !enabled
+	tqa.recomputeTenantQueriers()
+}
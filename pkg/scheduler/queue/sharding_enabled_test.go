@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_SetShardingEnabled(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	for i := 0; i < 5; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: TenantID(fmt.Sprintf("tenant-%d", i)), req: "request"}, 2))
+	}
+
+	shards := map[TenantID][]QuerierID{}
+	for tenantID := range tqa.tenantsByID {
+		shards[tenantID] = getTenantsQueriers(qb, tenantID)
+		require.Len(t, shards[tenantID], 2)
+	}
+
+	var unsharded []TenantID
+	qb.observer.OnTenantUnsharded = func(tenantID TenantID) {
+		unsharded = append(unsharded, tenantID)
+	}
+
+	qb.setShardingEnabled(false)
+	for tenantID := range tqa.tenantsByID {
+		assert.Len(t, getTenantsQueriers(qb, tenantID), 5, "all queriers can serve %s", tenantID)
+		assert.Equal(t, 2, tqa.tenantsByID[tenantID].maxQueriers)
+	}
+	assert.False(t, tqa.anyTenantSharded())
+	assert.Empty(t, unsharded, "disabling sharding is not a fleet contraction")
+	assert.NoError(t, isConsistent(qb))
+
+	// tenants created or updated while sharding is disabled are not sharded either
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-new", req: "request"}, 2))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "request"}, 3))
+	assert.Len(t, getTenantsQueriers(qb, "tenant-new"), 5)
+	assert.Len(t, getTenantsQueriers(qb, "tenant-0"), 5)
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "request"}, 2))
+
+	// re-enabling restores the prior shards
+	qb.setShardingEnabled(true)
+	for tenantID, shard := range shards {
+		assert.Equal(t, shard, getTenantsQueriers(qb, tenantID))
+	}
+	assert.Len(t, getTenantsQueriers(qb, "tenant-new"), 2)
+	assert.NoError(t, isConsistent(qb))
+}
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-kit/log/level"
+	"github.com/pkg/errors"
+)
+
+// A queue snapshot lets a scheduler restore the requests it had queued once it restarts, so that a rolling restart
+// does not fail all of the queries waiting in the queue. On top of the broker's scheduling state, the snapshot holds
+// the tenants with queued requests in tenant order, each with its max queriers, weight, and queued requests in
+// dequeue order, serialized by a RequestCodec.
+//
+// The tenant-querier assignments are not part of the snapshot: they are derived from the tenants' max queriers and
+// the connected queriers, and are recomputed as the queriers reconnect to the restarted scheduler.
+
+// RequestCodec serializes queued requests into queue snapshots, and deserializes them when a snapshot is restored.
+type RequestCodec interface {
+	EncodeRequest(req Request) ([]byte, error)
+	DecodeRequest(data []byte) (Request, error)
+}
+
+// RestoreOptions configures how RestoreSnapshot restores the requests of a queue snapshot.
+type RestoreOptions struct {
+	// TenantLimits returns the current max queriers and weight of a tenant. The restored requests of the tenant are
+	// enqueued with them rather than with the ones saved in the snapshot, which may have changed since.
+	// The requests of a tenant it fails for are dropped. Nil restores the saved ones.
+	TenantLimits func(tenantID string) (maxQueriers, weight int, err error)
+
+	// OnRestored is called with each restored request before it may be dispatched to a querier. Optional.
+	OnRestored func(req Request)
+}
+
+// tenantState is a tenant with queued requests in a queue snapshot.
+type tenantState struct {
+	TenantID    TenantID `json:"tenant_id"`
+	MaxQueriers int      `json:"max_queriers,omitempty"`
+	Weight      int      `json:"weight,omitempty"`
+
+	// queued requests in dequeue order, serialized by the RequestCodec
+	Requests [][]byte `json:"requests,omitempty"`
+}
+
+// exportSnapshot serializes the broker's scheduling state together with its queued requests.
+func (qb *queueBroker) exportSnapshot(codec RequestCodec) ([]byte, error) {
+	tqa := &qb.tenantQuerierAssignments
+	state := brokerState{FairnessCounters: qb.exportFairnessCounters()}
+
+	for _, tenantID := range tqa.tenantIDOrder {
+		if tenantID == emptyTenantID {
+			continue
+		}
+		tenant := tqa.tenantsByID[tenantID]
+		ts := tenantState{
+			TenantID:    tenantID,
+			MaxQueriers: tenant.maxQueriers,
+			Weight:      tqa.tenantSelectionWeight(tenantID),
+		}
+		if ts.MaxQueriers > 0 {
+			// the shard expansion is re-learned by the restored broker
+			ts.MaxQueriers -= tenant.shardExpansion
+		}
+
+		var err error
+		qb.visitTenantRequests(tenantID, func(req *tenantRequest) bool {
+			var data []byte
+			if data, err = codec.EncodeRequest(req.req); err != nil {
+				return false
+			}
+			ts.Requests = append(ts.Requests, data)
+			return true
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode queued request of tenant %s", tenantID)
+		}
+		if len(ts.Requests) > 0 {
+			state.Tenants = append(state.Tenants, ts)
+		}
+	}
+	return json.Marshal(state)
+}
+
+// restoreSnapshot imports the scheduling state of a snapshot exported by exportSnapshot, and enqueues its requests
+// after the requests already queued. A request which fails to be decoded or enqueued is dropped.
+// Returns the number of restored requests.
+func (q *RequestQueue) restoreSnapshot(broker *queueBroker, data []byte, codec RequestCodec, opts RestoreOptions) (int, error) {
+	var state brokerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0, errors.Wrap(err, "failed to decode queue snapshot")
+	}
+	broker.importFairnessCounters(state.FairnessCounters)
+
+	restored, dropped := 0, 0
+	for _, ts := range state.Tenants {
+		maxQueriers, weight := ts.MaxQueriers, ts.Weight
+		if opts.TenantLimits != nil {
+			var err error
+			if maxQueriers, weight, err = opts.TenantLimits(string(ts.TenantID)); err != nil {
+				level.Warn(q.log).Log("msg", "dropping queued requests of tenant whose limits failed to be read", "tenant", ts.TenantID, "err", err)
+				dropped += len(ts.Requests)
+				continue
+			}
+		}
+
+		for _, data := range ts.Requests {
+			req, err := codec.DecodeRequest(data)
+			if err != nil {
+				level.Warn(q.log).Log("msg", "dropping queued request which failed to be decoded from the queue snapshot", "tenant", ts.TenantID, "err", err)
+				dropped++
+				continue
+			}
+
+			var onSuccess func()
+			if opts.OnRestored != nil {
+				onSuccess = func() { opts.OnRestored(req) }
+			}
+			err = q.enqueueRequestToBroker(broker, requestToEnqueue{
+				tenantID:    ts.TenantID,
+				req:         req,
+				maxQueriers: maxQueriers,
+				weight:      weight,
+				successFn:   onSuccess,
+			})
+			if err != nil {
+				dropped++
+				continue
+			}
+			restored++
+		}
+	}
+	if dropped > 0 {
+		level.Warn(q.log).Log("msg", "dropped queued requests which could not be restored from the queue snapshot", "dropped", dropped, "restored", restored)
+	}
+	return restored, nil
+}
+
+// Snapshot returns a snapshot of the queued requests and of the scheduling state of the queue, serializing the
+// requests with codec. The snapshot can be restored with RestoreSnapshot, e.g. once the scheduler restarted.
+func (q *RequestQueue) Snapshot(ctx context.Context, codec RequestCodec) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if runErr := q.runInDispatcher(ctx, func(qb *queueBroker) {
+		data, err = qb.exportSnapshot(codec)
+	}); runErr != nil {
+		return nil, runErr
+	}
+	return data, err
+}
+
+// RestoreSnapshot enqueues the requests of a snapshot returned by Snapshot, deserializing them with codec,
+// as configured by opts. Requests which cannot be decoded or enqueued, e.g. because the tenant's queue is full,
+// are dropped. Returns the number of restored requests.
+func (q *RequestQueue) RestoreSnapshot(ctx context.Context, data []byte, codec RequestCodec, opts RestoreOptions) (int, error) {
+	var (
+		restored int
+		err      error
+	)
+	if runErr := q.runInDispatcher(ctx, func(qb *queueBroker) {
+		restored, err = q.restoreSnapshot(qb, data, codec, opts)
+	}); runErr != nil {
+		return 0, runErr
+	}
+	return restored, err
+}
+
+// SnapshotOnStop makes the queue write a snapshot of the requests left in it with write once it stops,
+// superseding the snapshots returned by Snapshot before. The snapshot holds no request unless the queue stopped
+// with no querier connected to drain it. Must be called before the queue is started.
+func (q *RequestQueue) SnapshotOnStop(codec RequestCodec, write func([]byte) error) {
+	q.stopSnapshotCodec = codec
+	q.stopSnapshotWrite = write
+}
+
+func (q *RequestQueue) writeStopSnapshot(broker *queueBroker) {
+	if q.stopSnapshotWrite == nil {
+		return
+	}
+	data, err := broker.exportSnapshot(q.stopSnapshotCodec)
+	if err == nil {
+		err = q.stopSnapshotWrite(data)
+	}
+	if err != nil {
+		level.Warn(q.log).Log("msg", "failed to write the queue snapshot on stop", "err", err)
+	}
+}
+
+// runInDispatcher runs fn with the broker in dispatcherLoop(), and waits for it to complete.
+func (q *RequestQueue) runInDispatcher(ctx context.Context, fn func(*queueBroker)) error {
+	done := make(chan struct{})
+	inspect := func(qb *queueBroker) {
+		fn(qb)
+		close(done)
+	}
+
+	select {
+	case q.brokerInspections <- inspect:
+		<-done
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-q.stopCompleted:
+		return ErrStopped
+	}
+}
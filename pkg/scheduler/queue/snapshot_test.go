@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stringCodec serializes string requests; the request "corrupt" fails to be decoded.
+type stringCodec struct{}
+
+func (stringCodec) EncodeRequest(req Request) ([]byte, error) {
+	s, ok := req.(string)
+	if !ok {
+		return nil, errors.Errorf("unexpected request %v", req)
+	}
+	return []byte(s), nil
+}
+
+func (stringCodec) DecodeRequest(data []byte) (Request, error) {
+	if string(data) == "corrupt" {
+		return nil, errors.New("corrupt request")
+	}
+	return string(data), nil
+}
+
+func newSnapshotTestQueue(queueLength *prometheus.GaugeVec) *RequestQueue {
+	return NewRequestQueue(log.NewNopLogger(), 100, 0,
+		queueLength,
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{})
+}
+
+func TestQueues_ExportSnapshot(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	require.NoError(t, qb.setTenantWeight("tenant-2", 3))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "req-2"}, 2))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-3"}, 0))
+
+	data, err := qb.exportSnapshot(stringCodec{})
+	require.NoError(t, err)
+
+	var state brokerState
+	require.NoError(t, json.Unmarshal(data, &state))
+	assert.NotNil(t, state.FairnessCounters)
+	assert.Equal(t, []tenantState{
+		{TenantID: "tenant-1", Weight: 1, Requests: [][]byte{[]byte("req-1"), []byte("req-3")}},
+		{TenantID: "tenant-2", MaxQueriers: 2, Weight: 3, Requests: [][]byte{[]byte("req-2")}},
+	}, state.Tenants)
+
+	// a request which cannot be serialized fails the snapshot
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: 42}, 0))
+	_, err = qb.exportSnapshot(stringCodec{})
+	assert.Error(t, err)
+}
+
+func TestRequestQueue_SnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+
+	queue := newSnapshotTestQueue(promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}))
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	for _, r := range []struct{ tenantID, req string }{
+		{"user-1", "req-1"}, {"user-1", "req-2"}, {"user-2", "req-3"}, {"user-2", "corrupt"},
+	} {
+		require.NoError(t, queue.EnqueueRequestToDispatcher(r.tenantID, r.req, 0, 1, nil))
+	}
+	data, err := queue.Snapshot(ctx, stringCodec{})
+	require.NoError(t, err)
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+
+	// restart
+	queueLength := promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"})
+	restored := newSnapshotTestQueue(queueLength)
+	require.NoError(t, services.StartAndAwaitRunning(ctx, restored))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, restored))
+	})
+
+	var restoredRequests []Request
+	count, err := restored.RestoreSnapshot(ctx, data, stringCodec{}, RestoreOptions{
+		OnRestored: func(req Request) {
+			restoredRequests = append(restoredRequests, req)
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, count, "the request which fails to be decoded is dropped")
+	assert.Equal(t, []Request{"req-1", "req-2", "req-3"}, restoredRequests)
+	assert.Equal(t, 2.0, testutil.ToFloat64(queueLength.WithLabelValues("user-1")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(queueLength.WithLabelValues("user-2")))
+
+	// the restored requests are dispatched in the tenant order of the snapshot
+	restored.RegisterQuerierConnection("querier-1")
+	t.Cleanup(func() {
+		restored.UnregisterQuerierConnection("querier-1")
+	})
+	last := FirstUser()
+	var dispatched []Request
+	for i := 0; i < 3; i++ {
+		var req Request
+		req, last, err = restored.GetNextRequestForQuerier(ctx, last, "querier-1", "")
+		require.NoError(t, err)
+		dispatched = append(dispatched, req)
+	}
+	assert.Equal(t, []Request{"req-1", "req-3", "req-2"}, dispatched)
+
+	_, err = restored.RestoreSnapshot(ctx, []byte("not json"), stringCodec{}, RestoreOptions{})
+	assert.Error(t, err)
+}
+
+func TestRequestQueue_SnapshotOnStop(t *testing.T) {
+	ctx := context.Background()
+
+	queue := newSnapshotTestQueue(promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}))
+	var written []byte
+	queue.SnapshotOnStop(stringCodec{}, func(data []byte) error {
+		written = data
+		return nil
+	})
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", "req-1", 0, 1, nil))
+
+	// with no querier connected, the queue stops without being drained
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+	require.NotNil(t, written)
+
+	_, err := queue.Snapshot(ctx, stringCodec{})
+	assert.ErrorIs(t, err, ErrStopped)
+
+	restored := newSnapshotTestQueue(promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}))
+	require.NoError(t, services.StartAndAwaitRunning(ctx, restored))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, restored))
+	})
+	count, err := restored.RestoreSnapshot(ctx, written, stringCodec{}, RestoreOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestRequestQueue_SnapshotRestore_CurrentTenantLimits(t *testing.T) {
+	ctx := context.Background()
+
+	queue := newSnapshotTestQueue(promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}))
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", "req-1", 2, 3, nil))
+	require.NoError(t, queue.EnqueueRequestToDispatcher("user-2", "req-2", 2, 3, nil))
+	data, err := queue.Snapshot(ctx, stringCodec{})
+	require.NoError(t, err)
+	require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+
+	restored := newSnapshotTestQueue(promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}))
+	require.NoError(t, services.StartAndAwaitRunning(ctx, restored))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, restored))
+	})
+
+	count, err := restored.RestoreSnapshot(ctx, data, stringCodec{}, RestoreOptions{
+		TenantLimits: func(tenantID string) (int, int, error) {
+			if tenantID == "user-2" {
+				return 0, 0, errors.New("invalid tenant")
+			}
+			return 1, 5, nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "the requests of the tenant whose limits failed to be read are dropped")
+
+	var tenants []tenantState
+	require.NoError(t, restored.runInDispatcher(ctx, func(qb *queueBroker) {
+		data, err := qb.exportSnapshot(stringCodec{})
+		require.NoError(t, err)
+		var state brokerState
+		require.NoError(t, json.Unmarshal(data, &state))
+		tenants = state.Tenants
+	}))
+	assert.Equal(t, []tenantState{{TenantID: "user-1", MaxQueriers: 1, Weight: 5, Requests: [][]byte{[]byte("req-1")}}}, tenants)
+}
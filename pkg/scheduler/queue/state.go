@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// brokerState is the scheduling bookkeeping of a queueBroker which can be persisted across scheduler restarts.
+// Queued requests are only part of the state exported as a queue snapshot, see RequestQueue.Snapshot().
+// All fields are optional, so that state exported by an older scheduler, which lacks some of them, can still be imported.
+type brokerState struct {
+	FairnessCounters *fairnessCountersState `json:"fairness_counters,omitempty"`
+	Tenants          []tenantState          `json:"tenants,omitempty"`
+}
+
+// fairnessCountersState holds the counters used to keep serving tenants fairly,
+// which would otherwise be re-learned after a restart.
+type fairnessCountersState struct {
+	// recent per-tenant service; only imported into a broker configured with the same bucket width and count
+	RecentDequeuesBucketWidth time.Duration           `json:"recent_dequeues_bucket_width,omitempty"`
+	RecentDequeues            []fairnessCounterBucket `json:"recent_dequeues,omitempty"`
+
+	TierContendedDequeues uint64 `json:"tier_contended_dequeues,omitempty"`
+	TierLowerTierDequeues uint64 `json:"tier_lower_tier_dequeues,omitempty"`
+}
+
+type fairnessCounterBucket struct {
+	Epoch  int64            `json:"epoch"`
+	Counts map[TenantID]int `json:"counts,omitempty"`
+}
+
+// exportState serializes the broker's persistable scheduling state.
+func (qb *queueBroker) exportState() ([]byte, error) {
+	return json.Marshal(brokerState{FairnessCounters: qb.exportFairnessCounters()})
+}
+
+func (qb *queueBroker) exportFairnessCounters() *fairnessCountersState {
+	fairness := &fairnessCountersState{
+		TierContendedDequeues: qb.tierContendedDequeues,
+		TierLowerTierDequeues: qb.tierLowerTierDequeues,
+	}
+	if qb.recentDequeues != nil {
+		fairness.RecentDequeuesBucketWidth = qb.recentDequeues.bucketWidth
+		for _, bucket := range qb.recentDequeues.buckets {
+			fairness.RecentDequeues = append(fairness.RecentDequeues, fairnessCounterBucket{Epoch: bucket.epoch, Counts: bucket.counts})
+		}
+	}
+	return fairness
+}
+
+// importState restores scheduling state previously serialized by exportState.
+// Counters missing from the state keep their current values.
+func (qb *queueBroker) importState(data []byte) error {
+	var state brokerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return errors.Wrap(err, "failed to decode queue broker state")
+	}
+	qb.importFairnessCounters(state.FairnessCounters)
+	return nil
+}
+
+func (qb *queueBroker) importFairnessCounters(fairness *fairnessCountersState) {
+	if fairness == nil {
+		return
+	}
+	qb.tierContendedDequeues = fairness.TierContendedDequeues
+	qb.tierLowerTierDequeues = fairness.TierLowerTierDequeues
+	if qb.recentDequeues != nil &&
+		fairness.RecentDequeuesBucketWidth == qb.recentDequeues.bucketWidth &&
+		len(fairness.RecentDequeues) == len(qb.recentDequeues.buckets) {
+		for i, bucket := range fairness.RecentDequeues {
+			qb.recentDequeues.buckets[i] = tenantCounterBucket{epoch: bucket.Epoch, counts: bucket.Counts}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ExportImportState_FairnessCounters(t *testing.T) {
+	clk := newManualClock()
+	newBroker := func() *queueBroker {
+		qb := newQueueBroker(100, 0)
+		qb.clock = clk
+		qb.recentDequeues = newWindowedTenantCounter(time.Minute, 6)
+		qb.tenantSelection = tenantSelectionTiered
+		qb.tierReservedFraction = 0.5
+		qb.addQuerierConnection("querier-1")
+		return qb
+	}
+
+	qb := newBroker()
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-low", TenantConfig{Tier: 1}))
+	for i := 0; i < 10; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-high", req: i}, 0))
+	}
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-low", req: "low"}, 0))
+	dequeueN(t, qb, "querier-1", 6)
+
+	expectedFairness := qb.fairnessIndex()
+	require.Less(t, expectedFairness, 1.0)
+
+	data, err := qb.exportState()
+	require.NoError(t, err)
+
+	// restart
+	restored := newBroker()
+	require.NoError(t, restored.importState(data))
+	assert.Equal(t, qb.recentDequeues.counts(clk.Now()), restored.recentDequeues.counts(clk.Now()))
+	assert.Equal(t, qb.tierContendedDequeues, restored.tierContendedDequeues)
+	assert.Equal(t, qb.tierLowerTierDequeues, restored.tierLowerTierDequeues)
+
+	// restored service counters still age out of the window
+	clk.Advance(2 * time.Minute)
+	assert.Empty(t, restored.recentDequeues.counts(clk.Now()))
+}
+
+func TestQueues_ImportState_BackwardCompatibility(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.recentDequeues = newWindowedTenantCounter(time.Minute, 6)
+	qb.tierContendedDequeues = 3
+
+	// state exported before fairness counters were persisted
+	require.NoError(t, qb.importState([]byte(`{}`)))
+	assert.Equal(t, uint64(3), qb.tierContendedDequeues)
+	assert.Empty(t, qb.recentDequeues.counts(time.Now()))
+
+	// state exported by a broker with a different service window is not imported
+	other := newQueueBroker(100, 0)
+	other.recentDequeues = newWindowedTenantCounter(time.Hour, 6)
+	other.recentDequeues.add("tenant-1", 1, time.Now())
+	data, err := other.exportState()
+	require.NoError(t, err)
+	require.NoError(t, qb.importState(data))
+	assert.Empty(t, qb.recentDequeues.counts(time.Now()))
+
+	assert.Error(t, qb.importState([]byte(`not json`)))
+}
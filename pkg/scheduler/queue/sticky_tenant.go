@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// Under round-robin tenant selection, the broker can stick with the tenant it last dequeued a request from,
+// for up to tenantStickiness consecutive dequeues or until the tenant queue empties, before moving on to the next tenant.
+// This trades fairness for fewer tenants with a partially drained backlog at any time.
+// A tenant configured with a DequeueBurst is stuck with for up to its burst instead.
+//
+// The broker only sticks with a tenant while it can be dispatched to the querier, so a burst yields to the inflight cap,
+// MinRequestAge and querier overload checks, and other tenants wait for at most the burst before the rotation advances.
+
+// stickyTenantForQuerier returns the tenant the broker is sticking with, if the querier can be served a request from it.
+func (qb *queueBroker) stickyTenantForQuerier(querierID QuerierID) *queueTenant {
+	if qb.stickyTenantDequeues >= qb.tenantDequeueBurst(qb.stickyTenantID) {
+		return nil
+	}
+
+	tqa := &qb.tenantQuerierAssignments
+	if q := tqa.queriersByID[querierID]; q == nil || q.shuttingDown || q.overflow {
+		// let the tenant selection report the querier is shutting down, or select a backlogged tenant
+		return nil
+	}
+	tenant := tqa.tenantsByID[qb.stickyTenantID]
+	if tenant == nil || qb.tenantQueuesTree.getNode(QueuePath{string(tenant.tenantID)}) == nil {
+		return nil
+	}
+	if tenantQuerierSet := tqa.tenantQuerierIDs[tenant.tenantID]; tenantQuerierSet != nil {
+		if _, ok := tenantQuerierSet[querierID]; !ok {
+			return nil
+		}
+	}
+	if !qb.tenantDispatchableToQuerier(tenant.tenantID, querierID) {
+		return nil
+	}
+	return tenant
+}
+
+// tenantDequeueBurst returns the maximum number of consecutive requests dequeued from the tenant
+// under round-robin tenant selection: its configured DequeueBurst, or else the tenant stickiness of the broker.
+func (qb *queueBroker) tenantDequeueBurst(tenantID TenantID) int {
+	if cfg, ok := qb.tenantQuerierAssignments.tenantConfigs[tenantID]; ok && cfg.DequeueBurst > 0 {
+		return cfg.DequeueBurst
+	}
+	return qb.tenantStickiness
+}
+
+// recordStickyTenantDequeue counts a request dequeued from the tenant towards the tenant stickiness.
+func (qb *queueBroker) recordStickyTenantDequeue(tenantID TenantID) {
+	if tenantID != qb.stickyTenantID {
+		qb.stickyTenantID = tenantID
+		qb.stickyTenantDequeues = 0
+	}
+	qb.stickyTenantDequeues++
+}
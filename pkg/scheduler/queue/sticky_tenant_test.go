@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_TenantStickiness(t *testing.T) {
+	for testName, testData := range map[string]struct {
+		stickiness int
+		expected   []TenantID
+	}{
+		"round-robin by default": {
+			stickiness: 0,
+			// each querier round-robins the tenants on its own
+			expected: []TenantID{
+				"tenant-1", "tenant-1", "tenant-2", "tenant-2", "tenant-3", "tenant-3",
+				"tenant-1", "tenant-1", "tenant-2", "tenant-3", "tenant-3", "tenant-1",
+			},
+		},
+		"tenant drained up to the stickiness cap before moving on": {
+			stickiness: 3,
+			expected: []TenantID{
+				"tenant-1", "tenant-1", "tenant-1", "tenant-2", "tenant-2", "tenant-2",
+				"tenant-3", "tenant-3", "tenant-3", "tenant-1", "tenant-1", "tenant-3",
+			},
+		},
+		"tenant drained until its queue empties": {
+			stickiness: 10,
+			expected: []TenantID{
+				"tenant-1", "tenant-1", "tenant-1", "tenant-1", "tenant-1", "tenant-2",
+				"tenant-2", "tenant-2", "tenant-3", "tenant-3", "tenant-3", "tenant-3",
+			},
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.tenantStickiness = testData.stickiness
+			qb.addQuerierConnection("querier-1")
+			qb.addQuerierConnection("querier-2")
+
+			for tenantID, numRequests := range map[TenantID]int{"tenant-1": 5, "tenant-2": 3, "tenant-3": 4} {
+				for i := 0; i < numRequests; i++ {
+					require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: fmt.Sprintf("%s-%d", tenantID, i)}, 0))
+				}
+			}
+			// enqueue order of the tenants is randomized by the map, so fix the tenant order
+			qb.tenantQuerierAssignments.tenantIDOrder = []TenantID{"tenant-1", "tenant-2", "tenant-3"}
+			for i, tenantID := range qb.tenantQuerierAssignments.tenantIDOrder {
+				qb.tenantQuerierAssignments.tenantsByID[tenantID].orderIndex = i
+			}
+
+			// queriers take turns, and both stick with the same tenant
+			var dequeued []TenantID
+			lastTenantIndexes := map[QuerierID]int{"querier-1": -1, "querier-2": -1}
+			for i := 0; i < len(testData.expected); i++ {
+				querierID := QuerierID(fmt.Sprintf("querier-%d", i%2+1))
+				req, _, lastTenantIndex, err := qb.dequeueRequestForQuerier(lastTenantIndexes[querierID], querierID)
+				require.NoError(t, err)
+				require.NotNil(t, req)
+				lastTenantIndexes[querierID] = lastTenantIndex
+				dequeued = append(dequeued, req.tenantID)
+			}
+			assert.Equal(t, testData.expected, dequeued)
+			assert.True(t, qb.isEmpty())
+		})
+	}
+}
+
+func TestQueues_TenantStickinessRespectsShards(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.tenantStickiness = 10
+	for i := 0; i < 4; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-sharded", req: i}, 1))
+	}
+	shardQuerier := getTenantsQueriers(qb, "tenant-sharded")[0]
+	dequeueN(t, qb, shardQuerier, 1)
+
+	// queriers outside of the shard are not served from the sticky tenant
+	for querierID := range qb.tenantQuerierAssignments.queriersByID {
+		if querierID == shardQuerier {
+			continue
+		}
+		req, _, _, err := qb.dequeueRequestForQuerier(-1, querierID)
+		require.NoError(t, err)
+		assert.Nil(t, req, querierID)
+	}
+
+	// a querier shutting down is not served from the sticky tenant
+	qb.notifyQuerierShutdown(shardQuerier)
+	_, _, _, err := qb.dequeueRequestForQuerier(-1, shardQuerier)
+	assert.ErrorIs(t, err, ErrQuerierShuttingDown)
+}
+
+func TestQueues_TenantDequeueBurst(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-1", TenantConfig{DequeueBurst: 3}))
+
+	for _, tenantID := range []TenantID{"tenant-1", "tenant-2", "tenant-3"} {
+		for i := 0; i < 4; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: i}, 0))
+		}
+	}
+
+	var dequeued []TenantID
+	lastTenantIndex := -1
+	for !qb.isEmpty() {
+		req, _, tenantIndex, err := qb.dequeueRequestForQuerier(lastTenantIndex, "querier-1")
+		require.NoError(t, err)
+		require.NotNil(t, req)
+		lastTenantIndex = tenantIndex
+		dequeued = append(dequeued, req.tenantID)
+	}
+
+	// tenant-1 is served up to 3 consecutive requests, the other tenants one at a time
+	assert.Equal(t, []TenantID{
+		"tenant-1", "tenant-1", "tenant-1", "tenant-2", "tenant-3",
+		"tenant-1", "tenant-2", "tenant-3",
+		"tenant-2", "tenant-3",
+		"tenant-2", "tenant-3",
+	}, dequeued)
+}
+
+func TestQueues_TenantDequeueBurstYieldsToInflightCap(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.trackInflight = true
+	qb.addQuerierConnection("querier-1")
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-1", TenantConfig{DequeueBurst: 5, MaxInflight: 2}))
+
+	for _, tenantID := range []TenantID{"tenant-1", "tenant-2"} {
+		for i := 0; i < 5; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: i}, 0))
+		}
+	}
+
+	var dequeued []TenantID
+	lastTenantIndex := -1
+	for i := 0; i < 4; i++ {
+		req, _, tenantIndex, err := qb.dequeueRequestForQuerier(lastTenantIndex, "querier-1")
+		require.NoError(t, err)
+		require.NotNil(t, req)
+		lastTenantIndex = tenantIndex
+		dequeued = append(dequeued, req.tenantID)
+	}
+
+	// the burst of tenant-1 ends when it reaches its max inflight requests
+	assert.Equal(t, []TenantID{"tenant-1", "tenant-1", "tenant-2", "tenant-2"}, dequeued)
+}
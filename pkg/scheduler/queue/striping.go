@@ -0,0 +1,37 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "sort"
+
+// stripedRequestMatcher matches the tenant's requests for the querier, striping the tenant's stream of requests
+// across the queriers of its shard: the querier at position i of the k queriers in the sorted shard
+// takes the oldest queued request whose sequence number is i modulo k. Returns nil if the querier takes any request.
+//
+// If no such request is queued, the request at the front of the tenant queue is dequeued instead,
+// so that queriers polling faster than others still pick up the tenant's backlog rather than idling.
+func (qb *queueBroker) stripedRequestMatcher(tenant *queueTenant, querierID QuerierID) func(v any) bool {
+	shard := qb.tenantShardQuerierIDs(tenant.tenantID)
+	stripe := sort.Search(len(shard), func(i int) bool { return shard[i] >= querierID })
+	if len(shard) <= 1 || stripe >= len(shard) || shard[stripe] != querierID {
+		return nil
+	}
+	return func(v any) bool {
+		return v.(*tenantRequest).seq%uint64(len(shard)) == uint64(stripe)
+	}
+}
+
+// tenantShardQuerierIDs returns the sorted IDs of the queriers which can handle the tenant's requests.
+func (qb *queueBroker) tenantShardQuerierIDs(tenantID TenantID) querierIDSlice {
+	tqa := &qb.tenantQuerierAssignments
+	tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]
+	if tenantQuerierSet == nil {
+		return tqa.querierIDsSorted
+	}
+	shard := make(querierIDSlice, 0, len(tenantQuerierSet))
+	for querierID := range tenantQuerierSet {
+		shard = append(shard, querierID)
+	}
+	sort.Sort(shard)
+	return shard
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_StripeTenantRequests(t *testing.T) {
+	const numRequests = 12
+
+	tests := map[string]struct {
+		stripe   bool
+		expected map[QuerierID][]any
+	}{
+		"pure FIFO": {
+			stripe: false,
+			expected: map[QuerierID][]any{
+				// the fastest querier takes the next requests in FIFO order
+				"querier-1": {0, 1, 2, 3, 4, 5},
+				"querier-2": {6, 8, 10},
+				"querier-3": {7, 9, 11},
+			},
+		},
+		"striped": {
+			stripe: true,
+			expected: map[QuerierID][]any{
+				// the fast querier takes its own stripe, then the front of the queue once its stripe is exhausted
+				"querier-1": {0, 3, 6, 9, 1, 2},
+				"querier-2": {4, 7, 10},
+				"querier-3": {5, 8, 11},
+			},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.stripeTenantRequests = testData.stripe
+			for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3"} {
+				qb.addQuerierConnection(querierID)
+			}
+			for i := 0; i < numRequests; i++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+			}
+
+			dequeued := map[QuerierID][]any{}
+			// querier-1 polls faster than the others at first
+			for _, querierID := range []QuerierID{"querier-1", "querier-1", "querier-1", "querier-1", "querier-1", "querier-1", "querier-2", "querier-3", "querier-2", "querier-3", "querier-2", "querier-3"} {
+				req := dequeueN(t, qb, querierID, 1)[0]
+				dequeued[querierID] = append(dequeued[querierID], req.req)
+			}
+			assert.Equal(t, testData.expected, dequeued)
+			assert.True(t, qb.isEmpty())
+			assert.NoError(t, isConsistent(qb))
+		})
+	}
+}
+
+func TestQueues_StripeTenantRequests_EvenPolling(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.stripeTenantRequests = true
+	queriers := []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"}
+	for _, querierID := range queriers {
+		qb.addQuerierConnection(querierID)
+	}
+
+	// the tenant is sharded to 2 of the 4 queriers
+	for i := 0; i < 10; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 2))
+	}
+	shard := getTenantsQueriers(qb, "tenant-1")
+	require.Len(t, shard, 2)
+
+	// requests are striped across the shard even when the queriers poll in the opposite order
+	dequeued := map[QuerierID][]any{}
+	for i := 0; i < 5; i++ {
+		for _, querierID := range []QuerierID{shard[1], shard[0]} {
+			dequeued[querierID] = append(dequeued[querierID], dequeueN(t, qb, querierID, 1)[0].req)
+		}
+	}
+	assert.Equal(t, []any{0, 2, 4, 6, 8}, dequeued[shard[0]])
+	assert.Equal(t, []any{1, 3, 5, 7, 9}, dequeued[shard[1]])
+}
@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// TenantConfig holds per-tenant scheduling configuration which is not provided along with each enqueued request.
+// The zero value keeps the default scheduling behavior for the tenant.
+type TenantConfig struct {
+	// MinQueriers is the minimum number of live queriers the tenant is expected to be served by.
+	MinQueriers int
+
+	// DispatchTimeout is how long a querier may hold a dispatched request of the tenant before
+	// the request is reported as overdue; 0 uses the broker's default dispatch timeout.
+	DispatchTimeout time.Duration
+
+	// Weight is the tenant's relative share of selections under weighted random and fair queuing tenant selection;
+	// 0 means a weight of 1. Round-robin tenant selection disregards weights.
+	Weight int
+
+	// Tier is the tenant's SLO tier under tiered tenant selection; tenants in lower-numbered tiers are served first.
+	// Changes apply to a tenant with a queue the next time it is created or updated by an enqueue.
+	Tier int
+
+	// KeepWarm retains the tenant, along with its querier shard, while it has no queued requests,
+	// regardless of the tenant removal policy.
+	KeepWarm bool
+
+	// MaxInflight is the maximum number of the tenant's requests dispatched to queriers and not yet completed;
+	// the tenant is not selected for dispatch while at the limit. 0 means no limit.
+	// Only enforced when the broker tracks inflight requests.
+	MaxInflight int
+
+	// MinRequestAge is how long the tenant's requests are held in the queue after being enqueued
+	// before they can be dispatched, allowing related requests to accumulate; 0 dispatches immediately.
+	MinRequestAge time.Duration
+
+	// PriorityBands overrides the number of priority bands of the broker for the tenant's requests; 0 uses the broker's.
+	// Must not exceed the broker's maximum number of priority bands; this is validated when the tenant is created or updated.
+	PriorityBands int
+
+	// DequeueBurst is the maximum number of the tenant's requests served consecutively under round-robin tenant selection
+	// before the rotation moves on to the next tenant; 0 uses the broker's tenant stickiness, which serves one request by default.
+	DequeueBurst int
+
+	// CoalesceWindow is how long the tenant's next request is held after being enqueued when it can be coalesced with,
+	// so that more duplicates of it attach as waiters before it is dispatched; other tenants are served meanwhile.
+	// Only applies when the broker coalesces duplicate requests. 0 dispatches immediately.
+	CoalesceWindow time.Duration
+
+	// RequestOrdering is the order in which the tenant's queued requests are dispatched; empty uses the broker's ordering.
+	// Changes apply to requests queued after the tenant is next created or updated by an enqueue.
+	RequestOrdering RequestOrdering
+
+	// ForgetDelay is how long a querier of the tenant's shard may be disconnected before the tenant is reshuffled
+	// away from it, while the querier is kept for the other tenants until the broker's querier forget delay.
+	// Only shorter delays than the broker's have an effect. 0 uses the broker's querier forget delay.
+	ForgetDelay time.Duration
+
+	// ErrorBudget is the number of the tenant's requests which may be re-enqueued after a failed dispatch within
+	// ErrorBudgetWindow; the next failure exhausts the budget, and pauses the dispatch of the tenant's requests
+	// for ErrorBudgetCooldown. The budget is disabled unless both ErrorBudget and ErrorBudgetWindow are positive.
+	ErrorBudget         int
+	ErrorBudgetWindow   time.Duration
+	ErrorBudgetCooldown time.Duration
+}
+
+// setTenantConfig sets the configuration for a tenant, whether or not the tenant currently has a queue.
+func (tqa *tenantQuerierAssignments) setTenantConfig(tenantID TenantID, cfg TenantConfig) error {
+	if tenantID == emptyTenantID {
+		return ErrInvalidTenantID
+	}
+	if !cfg.RequestOrdering.valid() {
+		return ErrInvalidRequestOrdering
+	}
+	tqa.recorder.record(Event{Type: EventSetTenantConfig, TenantID: tenantID, TenantConfig: &cfg})
+	if cfg == (TenantConfig{}) {
+		delete(tqa.tenantConfigs, tenantID)
+		return nil
+	}
+	tqa.tenantConfigs[tenantID] = cfg
+	return nil
+}
+
+// casTenantConfig sets the tenant's configuration to desired only if its current configuration is expected,
+// so that concurrent reloaders do not overwrite each other's updates; a tenant without a configuration has the zero config.
+// A tenant with a queue is then updated with the new configuration, and reshuffled if needed, as by an enqueue.
+// Returns whether desired was applied; an invalid desired configuration is neither compared nor applied.
+func (qb *queueBroker) casTenantConfig(tenantID TenantID, expected, desired TenantConfig) (bool, error) {
+	tqa := &qb.tenantQuerierAssignments
+	if tenantID == emptyTenantID {
+		return false, ErrInvalidTenantID
+	}
+	if !desired.RequestOrdering.valid() {
+		return false, ErrInvalidRequestOrdering
+	}
+	if err := tqa.validatePriorityBands(desired.PriorityBands); err != nil {
+		return false, err
+	}
+	if tqa.tenantConfigs[tenantID] != expected {
+		return false, nil
+	}
+	if err := tqa.setTenantConfig(tenantID, desired); err != nil {
+		return false, err
+	}
+
+	tenant := tqa.tenantsByID[tenantID]
+	if tenant == nil {
+		return true, nil
+	}
+	maxQueriers := tenant.maxQueriers
+	if maxQueriers > 0 {
+		maxQueriers -= tenant.shardExpansion
+	}
+	return true, tqa.createOrUpdateTenant(tenantID, maxQueriers)
+}
+
+// unmetMinimums returns the tenants whose count of live queriers is below their configured MinQueriers,
+// mapped to the number of queriers missing to satisfy the minimum.
+//
+// Only queriers with active connections are counted as live; queriers which disconnected
+// but are not yet forgotten, or which notified a graceful shutdown, do not count.
+// Configured tenants without a queue are counted against all live queriers, as they are not sharded yet.
+func (tqa *tenantQuerierAssignments) unmetMinimums() map[TenantID]int {
+	unmet := map[TenantID]int{}
+	for tenantID, cfg := range tqa.tenantConfigs {
+		if cfg.MinQueriers <= 0 {
+			continue
+		}
+		if missing := cfg.MinQueriers - tqa.liveQueriersForTenant(tenantID); missing > 0 {
+			unmet[tenantID] = missing
+		}
+	}
+	return unmet
+}
+
+// liveQueriersForTenant counts the queriers with active connections which can handle the tenant's requests.
+func (tqa *tenantQuerierAssignments) liveQueriersForTenant(tenantID TenantID) int {
+	tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]
+	live := 0
+	for querierID, querier := range tqa.queriersByID {
+		if querier.connections <= 0 || querier.shuttingDown {
+			continue
+		}
+		if _, ok := tenantQuerierSet[querierID]; tenantQuerierSet == nil || ok {
+			live++
+		}
+	}
+	return live
+}
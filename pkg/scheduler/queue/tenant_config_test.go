@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantQuerierAssignments_UnmetMinimums(t *testing.T) {
+	now := time.Now()
+	qb := newQueueBroker(100, time.Minute)
+	tqa := &qb.tenantQuerierAssignments
+
+	for i := 1; i <= 4; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+
+	// tenant-sharded is limited to 2 queriers, below its minimum of 3
+	require.NoError(t, tqa.setTenantConfig("tenant-sharded", TenantConfig{MinQueriers: 3}))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-sharded", req: "request"}, 2))
+
+	// tenant-satisfied can use all 4 queriers, satisfying its minimum of 3
+	require.NoError(t, tqa.setTenantConfig("tenant-satisfied", TenantConfig{MinQueriers: 3}))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-satisfied", req: "request"}, 0))
+
+	// tenant-unconfigured has no minimum
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-unconfigured", req: "request"}, 1))
+
+	assert.Equal(t, map[TenantID]int{"tenant-sharded": 1}, tqa.unmetMinimums())
+
+	// queriers without live connections do not count, even if they are not forgotten yet
+	qb.removeQuerierConnection("querier-1", now)
+	qb.removeQuerierConnection("querier-2", now)
+	require.Contains(t, tqa.queriersByID, QuerierID("querier-1"))
+
+	unmet := tqa.unmetMinimums()
+	assert.Equal(t, 1, unmet["tenant-satisfied"])
+	assert.GreaterOrEqual(t, unmet["tenant-sharded"], 1)
+	assert.NotContains(t, unmet, TenantID("tenant-unconfigured"))
+}
+
+func TestTenantQuerierAssignments_SetTenantConfig(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+
+	assert.ErrorIs(t, tqa.setTenantConfig(emptyTenantID, TenantConfig{MinQueriers: 1}), ErrInvalidTenantID)
+
+	require.NoError(t, tqa.setTenantConfig("tenant-1", TenantConfig{MinQueriers: 1}))
+	assert.Equal(t, TenantConfig{MinQueriers: 1}, tqa.tenantConfigs["tenant-1"])
+
+	// setting the zero config removes the tenant config
+	require.NoError(t, tqa.setTenantConfig("tenant-1", TenantConfig{}))
+	assert.NotContains(t, tqa.tenantConfigs, TenantID("tenant-1"))
+}
+
+func TestQueues_CasTenantConfig(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+	qb.addQuerierConnection("querier-3")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "r"}, 2))
+	shard := getTenantsQueriers(qb, "tenant-1")
+	shuffles := tqa.tenantShuffles
+
+	// a tenant without a configuration has the zero config
+	applied, err := qb.casTenantConfig("tenant-1", TenantConfig{}, TenantConfig{Tier: 1, MinQueriers: 2})
+	require.NoError(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, TenantConfig{Tier: 1, MinQueriers: 2}, tqa.tenantConfigs["tenant-1"])
+	// the tenant is updated with its new configuration, without being reshuffled
+	assert.Equal(t, 1, tqa.tenantsByID["tenant-1"].tier)
+	assert.Equal(t, shard, getTenantsQueriers(qb, "tenant-1"))
+	assert.Equal(t, shuffles, tqa.tenantShuffles)
+
+	// a stale expected config is a no-op
+	applied, err = qb.casTenantConfig("tenant-1", TenantConfig{}, TenantConfig{Tier: 2})
+	require.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, TenantConfig{Tier: 1, MinQueriers: 2}, tqa.tenantConfigs["tenant-1"])
+	assert.Equal(t, 1, tqa.tenantsByID["tenant-1"].tier)
+
+	// tenants without a queue are configured without being created
+	applied, err = qb.casTenantConfig("tenant-2", TenantConfig{}, TenantConfig{Weight: 3})
+	require.NoError(t, err)
+	assert.True(t, applied)
+	assert.Equal(t, TenantConfig{Weight: 3}, tqa.tenantConfigs["tenant-2"])
+	assert.NotContains(t, tqa.tenantsByID, TenantID("tenant-2"))
+
+	// an invalid desired config is not applied, even if the expected config matches
+	applied, err = qb.casTenantConfig("tenant-1", TenantConfig{Tier: 1, MinQueriers: 2}, TenantConfig{PriorityBands: -1})
+	assert.ErrorIs(t, err, ErrInvalidPriorityBands)
+	assert.False(t, applied)
+	applied, err = qb.casTenantConfig("tenant-1", TenantConfig{Tier: 1, MinQueriers: 2}, TenantConfig{RequestOrdering: "lifo"})
+	assert.ErrorIs(t, err, ErrInvalidRequestOrdering)
+	assert.False(t, applied)
+	_, err = qb.casTenantConfig(emptyTenantID, TenantConfig{}, TenantConfig{})
+	assert.ErrorIs(t, err, ErrInvalidTenantID)
+	assert.Equal(t, TenantConfig{Tier: 1, MinQueriers: 2}, tqa.tenantConfigs["tenant-1"])
+	assert.NoError(t, isConsistent(qb))
+}
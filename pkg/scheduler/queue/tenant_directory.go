@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "sort"
+
+// TenantState is the status of a tenant tracked by the broker.
+type TenantState string
+
+const (
+	// TenantActive: the tenant has queued requests.
+	TenantActive TenantState = "active"
+	// TenantIdle: the tenant has no queued requests, and is only retained by lazy tenant removal or kept warm.
+	TenantIdle TenantState = "idle"
+	// TenantPaused: the tenant's queue is frozen, or the tenant is paused after exhausting its error budget,
+	// whether or not it has queued requests.
+	TenantPaused TenantState = "paused"
+)
+
+// TenantStatus is the status of a tenant in the tenant directory.
+type TenantStatus struct {
+	TenantID TenantID    `json:"tenant_id"`
+	State    TenantState `json:"state"`
+	// number of requests queued for the tenant, not counting enqueues buffered while it is frozen
+	Depth int `json:"depth"`
+}
+
+// tenantDirectory returns the status of every tenant the broker tracks, sorted by tenant ID:
+// the tenants with a queue, whether or not it holds requests, and the frozen tenants.
+func (qb *queueBroker) tenantDirectory() []TenantStatus {
+	tqa := &qb.tenantQuerierAssignments
+	directory := make([]TenantStatus, 0, len(tqa.tenantsByID))
+	for tenantID := range tqa.tenantsByID {
+		directory = append(directory, qb.tenantStatus(tenantID))
+	}
+	for tenantID := range qb.frozenTenants {
+		if tqa.tenantsByID[tenantID] == nil {
+			directory = append(directory, qb.tenantStatus(tenantID))
+		}
+	}
+	sort.Slice(directory, func(i, j int) bool { return directory[i].TenantID < directory[j].TenantID })
+	return directory
+}
+
+// tenantStatus returns the current status of the tenant.
+func (qb *queueBroker) tenantStatus(tenantID TenantID) TenantStatus {
+	status := TenantStatus{TenantID: tenantID, State: TenantIdle}
+	if node := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}); node != nil {
+		status.Depth = node.ItemCount()
+		status.State = TenantActive
+	}
+	if qb.tenantFrozen(tenantID) || qb.tenantPausedByErrorBudget(tenantID, qb.clock.Now()) {
+		status.State = TenantPaused
+	}
+	return status
+}
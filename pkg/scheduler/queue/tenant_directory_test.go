@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_TenantDirectory(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.tenantRemovalPolicy = tenantRemovalLazy
+	qb.tenantRemovalGracePeriod = time.Hour
+	qb.addQuerierConnection("querier-1")
+	assert.Empty(t, qb.tenantDirectory())
+
+	for _, tenantID := range []TenantID{"tenant-c", "tenant-a", "tenant-b", "tenant-d"} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "r1"}, 0))
+	}
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-c", req: "r2"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-c", req: "r3"}, 0))
+	// tenant-c then tenant-a are dequeued from, leaving tenant-a retained with an empty queue
+	dequeueN(t, qb, "querier-1", 2)
+	qb.freezeTenant("tenant-b")
+	// a tenant frozen before it was ever enqueued to is tracked with its buffered enqueues
+	qb.freezeTenant("tenant-e")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-e", req: "r1"}, 0))
+
+	assert.Equal(t, []TenantStatus{
+		{TenantID: "tenant-a", State: TenantIdle},
+		{TenantID: "tenant-b", State: TenantPaused, Depth: 1},
+		{TenantID: "tenant-c", State: TenantActive, Depth: 2},
+		{TenantID: "tenant-d", State: TenantActive, Depth: 1},
+		{TenantID: "tenant-e", State: TenantPaused},
+	}, qb.tenantDirectory())
+
+	// the directory reflects the live state
+	qb.unfreezeTenant("tenant-b")
+	qb.unfreezeTenant("tenant-e")
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-a", req: "r2"}, 0))
+
+	assert.Equal(t, []TenantStatus{
+		{TenantID: "tenant-a", State: TenantActive, Depth: 1},
+		{TenantID: "tenant-b", State: TenantActive, Depth: 1},
+		{TenantID: "tenant-c", State: TenantActive, Depth: 2},
+		{TenantID: "tenant-d", State: TenantActive, Depth: 1},
+		{TenantID: "tenant-e", State: TenantActive, Depth: 1},
+	}, qb.tenantDirectory())
+}
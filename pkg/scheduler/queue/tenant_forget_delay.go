@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// A tenant configured with a ForgetDelay shorter than the broker's querier forget delay treats the queriers
+// disconnected for longer than its own delay as forgotten: it is reshuffled over the queriers it has not forgotten,
+// so that its shard moves away from them sooner. The queriers are kept by the broker, and by the other tenants,
+// until they reconnect or the broker's forget delay forgets them for all tenants.
+//
+// Tenants only forget queriers when the shards are computed from the locally connected queriers,
+// as a querier disconnected from this scheduler may still be connected to others sharing an authoritative querier set.
+
+// forgetTenantDisconnectedQueriers updates the queriers forgotten by each tenant configured with a ForgetDelay,
+// reshuffling the tenants whose forgotten queriers changed. Returns the number of tenants reshuffled.
+func (tqa *tenantQuerierAssignments) forgetTenantDisconnectedQueriers(now time.Time) int {
+	reshuffled := 0
+	for tenantID, tenant := range tqa.tenantsByID {
+		var forgotten map[QuerierID]struct{}
+		if delay := tqa.tenantConfigs[tenantID].ForgetDelay; delay > 0 && tqa.authoritativeQuerierIDs == nil {
+			threshold := now.Add(-delay)
+			for querierID, querier := range tqa.queriersByID {
+				if querier.connections == 0 && !querier.disconnectedAt.IsZero() && querier.disconnectedAt.Before(threshold) {
+					if forgotten == nil {
+						forgotten = map[QuerierID]struct{}{}
+					}
+					forgotten[querierID] = struct{}{}
+				}
+			}
+		}
+		if sameQuerierSet(tenant.forgottenQuerierIDs, forgotten) {
+			continue
+		}
+		tenant.forgottenQuerierIDs = forgotten
+		tqa.shuffleTenantQueriers(tenantID, nil)
+		reshuffled++
+	}
+	return reshuffled
+}
+
+// restoreForgottenQuerier reshuffles the tenants which forgot the querier as it reconnected.
+func (tqa *tenantQuerierAssignments) restoreForgottenQuerier(querierID QuerierID) {
+	for tenantID, tenant := range tqa.tenantsByID {
+		if _, ok := tenant.forgottenQuerierIDs[querierID]; ok {
+			delete(tenant.forgottenQuerierIDs, querierID)
+			tqa.shuffleTenantQueriers(tenantID, nil)
+		}
+	}
+}
+
+// tenantShardingQuerierIDs returns the sorted querier IDs the tenant is shuffle sharded across:
+// the broker's sharding querier IDs, without the queriers the tenant has forgotten.
+func (tqa *tenantQuerierAssignments) tenantShardingQuerierIDs(tenant *queueTenant) querierIDSlice {
+	shardingQuerierIDs := tqa.shardingQuerierIDs()
+	if len(tenant.forgottenQuerierIDs) == 0 {
+		return shardingQuerierIDs
+	}
+	remaining := make(querierIDSlice, 0, len(shardingQuerierIDs))
+	for _, querierID := range shardingQuerierIDs {
+		if _, ok := tenant.forgottenQuerierIDs[querierID]; !ok {
+			remaining = append(remaining, querierID)
+		}
+	}
+	return remaining
+}
+
+func sameQuerierSet(a, b map[QuerierID]struct{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for querierID := range a {
+		if _, ok := b[querierID]; !ok {
+			return false
+		}
+	}
+	return true
+}
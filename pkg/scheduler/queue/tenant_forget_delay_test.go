@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_TenantForgetDelay(t *testing.T) {
+	clk := newManualClock()
+	qb := newQueueBroker(100, time.Hour)
+	qb.clock = clk
+	tqa := &qb.tenantQuerierAssignments
+	require.NoError(t, tqa.setTenantConfig("tenant-strict", TenantConfig{ForgetDelay: time.Minute}))
+	for i := 0; i < 6; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-strict", req: "r1"}, 2))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-default", req: "r2"}, 5))
+	strictShard := getTenantsQueriers(qb, "tenant-strict")
+	defaultShard := getTenantsQueriers(qb, "tenant-default")
+
+	// disconnect a querier which both tenants are sharded on
+	var disconnected QuerierID
+	for _, querierID := range strictShard {
+		if _, ok := tqa.tenantQuerierIDs["tenant-default"][querierID]; ok {
+			disconnected = querierID
+			break
+		}
+	}
+	require.NotEmpty(t, disconnected)
+	qb.removeQuerierConnection(disconnected, clk.Now())
+
+	// nothing changes before the tenant's forget delay
+	clk.Advance(30 * time.Second)
+	assert.Zero(t, qb.forgetDisconnectedQueriers(clk.Now()))
+	assert.Equal(t, strictShard, getTenantsQueriers(qb, "tenant-strict"))
+
+	// the strict tenant moves away from the querier, which the broker and the other tenants keep
+	clk.Advance(time.Minute)
+	assert.Equal(t, 1, qb.forgetDisconnectedQueriers(clk.Now()))
+	shard := getTenantsQueriers(qb, "tenant-strict")
+	assert.Len(t, shard, 2)
+	assert.NotContains(t, shard, disconnected)
+	assert.Contains(t, tqa.queriersByID, disconnected)
+	assert.Equal(t, defaultShard, getTenantsQueriers(qb, "tenant-default"))
+	assert.Zero(t, qb.forgetDisconnectedQueriers(clk.Now()))
+	assert.NoError(t, isConsistent(qb))
+
+	// the strict tenant gets its shard back when the querier reconnects
+	qb.addQuerierConnection(disconnected)
+	assert.Equal(t, strictShard, getTenantsQueriers(qb, "tenant-strict"))
+	assert.Empty(t, tqa.tenantsByID["tenant-strict"].forgottenQuerierIDs)
+	assert.NoError(t, isConsistent(qb))
+}
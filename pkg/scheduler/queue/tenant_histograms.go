@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// OverflowTenantLabel is the user label value of the TenantQueueHistograms series
+// which aggregate the tenants beyond the cap.
+const OverflowTenantLabel = "__overflow__"
+
+// TenantQueueHistograms tracks per-tenant histograms of the time requests wait in the queue before being dispatched
+// to a querier, and of the depth of the tenant's queue as requests are enqueued.
+//
+// To bound the cardinality of the histograms, at most maxTenants tenants get their own series at once; the requests
+// of further tenants are observed in the series labelled with OverflowTenantLabel, until a tenant is released with
+// DeleteTenant.
+type TenantQueueHistograms struct {
+	waitTime   *prometheus.HistogramVec
+	depth      *prometheus.HistogramVec
+	maxTenants int
+
+	mtx     sync.Mutex
+	tenants map[string]struct{}
+}
+
+// NewTenantQueueHistograms registers the histograms with the given metric name prefix, e.g. cortex_query_scheduler.
+// Returns nil if maxTenants is 0, in which case no histogram is tracked.
+func NewTenantQueueHistograms(registerer prometheus.Registerer, prefix string, maxTenants int) *TenantQueueHistograms {
+	if maxTenants <= 0 {
+		return nil
+	}
+	return &TenantQueueHistograms{
+		waitTime: promauto.With(registerer).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prefix + "_tenant_queue_wait_seconds",
+			Help:    "Time spent by requests in the queue before being dispatched to a querier, per tenant.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"user"}),
+		depth: promauto.With(registerer).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prefix + "_tenant_queue_depth",
+			Help:    "Number of queued requests of the tenant, including the request being enqueued, observed on each enqueue.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 7),
+		}, []string{"user"}),
+		maxTenants: maxTenants,
+		tenants:    map[string]struct{}{},
+	}
+}
+
+// observeWaitTime observes the time the tenant's request waited in the queue before being dispatched.
+func (h *TenantQueueHistograms) observeWaitTime(tenantID TenantID, wait time.Duration) {
+	if h == nil {
+		return
+	}
+	h.waitTime.WithLabelValues(h.label(tenantID)).Observe(wait.Seconds())
+}
+
+// observeDepth observes the depth of the tenant's queue after enqueuing a request.
+func (h *TenantQueueHistograms) observeDepth(tenantID TenantID, depth int) {
+	if h == nil {
+		return
+	}
+	h.depth.WithLabelValues(h.label(tenantID)).Observe(float64(depth))
+}
+
+// label returns the user label of the tenant's series, giving the tenant its own series if the cap allows.
+func (h *TenantQueueHistograms) label(tenantID TenantID) string {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if _, ok := h.tenants[string(tenantID)]; ok {
+		return string(tenantID)
+	}
+	if len(h.tenants) >= h.maxTenants {
+		return OverflowTenantLabel
+	}
+	h.tenants[string(tenantID)] = struct{}{}
+	return string(tenantID)
+}
+
+// DeleteTenant deletes the series of the tenant, releasing its place under the cap for another tenant.
+func (h *TenantQueueHistograms) DeleteTenant(tenantID string) {
+	if h == nil {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	if _, ok := h.tenants[tenantID]; !ok {
+		return
+	}
+	delete(h.tenants, tenantID)
+	h.waitTime.DeleteLabelValues(tenantID)
+	h.depth.DeleteLabelValues(tenantID)
+}
@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/grafana/dskit/services"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantQueueHistograms_Disabled(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	h := NewTenantQueueHistograms(reg, "cortex_query_scheduler", 0)
+	assert.Nil(t, h)
+
+	// a nil TenantQueueHistograms tracks nothing
+	h.observeDepth("tenant-1", 1)
+	h.observeWaitTime("tenant-1", time.Second)
+	h.DeleteTenant("tenant-1")
+
+	count, err := testutil.GatherAndCount(reg)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+func TestTenantQueueHistograms_Cap(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	h := NewTenantQueueHistograms(reg, "cortex_query_scheduler", 2)
+
+	for _, tenantID := range []TenantID{"tenant-1", "tenant-2", "tenant-3", "tenant-4", "tenant-1"} {
+		h.observeWaitTime(tenantID, time.Second)
+	}
+	assert.Equal(t, 3, testutil.CollectAndCount(h.waitTime))
+	assert.Equal(t, uint64(2), histogramCount(t, h.waitTime, "tenant-1"))
+	assert.Equal(t, uint64(1), histogramCount(t, h.waitTime, "tenant-2"))
+	assert.Equal(t, uint64(2), histogramCount(t, h.waitTime, OverflowTenantLabel))
+
+	// deleting a tenant gives its place to the next tenant
+	h.DeleteTenant("tenant-2")
+	h.DeleteTenant("tenant-3")
+	h.observeDepth("tenant-3", 5)
+	h.observeDepth("tenant-4", 5)
+	assert.Equal(t, uint64(1), histogramCount(t, h.depth, "tenant-3"))
+	assert.Equal(t, uint64(1), histogramCount(t, h.depth, OverflowTenantLabel))
+	assert.Equal(t, 2, testutil.CollectAndCount(h.waitTime), "the series of the deleted tenant are gone")
+}
+
+func TestRequestQueue_TenantQueueHistograms(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	histograms := NewTenantQueueHistograms(reg, "cortex_query_scheduler", 10)
+	queue := NewRequestQueue(log.NewNopLogger(), 100, 0,
+		promauto.With(nil).NewGaugeVec(prometheus.GaugeOpts{}, []string{"user"}),
+		promauto.With(nil).NewCounterVec(prometheus.CounterOpts{}, []string{"user"}),
+		promauto.With(nil).NewHistogram(prometheus.HistogramOpts{}),
+		RequestQueueOptions{TenantHistograms: histograms})
+
+	ctx := context.Background()
+	require.NoError(t, services.StartAndAwaitRunning(ctx, queue))
+	t.Cleanup(func() {
+		require.NoError(t, services.StopAndAwaitTerminated(ctx, queue))
+	})
+
+	for _, req := range []string{"req-1", "req-2", "req-3"} {
+		require.NoError(t, queue.EnqueueRequestToDispatcher("user-1", req, 0, 1, nil))
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	queue.RegisterQuerierConnection("querier-1")
+	t.Cleanup(func() {
+		queue.UnregisterQuerierConnection("querier-1")
+	})
+	_, _, err := queue.GetNextRequestForQuerier(ctx, FirstUser(), "querier-1", "")
+	require.NoError(t, err)
+
+	// the depth is observed on enqueue, including the request being enqueued
+	depth := histogram(t, histograms.depth, "user-1")
+	assert.Equal(t, uint64(3), depth.GetSampleCount())
+	assert.Equal(t, float64(1+2+3), depth.GetSampleSum())
+
+	assert.Eventually(t, func() bool {
+		return histogram(t, histograms.waitTime, "user-1").GetSampleCount() == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.GreaterOrEqual(t, histogram(t, histograms.waitTime, "user-1").GetSampleSum(), (50 * time.Millisecond).Seconds())
+}
+
+func histogram(t *testing.T, vec *prometheus.HistogramVec, user string) *dto.Histogram {
+	m := &dto.Metric{}
+	require.NoError(t, vec.WithLabelValues(user).(prometheus.Metric).Write(m))
+	return m.GetHistogram()
+}
+
+func histogramCount(t *testing.T, vec *prometheus.HistogramVec, user string) uint64 {
+	return histogram(t, vec, user).GetSampleCount()
+}
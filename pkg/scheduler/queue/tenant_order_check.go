@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+type tenantOrderCorruptionPolicy int
+
+const (
+	// tenantOrderCorruptionPanic panics when a removed tenant's order index does not point to its slot
+	// in the tenant order, as the broker state is corrupted.
+	tenantOrderCorruptionPanic tenantOrderCorruptionPolicy = iota
+	// tenantOrderCorruptionSkip logs the inconsistency and leaves the slot the order index points to untouched,
+	// so that the corruption does not spread to the slot of another tenant. The slot actually holding the
+	// removed tenant, if any, is cleared instead.
+	tenantOrderCorruptionSkip
+)
+
+// clearTenantOrderSlot clears the slot of the removed tenant in the tenant order,
+// handling an order index which does not point to the tenant's slot according to the corruption policy.
+func (tqa *tenantQuerierAssignments) clearTenantOrderSlot(tenant *queueTenant) {
+	ix := tenant.orderIndex
+	if ix >= 0 && ix < len(tqa.tenantIDOrder) && tqa.tenantIDOrder[ix] == tenant.tenantID {
+		tqa.tenantIDOrder[ix] = emptyTenantID
+		return
+	}
+
+	slotTenantID := TenantID("<out of range>")
+	if ix >= 0 && ix < len(tqa.tenantIDOrder) {
+		slotTenantID = tqa.tenantIDOrder[ix]
+	}
+	if tqa.tenantOrderCorruptionPolicy == tenantOrderCorruptionPanic {
+		panic(fmt.Sprintf("inconsistent tenant order: removed tenant %q has order index %d of %d, holding tenant %q",
+			tenant.tenantID, ix, len(tqa.tenantIDOrder), slotTenantID))
+	}
+
+	logger := tqa.logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	level.Warn(logger).Log("msg", "inconsistent tenant order on tenant removal, leaving the slot of the order index untouched",
+		"tenant", tenant.tenantID, "order_index", ix, "tenant_order_len", len(tqa.tenantIDOrder), "slot_tenant", slotTenantID)
+	for i, tenantID := range tqa.tenantIDOrder {
+		if tenantID == tenant.tenantID {
+			tqa.tenantIDOrder[i] = emptyTenantID
+		}
+	}
+}
+
+func (p tenantOrderCorruptionPolicy) name() string {
+	switch p {
+	case tenantOrderCorruptionPanic:
+		return "strict"
+	case tenantOrderCorruptionSkip:
+		return "lenient"
+	default:
+		return "unknown"
+	}
+}
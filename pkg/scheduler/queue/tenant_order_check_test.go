@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_RemoveTenantWithInconsistentOrderIndex(t *testing.T) {
+	setup := func(t *testing.T) *queueBroker {
+		qb := newQueueBroker(100, 0)
+		for _, tenantID := range []TenantID{"tenant-1", "tenant-2", "tenant-3"} {
+			require.NoError(t, qb.tenantQuerierAssignments.createOrUpdateTenant(tenantID, 0))
+		}
+		return qb
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		qb := setup(t)
+		tqa := &qb.tenantQuerierAssignments
+		tqa.tenantsByID["tenant-1"].orderIndex = 1
+		assert.PanicsWithValue(t, `inconsistent tenant order: removed tenant "tenant-1" has order index 1 of 3, holding tenant "tenant-2"`, func() {
+			tqa.removeTenant("tenant-1")
+		})
+
+		qb = setup(t)
+		tqa = &qb.tenantQuerierAssignments
+		tqa.tenantsByID["tenant-1"].orderIndex = 7
+		assert.PanicsWithValue(t, `inconsistent tenant order: removed tenant "tenant-1" has order index 7 of 3, holding tenant "<out of range>"`, func() {
+			tqa.removeTenant("tenant-1")
+		})
+	})
+
+	t.Run("lenient", func(t *testing.T) {
+		for _, orderIndex := range []int{1, 7, -2} {
+			qb := setup(t)
+			tqa := &qb.tenantQuerierAssignments
+			var logs bytes.Buffer
+			tqa.logger = log.NewLogfmtLogger(&logs)
+			tqa.tenantOrderCorruptionPolicy = tenantOrderCorruptionSkip
+			tqa.tenantsByID["tenant-1"].orderIndex = orderIndex
+
+			require.NotPanics(t, func() { tqa.removeTenant("tenant-1") })
+			// the slot of tenant-2 is left alone, and the slot actually holding tenant-1 is cleared
+			assert.Equal(t, []TenantID{"", "tenant-2", "tenant-3"}, tqa.tenantIDOrder, "order index %d", orderIndex)
+			assert.NotContains(t, tqa.tenantsByID, TenantID("tenant-1"))
+			assert.Contains(t, logs.String(), "inconsistent tenant order on tenant removal")
+		}
+	})
+}
@@ -11,7 +11,9 @@ import (
 	"sort"
 	"time"
 
-	"github.com/grafana/mimir/pkg/util"
+	"github.com/go-kit/log"
+
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
 )
 
 type TenantID string
@@ -39,6 +41,51 @@ func (s querierIDSlice) Search(x QuerierID) int {
 type tenantRequest struct {
 	tenantID TenantID
 	req      Request
+
+	// key identifies duplicate submissions of a request for deduplication; empty if not deduplicated.
+	key string
+
+	// approximate size of the request payload as measured by the broker payload sizer, if any
+	payloadBytes int64
+
+	// when the request was enqueued to the back of the tenant queue
+	enqueueTime time.Time
+
+	// position of the request in the stream of requests enqueued to the back of the tenant queue
+	seq uint64
+	// position of the request in the stream of requests enqueued to the back of all tenant queues; unlike seq,
+	// it keeps increasing when a tenant is removed and re-created, so it orders requests across the tenant's lifetimes
+	globalSeq uint64
+
+	// priority class of the request, whose sub-queue of the tenant queue the request is queued in
+	class PriorityClass
+	// priority of the request within its sub-queue; requests with a higher priority are dequeued first
+	priority int
+
+	// requests with the same cache key are routed to the same querier of the tenant's shard
+	// under cache key affinity, to improve the querier cache hit rate; empty if the request has no cache locality.
+	cacheKey string
+
+	// tags of the request, e.g. the capabilities a querier needs to execute it; expected to be distinct
+	tags []string
+
+	// deadline of the request, past which its result is no longer wanted; zero if the request has no deadline
+	deadline time.Time
+	// estimated time it takes a querier to execute the request; zero if unknown
+	estimatedDuration time.Duration
+	// estimated cost of executing the request, counted against the querier cost budget while it is inflight; zero if unknown
+	cost int64
+	// component expected to serve the request, whose sub-queue of the tenant queue the request is queued in
+	// under query component queues; empty if unknown
+	component querycomponent.Component
+
+	// requests with the same key coalesced into this request while it was queued, which share its result
+	waiters []Request
+
+	// number of times the request has been re-enqueued to the front after a failed dispatch,
+	// and the priority boost the last of them gave the request, see boostRetriedRequest
+	retries    int
+	retryBoost int
 }
 
 type querierConn struct {
@@ -50,6 +97,18 @@ type querierConn struct {
 
 	// When the last connection has been unregistered.
 	disconnectedAt time.Time
+
+	// When a request was last dequeued for the querier, or when the querier first connected
+	// if no request has been dequeued for it yet.
+	lastDequeueAt time.Time
+
+	// Position in the tenant order of the last tenant the querier was dequeued a request from
+	// by dequeueNextRequestForQuerier, which manages it on behalf of the querier.
+	lastTenantIndex int
+
+	// True if the querier belongs to the overflow pool: it is not part of shuffle sharding
+	// and only serves the tenants whose backlog exceeds the broker's overflow threshold.
+	overflow bool
 }
 
 type tenantQuerierAssignments struct {
@@ -71,6 +130,9 @@ type tenantQuerierAssignments struct {
 	queriersByID map[QuerierID]*querierConn
 	// Sorted list of querier ids, used when shuffle sharding queriers for tenant
 	querierIDsSorted querierIDSlice
+	// Optional externally-supplied sorted list of all querier ids in the fleet;
+	// if not nil, it is used for shuffle sharding instead of the locally connected queriers.
+	authoritativeQuerierIDs querierIDSlice
 
 	// How long to wait before removing a querier which has got disconnected
 	// but hasn't notified about a graceful shutdown.
@@ -84,6 +146,79 @@ type tenantQuerierAssignments struct {
 	// If tenant querier ID set is not nil, only those queriers can handle the tenant's requests,
 	// Tenant querier ID is set to nil if sharding is off or available queriers <= tenant's maxQueriers.
 	tenantQuerierIDs map[TenantID]map[QuerierID]struct{}
+	// Reverse index of tenantQuerierIDs: the sharded tenants assigned to each querier,
+	// and the tenants which can use all queriers.
+	querierTenantIDs   map[QuerierID]map[TenantID]struct{}
+	unshardedTenantIDs map[TenantID]struct{}
+
+	// Number of sharded tenants with queued requests assigned to each querier,
+	// and number of tenants with queued requests which can use all queriers.
+	querierTenantsWithQueuedRequests   map[QuerierID]int
+	unshardedTenantsWithQueuedRequests int
+	// If true, a querier for which none of its tenants has queued requests is told so
+	// without scanning the tenant order, making polls by idle queriers cheap.
+	// Tenants retained by lazy removal are then not removed by polls while no tenant of the querier has queued requests.
+	idleQuerierFastPath bool
+
+	// Number of tenants with a non-nil tenant querier ID set.
+	shardedTenantCount int
+	// Total number of querier IDs across all non-nil tenant querier ID sets.
+	shardedQuerierEntries int
+
+	// If positive, tenants are left unsharded rather than shuffle sharded when their querier ID set would take
+	// the assignment memory estimate above this limit; unsharded tenants can use all queriers.
+	maxAssignmentMemoryBytes int64
+	// If positive, the maximum number of tenants sharded at once; beyond it, the tenants with the lowest
+	// selection weight are left unsharded, see admitShardedTenant.
+	maxShardedTenants int
+
+	// Maximum number of priority bands the broker or a tenant can be configured with; 0 uses defaultMaxPriorityBands.
+	maxPriorityBands int
+
+	// Number of times a tenant querier set has been computed via shuffle sharding.
+	tenantShuffles uint64
+	// Number of shuffle scratchpads allocated, and of shuffles computed in an already allocated scratchpad.
+	shuffleScratchpadAllocs uint64
+	shuffleScratchpadReuses uint64
+
+	// If true, shuffle sharding is disabled globally and all tenants can use all queriers,
+	// regardless of their max queriers.
+	shardingDisabled bool
+
+	// Per-tenant configuration; retained independently of whether the tenant currently has a queue.
+	tenantConfigs map[TenantID]TenantConfig
+
+	// If true, reshuffling a tenant after its maxQueriers changed is deferred from the enqueue path
+	// until applyPendingTenantReshuffles is called, keeping enqueueing fast for large fleets.
+	deferTenantReshuffle    bool
+	pendingTenantReshuffles map[TenantID]struct{}
+
+	// Dispatch failures and shard re-randomizations per tenant; retained across tenant removal
+	// so that a tenant which is re-created after its queue emptied keeps its re-randomized shard.
+	tenantShardFailures map[TenantID]*tenantShardFailures
+
+	// Querier sets manually pinned per tenant, overriding shuffle sharding until unpinned;
+	// retained across tenant removal like the tenant configs.
+	pinnedTenantShards map[TenantID]map[QuerierID]struct{}
+
+	// If positive, the times of the changes of each tenant's shard are retained for this long, see shardChurn;
+	// now returns the broker's current time for them.
+	shardChurnRetention time.Duration
+	shardChurnEvents    map[TenantID][]time.Time
+	now                 func() time.Time
+
+	observer *brokerObserver
+
+	// tenantOrderCorruptionPolicy controls how a tenant whose order index does not point to its slot in the tenant order
+	// is removed; logger receives the inconsistencies logged by the lenient policy, and may be nil.
+	tenantOrderCorruptionPolicy tenantOrderCorruptionPolicy
+	logger                      log.Logger
+
+	// recorder is shared with the broker; nil unless the broker is recording operations for replay.
+	recorder *eventRecorder
+
+	// dequeueTrace collects the tenants skipped by a traced dequeue; nil unless a traced dequeue is in progress.
+	dequeueTrace *[]SkipReason
 }
 
 type queueTenant struct {
@@ -96,6 +231,56 @@ type queueTenant struct {
 
 	// points up to tenant order to enable efficient removal
 	orderIndex int
+
+	// when the tenant queue was emptied; only set while the tenant is retained by lazy removal
+	emptySince time.Time
+
+	// queued requests by their deduplication key; only populated when deduplication is enabled
+	queuedRequestsByKey map[string]*tenantRequest
+	// dedupOverflowed is set once the tenant's deduplication keys exceeded the broker's dedupMaxKeysPerTenant;
+	// deduplication stays disabled for the tenant until it is removed from the broker
+	dedupOverflowed bool
+
+	// sum of the payload sizes of the queued requests; only tracked when the broker has a payload sizer
+	queuedPayloadBytes int64
+	// number of queued requests by query component; requests with no known component are not counted
+	queuedByComponent map[querycomponent.Component]int
+
+	// SLO tier of the tenant, refreshed from the tenant config whenever the tenant is created or updated
+	tier int
+
+	// order of the tenant's queued requests, refreshed from the tenant config whenever the tenant is created or updated;
+	// empty to use the broker's request ordering
+	requestOrdering RequestOrdering
+
+	// whether the queue depth reached the high watermark and has not fallen back to the low watermark yet
+	aboveHighWatermark bool
+	// whether the queue depth reached the enqueue backpressure queue length and has not fallen back to half of it yet
+	underEnqueueBackpressure bool
+	// highest queue depth reached since the tenant was added or the peak depths were last reset
+	peakDepth int
+
+	// sequence number of the next request enqueued to the back of the tenant queue
+	nextSeq uint64
+
+	// whether the tenant has a queue node with queued requests
+	hasQueuedRequests bool
+
+	// number of priority bands of the tenant, refreshed from the tenant config whenever the tenant is created or updated;
+	// 0 uses the broker's priority bands
+	priorityBands int
+
+	// queriers added to the tenant's max queriers by shard expansion under sustained backlog
+	shardExpansion int
+	// queue depth of the tenant when its backlog was last sampled by shard expansion, and when
+	backlogSampleDepth int
+	backlogSampledAt   time.Time
+
+	// queriers disconnected for longer than the tenant's ForgetDelay, which the tenant is not shuffle sharded across
+	forgottenQuerierIDs map[QuerierID]struct{}
+
+	// whether the tenant's queue depth exceeds the broker's overflowBacklogThreshold, making it eligible for overflow queriers
+	overflowBacklogged bool
 }
 
 // queueBroker encapsulates access to tenant queues for pending requests
@@ -106,21 +291,273 @@ type queueBroker struct {
 	tenantQuerierAssignments tenantQuerierAssignments
 
 	maxTenantQueueSize int
+	// reservedQueueSlots is the number of the last slots of each tenant queue, up to maxTenantQueueSize, reserved for
+	// requests of a priority above reservedSlotsPriorityThreshold; 0 reserves none.
+	reservedQueueSlots             int
+	reservedSlotsPriorityThreshold int
+
+	// ageHistogramBuckets are the ascending upper bounds of the buckets of tenantAgeHistogram;
+	// empty uses defaultAgeHistogramBuckets.
+	ageHistogramBuckets []time.Duration
+
+	// clock is used for all time-based logic of the broker; defaults to the real time.
+	clock clock
+
+	// observer is shared with the tenant-querier assignments.
+	observer *brokerObserver
+	// recorder optionally records the operations applied to the broker, for replay into a fresh broker.
+	recorder *eventRecorder
+
+	// querierIDNormalizer optionally maps the IDs queriers connect with to the ID of the logical querier they belong to,
+	// so that ID variants of the same querier are sharded and accounted for as one querier.
+	querierIDNormalizer func(querierID QuerierID) QuerierID
+
+	// rejectExpiredRequests rejects enqueues of requests whose deadline has already passed with ErrDeadlineAlreadyExceeded,
+	// rather than queuing requests which will be dropped when dequeued.
+	rejectExpiredRequests bool
+	// evictExpiredRequests drops requests past their deadline on dequeue rather than dispatching them,
+	// whatever the request ordering of their tenant; requests are always dropped under least-slack ordering.
+	evictExpiredRequests bool
+
+	// queryComponentQueues splits each tenant queue into a sub-queue per query component, see querycomponent.Component.
+	queryComponentQueues bool
+	// priorityClassMaxWait is how long the front request of a lower priority class sub-queue waits for the higher
+	// classes before it is dequeued ahead of them, see tenantPriorityClassOrder; 0 if lower classes wait indefinitely.
+	priorityClassMaxWait time.Duration
+
+	// trackInflight enables tracking of requests dispatched to queriers until they are completed.
+	// When enabled, callers are responsible for calling completeRequest for every dispatched request.
+	trackInflight    bool
+	inflightRequests map[*tenantRequest]inflightRequest
+	// number of inflight requests per tenant and per querier, maintained along with inflightRequests
+	inflightPerTenant  map[TenantID]int
+	inflightPerQuerier map[QuerierID]int
+	// estimated cost of the inflight requests of each querier, maintained along with inflightRequests
+	inflightCostPerQuerier map[QuerierID]int64
+	// querierCostBudget is the estimated cost of the inflight requests above which a querier is not dispatched
+	// further requests, see querierOverCostBudget; 0 disables the budget.
+	querierCostBudget int64
+	// recoverCrashedQuerierInflight re-enqueues the inflight requests of a querier which goes away
+	// without having notified a graceful shutdown, see recoverQuerierInflight.
+	recoverCrashedQuerierInflight bool
+	// querierOverloadFactor steers work off a querier whose inflight requests exceed this factor
+	// of the average inflight requests of the queriers in a tenant's shard; 0 disables rebalancing.
+	querierOverloadFactor float64
+	// priorityInversionAge steers a tenant's next request away from a querier holding a lower priority request
+	// dispatched at least this long ago, while a free querier of the tenant's shard can take it; 0 disables steering.
+	priorityInversionAge time.Duration
+	// inflightFullPolicy controls how enqueues are handled for a tenant which has reached its MaxInflight.
+	inflightFullPolicy inflightFullPolicy
+	// defaultDispatchTimeout is how long an inflight request may be held by a querier before it is
+	// reported as overdue, for tenants without a configured DispatchTimeout; 0 disables the deadline.
+	defaultDispatchTimeout time.Duration
+
+	// tenantRemovalPolicy controls whether a tenant is removed as soon as its queue empties,
+	// or is retained for tenantRemovalGracePeriod so that tenants which empty and refill
+	// constantly do not repeatedly get created, removed, and reshuffled.
+	tenantRemovalPolicy      tenantRemovalPolicy
+	tenantRemovalGracePeriod time.Duration
+	// idleShardCollapsePeriod is how long a tenant retained with an empty queue keeps its querier shard
+	// before the shard is collapsed, letting the tenant use all queriers until it is enqueued to again; 0 keeps the shard.
+	idleShardCollapsePeriod time.Duration
+	// shardExpansionWindow enables widening the shard of a tenant by shardExpansionStep queriers whenever its queue depth
+	// rose over this window while all queriers of its shard were busy, up to shardExpansionMaxQueriers queriers;
+	// 0 disables shard expansion.
+	shardExpansionWindow      time.Duration
+	shardExpansionStep        int
+	shardExpansionMaxQueriers int
+	// newQuerierBacklogTenants is the number of the most backlogged sharded tenants a newly connected querier
+	// is assigned to, in addition to the tenants shuffle sharding assigns it to; 0 leaves shuffle sharding alone.
+	newQuerierBacklogTenants int
+
+	// dedupMode controls how a request is handled when a request with the same key is already queued for the tenant.
+	dedupMode dedupMode
+	// dedupReplaceMovesToBack moves a replaced request to the back of the tenant queue
+	// instead of keeping the queue position of the request it replaces.
+	dedupReplaceMovesToBack bool
+	// frozenTenants holds the enqueues buffered for each frozen tenant, see freezeTenant;
+	// frozenEnqueuePolicy controls whether enqueues to frozen tenants are buffered or rejected.
+	frozenTenants       map[TenantID][]frozenEnqueue
+	frozenEnqueuePolicy frozenEnqueuePolicy
+	// errorBudgets holds the recent dispatch failures of the tenants configured with an error budget,
+	// and until when the tenants which exhausted it are paused; retained across tenant removal.
+	errorBudgets map[TenantID]*tenantErrorBudget
+	// backpressureLevel and tenantBackpressure are the fractions of dispatches held back for all tenants
+	// and for individual tenants, see setBackpressure.
+	backpressureLevel  float64
+	tenantBackpressure map[TenantID]float64
+
+	// tenantPreferredQueriers are the queriers the tenants' dequeues are routed to while available,
+	// see setTenantPreferredQuerier.
+	tenantPreferredQueriers map[TenantID]QuerierID
+
+	// trackTagDepths maintains the number of queued requests per request tag in queuedByTag, see depthByTag.
+	trackTagDepths bool
+	queuedByTag    map[string]int
+
+	// retryBoostInterval is how long a request re-enqueued after a failed dispatch must have been queued
+	// for each priority band it is boosted by; 0 does not boost retried requests.
+	retryBoostInterval time.Duration
+
+	// overflowBacklogThreshold is the queue depth above which a tenant is served by the overflow queriers,
+	// in addition to the queriers of its shard.
+	overflowBacklogThreshold int
+
+	// dedupMaxKeysPerTenant caps the number of deduplication keys tracked for a tenant;
+	// deduplication is disabled for a tenant whose keys would exceed it. 0 is uncapped.
+	dedupMaxKeysPerTenant int
+
+	// tenantHighWatermark and tenantLowWatermark are the tenant queue depths at which the observer
+	// is notified of a tenant backlog building up and clearing; a high watermark of 0 disables notifications.
+	tenantHighWatermark int
+	tenantLowWatermark  int
+	// enqueueBackpressureQueueLength is the tenant queue depth from which the observer is notified that the tenant
+	// is under enqueue backpressure, until its depth falls back to half of it; 0 disables enqueue backpressure.
+	enqueueBackpressureQueueLength int
+
+	// requestOrdering is the order of the queued requests of tenants which do not configure their own; empty orders by priority.
+	requestOrdering RequestOrdering
+	// sequence number of the next request enqueued to the back of any tenant queue
+	nextGlobalSeq uint64
+
+	// stripeTenantRequests stripes the stream of each tenant's requests across the queriers of its shard,
+	// instead of handing out the tenant's requests in FIFO order to whichever querier asks first.
+	stripeTenantRequests bool
+
+	// cacheKeyAffinityMaxWait enables routing requests with the same cache key to the same querier of the tenant's shard;
+	// other queriers of the shard take a request once it has been queued for this long. 0 disables cache key affinity.
+	cacheKeyAffinityMaxWait time.Duration
+
+	// dequeueFilter is the predicate of a filtered dequeue; nil unless a filtered dequeue is in progress.
+	dequeueFilter func(*tenantRequest) bool
+	// dequeueComponent is the query component of a dequeue for a querier worker reserved for it;
+	// empty unless such a dequeue is in progress.
+	dequeueComponent querycomponent.Component
+
+	// payloadSizer optionally measures the approximate size of request payloads on enqueue,
+	// in order to attribute the memory held by queued requests to tenants.
+	payloadSizer func(req Request) int64
+	// maxQueuedPayloadBytes is the memory ceiling on the payload of all queued requests, as measured by payloadSizer;
+	// globalMemoryPolicy controls how enqueues which would exceed it are handled. 0 disables the ceiling.
+	maxQueuedPayloadBytes int64
+	globalMemoryPolicy    globalMemoryPolicy
+	// payload of all queued requests, maintained along with the tenants' queued payload
+	queuedPayloadBytes int64
+
+	// classifier optionally derives the priority of requests on enqueue, e.g. from the headers they carry,
+	// overriding the priority they were enqueued with.
+	classifier func(req Request) int
+	// priorityBands is the number of priorities requests are enqueued with, from 0 to priorityBands-1;
+	// priorities out of range are clamped to the nearest band. 0 leaves request priorities unrestricted.
+	priorityBands int
+
+	// shardRerandomizeThreshold is the number of requests re-enqueued after failed dispatch
+	// which triggers re-randomizing the tenant's querier shard; 0 disables re-randomization.
+	shardRerandomizeThreshold int
+
+	// requests dequeued since the broker was created, in total and per tenant; retained across tenant removal
+	dequeuedTotal     uint64
+	dequeuedPerTenant map[TenantID]uint64
+	startedAt         time.Time
+
+	// recentDequeues optionally counts dequeued requests per tenant over a recent window,
+	// used to measure the fairness of the service tenants received.
+	recentDequeues *windowedTenantCounter
+	// recentEnqueues optionally counts requests enqueued per tenant over a recent window,
+	// used along with recentDequeues to detect tenants whose backlog is growing.
+	recentEnqueues *windowedTenantCounter
+
+	// tenantSelection is the strategy used to select the next tenant to dequeue a request from for a querier.
+	tenantSelection tenantSelectionStrategy
+	// tenantSelectionByWeights is set while the broker uses fair queuing tenant selection in place of round-robin
+	// selection only because some tenants have a weight other than 1, see setTenantWeight.
+	tenantSelectionByWeights bool
+	// rng is used by randomized tenant selection strategies, and to throttle dispatch under backpressure.
+	rng *rand.Rand
+	// fairQueuingSlots is the number of hashed slots holding the finish tags of tenants under fair queuing
+	// tenant selection, once the broker has more than fairQueuingExactTenants tenants; 0 uses the defaults.
+	fairQueuingSlots        int
+	fairQueuingExactTenants int
+	fairQueuing             fairQueuingTags
+	// tierReservedFraction is the fraction of dequeues reserved for lower SLO tiers under tiered tenant selection,
+	// while a higher tier also has queued requests; 0 lets higher tiers starve lower tiers.
+	tierReservedFraction float64
+	// dequeues made under tiered tenant selection while lower tiers had queued requests, and how many of them served lower tiers.
+	tierContendedDequeues uint64
+	tierLowerTierDequeues uint64
+	// position in the tenant order of the last tenant served a dequeue reserved for lower tiers
+	tierLowerTierIndex int
+
+	// maxDequeueBatchSize caps the number of requests a querier is dequeued by a single batch dequeue,
+	// whatever the batch size it asks for, so that no querier can grab the backlog of the others; 0 is unlimited.
+	maxDequeueBatchSize int
+
+	// maxBatchRequestsPerTenant caps the number of requests a single batch dequeue takes from any one tenant,
+	// so that a batch is spread across tenants even when one tenant dominates the backlog; 0 is unlimited.
+	maxBatchRequestsPerTenant int
+	// batchTenantDequeues counts the requests taken from each tenant by the batch dequeue in progress;
+	// nil unless a batch dequeue with a per-tenant cap is in progress.
+	batchTenantDequeues map[TenantID]int
+
+	// tenantStickiness is the maximum number of consecutive requests dequeued from a tenant under round-robin
+	// tenant selection before moving on to the next tenant, if the tenant still has queued requests;
+	// 0 moves on after every request.
+	tenantStickiness int
+	// tenant the broker last dequeued a request from, and the number of consecutive requests dequeued from it
+	stickyTenantID       TenantID
+	stickyTenantDequeues int
+
+	// reshuffleStormThreshold is the number of tenant shards computed by a single querier change,
+	// or the number of pending deferred reshuffles, which makes the broker shed enqueues with ErrSchedulerBusy
+	// for reshuffleStormBusyPeriod, until scheduling state stabilizes; 0 disables shedding.
+	reshuffleStormThreshold  int
+	reshuffleStormBusyPeriod time.Duration
+	busyUntil                time.Time
+
+	// connectionDebounce holds back the disconnects of querier connections for this long, and cancels them
+	// if the querier connects again in the meantime; 0 applies disconnects right away.
+	connectionDebounce   time.Duration
+	debouncedDisconnects map[QuerierID]*debouncedDisconnect
+
+	// validateQuerierID validates the querier IDs of registered connections; nil only rejects empty querier IDs.
+	validateQuerierID func(QuerierID) bool
+	// querierIDValidationPolicy controls whether the registration of an invalid querier ID is rejected with an error
+	// or logged and ignored.
+	querierIDValidationPolicy querierIDValidationPolicy
 }
 
 func newQueueBroker(maxTenantQueueSize int, forgetDelay time.Duration) *queueBroker {
-	return &queueBroker{
+	observer := &brokerObserver{}
+	qb := &queueBroker{
 		tenantQueuesTree: NewTreeQueue("root", maxTenantQueueSize),
 		tenantQuerierAssignments: tenantQuerierAssignments{
-			queriersByID:       map[QuerierID]*querierConn{},
-			querierIDsSorted:   nil,
-			querierForgetDelay: forgetDelay,
-			tenantIDOrder:      nil,
-			tenantsByID:        map[TenantID]*queueTenant{},
-			tenantQuerierIDs:   map[TenantID]map[QuerierID]struct{}{},
+			queriersByID:            map[QuerierID]*querierConn{},
+			querierIDsSorted:        nil,
+			querierForgetDelay:      forgetDelay,
+			tenantIDOrder:           nil,
+			tenantsByID:             map[TenantID]*queueTenant{},
+			tenantQuerierIDs:        map[TenantID]map[QuerierID]struct{}{},
+			querierTenantIDs:        map[QuerierID]map[TenantID]struct{}{},
+			unshardedTenantIDs:      map[TenantID]struct{}{},
+			tenantConfigs:           map[TenantID]TenantConfig{},
+			pendingTenantReshuffles: map[TenantID]struct{}{},
+			tenantShardFailures:     map[TenantID]*tenantShardFailures{},
+			pinnedTenantShards:      map[TenantID]map[QuerierID]struct{}{},
+			observer:                observer,
 		},
-		maxTenantQueueSize: maxTenantQueueSize,
+		maxTenantQueueSize:     maxTenantQueueSize,
+		observer:               observer,
+		inflightRequests:       map[*tenantRequest]inflightRequest{},
+		inflightPerTenant:      map[TenantID]int{},
+		inflightPerQuerier:     map[QuerierID]int{},
+		inflightCostPerQuerier: map[QuerierID]int64{},
+		dequeuedPerTenant:      map[TenantID]uint64{},
+		rng:                    rand.New(rand.NewSource(time.Now().UnixNano())),
+		tierLowerTierIndex:     -1,
 	}
+	qb.setClock(realClock{})
+	qb.tenantQuerierAssignments.now = func() time.Time { return qb.clock.Now() }
+	return qb
 }
 
 func (qb *queueBroker) isEmpty() bool {
@@ -131,17 +568,105 @@ func (qb *queueBroker) isEmpty() bool {
 //
 // Tenants and tenant-querier shuffle sharding relationships are managed internally as needed.
 func (qb *queueBroker) enqueueRequestBack(request *tenantRequest, tenantMaxQueriers int) error {
+	if qb.observer.OnEnqueueLatency != nil {
+		start := qb.clock.Now()
+		defer func() {
+			qb.observer.OnEnqueueLatency(request.tenantID, qb.clock.Now().Sub(start))
+		}()
+	}
+
+	if held, err := qb.holdFrozenEnqueue(request, tenantMaxQueriers, false); held {
+		return err
+	}
+	if qb.requestDeadlineExceeded(request, qb.clock.Now()) {
+		return ErrDeadlineAlreadyExceeded
+	}
+	if qb.schedulerBusy(qb.clock.Now()) {
+		return ErrSchedulerBusy
+	}
+	if qb.inflightFullPolicy == inflightFullReject && qb.tenantAtInflightCap(request.tenantID) {
+		return ErrTenantInflightFull
+	}
+
 	err := qb.tenantQuerierAssignments.createOrUpdateTenant(request.tenantID, tenantMaxQueriers)
 	if err != nil {
 		return err
 	}
 
-	queuePath := QueuePath{string(request.tenantID)}
-	err = qb.tenantQueuesTree.EnqueueBackByPath(queuePath, request)
-	if errors.Is(err, ErrMaxQueueLengthExceeded) {
-		return errors.Join(err, ErrTooManyRequests)
+	tenant := qb.tenantQuerierAssignments.tenantsByID[request.tenantID]
+	tenant.emptySince = time.Time{}
+
+	if qb.payloadSizer != nil {
+		request.payloadBytes = qb.payloadSizer(request.req)
+	}
+	if qb.classifier != nil {
+		request.priority = qb.classifier(request.req)
 	}
-	return err
+	request.priority = qb.priorityBand(tenant, request.priority)
+	if err := qb.admitUnderReservedCapacity(tenant, request); err != nil {
+		if qb.tenantQueuesTree.getNode(QueuePath{string(request.tenantID)}) == nil {
+			// do not leave behind a tenant created for the rejected request
+			qb.onTenantQueueEmptied(tenant, qb.clock.Now())
+		}
+		return err
+	}
+	request.enqueueTime = qb.clock.Now()
+	request.seq = tenant.nextSeq
+	tenant.nextSeq++
+	request.globalSeq = qb.nextGlobalSeq
+	qb.nextGlobalSeq++
+	if qb.recorder != nil {
+		qb.recorder.record(Event{
+			Type:          EventEnqueue,
+			TenantID:      request.tenantID,
+			MaxQueriers:   tenantMaxQueriers,
+			Seq:           request.seq,
+			PriorityClass: request.class,
+			Priority:      request.priority,
+			Key:           request.key,
+			CacheKey:      request.cacheKey,
+			PayloadBytes:  request.payloadBytes,
+		})
+	}
+	if err := qb.admitUnderMemoryCeiling(request); err != nil {
+		if qb.tenantQueuesTree.getNode(QueuePath{string(request.tenantID)}) == nil {
+			// do not leave behind a tenant created for the rejected request
+			qb.onTenantQueueEmptied(tenant, qb.clock.Now())
+		}
+		return err
+	}
+	if qb.replaceQueuedDuplicate(tenant, request) || qb.coalesceQueuedDuplicate(tenant, request) {
+		return nil
+	}
+
+	queuePath := qb.requestQueuePath(request)
+	if qb.tenantQueueFull(request.tenantID) {
+		err = ErrMaxQueueLengthExceeded
+	} else {
+		err = qb.tenantQueuesTree.EnqueueBackByPath(queuePath, request)
+	}
+	if err != nil {
+		if errors.Is(err, ErrMaxQueueLengthExceeded) {
+			qb.publish(BrokerEvent{Type: BrokerEventQueueFull, TenantID: request.tenantID})
+			return errors.Join(err, ErrTooManyRequests)
+		}
+		return err
+	}
+	qb.placeRequest(tenant, queuePath, qb.tenantQueuesTree.getNode(queuePath).localQueue.Back())
+	qb.tenantQuerierAssignments.setTenantHasQueuedRequests(tenant, true)
+	tenant.queuedPayloadBytes += request.payloadBytes
+	qb.queuedPayloadBytes += request.payloadBytes
+	qb.countQueuedTags(request, 1)
+	qb.countQueuedComponent(tenant, request, 1)
+	qb.trackQueuedKey(tenant, request)
+	qb.checkTenantWatermarks(tenant)
+	qb.checkTenantEnqueueBackpressure(tenant)
+	qb.recordPeakDepth(tenant)
+	qb.updateTenantOverflowBacklog(tenant)
+	if qb.recentEnqueues != nil {
+		qb.recentEnqueues.add(tenant.tenantID, 1, qb.clock.Now())
+	}
+	return nil
 }
 
 // enqueueRequestFront should only be used for re-enqueueing previously dequeued requests
@@ -150,53 +675,260 @@ func (qb *queueBroker) enqueueRequestBack(request *tenantRequest, tenantMaxQueri
 // max tenant queue size checks are skipped even though queue size violations
 // are not expected to occur when re-enqueuing a previously dequeued request.
 func (qb *queueBroker) enqueueRequestFront(request *tenantRequest, tenantMaxQueriers int) error {
+	if held, err := qb.holdFrozenEnqueue(request, tenantMaxQueriers, true); held {
+		return err
+	}
+	if qb.recorder != nil {
+		qb.recorder.record(Event{Type: EventEnqueueFront, TenantID: request.tenantID, MaxQueriers: tenantMaxQueriers, Seq: request.seq})
+	}
 	err := qb.tenantQuerierAssignments.createOrUpdateTenant(request.tenantID, tenantMaxQueriers)
 	if err != nil {
 		return err
 	}
 
-	queuePath := QueuePath{string(request.tenantID)}
-	return qb.tenantQueuesTree.EnqueueFrontByPath(queuePath, request)
+	tenant := qb.tenantQuerierAssignments.tenantsByID[request.tenantID]
+	tenant.emptySince = time.Time{}
+	qb.recordDispatchFailure(tenant.tenantID)
+	qb.spendErrorBudget(tenant.tenantID, qb.clock.Now())
+
+	// the request is no longer in flight once it is back in the queue
+	qb.untrackInflight(request)
+	qb.boostRetriedRequest(tenant, request)
+
+	queuePath := qb.requestQueuePath(request)
+	err = qb.tenantQueuesTree.EnqueueFrontByPath(queuePath, request)
+	if err != nil {
+		return err
+	}
+	qb.placeRequest(tenant, queuePath, qb.tenantQueuesTree.getNode(queuePath).localQueue.Front())
+	qb.tenantQuerierAssignments.setTenantHasQueuedRequests(tenant, true)
+	tenant.queuedPayloadBytes += request.payloadBytes
+	qb.queuedPayloadBytes += request.payloadBytes
+	qb.countQueuedTags(request, 1)
+	qb.countQueuedComponent(tenant, request, 1)
+	qb.trackQueuedKey(tenant, request)
+	qb.checkTenantWatermarks(tenant)
+	qb.checkTenantEnqueueBackpressure(tenant)
+	qb.recordPeakDepth(tenant)
+	qb.updateTenantOverflowBacklog(tenant)
+	return nil
 }
 
 func (qb *queueBroker) dequeueRequestForQuerier(lastTenantIndex int, querierID QuerierID) (*tenantRequest, *queueTenant, int, error) {
-	tenant, tenantIndex, err := qb.tenantQuerierAssignments.getNextTenantForQuerier(lastTenantIndex, querierID)
+	querierID = qb.logicalQuerierID(querierID)
+	if qb.recorder != nil {
+		qb.recorder.record(Event{Type: EventDequeue, QuerierID: querierID, LastTenantIndex: lastTenantIndex})
+	}
+	for {
+		request, tenant, tenantIndex, err := qb.dequeueQueuedRequestForQuerier(lastTenantIndex, querierID)
+		if request == nil {
+			return nil, tenant, tenantIndex, err
+		}
+		if qb.dropExpiredRequest(tenant, request, qb.clock.Now()) {
+			// serve the querier another request instead, from the same tenant if it has any left
+			continue
+		}
+
+		if qb.recentDequeues != nil {
+			qb.recentDequeues.add(tenant.tenantID, 1, qb.clock.Now())
+		}
+		qb.recordStickyTenantDequeue(tenant.tenantID)
+		qb.dequeuedTotal++
+		qb.dequeuedPerTenant[tenant.tenantID]++
+		qb.chargeFairQueuing(tenant.tenantID)
+		qb.tenantQuerierAssignments.queriersByID[querierID].lastDequeueAt = qb.clock.Now()
+		if qb.trackInflight {
+			qb.trackInflightRequest(request, qb.newInflightRequest(tenant.tenantID, querierID, qb.clock.Now()))
+		}
+		return request, tenant, tenantIndex, nil
+	}
+}
+
+// dequeueQueuedRequestForQuerier selects the tenant and takes the request to dequeue for the querier
+// off the tenant queue, leaving the caller to account for the request being dispatched.
+func (qb *queueBroker) dequeueQueuedRequestForQuerier(lastTenantIndex int, querierID QuerierID) (*tenantRequest, *queueTenant, int, error) {
+	tenant, tenantIndex, err := qb.getNextTenantWithRequestsForQuerier(lastTenantIndex, querierID)
 	if tenant == nil || err != nil {
 		return nil, tenant, tenantIndex, err
 	}
 
 	queuePath := QueuePath{string(tenant.tenantID)}
-	queueElement := qb.tenantQueuesTree.DequeueByPath(queuePath)
+	var queueElement any
+	match, frontIfNoMatch := qb.requestMatcherForQuerier(tenant, querierID)
+	if match != nil {
+		queueElement = qb.dequeueMatchingFromTenantQueue(tenant.tenantID, match)
+	}
+	if match == nil || (queueElement == nil && frontIfNoMatch) {
+		queueElement = qb.dequeueFrontOfTenantQueue(tenant.tenantID)
+	}
 
 	queueNodeAfterDequeue := qb.tenantQueuesTree.getNode(queuePath)
+	qb.checkTenantWatermarks(tenant)
+	qb.checkTenantEnqueueBackpressure(tenant)
+	qb.updateTenantOverflowBacklog(tenant)
 	if queueNodeAfterDequeue == nil {
 		// queue node was deleted due to being empty after dequeue
-		qb.tenantQuerierAssignments.removeTenant(tenant.tenantID)
+		qb.tenantQuerierAssignments.setTenantHasQueuedRequests(tenant, false)
+		qb.onTenantQueueEmptied(tenant, qb.clock.Now())
 	}
 
 	var request *tenantRequest
 	if queueElement != nil {
 		// re-casting to same type it was enqueued as; panic would indicate a bug
 		request = queueElement.(*tenantRequest)
+		tenant.queuedPayloadBytes -= request.payloadBytes
+		qb.queuedPayloadBytes -= request.payloadBytes
+		qb.countQueuedTags(request, -1)
+		qb.countQueuedComponent(tenant, request, -1)
+		qb.untrackQueuedKey(tenant, request)
 	}
 
 	return request, tenant, tenantIndex, nil
 }
 
-func (qb *queueBroker) addQuerierConnection(querierID QuerierID) {
+// requestMatcherForQuerier returns the predicate matching which of the tenant's requests is dequeued for the querier,
+// the first matching request in queue order being dequeued, and whether the request at the front of the tenant queue
+// is dequeued if none matches. A nil predicate dequeues the request at the front of the tenant queue.
+func (qb *queueBroker) requestMatcherForQuerier(tenant *queueTenant, querierID QuerierID) (match func(v any) bool, frontIfNoMatch bool) {
+	strict := qb.tenantRequestOrdering(tenant) == RequestOrderingStrict
+	switch {
+	case qb.dequeueFilter != nil:
+		return qb.acceptedRequestMatcher(tenant, querierID), false
+	case qb.dequeueComponent != "":
+		if qb.queryComponentQueues && qb.cacheKeyAffinityMaxWait <= 0 {
+			// the front of the component's sub-queue is dequeued, see dequeueFrontOfTenantQueue
+			return nil, true
+		}
+		return qb.acceptedRequestMatcher(tenant, querierID), false
+	case qb.stripeTenantRequests && !strict:
+		return qb.stripedRequestMatcher(tenant, querierID), true
+	case qb.cacheKeyAffinityMaxWait > 0 && !strict:
+		return qb.cacheAffineRequestMatcher(tenant, querierID), true
+	}
+	return nil, true
+}
+
+// getNextTenantWithRequestsForQuerier rotates through the tenants assigned to the querier
+// as getNextTenantForQuerier does, skipping tenants which have no queued requests
+// or which should not be dispatched to the querier due to inflight limits.
+//
+// Tenants without queued requests are only present in the tenant order when they are
+// retained by the lazy tenant removal policy; such tenants are removed here once expired.
+func (qb *queueBroker) getNextTenantWithRequestsForQuerier(lastTenantIndex int, querierID QuerierID) (*queueTenant, int, error) {
+	if tenant := qb.preferredTenantForQuerier(querierID); tenant != nil {
+		return tenant, tenant.orderIndex, nil
+	}
+
+	switch {
+	case qb.tenantQuerierAssignments.isOverflowQuerier(querierID):
+		// overflow queriers rotate through the backlogged tenants whatever the tenant selection
+	case qb.tenantSelection == tenantSelectionWeightedRandom:
+		return qb.getWeightedRandomTenantWithRequestsForQuerier(lastTenantIndex, querierID)
+	case qb.tenantSelection == tenantSelectionTiered:
+		return qb.getTieredTenantWithRequestsForQuerier(lastTenantIndex, querierID)
+	case qb.tenantSelection == tenantSelectionFairQueuing:
+		return qb.getFairQueuingTenantWithRequestsForQuerier(lastTenantIndex, querierID)
+	}
+
+	if tenant := qb.stickyTenantForQuerier(querierID); tenant != nil {
+		return tenant, tenant.orderIndex, nil
+	}
+
+	tqa := &qb.tenantQuerierAssignments
+	tenantIndex := lastTenantIndex
+	var firstTenant *queueTenant
+	// each tenant in the order is visited at most once
+	for iters := 0; iters == 0 || iters < len(tqa.tenantIDOrder); iters++ {
+		tenant, nextTenantIndex, err := tqa.getNextTenantForQuerier(tenantIndex, querierID)
+		if tenant == nil || err != nil {
+			return tenant, nextTenantIndex, err
+		}
+		if tenant == firstTenant {
+			// visited all the tenants assigned to the querier
+			break
+		}
+		if firstTenant == nil {
+			firstTenant = tenant
+		}
+		if qb.tenantQueuesTree.getNode(QueuePath{string(tenant.tenantID)}) == nil {
+			tqa.traceSkip(tenant.tenantID, SkipEmpty)
+			qb.removeTenantIfIdleExpired(tenant, qb.clock.Now())
+		} else if cause := qb.tenantDispatchBlocker(tenant.tenantID, querierID); cause == "" {
+			return tenant, nextTenantIndex, nil
+		} else {
+			tqa.traceSkip(tenant.tenantID, cause)
+		}
+		tenantIndex = nextTenantIndex
+	}
+	return nil, lastTenantIndex, nil
+}
+
+// addQuerierConnection registers a connection of the querier, or returns ErrInvalidQuerierID if the querier ID
+// is rejected under the strict querier ID validation policy.
+func (qb *queueBroker) addQuerierConnection(querierID QuerierID) error {
+	if ok, err := qb.admitQuerierID(querierID); !ok {
+		return err
+	}
+	querierID = qb.logicalQuerierID(querierID)
+	defer qb.detectReshuffleStorm(qb.tenantQuerierAssignments.tenantShuffles)
+	qb.recorder.record(Event{Type: EventConnect, QuerierID: querierID})
+	if qb.cancelDebouncedDisconnect(querierID) {
+		return nil
+	}
+	_, known := qb.tenantQuerierAssignments.queriersByID[querierID]
 	qb.tenantQuerierAssignments.addQuerierConnection(querierID)
+	if !known {
+		qb.assignNewQuerierToBackloggedTenants(querierID)
+	}
+	if querier := qb.tenantQuerierAssignments.queriersByID[querierID]; querier.lastDequeueAt.IsZero() {
+		querier.lastDequeueAt = qb.clock.Now()
+	}
+	return nil
 }
 
 func (qb *queueBroker) removeQuerierConnection(querierID QuerierID, now time.Time) {
+	if qb.rejectsQuerierID(querierID) {
+		return
+	}
+	querierID = qb.logicalQuerierID(querierID)
+	defer qb.detectReshuffleStorm(qb.tenantQuerierAssignments.tenantShuffles)
+	qb.recorder.record(Event{Type: EventDisconnect, Time: now, QuerierID: querierID})
+	if qb.debounceQuerierDisconnect(querierID, now) {
+		return
+	}
+	qb.disconnectQuerierConnection(querierID, now)
+}
+
+// disconnectQuerierConnection applies the disconnect of one of the querier's connections.
+func (qb *queueBroker) disconnectQuerierConnection(querierID QuerierID, now time.Time) {
+	crashed := qb.crashedQuerierCandidates(querierID)
 	qb.tenantQuerierAssignments.removeQuerierConnection(querierID, now)
+	qb.recoverCrashedQueriers(crashed)
 }
 
 func (qb *queueBroker) notifyQuerierShutdown(querierID QuerierID) {
+	if qb.rejectsQuerierID(querierID) {
+		return
+	}
+	querierID = qb.logicalQuerierID(querierID)
+	defer qb.detectReshuffleStorm(qb.tenantQuerierAssignments.tenantShuffles)
+	qb.recorder.record(Event{Type: EventShutdown, QuerierID: querierID})
+	qb.applyDebouncedDisconnect(querierID)
 	qb.tenantQuerierAssignments.notifyQuerierShutdown(querierID)
 }
 
+// forgetDisconnectedQueriers applies the disconnects debounced for long enough, forgets the queriers disconnected
+// for longer than the querier forget delay, and updates the queriers forgotten by the tenants configured with
+// their own ForgetDelay. Returns the number of queriers disconnected or forgotten and of tenants reshuffled,
+// which is positive if any shard changed.
 func (qb *queueBroker) forgetDisconnectedQueriers(now time.Time) int {
-	return qb.tenantQuerierAssignments.forgetDisconnectedQueriers(now)
+	defer qb.detectReshuffleStorm(qb.tenantQuerierAssignments.tenantShuffles)
+	qb.recorder.record(Event{Type: EventForgetQueriers, Time: now})
+	disconnected := qb.applyDebouncedDisconnects(now)
+	crashed := qb.crashedQuerierCandidates()
+	forgotten := qb.tenantQuerierAssignments.forgetDisconnectedQueriers(now)
+	qb.recoverCrashedQueriers(crashed)
+	return disconnected + forgotten + qb.tenantQuerierAssignments.forgetTenantDisconnectedQueriers(now)
 }
 
 // getNextTenantForQuerier gets the next tenant in the tenant order assigned to a given querier.
@@ -209,7 +941,23 @@ func (tqa *tenantQuerierAssignments) getNextTenantForQuerier(lastTenantIndex int
 	// check if querier is registered and is not shutting down
 	if q := tqa.queriersByID[querierID]; q == nil || q.shuttingDown {
 		return nil, lastTenantIndex, ErrQuerierShuttingDown
+	} else if q.overflow {
+		tenant, tenantOrderIndex := tqa.overflowNextTenantForQuerier(lastTenantIndex)
+		return tenant, tenantOrderIndex, nil
+	}
+	if tqa.idleQuerierFastPath && tqa.querierHasNoQueuedRequests(querierID) {
+		return nil, lastTenantIndex, nil
 	}
+	if tqa.dequeueTrace == nil && tqa.useQuerierTenantIndex(querierID) {
+		tenant, tenantOrderIndex := tqa.indexedNextTenantForQuerier(lastTenantIndex, querierID)
+		return tenant, tenantOrderIndex, nil
+	}
+	tenant, tenantOrderIndex := tqa.scanNextTenantForQuerier(lastTenantIndex, querierID)
+	return tenant, tenantOrderIndex, nil
+}
+
+// scanNextTenantForQuerier finds the next tenant assigned to the querier by scanning the tenant order.
+func (tqa *tenantQuerierAssignments) scanNextTenantForQuerier(lastTenantIndex int, querierID QuerierID) (*queueTenant, int) {
 	tenantOrderIndex := lastTenantIndex
 	for iters := 0; iters < len(tqa.tenantIDOrder); iters++ {
 		tenantOrderIndex++
@@ -231,14 +979,15 @@ func (tqa *tenantQuerierAssignments) getNextTenantForQuerier(lastTenantIndex int
 		tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]
 		if tenantQuerierSet == nil {
 			// tenant can use all queriers
-			return tenant, tenantOrderIndex, nil
+			return tenant, tenantOrderIndex
 		} else if _, ok := tenantQuerierSet[querierID]; ok {
 			// tenant is assigned this querier
-			return tenant, tenantOrderIndex, nil
+			return tenant, tenantOrderIndex
 		}
+		tqa.traceSkip(tenantID, SkipNotInShard)
 	}
 
-	return nil, lastTenantIndex, nil
+	return nil, lastTenantIndex
 }
 
 func (tqa *tenantQuerierAssignments) getTenant(tenantID TenantID) (*queueTenant, error) {
@@ -262,6 +1011,9 @@ func (tqa *tenantQuerierAssignments) createOrUpdateTenant(tenantID TenantID, max
 	if maxQueriers < 0 {
 		maxQueriers = 0
 	}
+	if err := tqa.validatePriorityBands(tqa.tenantConfigs[tenantID].PriorityBands); err != nil {
+		return err
+	}
 
 	tenant := tqa.tenantsByID[tenantID]
 
@@ -271,39 +1023,57 @@ func (tqa *tenantQuerierAssignments) createOrUpdateTenant(tenantID TenantID, max
 			// maxQueriers 0 enables a later check to trigger tenant-querier assignment
 			// for new queue tenants with shuffle sharding enabled
 			maxQueriers:      0,
-			shuffleShardSeed: util.ShuffleShardSeed(string(tenantID), ""),
+			shuffleShardSeed: tqa.shuffleShardSeed(tenantID),
 			// orderIndex set to sentinel value to indicate it is not inserted yet
 			orderIndex: -1,
 		}
-		for i, id := range tqa.tenantIDOrder {
-			if id == emptyTenantID {
-				// previously removed tenant not yet cleaned up; take its place
-				tenant.orderIndex = i
-				tqa.tenantIDOrder[i] = tenantID
-				tqa.tenantsByID[tenantID] = tenant
-				break
-			}
-		}
-
-		if tenant.orderIndex < 0 {
-			// there were no empty spaces in tenant order; append
-			tenant.orderIndex = len(tqa.tenantIDOrder)
-			tqa.tenantIDOrder = append(tqa.tenantIDOrder, tenantID)
-			tqa.tenantsByID[tenantID] = tenant
-		}
+		tqa.insertTenantInOrder(tenant)
+		tqa.tenantsByID[tenantID] = tenant
+		// new tenants can use all queriers until they are sharded
+		tqa.unshardedTenantIDs[tenantID] = struct{}{}
+		tqa.publish(BrokerEvent{Type: BrokerEventTenantAdded, TenantID: tenantID})
 	}
 
 	// tenant now either retrieved or created
+	tenant.tier = tqa.tenantConfigs[tenantID].Tier
+	tenant.priorityBands = tqa.tenantConfigs[tenantID].PriorityBands
+	tenant.requestOrdering = tqa.tenantConfigs[tenantID].RequestOrdering
+
+	if maxQueriers > 0 {
+		maxQueriers += tenant.shardExpansion
+	}
+
 	if tenant.maxQueriers != maxQueriers {
 		// tenant queriers need to be computed/recomputed;
 		// either this is a new tenant with sharding enabled,
 		// or the tenant already existed but its maxQueriers has changed
 		tenant.maxQueriers = maxQueriers
+		if tqa.deferTenantReshuffle {
+			// keep serving the tenant with its previous shard until the reshuffle is applied
+			tqa.pendingTenantReshuffles[tenantID] = struct{}{}
+			return nil
+		}
 		tqa.shuffleTenantQueriers(tenantID, nil)
 	}
 	return nil
 }
 
+// insertTenantInOrder gives the tenant a slot in the tenant order.
+func (tqa *tenantQuerierAssignments) insertTenantInOrder(tenant *queueTenant) {
+	for i, id := range tqa.tenantIDOrder {
+		if id == emptyTenantID {
+			// previously removed tenant not yet cleaned up; take its place
+			tenant.orderIndex = i
+			tqa.tenantIDOrder[i] = tenant.tenantID
+			return
+		}
+	}
+
+	// there were no empty spaces in tenant order; append
+	tenant.orderIndex = len(tqa.tenantIDOrder)
+	tqa.tenantIDOrder = append(tqa.tenantIDOrder, tenant.tenantID)
+}
+
 func (tqa *tenantQuerierAssignments) addQuerierConnection(querierID QuerierID) {
 	querier := tqa.queriersByID[querierID]
 	if querier != nil {
@@ -312,14 +1082,19 @@ func (tqa *tenantQuerierAssignments) addQuerierConnection(querierID QuerierID) {
 		// Reset in case the querier re-connected while it was in the forget waiting period.
 		querier.shuttingDown = false
 		querier.disconnectedAt = time.Time{}
+		if querier.connections == 1 {
+			tqa.restoreForgottenQuerier(querierID)
+			tqa.publish(BrokerEvent{Type: BrokerEventQuerierConnected, QuerierID: querierID})
+		}
 
 		return
 	}
 
 	// First connection from this querier.
-	tqa.queriersByID[querierID] = &querierConn{connections: 1}
+	tqa.queriersByID[querierID] = &querierConn{connections: 1, lastTenantIndex: -1}
 	tqa.querierIDsSorted = append(tqa.querierIDsSorted, querierID)
 	sort.Sort(tqa.querierIDsSorted)
+	tqa.publish(BrokerEvent{Type: BrokerEventQuerierConnected, QuerierID: querierID})
 
 	tqa.recomputeTenantQueriers()
 }
@@ -329,14 +1104,24 @@ func (tqa *tenantQuerierAssignments) removeTenant(tenantID TenantID) {
 	if tenant == nil {
 		return
 	}
+	tqa.setTenantHasQueuedRequests(tenant, false)
 	delete(tqa.tenantsByID, tenantID)
-	tqa.tenantIDOrder[tenant.orderIndex] = emptyTenantID
+	tqa.clearTenantOrderSlot(tenant)
+	tqa.setTenantQuerierIDs(tenantID, nil)
+	delete(tqa.tenantQuerierIDs, tenantID)
+	delete(tqa.unshardedTenantIDs, tenantID)
+	delete(tqa.pendingTenantReshuffles, tenantID)
+	tqa.shrinkTenantOrder()
+	tqa.publish(BrokerEvent{Type: BrokerEventTenantRemoved, TenantID: tenantID})
+}
 
-	// Shrink tenant list if possible by removing empty tenant IDs.
-	// We remove only from the end; removing from the middle would re-index all tenant IDs
-	// and skip tenants when starting iteration from a querier-provided lastTenantIndex.
-	// Empty tenant IDs stuck in the middle of the slice are handled
-	// by replacing them when a new tenant ID arrives in the queue.
+// shrinkTenantOrder shrinks the tenant list if possible by removing empty tenant IDs.
+//
+// We remove only from the end; removing from the middle would re-index all tenant IDs
+// and skip tenants when starting iteration from a querier-provided lastTenantIndex.
+// Empty tenant IDs stuck in the middle of the slice are handled
+// by replacing them when a new tenant ID arrives in the queue.
+func (tqa *tenantQuerierAssignments) shrinkTenantOrder() {
 	for i := len(tqa.tenantIDOrder) - 1; i >= 0 && tqa.tenantIDOrder[i] == emptyTenantID; i-- {
 		tqa.tenantIDOrder = tqa.tenantIDOrder[:i]
 	}
@@ -353,6 +1138,7 @@ func (tqa *tenantQuerierAssignments) removeQuerierConnection(querierID QuerierID
 	if querier.connections > 0 {
 		return
 	}
+	tqa.publish(BrokerEvent{Type: BrokerEventQuerierDisconnected, QuerierID: querierID})
 
 	// There no more active connections. If the forget delay is configured then
 	// we can remove it only if querier has announced a graceful shutdown.
@@ -368,6 +1154,11 @@ func (tqa *tenantQuerierAssignments) removeQuerierConnection(querierID QuerierID
 }
 
 func (tqa *tenantQuerierAssignments) removeQuerier(querierID QuerierID) {
+	if querier := tqa.queriersByID[querierID]; querier != nil && querier.overflow {
+		// overflow queriers are not part of any shard
+		delete(tqa.queriersByID, querierID)
+		return
+	}
 	delete(tqa.queriersByID, querierID)
 
 	ix := tqa.querierIDsSorted.Search(querierID)
@@ -422,35 +1213,60 @@ func (tqa *tenantQuerierAssignments) forgetDisconnectedQueriers(now time.Time) i
 }
 
 func (tqa *tenantQuerierAssignments) recomputeTenantQueriers() {
+	// the scratchpad is allocated by the first shuffle and reused by the following ones
 	var scratchpad querierIDSlice
 	for tenantID, tenant := range tqa.tenantsByID {
-		if tenant.maxQueriers > 0 && tenant.maxQueriers < len(tqa.querierIDsSorted) && scratchpad == nil {
-			// shuffle sharding is enabled and the number of queriers exceeds tenant maxQueriers,
-			// meaning tenant querier assignments need computed via shuffle sharding;
-			// allocate the scratchpad the first time this case is hit and it will be reused after
-			scratchpad = make(querierIDSlice, 0, len(tqa.querierIDsSorted))
+		wasSharded := tqa.tenantQuerierIDs[tenantID] != nil
+		scratchpad = tqa.shuffleTenantQueriers(tenantID, scratchpad)
+		if wasSharded && tqa.tenantQuerierIDs[tenantID] == nil && tenant.maxQueriers > 0 && !tqa.shardingDisabled {
+			// the number of queriers shrank to or below the tenant's max queriers
+			tqa.observer.tenantUnsharded(tenantID)
 		}
-
-		tqa.shuffleTenantQueriers(tenantID, scratchpad)
 	}
 }
 
-func (tqa *tenantQuerierAssignments) shuffleTenantQueriers(tenantID TenantID, scratchpad querierIDSlice) {
+// shuffleTenantQueriers computes the tenant's querier shard, shuffling the queriers in scratchpad,
+// and returns the scratchpad for the next shuffle to reuse; it is allocated if it is too small.
+func (tqa *tenantQuerierAssignments) shuffleTenantQueriers(tenantID TenantID, scratchpad querierIDSlice) querierIDSlice {
 	tenant := tqa.tenantsByID[tenantID]
 	if tenant == nil {
-		return
+		return scratchpad
 	}
+	delete(tqa.pendingTenantReshuffles, tenantID)
 
-	if tenant.maxQueriers == 0 || len(tqa.querierIDsSorted) <= tenant.maxQueriers {
+	if pinned, ok := tqa.pinnedTenantShards[tenantID]; ok {
+		tqa.setTenantQuerierIDs(tenantID, tqa.livePinnedQuerierIDs(pinned))
+		return scratchpad
+	}
+
+	shardingQuerierIDs := tqa.tenantShardingQuerierIDs(tenant)
+	if tqa.shardingDisabled || tenant.maxQueriers == 0 || len(shardingQuerierIDs) <= tenant.maxQueriers {
 		// shuffle shard is either disabled or calculation is unnecessary
-		tqa.tenantQuerierIDs[tenantID] = nil
-		return
+		tqa.setTenantQuerierIDs(tenantID, nil)
+		return scratchpad
+	}
+
+	if tqa.exceedsAssignmentMemoryLimit(tenantID, tenant.maxQueriers) {
+		// coarser sharding: the tenant can use all queriers rather than growing the assignment maps
+		tqa.setTenantQuerierIDs(tenantID, nil)
+		return scratchpad
+	}
+	if !tqa.admitShardedTenant(tenantID) {
+		tqa.setTenantQuerierIDs(tenantID, nil)
+		return scratchpad
 	}
 
+	tqa.tenantShuffles++
 	querierIDSet := make(map[QuerierID]struct{}, tenant.maxQueriers)
 	rnd := rand.New(rand.NewSource(tenant.shuffleShardSeed))
 
-	scratchpad = append(scratchpad[:0], tqa.querierIDsSorted...)
+	if cap(scratchpad) < len(shardingQuerierIDs) {
+		// append allocates a new scratchpad
+		tqa.shuffleScratchpadAllocs++
+	} else {
+		tqa.shuffleScratchpadReuses++
+	}
+	scratchpad = append(scratchpad[:0], shardingQuerierIDs...)
 
 	last := len(scratchpad) - 1
 	for i := 0; i < tenant.maxQueriers; i++ {
@@ -460,5 +1276,44 @@ func (tqa *tenantQuerierAssignments) shuffleTenantQueriers(tenantID TenantID, sc
 		scratchpad[r], scratchpad[last] = scratchpad[last], scratchpad[r]
 		last--
 	}
-	tqa.tenantQuerierIDs[tenantID] = querierIDSet
+	tqa.setTenantQuerierIDs(tenantID, querierIDSet)
+	return scratchpad
+}
+
+// setTenantQuerierIDs assigns the tenant querier ID set, maintaining the counts of sharded tenants and their querier IDs,
+// and the querier to tenant reverse index.
+func (tqa *tenantQuerierAssignments) setTenantQuerierIDs(tenantID TenantID, querierIDs map[QuerierID]struct{}) {
+	if tqa.tenantsByID[tenantID] != nil && shardChanged(tqa.tenantQuerierIDs[tenantID], querierIDs) {
+		// the removal of a tenant is not a change of its shard
+		tqa.recordShardChurn(tenantID)
+		tqa.publish(BrokerEvent{Type: BrokerEventTenantReshuffled, TenantID: tenantID})
+	}
+	tqa.updateQuerierTenantIndex(tenantID, tqa.tenantQuerierIDs[tenantID], querierIDs)
+	tqa.updateTenantsWithQueuedRequests(tenantID, tqa.tenantQuerierIDs[tenantID], querierIDs)
+	if current := tqa.tenantQuerierIDs[tenantID]; current != nil {
+		tqa.shardedTenantCount--
+		tqa.shardedQuerierEntries -= len(current)
+	}
+	if querierIDs != nil {
+		tqa.shardedTenantCount++
+		tqa.shardedQuerierEntries += len(querierIDs)
+	}
+	if querierIDs == nil {
+		// a missing entry is equivalent to a nil set; only sharded tenants hold an entry in the map
+		delete(tqa.tenantQuerierIDs, tenantID)
+		return
+	}
+	tqa.tenantQuerierIDs[tenantID] = querierIDs
+}
+
+// anyTenantSharded returns true if at least one tenant is restricted to a subset of the queriers,
+// allowing callers to skip shuffle-sharding-aware logic when every tenant can use all queriers.
+func (tqa *tenantQuerierAssignments) anyTenantSharded() bool {
+	return tqa.shardedTenantCount > 0
+}
+
+// shuffleAllocStats returns the number of scratchpads allocated for shuffle sharding tenant queriers,
+// and the number of shuffles which reused an already allocated scratchpad.
+func (tqa *tenantQuerierAssignments) shuffleAllocStats() (allocs, reuses uint64) {
+	return tqa.shuffleScratchpadAllocs, tqa.shuffleScratchpadReuses
 }
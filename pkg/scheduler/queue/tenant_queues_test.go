@@ -422,7 +422,13 @@ func (qb *queueBroker) getOrAddTenantQueue(tenantID TenantID, maxQueriers int) (
 	}
 
 	queuePath := QueuePath{string(tenantID)}
-	return qb.tenantQueuesTree.getOrAddNode(queuePath)
+	queue, err := qb.tenantQueuesTree.getOrAddNode(queuePath)
+	if err != nil {
+		return nil, err
+	}
+	// the queue is expected to be filled by the caller
+	qb.tenantQuerierAssignments.setTenantHasQueuedRequests(qb.tenantQuerierAssignments.tenantsByID[tenantID], true)
+	return queue, nil
 }
 
 // getQueue is a test utility, not intended for use by consumers of queueBroker
@@ -457,13 +463,19 @@ func confirmOrderForQuerier(t *testing.T, qb *queueBroker, querier QuerierID, la
 }
 
 func isConsistent(qb *queueBroker) error {
-	if len(qb.tenantQuerierAssignments.querierIDsSorted) != len(qb.tenantQuerierAssignments.queriersByID) {
+	shardingQueriers := 0
+	for _, querier := range qb.tenantQuerierAssignments.queriersByID {
+		if !querier.overflow {
+			shardingQueriers++
+		}
+	}
+	if len(qb.tenantQuerierAssignments.querierIDsSorted) != shardingQueriers {
 		return fmt.Errorf("inconsistent number of sorted queriers and querier connections")
 	}
 
 	tenantCount := 0
 	for ix, tenantID := range qb.tenantQuerierAssignments.tenantIDOrder {
-		if tenantID != "" && qb.getQueue(tenantID) == nil {
+		if tenantID != "" && qb.getQueue(tenantID) == nil && qb.tenantQuerierAssignments.tenantsByID[tenantID].emptySince.IsZero() {
 			return fmt.Errorf("tenant %s doesn't have queue", tenantID)
 		}
 		if tenantID == "" && qb.getQueue(tenantID) != nil {
@@ -481,20 +493,114 @@ func isConsistent(qb *queueBroker) error {
 			return fmt.Errorf("invalid tenant's index, expected=%d, got=%d", ix, tenant.orderIndex)
 		}
 
+		if _, pending := qb.tenantQuerierAssignments.pendingTenantReshuffles[tenantID]; pending {
+			// tenant is served with its previous shard until the deferred reshuffle is applied
+			continue
+		}
+
+		if _, pinned := qb.tenantQuerierAssignments.pinnedTenantShards[tenantID]; pinned {
+			// pinned shards are not derived from maxQueriers
+			continue
+		}
+
+		if qb.tenantQuerierAssignments.shardingDisabled {
+			if querierSet != nil {
+				return fmt.Errorf("tenant %s has queriers, but sharding is disabled", tenantID)
+			}
+			continue
+		}
+
 		if tenant.maxQueriers == 0 && querierSet != nil {
 			return fmt.Errorf("tenant %s has queriers, but maxQueriers=0", tenantID)
 		}
 
-		if tenant.maxQueriers > 0 && len(qb.tenantQuerierAssignments.querierIDsSorted) <= tenant.maxQueriers && querierSet != nil {
+		if tenant.maxQueriers > 0 && len(qb.tenantQuerierAssignments.shardingQuerierIDs()) <= tenant.maxQueriers && querierSet != nil {
 			return fmt.Errorf("tenant %s has queriers set despite not enough queriers available", tenantID)
 		}
 
-		if tenant.maxQueriers > 0 && len(qb.tenantQuerierAssignments.querierIDsSorted) > tenant.maxQueriers && len(querierSet) != tenant.maxQueriers {
+		if querierSet == nil && (qb.tenantQuerierAssignments.maxAssignmentMemoryBytes > 0 || qb.tenantQuerierAssignments.maxShardedTenants > 0) {
+			// tenant may be left unsharded to keep the assignment maps within the memory limit or the sharded tenant cap
+			continue
+		}
+
+		if tenant.maxQueriers > 0 && len(qb.tenantQuerierAssignments.shardingQuerierIDs()) > tenant.maxQueriers && len(querierSet) != tenant.maxQueriers {
 			return fmt.Errorf("tenant %s has incorrect number of queriers, expected=%d, got=%d", tenantID, len(querierSet), tenant.maxQueriers)
 		}
 	}
 
-	tenantQueueCount := qb.tenantQueuesTree.NodeCount() - 1 // exclude root node
+	shardedTenantCount, shardedQuerierEntries := 0, 0
+	for _, querierSet := range qb.tenantQuerierAssignments.tenantQuerierIDs {
+		if querierSet != nil {
+			shardedTenantCount++
+			shardedQuerierEntries += len(querierSet)
+		}
+	}
+	if shardedTenantCount != qb.tenantQuerierAssignments.shardedTenantCount {
+		return fmt.Errorf("inconsistent number of sharded tenants, expected=%d, got=%d", shardedTenantCount, qb.tenantQuerierAssignments.shardedTenantCount)
+	}
+	if shardedQuerierEntries != qb.tenantQuerierAssignments.shardedQuerierEntries {
+		return fmt.Errorf("inconsistent number of sharded querier entries, expected=%d, got=%d", shardedQuerierEntries, qb.tenantQuerierAssignments.shardedQuerierEntries)
+	}
+
+	for querierID, tenantIDs := range qb.tenantQuerierAssignments.querierTenantIDs {
+		for tenantID := range tenantIDs {
+			if _, ok := qb.tenantQuerierAssignments.tenantQuerierIDs[tenantID][querierID]; !ok {
+				return fmt.Errorf("querier %s indexed for tenant %s which is not assigned to it", querierID, tenantID)
+			}
+		}
+	}
+	for tenantID, querierSet := range qb.tenantQuerierAssignments.tenantQuerierIDs {
+		for querierID := range querierSet {
+			if _, ok := qb.tenantQuerierAssignments.querierTenantIDs[querierID][tenantID]; !ok {
+				return fmt.Errorf("tenant %s assigned to querier %s is missing from the querier index", tenantID, querierID)
+			}
+		}
+	}
+	for tenantID := range qb.tenantQuerierAssignments.tenantsByID {
+		_, sharded := qb.tenantQuerierAssignments.tenantQuerierIDs[tenantID]
+		if _, unsharded := qb.tenantQuerierAssignments.unshardedTenantIDs[tenantID]; sharded == unsharded {
+			return fmt.Errorf("tenant %s must be either sharded or indexed as unsharded", tenantID)
+		}
+	}
+	if len(qb.tenantQuerierAssignments.unshardedTenantIDs)+len(qb.tenantQuerierAssignments.tenantQuerierIDs) != len(qb.tenantQuerierAssignments.tenantsByID) {
+		return fmt.Errorf("unsharded tenant index contains removed tenants")
+	}
+
+	unshardedTenantsWithQueuedRequests, querierTenantsWithQueuedRequests := 0, map[QuerierID]int{}
+	for tenantID, tenant := range qb.tenantQuerierAssignments.tenantsByID {
+		if tenant.hasQueuedRequests != (qb.getQueue(tenantID) != nil) {
+			return fmt.Errorf("tenant %s has inconsistent queued requests flag", tenantID)
+		}
+		if !tenant.hasQueuedRequests {
+			continue
+		}
+		querierSet := qb.tenantQuerierAssignments.tenantQuerierIDs[tenantID]
+		if querierSet == nil {
+			unshardedTenantsWithQueuedRequests++
+		}
+		for querierID := range querierSet {
+			querierTenantsWithQueuedRequests[querierID]++
+		}
+	}
+	if unshardedTenantsWithQueuedRequests != qb.tenantQuerierAssignments.unshardedTenantsWithQueuedRequests {
+		return fmt.Errorf("inconsistent number of unsharded tenants with queued requests, expected=%d, got=%d", unshardedTenantsWithQueuedRequests, qb.tenantQuerierAssignments.unshardedTenantsWithQueuedRequests)
+	}
+	for querierID, count := range qb.tenantQuerierAssignments.querierTenantsWithQueuedRequests {
+		if querierTenantsWithQueuedRequests[querierID] != count {
+			return fmt.Errorf("inconsistent number of tenants with queued requests for querier %s, expected=%d, got=%d", querierID, querierTenantsWithQueuedRequests[querierID], count)
+		}
+	}
+	if len(querierTenantsWithQueuedRequests) != len(qb.tenantQuerierAssignments.querierTenantsWithQueuedRequests) {
+		return fmt.Errorf("inconsistent number of queriers with queued requests")
+	}
+
+	tenantQueueCount := len(qb.tenantQueuesTree.childQueueMap)
+	for _, tenant := range qb.tenantQuerierAssignments.tenantsByID {
+		if qb.getQueue(tenant.tenantID) == nil {
+			// tenant with an empty queue retained by lazy removal
+			tenantQueueCount++
+		}
+	}
 	if tenantCount != tenantQueueCount {
 		return fmt.Errorf("inconsistent number of tenants list and tenant queues")
 	}
@@ -519,6 +625,102 @@ func getTenantsByQuerier(broker *queueBroker, querierID QuerierID) []TenantID {
 	return tenantIDs
 }
 
+func TestQueues_AnyTenantSharded(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	assert.False(t, tqa.anyTenantSharded())
+
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+	qb.addQuerierConnection("querier-3")
+
+	// all tenants can use all queriers
+	getOrAdd(t, qb, "tenant-unsharded", 0)
+	getOrAdd(t, qb, "tenant-all-queriers", 3)
+	assert.False(t, tqa.anyTenantSharded())
+
+	// one tenant is sharded
+	getOrAdd(t, qb, "tenant-sharded", 2)
+	assert.True(t, tqa.anyTenantSharded())
+
+	// fleet shrinks to the tenant's max queriers; no tenant is sharded anymore
+	qb.tenantQuerierAssignments.removeQuerier("querier-3")
+	assert.False(t, tqa.anyTenantSharded())
+
+	// fleet grows again
+	qb.addQuerierConnection("querier-3")
+	assert.True(t, tqa.anyTenantSharded())
+
+	// removing the sharded tenant
+	qb.removeTenantQueue("tenant-sharded")
+	assert.False(t, tqa.anyTenantSharded())
+	assert.NoError(t, isConsistent(qb))
+}
+
+func TestQueues_ShuffleAllocStats(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	for i := 0; i < 5; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	for i := 0; i < 10; i++ {
+		getOrAdd(t, qb, TenantID(fmt.Sprintf("tenant-%d", i)), 2)
+	}
+
+	allocs, reuses := tqa.shuffleAllocStats()
+	assert.Equal(t, uint64(10), allocs, "shuffles on the enqueue path allocate a scratchpad each")
+	assert.Zero(t, reuses)
+
+	// each recompute allocates one scratchpad for its first sharded tenant, and reuses it for the other ones
+	for i := 5; i < 8; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	allocs, reuses = tqa.shuffleAllocStats()
+	assert.Equal(t, uint64(10+3), allocs)
+	assert.Equal(t, uint64(3*9), reuses)
+	assert.Greater(t, reuses, allocs)
+}
+
+func TestQueues_TenantUnshardedOnFleetContraction(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+
+	var unsharded []TenantID
+	qb.observer.OnTenantUnsharded = func(tenantID TenantID) {
+		unsharded = append(unsharded, tenantID)
+	}
+
+	for i := 1; i <= 4; i++ {
+		qb.addQuerierConnection(QuerierID(fmt.Sprintf("querier-%d", i)))
+	}
+	getOrAdd(t, qb, "tenant-sharded", 2)
+	getOrAdd(t, qb, "tenant-unsharded", 0)
+	require.Len(t, tqa.tenantQuerierIDs["tenant-sharded"], 2)
+
+	// fleet shrinks, but is still larger than the tenant's max queriers
+	tqa.removeQuerier("querier-4")
+	assert.Len(t, tqa.tenantQuerierIDs["tenant-sharded"], 2)
+	assert.Empty(t, unsharded)
+
+	// fleet shrinks to the tenant's max queriers; tenant transitions to all queriers
+	tqa.removeQuerier("querier-3")
+	assert.Nil(t, tqa.tenantQuerierIDs["tenant-sharded"])
+	assert.Equal(t, []TenantID{"tenant-sharded"}, unsharded)
+	assert.ElementsMatch(t, []TenantID{"tenant-sharded", "tenant-unsharded"}, getTenantsByQuerier(qb, "querier-1"))
+	assert.ElementsMatch(t, []TenantID{"tenant-sharded", "tenant-unsharded"}, getTenantsByQuerier(qb, "querier-2"))
+
+	// fleet shrinks further; tenant was already using all queriers so no further notification
+	tqa.removeQuerier("querier-2")
+	assert.Nil(t, tqa.tenantQuerierIDs["tenant-sharded"])
+	assert.Equal(t, []TenantID{"tenant-sharded"}, unsharded)
+
+	// fleet grows again; tenant is sharded again
+	qb.addQuerierConnection("querier-2")
+	qb.addQuerierConnection("querier-3")
+	assert.Len(t, tqa.tenantQuerierIDs["tenant-sharded"], 2)
+	assert.NoError(t, isConsistent(qb))
+}
+
 func TestShuffleQueriers(t *testing.T) {
 	allQueriers := querierIDSlice{"a", "b", "c", "d", "e"}
 	tqs := tenantQuerierAssignments{
@@ -528,7 +730,9 @@ func TestShuffleQueriers(t *testing.T) {
 				shuffleShardSeed: 12345,
 			},
 		},
-		tenantQuerierIDs: map[TenantID]map[QuerierID]struct{}{},
+		tenantQuerierIDs:   map[TenantID]map[QuerierID]struct{}{},
+		querierTenantIDs:   map[QuerierID]map[TenantID]struct{}{},
+		unshardedTenantIDs: map[TenantID]struct{}{},
 	}
 
 	// maxQueriers is 0, so sharding is off
@@ -575,7 +779,9 @@ func TestShuffleQueriersCorrectness(t *testing.T) {
 				shuffleShardSeed: 12345,
 			},
 		},
-		tenantQuerierIDs: map[TenantID]map[QuerierID]struct{}{},
+		tenantQuerierIDs:   map[TenantID]map[QuerierID]struct{}{},
+		querierTenantIDs:   map[QuerierID]map[TenantID]struct{}{},
+		unshardedTenantIDs: map[TenantID]struct{}{},
 	}
 
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+type tenantRemovalPolicy int
+
+const (
+	// tenantRemovalEager removes a tenant as soon as its queue is emptied by a dequeue.
+	tenantRemovalEager tenantRemovalPolicy = iota
+	// tenantRemovalLazy retains a tenant with an empty queue for the removal grace period,
+	// keeping its place in the tenant order and its querier shard in case it is refilled.
+	tenantRemovalLazy
+)
+
+// onTenantQueueEmptied applies the tenant removal policy after the tenant queue has been emptied.
+func (qb *queueBroker) onTenantQueueEmptied(tenant *queueTenant, now time.Time) {
+	if (qb.tenantRemovalPolicy == tenantRemovalLazy && qb.tenantRemovalGracePeriod > 0) || qb.keepWarm(tenant.tenantID) {
+		tenant.emptySince = now
+		return
+	}
+	qb.tenantQuerierAssignments.removeTenant(tenant.tenantID)
+}
+
+// removeTenantIfIdleExpired removes a tenant retained with an empty queue once its grace period has passed,
+// unless the tenant is kept warm.
+// Returns true if the tenant was removed.
+func (qb *queueBroker) removeTenantIfIdleExpired(tenant *queueTenant, now time.Time) bool {
+	if tenant.emptySince.IsZero() || now.Sub(tenant.emptySince) < qb.tenantRemovalGracePeriod || qb.keepWarm(tenant.tenantID) {
+		return false
+	}
+	qb.tenantQuerierAssignments.removeTenant(tenant.tenantID)
+	return true
+}
+
+// removeIdleTenants removes all tenants retained by lazy removal whose grace period has passed.
+// Returns the number of removed tenants.
+func (qb *queueBroker) removeIdleTenants(now time.Time) int {
+	removed := 0
+	for _, tenant := range qb.tenantQuerierAssignments.tenantsByID {
+		if qb.removeTenantIfIdleExpired(tenant, now) {
+			removed++
+		}
+	}
+	return removed
+}
@@ -0,0 +1,114 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_TenantRemovalPolicy(t *testing.T) {
+	const (
+		maxQueriers = 1
+		refills     = 10
+	)
+
+	tests := map[string]struct {
+		policy           tenantRemovalPolicy
+		expectedShuffles uint64
+	}{
+		"eager removal reshuffles on every refill": {
+			policy:           tenantRemovalEager,
+			expectedShuffles: refills,
+		},
+		"lazy removal reshuffles only once": {
+			policy:           tenantRemovalLazy,
+			expectedShuffles: 1,
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.tenantRemovalPolicy = testData.policy
+			qb.tenantRemovalGracePeriod = time.Hour
+			qb.addQuerierConnection("querier-1")
+			qb.addQuerierConnection("querier-2")
+
+			// tenant constantly empties and refills
+			for i := 0; i < refills; i++ {
+				require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, maxQueriers))
+				querierID := getTenantsQueriers(qb, "tenant-1")[0]
+				req, _, _, err := qb.dequeueRequestForQuerier(-1, querierID)
+				require.NoError(t, err)
+				require.Equal(t, i, req.req)
+				require.NoError(t, isConsistent(qb))
+			}
+
+			assert.Equal(t, testData.expectedShuffles, qb.tenantQuerierAssignments.tenantShuffles)
+		})
+	}
+}
+
+func TestQueues_TenantRemovalPolicy_LazyRemovalGracePeriod(t *testing.T) {
+	now := time.Now()
+	qb := newQueueBroker(100, 0)
+	qb.tenantRemovalPolicy = tenantRemovalLazy
+	qb.tenantRemovalGracePeriod = time.Minute
+	qb.addQuerierConnection("querier-1")
+
+	for i := 0; i < 3; i++ {
+		tenantID := TenantID(fmt.Sprintf("tenant-%d", i))
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: "request"}, 0))
+	}
+
+	// drain all tenant queues; tenants are retained with empty queues
+	lastTenantIndex := -1
+	for i := 0; i < 3; i++ {
+		req, _, idx, err := qb.dequeueRequestForQuerier(lastTenantIndex, "querier-1")
+		require.NoError(t, err)
+		require.NotNil(t, req)
+		lastTenantIndex = idx
+	}
+	assert.True(t, qb.isEmpty())
+	assert.Len(t, qb.tenantQuerierAssignments.tenantsByID, 3)
+	assert.NoError(t, isConsistent(qb))
+
+	// retained tenants with empty queues are skipped when dequeuing
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-0", req: "refilled"}, 0))
+	req, tenant, _, err := qb.dequeueRequestForQuerier(lastTenantIndex, "querier-1")
+	require.NoError(t, err)
+	require.NotNil(t, req)
+	assert.Equal(t, TenantID("tenant-0"), tenant.tenantID)
+
+	req, tenant, _, err = qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	assert.Nil(t, req)
+	assert.Nil(t, tenant)
+
+	// grace period has not passed yet
+	assert.Equal(t, 0, qb.removeIdleTenants(now))
+	assert.Len(t, qb.tenantQuerierAssignments.tenantsByID, 3)
+
+	// grace period has passed
+	assert.Equal(t, 3, qb.removeIdleTenants(now.Add(2*time.Minute)))
+	assert.Empty(t, qb.tenantQuerierAssignments.tenantsByID)
+	assert.Empty(t, qb.tenantQuerierAssignments.tenantIDOrder)
+	assert.NoError(t, isConsistent(qb))
+}
+
+// getTenantsQueriers returns the sorted queriers which can handle requests for the tenant.
+func getTenantsQueriers(qb *queueBroker, tenantID TenantID) []QuerierID {
+	var querierIDs []QuerierID
+	for _, querierID := range qb.tenantQuerierAssignments.querierIDsSorted {
+		querierSet := qb.tenantQuerierAssignments.tenantQuerierIDs[tenantID]
+		if _, ok := querierSet[querierID]; querierSet == nil || ok {
+			querierIDs = append(querierIDs, querierID)
+		}
+	}
+	return querierIDs
+}
@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+type tenantSelectionStrategy int
+
+const (
+	// tenantSelectionRoundRobin rotates through the tenants assigned to a querier in tenant order.
+	tenantSelectionRoundRobin tenantSelectionStrategy = iota
+	// tenantSelectionWeightedRandom picks one of the tenants with queued requests assigned to a querier
+	// at random, with probability proportional to the tenant's configured Weight.
+	tenantSelectionWeightedRandom
+	// tenantSelectionTiered drains the tenants of the highest SLO tier with queued requests before lower tiers,
+	// rotating through the tenants within the tier in tenant order.
+	tenantSelectionTiered
+	// tenantSelectionFairQueuing picks the tenant with queued requests assigned to a querier which has been served
+	// the least in proportion to its configured Weight, by start-time fair queuing, see fair_queuing.go.
+	tenantSelectionFairQueuing
+)
+
+// tenantSelectionWeight returns the tenant's configured selection weight; tenants without a configured weight have weight 1.
+func (tqa *tenantQuerierAssignments) tenantSelectionWeight(tenantID TenantID) int {
+	if cfg, ok := tqa.tenantConfigs[tenantID]; ok && cfg.Weight > 0 {
+		return cfg.Weight
+	}
+	return 1
+}
+
+// setTenantWeight sets the tenant's selection weight, leaving the rest of its configuration unchanged;
+// a weight of 0 is the same as 1. Round-robin tenant selection disregards weights, so while any tenant has a weight
+// other than 1, the broker switches from round-robin to fair queuing tenant selection, which dispatches requests
+// in proportion to the weights of the tenants. It switches back once all tenants have the default weight again.
+func (qb *queueBroker) setTenantWeight(tenantID TenantID, weight int) error {
+	tqa := &qb.tenantQuerierAssignments
+	if weight <= 1 {
+		weight = 1
+	}
+	if tqa.tenantSelectionWeight(tenantID) == weight {
+		return nil
+	}
+
+	cfg := tqa.tenantConfigs[tenantID]
+	cfg.Weight = weight
+	if weight == 1 {
+		cfg.Weight = 0
+	}
+	if err := tqa.setTenantConfig(tenantID, cfg); err != nil {
+		return err
+	}
+	switch {
+	case weight != 1 && qb.tenantSelection == tenantSelectionRoundRobin:
+		qb.tenantSelection = tenantSelectionFairQueuing
+		qb.tenantSelectionByWeights = true
+	case weight == 1 && qb.tenantSelectionByWeights && !tqa.anyTenantWeighted():
+		qb.tenantSelection = tenantSelectionRoundRobin
+		qb.tenantSelectionByWeights = false
+		// tenants start over if the broker switches to fair queuing again
+		qb.fairQueuing = fairQueuingTags{}
+	}
+	return nil
+}
+
+// anyTenantWeighted returns true if any tenant has a weight other than 1.
+func (tqa *tenantQuerierAssignments) anyTenantWeighted() bool {
+	for _, cfg := range tqa.tenantConfigs {
+		if cfg.Weight > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// getWeightedRandomTenantWithRequestsForQuerier picks a tenant with queued requests which the querier can handle,
+// with probability proportional to the tenant's weight. As all weights are positive, every tenant with queued
+// requests has a nonzero probability of being selected, so each is eventually served.
+//
+// The returned tenant index is the tenant's index in the tenant order, so that a querier can move
+// between selection strategies without skipping tenants.
+func (qb *queueBroker) getWeightedRandomTenantWithRequestsForQuerier(lastTenantIndex int, querierID QuerierID) (*queueTenant, int, error) {
+	tqa := &qb.tenantQuerierAssignments
+	if q := tqa.queriersByID[querierID]; q == nil || q.shuttingDown {
+		return nil, lastTenantIndex, ErrQuerierShuttingDown
+	}
+
+	var candidates []*queueTenant
+	totalWeight := 0
+	// tenants removed during the scan only shrink the tenant order behind the current index
+	for i := 0; i < len(tqa.tenantIDOrder); i++ {
+		tenantID := tqa.tenantIDOrder[i]
+		if tenantID == emptyTenantID {
+			continue
+		}
+		if tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]; tenantQuerierSet != nil {
+			if _, ok := tenantQuerierSet[querierID]; !ok {
+				tqa.traceSkip(tenantID, SkipNotInShard)
+				continue
+			}
+		}
+		tenant := tqa.tenantsByID[tenantID]
+		if qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}) == nil {
+			tqa.traceSkip(tenantID, SkipEmpty)
+			qb.removeTenantIfIdleExpired(tenant, qb.clock.Now())
+			continue
+		}
+		if cause := qb.tenantDispatchBlocker(tenantID, querierID); cause != "" {
+			tqa.traceSkip(tenantID, cause)
+			continue
+		}
+		candidates = append(candidates, tenant)
+		totalWeight += tqa.tenantSelectionWeight(tenantID)
+	}
+	if len(candidates) == 0 {
+		return nil, lastTenantIndex, nil
+	}
+
+	pick := qb.rng.Intn(totalWeight)
+	for _, tenant := range candidates {
+		pick -= tqa.tenantSelectionWeight(tenant.tenantID)
+		if pick < 0 {
+			tqa.traceNotSelected(candidates, tenant)
+			return tenant, tenant.orderIndex, nil
+		}
+	}
+	// unreachable as the candidate weights sum up to totalWeight
+	tenant := candidates[len(candidates)-1]
+	return tenant, tenant.orderIndex, nil
+}
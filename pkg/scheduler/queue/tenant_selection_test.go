@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_WeightedRandomTenantSelection(t *testing.T) {
+	const selections = 20000
+
+	qb := newQueueBroker(selections, 0)
+	qb.tenantSelection = tenantSelectionWeightedRandom
+	qb.rng = rand.New(rand.NewSource(1))
+	qb.addQuerierConnection("querier-1")
+
+	weights := map[TenantID]int{"tenant-a": 1, "tenant-b": 3, "tenant-c": 6}
+	totalWeight := 0
+	for tenantID, weight := range weights {
+		require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig(tenantID, TenantConfig{Weight: weight}))
+		totalWeight += weight
+		// enough requests so that no tenant queue empties during the test
+		for i := 0; i < selections; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: i}, 0))
+		}
+	}
+
+	selected := map[TenantID]int{}
+	for _, req := range dequeueN(t, qb, "querier-1", selections) {
+		selected[req.tenantID]++
+	}
+
+	for tenantID, weight := range weights {
+		expected := float64(weight) / float64(totalWeight)
+		assert.InDelta(t, expected, float64(selected[tenantID])/selections, 0.02, tenantID)
+	}
+}
+
+func TestQueues_WeightedRandomTenantSelection_OnlyTenantsWithWork(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.tenantSelection = tenantSelectionWeightedRandom
+	qb.rng = rand.New(rand.NewSource(1))
+	qb.addQuerierConnection("querier-1")
+	qb.addQuerierConnection("querier-2")
+
+	require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-heavy", TenantConfig{Weight: 1000}))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-heavy", req: "heavy"}, 0))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-light", req: "light"}, 0))
+	// tenant-sharded can only be served by one of the queriers
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-sharded", req: "sharded"}, 1))
+
+	var dequeued []any
+	for _, querierID := range []QuerierID{"querier-1", "querier-2"} {
+		for {
+			req, _, _, err := qb.dequeueRequestForQuerier(-1, querierID)
+			require.NoError(t, err)
+			if req == nil {
+				break
+			}
+			dequeued = append(dequeued, req.req)
+		}
+	}
+
+	// tenants with a lower weight are still served once heavier tenants have no queued requests
+	assert.ElementsMatch(t, []any{"heavy", "light", "sharded"}, dequeued)
+	assert.True(t, qb.isEmpty())
+
+	qb.notifyQuerierShutdown("querier-1")
+	_, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	assert.ErrorIs(t, err, ErrQuerierShuttingDown)
+}
+
+func TestQueues_SetTenantWeight(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	tqa := &qb.tenantQuerierAssignments
+	require.NoError(t, tqa.setTenantConfig("tenant-1", TenantConfig{MaxInflight: 2}))
+
+	// the default weight neither creates a configuration nor switches the tenant selection
+	require.NoError(t, qb.setTenantWeight("tenant-2", 0))
+	require.NoError(t, qb.setTenantWeight("tenant-2", 1))
+	assert.NotContains(t, tqa.tenantConfigs, TenantID("tenant-2"))
+	assert.Equal(t, tenantSelectionRoundRobin, qb.tenantSelection)
+
+	// a weight is set along with the rest of the tenant's configuration, and switches to fair queuing
+	require.NoError(t, qb.setTenantWeight("tenant-1", 5))
+	assert.Equal(t, TenantConfig{MaxInflight: 2, Weight: 5}, tqa.tenantConfigs["tenant-1"])
+	assert.Equal(t, tenantSelectionFairQueuing, qb.tenantSelection)
+
+	require.NoError(t, qb.setTenantWeight("tenant-2", 3))
+	assert.Equal(t, tenantSelectionFairQueuing, qb.tenantSelection)
+
+	// the broker switches back to round-robin once no tenant has a weight other than 1
+	require.NoError(t, qb.setTenantWeight("tenant-1", 1))
+	assert.Equal(t, TenantConfig{MaxInflight: 2}, tqa.tenantConfigs["tenant-1"])
+	assert.Equal(t, tenantSelectionFairQueuing, qb.tenantSelection)
+	require.NoError(t, qb.setTenantWeight("tenant-2", 0))
+	assert.Equal(t, tenantSelectionRoundRobin, qb.tenantSelection)
+	assert.ErrorIs(t, qb.setTenantWeight("", 2), ErrInvalidTenantID)
+
+	// other tenant selection strategies are kept
+	for _, selection := range []tenantSelectionStrategy{tenantSelectionTiered, tenantSelectionFairQueuing} {
+		qb = newQueueBroker(100, 0)
+		qb.tenantSelection = selection
+		require.NoError(t, qb.setTenantWeight("tenant-1", 5))
+		assert.Equal(t, selection, qb.tenantSelection)
+		require.NoError(t, qb.setTenantWeight("tenant-1", 1))
+		assert.Equal(t, selection, qb.tenantSelection)
+	}
+}
@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// throughputCounters returns the number of requests dequeued since the broker was created, in total and per tenant,
+// along with when the broker was created, so that callers can compute average dequeue rates.
+// Unlike recentDequeues, the counters are never reset and cost no more than incrementing them on dequeue.
+func (qb *queueBroker) throughputCounters() (global uint64, perTenant map[TenantID]uint64, since time.Time) {
+	perTenant = make(map[TenantID]uint64, len(qb.dequeuedPerTenant))
+	for tenantID, dequeued := range qb.dequeuedPerTenant {
+		perTenant[tenantID] = dequeued
+	}
+	return qb.dequeuedTotal, perTenant, qb.startedAt
+}
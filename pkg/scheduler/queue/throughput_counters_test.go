@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ThroughputCounters(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	clk := newManualClock()
+	qb.setClock(clk)
+	qb.addQuerierConnection("querier-1")
+
+	global, perTenant, since := qb.throughputCounters()
+	assert.Zero(t, global)
+	assert.Empty(t, perTenant)
+	assert.Equal(t, clk.Now(), since, "the creation time is taken from the broker clock")
+	clk.Advance(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+	}
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: 0}, 0))
+	dequeueN(t, qb, "querier-1", 4)
+
+	// a dequeue finding no request is not counted
+	req, _, _, err := qb.dequeueRequestForQuerier(-1, "querier-1")
+	require.NoError(t, err)
+	require.Nil(t, req)
+
+	global, perTenant, sinceAfter := qb.throughputCounters()
+	assert.Equal(t, uint64(4), global)
+	// counters are retained after the tenants are removed
+	assert.Empty(t, qb.tenantQuerierAssignments.tenantsByID)
+	assert.Equal(t, map[TenantID]uint64{"tenant-1": 3, "tenant-2": 1}, perTenant)
+	assert.Equal(t, since, sinceAfter)
+
+	// the returned counters are a copy
+	perTenant["tenant-1"] = 100
+	_, perTenant, _ = qb.throughputCounters()
+	assert.Equal(t, uint64(3), perTenant["tenant-1"])
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// throughputEstimate estimates each tenant's steady-state fraction of the total dispatch throughput,
+// assuming every tenant has a backlog and every available querier dispatches at the same rate.
+//
+// Each querier divides its dispatches among the tenants it can serve: equally under round-robin tenant selection,
+// and in proportion to the tenants' weights under weighted random and fair queuing tenant selection. Tiered tenant selection is
+// estimated as round-robin, as the share of lower tiers depends on the backlog of higher tiers.
+// Queriers which cannot serve any tenant do not contribute to the total, so the fractions sum to 1
+// unless no tenant can be served, in which case the estimate is empty.
+func (qb *queueBroker) throughputEstimate() map[TenantID]float64 {
+	tqa := &qb.tenantQuerierAssignments
+	weight := func(tenantID TenantID) float64 {
+		if qb.tenantSelection == tenantSelectionWeightedRandom || qb.tenantSelection == tenantSelectionFairQueuing {
+			return float64(tqa.tenantSelectionWeight(tenantID))
+		}
+		return 1
+	}
+
+	shares := map[TenantID]float64{}
+	servingQueriers := 0
+	for _, querierID := range tqa.querierIDsSorted {
+		if q := tqa.queriersByID[querierID]; q == nil || q.connections == 0 || q.shuttingDown {
+			continue
+		}
+
+		var totalWeight float64
+		for tenantID := range tqa.tenantsByID {
+			if tqa.tenantUsesQuerier(tenantID, querierID) {
+				totalWeight += weight(tenantID)
+			}
+		}
+		if totalWeight == 0 {
+			continue
+		}
+		servingQueriers++
+		for tenantID := range tqa.tenantsByID {
+			if tqa.tenantUsesQuerier(tenantID, querierID) {
+				shares[tenantID] += weight(tenantID) / totalWeight
+			}
+		}
+	}
+
+	for tenantID := range shares {
+		shares[tenantID] /= float64(servingQueriers)
+	}
+	return shares
+}
+
+// tenantUsesQuerier returns true if the querier can handle the tenant's requests.
+func (tqa *tenantQuerierAssignments) tenantUsesQuerier(tenantID TenantID, querierID QuerierID) bool {
+	tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]
+	if tenantQuerierSet == nil {
+		return true
+	}
+	_, ok := tenantQuerierSet[querierID]
+	return ok
+}
@@ -0,0 +1,64 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_ThroughputEstimate(t *testing.T) {
+	for testName, testData := range map[string]struct {
+		selection tenantSelectionStrategy
+		expected  map[TenantID]float64
+	}{
+		"round-robin": {
+			selection: tenantSelectionRoundRobin,
+			// the shard querier splits between both tenants, the other querier serves tenant-unsharded only
+			expected: map[TenantID]float64{"tenant-sharded": 0.25, "tenant-unsharded": 0.75},
+		},
+		"weighted random": {
+			selection: tenantSelectionWeightedRandom,
+			// the shard querier splits 3:1 between both tenants, the other querier serves tenant-unsharded only
+			expected: map[TenantID]float64{"tenant-sharded": 0.375, "tenant-unsharded": 0.625},
+		},
+	} {
+		t.Run(testName, func(t *testing.T) {
+			qb := newQueueBroker(100, 0)
+			qb.tenantSelection = testData.selection
+			qb.addQuerierConnection("querier-1")
+			qb.addQuerierConnection("querier-2")
+			require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig("tenant-sharded", TenantConfig{Weight: 3}))
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-sharded", req: "req-1"}, 1))
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-unsharded", req: "req-2"}, 0))
+			require.Len(t, getTenantsQueriers(qb, "tenant-sharded"), 1)
+
+			estimate := qb.throughputEstimate()
+			require.Len(t, estimate, len(testData.expected))
+			sum := 0.0
+			for tenantID, expected := range testData.expected {
+				assert.InDelta(t, expected, estimate[tenantID], 1e-9, tenantID)
+				sum += estimate[tenantID]
+			}
+			assert.InDelta(t, 1, sum, 1e-9)
+		})
+	}
+}
+
+func TestQueues_ThroughputEstimate_QueriersWithoutTenants(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	assert.Empty(t, qb.throughputEstimate())
+
+	for _, querierID := range []QuerierID{"querier-1", "querier-2", "querier-3", "querier-4"} {
+		qb.addQuerierConnection(querierID)
+	}
+	assert.Empty(t, qb.throughputEstimate())
+
+	// queriers outside of the shards do not dilute the estimate,
+	// whether or not both tenants are sharded to the same querier
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: "req-1"}, 1))
+	require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-2", req: "req-2"}, 1))
+	assert.Equal(t, map[TenantID]float64{"tenant-1": 0.5, "tenant-2": 0.5}, qb.throughputEstimate())
+}
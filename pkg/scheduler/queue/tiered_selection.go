@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// getTieredTenantWithRequestsForQuerier selects the next tenant with queued requests which the querier can handle
+// from the highest SLO tier with queued requests, rotating through the tier's tenants in tenant order
+// starting after lastTenantIndex.
+//
+// To avoid starving lower tiers, tierReservedFraction of the dequeues made while lower tiers have queued requests
+// are instead given to the tenants of the lower tiers, rotating through all of them regardless of their tier,
+// independently of the querier's position in the tenant order.
+func (qb *queueBroker) getTieredTenantWithRequestsForQuerier(lastTenantIndex int, querierID QuerierID) (*queueTenant, int, error) {
+	tqa := &qb.tenantQuerierAssignments
+	if q := tqa.queriersByID[querierID]; q == nil || q.shuttingDown {
+		return nil, lastTenantIndex, ErrQuerierShuttingDown
+	}
+
+	eligible := map[int]*queueTenant{}
+	topTier, hasLowerTiers := 0, false
+	// tenants removed during the scan only shrink the tenant order behind the current index
+	for i := 0; i < len(tqa.tenantIDOrder); i++ {
+		tenantID := tqa.tenantIDOrder[i]
+		if tenantID == emptyTenantID {
+			continue
+		}
+		if tenantQuerierSet := tqa.tenantQuerierIDs[tenantID]; tenantQuerierSet != nil {
+			if _, ok := tenantQuerierSet[querierID]; !ok {
+				tqa.traceSkip(tenantID, SkipNotInShard)
+				continue
+			}
+		}
+		tenant := tqa.tenantsByID[tenantID]
+		if qb.tenantQueuesTree.getNode(QueuePath{string(tenantID)}) == nil {
+			tqa.traceSkip(tenantID, SkipEmpty)
+			qb.removeTenantIfIdleExpired(tenant, qb.clock.Now())
+			continue
+		}
+		if cause := qb.tenantDispatchBlocker(tenantID, querierID); cause != "" {
+			tqa.traceSkip(tenantID, cause)
+			continue
+		}
+
+		switch {
+		case len(eligible) == 0:
+			topTier = tenant.tier
+		case tenant.tier < topTier:
+			topTier, hasLowerTiers = tenant.tier, true
+		case tenant.tier > topTier:
+			hasLowerTiers = true
+		}
+		eligible[i] = tenant
+	}
+	if len(eligible) == 0 {
+		return nil, lastTenantIndex, nil
+	}
+
+	serveLowerTiers := false
+	if hasLowerTiers {
+		serveLowerTiers = float64(qb.tierLowerTierDequeues) < qb.tierReservedFraction*float64(qb.tierContendedDequeues+1)
+		qb.tierContendedDequeues++
+		if serveLowerTiers {
+			qb.tierLowerTierDequeues++
+		}
+	}
+
+	tenantOrderIndex := lastTenantIndex
+	if serveLowerTiers {
+		// lower tiers rotate independently of the querier, which is mostly served the top tier
+		tenantOrderIndex = qb.tierLowerTierIndex
+	}
+	for iters := 0; iters < len(tqa.tenantIDOrder); iters++ {
+		tenantOrderIndex++
+		if tenantOrderIndex >= len(tqa.tenantIDOrder) {
+			// do not wrap with modulo; see getNextTenantForQuerier
+			tenantOrderIndex = 0
+		}
+		tenant, ok := eligible[tenantOrderIndex]
+		if !ok {
+			continue
+		}
+		if (tenant.tier == topTier) != serveLowerTiers {
+			if serveLowerTiers {
+				qb.tierLowerTierIndex = tenantOrderIndex
+			}
+			if tqa.dequeueTrace != nil {
+				tqa.traceNotSelected(tenantsInOrder(eligible), tenant)
+			}
+			return tenant, tenantOrderIndex, nil
+		}
+	}
+	// unreachable as the selected tiers have at least one eligible tenant
+	return nil, lastTenantIndex, nil
+}
@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	tierGold = iota
+	tierSilver
+	tierBronze
+)
+
+func newTieredQueueBroker(t *testing.T, tiers map[TenantID]int, requestsPerTenant int) *queueBroker {
+	qb := newQueueBroker(requestsPerTenant, 0)
+	qb.tenantSelection = tenantSelectionTiered
+	qb.addQuerierConnection("querier-1")
+
+	// enqueue in an order which does not match the tiers
+	for _, tenantID := range []TenantID{"bronze-1", "silver-1", "gold-1", "bronze-2", "gold-2"} {
+		tier, ok := tiers[tenantID]
+		if !ok {
+			continue
+		}
+		require.NoError(t, qb.tenantQuerierAssignments.setTenantConfig(tenantID, TenantConfig{Tier: tier}))
+		for i := 0; i < requestsPerTenant; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: tenantID, req: fmt.Sprintf("%s/%d", tenantID, i)}, 0))
+		}
+	}
+	return qb
+}
+
+func TestQueues_TieredTenantSelection(t *testing.T) {
+	qb := newTieredQueueBroker(t, map[TenantID]int{
+		"gold-1":   tierGold,
+		"gold-2":   tierGold,
+		"silver-1": tierSilver,
+		"bronze-1": tierBronze,
+		"bronze-2": tierBronze,
+	}, 2)
+
+	var dequeued []any
+	for _, req := range dequeueN(t, qb, "querier-1", 10) {
+		dequeued = append(dequeued, req.req)
+	}
+
+	// higher tiers are drained first, tenants within a tier are served round-robin
+	assert.Equal(t, []any{
+		"gold-1/0", "gold-2/0", "gold-1/1", "gold-2/1",
+		"silver-1/0", "silver-1/1",
+		"bronze-2/0", "bronze-1/0", "bronze-2/1", "bronze-1/1",
+	}, dequeued)
+	assert.True(t, qb.isEmpty())
+}
+
+func TestQueues_TieredTenantSelection_SingleTierByDefault(t *testing.T) {
+	qb := newTieredQueueBroker(t, map[TenantID]int{"bronze-1": 0, "silver-1": 0, "gold-1": 0}, 2)
+
+	var dequeued []any
+	for _, req := range dequeueN(t, qb, "querier-1", 6) {
+		dequeued = append(dequeued, req.req)
+	}
+	// same as round-robin
+	assert.Equal(t, []any{"bronze-1/0", "silver-1/0", "gold-1/0", "bronze-1/1", "silver-1/1", "gold-1/1"}, dequeued)
+}
+
+func TestQueues_TieredTenantSelection_ReservedFraction(t *testing.T) {
+	const dequeues = 100
+
+	for _, reservedFraction := range []float64{0, 0.1, 0.25} {
+		t.Run(fmt.Sprintf("reserved fraction %v", reservedFraction), func(t *testing.T) {
+			qb := newTieredQueueBroker(t, map[TenantID]int{
+				"gold-1":   tierGold,
+				"silver-1": tierSilver,
+				"bronze-1": tierBronze,
+			}, dequeues)
+			qb.tierReservedFraction = reservedFraction
+
+			served := map[TenantID]int{}
+			for _, req := range dequeueN(t, qb, "querier-1", dequeues) {
+				served[req.tenantID]++
+			}
+
+			lowerTiers := served["silver-1"] + served["bronze-1"]
+			assert.InDelta(t, reservedFraction*dequeues, lowerTiers, 1)
+			assert.Equal(t, dequeues-lowerTiers, served["gold-1"])
+			if reservedFraction > 0 {
+				// the reserved dequeues rotate through all lower tiers
+				assert.Positive(t, served["silver-1"])
+				assert.Positive(t, served["bronze-1"])
+			}
+		})
+	}
+}
@@ -12,6 +12,10 @@ type QueueIndex int     //nolint:revive // disallows types beginning with packag
 
 const localQueueIndex = -1
 
+// defaultMaxQueuePathDepth is the maximum length of the paths items can be enqueued at, unless configured otherwise;
+// it is well above the depth of any hierarchy of queuing dimensions, and only guards against buggy path construction.
+const defaultMaxQueuePathDepth = 16
+
 // TreeQueue is a hierarchical queue implementation with an arbitrary amount of child queues.
 //
 // TreeQueue internally maintains round-robin fair queuing across all of its queue dimensions.
@@ -26,8 +30,10 @@ const localQueueIndex = -1
 // at the same level of the tree are empty down to the leaf node.
 type TreeQueue struct {
 	// name of the tree node will be set to its segment of the queue path
-	name                   string
-	maxQueueLen            int
+	name        string
+	maxQueueLen int
+	// maximum length of the paths relative to this node items can be enqueued at, inherited by child nodes
+	maxPathDepth           int
 	localQueue             *list.List
 	currentChildQueueIndex int
 	childQueueOrder        []string
@@ -38,6 +44,7 @@ func NewTreeQueue(name string, maxQueueLen int) *TreeQueue {
 	return &TreeQueue{
 		name:                   name,
 		maxQueueLen:            maxQueueLen,
+		maxPathDepth:           defaultMaxQueuePathDepth,
 		localQueue:             nil,
 		currentChildQueueIndex: localQueueIndex,
 		childQueueMap:          map[string]*TreeQueue{},
@@ -76,6 +83,17 @@ func (q *TreeQueue) ItemCount() int {
 	return count
 }
 
+// Depth returns the number of levels of nodes below the TreeQueue node, recursively; 0 if the node has no children.
+func (q *TreeQueue) Depth() int {
+	depth := 0
+	for _, childQueue := range q.childQueueMap {
+		if childDepth := childQueue.Depth() + 1; childDepth > depth {
+			depth = childDepth
+		}
+	}
+	return depth
+}
+
 func (q *TreeQueue) LocalQueueLen() int {
 	localQueueLen := 0
 	if q.localQueue != nil {
@@ -130,6 +148,7 @@ func (q *TreeQueue) EnqueueFrontByPath(childPath QueuePath, v any) error {
 }
 
 // getOrAddNode recursively adds tree queue nodes based on given relative child path.
+// Returns ErrQueuePathTooDeep, without adding any node, if the path is longer than the max path depth.
 //
 // childPath must be relative to the receiver node; providing a QueuePath beginning with
 // the receiver/parent node name will create a child node of the same name as the parent.
@@ -137,6 +156,9 @@ func (q *TreeQueue) getOrAddNode(childPath QueuePath) (*TreeQueue, error) {
 	if len(childPath) == 0 {
 		return q, nil
 	}
+	if len(childPath) > q.maxPathDepth {
+		return nil, ErrQueuePathTooDeep
+	}
 
 	var childQueue *TreeQueue
 	var ok bool
@@ -145,6 +167,7 @@ func (q *TreeQueue) getOrAddNode(childPath QueuePath) (*TreeQueue, error) {
 		// no child node matches next path segment
 		// create next child before recurring
 		childQueue = NewTreeQueue(childPath[0], q.maxQueueLen)
+		childQueue.maxPathDepth = q.maxPathDepth
 
 		// add new child queue to ordered list for round-robining;
 		// in order to maintain round-robin order as nodes are created and deleted,
@@ -187,10 +210,108 @@ func (q *TreeQueue) getNode(childPath QueuePath) *TreeQueue {
 	return nil
 }
 
+// visitItems calls fn for every item in the node's local queue and then in its child nodes,
+// in child queue order, recursively, until fn returns false.
+// Returns false if the visit was stopped by fn.
+func (q *TreeQueue) visitItems(fn func(v any) bool) bool {
+	if q.localQueue != nil {
+		for elem := q.localQueue.Front(); elem != nil; elem = elem.Next() {
+			if !fn(elem.Value) {
+				return false
+			}
+		}
+	}
+	for _, childQueueName := range q.childQueueOrder {
+		if !q.childQueueMap[childQueueName].visitItems(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// dequeueMatchingByPath removes and returns the first item for which match returns true from the node located at
+// the given relative child path, or nil if no item matches; see dequeueMatching.
+//
+// Like DequeueByPath, the nodes along the child path are deleted if they are empty after dequeuing.
+func (q *TreeQueue) dequeueMatchingByPath(childPath QueuePath, match func(v any) bool) any {
+	childQueue := q.getNode(childPath)
+	if childQueue == nil {
+		return nil
+	}
+
+	v := childQueue.dequeueMatching(match)
+	if v != nil {
+		q.deleteEmptyNodes(childPath)
+	}
+	return v
+}
+
+// dequeueMatching removes and returns the first item for which match returns true, or nil if no item matches.
+//
+// The node's local queue and child nodes are searched in the round-robin order Dequeue follows, recursively,
+// each queue from its front. The round-robin order then carries on after the queue the item was removed from,
+// as if the item had been dequeued. For a leaf node, this is the first matching item of its local queue.
+func (q *TreeQueue) dequeueMatching(match func(v any) bool) any {
+	for i := 0; i <= len(q.childQueueOrder); i++ {
+		index := q.roundRobinIndex(i)
+		if index == localQueueIndex {
+			if q.localQueue == nil {
+				continue
+			}
+			for elem := q.localQueue.Front(); elem != nil; elem = elem.Next() {
+				if match(elem.Value) {
+					q.currentChildQueueIndex = index
+					q.wrapIndex(true)
+					return q.localQueue.Remove(elem)
+				}
+			}
+			continue
+		}
+
+		childQueueName := q.childQueueOrder[index]
+		childQueue := q.childQueueMap[childQueueName]
+		if v := childQueue.dequeueMatching(match); v != nil {
+			q.currentChildQueueIndex = index
+			if childQueue.IsEmpty() {
+				// deleteNode wraps index for us
+				q.deleteNode(QueuePath{childQueueName})
+			} else {
+				q.wrapIndex(true)
+			}
+			return v
+		}
+	}
+	return nil
+}
+
+// front returns the item Dequeue would remove next, without removing it, or nil if the node is empty.
+func (q *TreeQueue) front() any {
+	for i := 0; i <= len(q.childQueueOrder); i++ {
+		index := q.roundRobinIndex(i)
+		if index == localQueueIndex {
+			if q.localQueue != nil && q.localQueue.Front() != nil {
+				return q.localQueue.Front().Value
+			}
+			continue
+		}
+		if v := q.childQueueMap[q.childQueueOrder[index]].front(); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// roundRobinIndex returns the index of the queue i turns after the current one in the round-robin order of the node,
+// localQueueIndex standing for the node's local queue.
+func (q *TreeQueue) roundRobinIndex(i int) int {
+	return (q.currentChildQueueIndex+1+i)%(len(q.childQueueOrder)+1) - 1
+}
+
 // DequeueByPath selects a child node by a given relative child path and calls Dequeue on the node.
 //
 // While the child node will recursively clean up its own empty children during dequeue,
-// nodes cannot delete themselves; DequeueByPath cleans up the child node as well if it is empty.
+// nodes cannot delete themselves; DequeueByPath cleans up the child node as well if it is empty,
+// and then the parent nodes along the child path left empty.
 // This maintains structural guarantees relied on to make IsEmpty() non-recursive.
 //
 // childPath is relative to the receiver node; pass a zero-length path to refer to the node itself.
@@ -202,16 +323,25 @@ func (q *TreeQueue) DequeueByPath(childPath QueuePath) any {
 
 	v := childQueue.Dequeue()
 
-	if childQueue.IsEmpty() {
-		// child node will recursively clean up its own empty children during dequeue,
-		// but nodes cannot delete themselves; delete the empty child in order to
-		// maintain structural guarantees relied on to make IsEmpty() non-recursive
-		q.deleteNode(childPath)
-	}
+	// child node will recursively clean up its own empty children during dequeue,
+	// but nodes cannot delete themselves; delete the empty child and its emptied parents in order to
+	// maintain structural guarantees relied on to make IsEmpty() non-recursive
+	q.deleteEmptyNodes(childPath)
 
 	return v
 }
 
+// deleteEmptyNodes deletes the node located at the given relative child path if it is empty,
+// and then each of its parent nodes below the receiver node left empty.
+func (q *TreeQueue) deleteEmptyNodes(childPath QueuePath) {
+	for i := len(childPath); i > 0; i-- {
+		if node := q.getNode(childPath[:i]); node == nil || !node.IsEmpty() {
+			return
+		}
+		q.deleteNode(childPath[:i])
+	}
+}
+
 // Dequeue removes and returns an item from the front of the next nonempty queue node in the tree.
 //
 // Dequeuing from a node follows the round-robin order of the node's childQueueOrder,
@@ -273,7 +403,7 @@ func (q *TreeQueue) deleteNode(childPath QueuePath) bool {
 	delete(parentNode.childQueueMap, childQueueName)
 	for i, name := range parentNode.childQueueOrder {
 		if name == childQueueName {
-			parentNode.childQueueOrder = append(q.childQueueOrder[:i], q.childQueueOrder[i+1:]...)
+			parentNode.childQueueOrder = append(parentNode.childQueueOrder[:i], parentNode.childQueueOrder[i+1:]...)
 			parentNode.wrapIndex(false)
 			break
 		}
@@ -290,4 +420,7 @@ func (q *TreeQueue) wrapIndex(increment bool) {
 	}
 }
 
-var ErrMaxQueueLengthExceeded = errors.New("max queue length exceeded")
+var (
+	ErrMaxQueueLengthExceeded = errors.New("max queue length exceeded")
+	ErrQueuePathTooDeep       = errors.New("queue path exceeds the max depth")
+)
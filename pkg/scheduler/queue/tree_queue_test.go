@@ -321,6 +321,29 @@ func TestNodeCannotDeleteItself(t *testing.T) {
 	require.NotNil(t, root)
 }
 
+func TestEnqueueByPathRespectsMaxPathDepth(t *testing.T) {
+	root := NewTreeQueue("root", maxTestQueueLen)
+	root.maxPathDepth = 3
+
+	require.NoError(t, root.EnqueueBackByPath(QueuePath{"a"}, "a"))
+	require.NoError(t, root.EnqueueBackByPath(QueuePath{"a", "b"}, "ab"))
+	require.NoError(t, root.EnqueueFrontByPath(QueuePath{"a", "b", "c"}, "abc"))
+	require.Equal(t, 3, root.Depth())
+
+	require.ErrorIs(t, root.EnqueueBackByPath(QueuePath{"a", "b", "c", "d"}, "abcd"), ErrQueuePathTooDeep)
+	require.ErrorIs(t, root.EnqueueFrontByPath(QueuePath{"x", "y", "z", "w"}, "xyzw"), ErrQueuePathTooDeep)
+	// no node is added for paths beyond the max depth
+	require.Equal(t, 3, root.Depth())
+	require.Equal(t, 4, root.NodeCount())
+	require.Equal(t, 3, root.ItemCount())
+
+	// the max depth is relative to the node enqueued to
+	child := root.getNode(QueuePath{"a"})
+	require.NoError(t, child.EnqueueBackByPath(QueuePath{"b", "c", "d"}, "abcd"))
+	require.ErrorIs(t, child.EnqueueBackByPath(QueuePath{"b", "c", "d", "e"}, "abcde"), ErrQueuePathTooDeep)
+	require.Equal(t, 4, root.Depth())
+}
+
 func makeBalancedTreeQueue(t *testing.T, firstDimensions, secondDimensions []string, itemsPerDimensions int) *TreeQueue {
 	root := NewTreeQueue("root", maxTestQueueLen)
 	require.Equal(t, 1, root.NodeCount())
@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// visitAllRequests calls fn for every queued request, walking the tenants in tenant order
+// and each tenant's requests in dequeue order, until fn returns false.
+//
+// fn must not modify the broker.
+func (qb *queueBroker) visitAllRequests(fn func(tenantID TenantID, req *tenantRequest) bool) {
+	for _, tenantID := range qb.tenantQuerierAssignments.tenantIDOrder {
+		if tenantID == emptyTenantID {
+			continue
+		}
+		if !qb.visitTenantRequests(tenantID, func(req *tenantRequest) bool { return fn(tenantID, req) }) {
+			return
+		}
+	}
+}
+
+// visitTenantRequests calls fn for every request queued for the tenant, in order, until fn returns false.
+// The tenant's priority class sub-queues are visited in the order they are dequeued from.
+// Returns false if the visit was stopped by fn.
+func (qb *queueBroker) visitTenantRequests(tenantID TenantID, fn func(req *tenantRequest) bool) bool {
+	order, n := qb.tenantPriorityClassOrder(tenantID)
+	for _, class := range order[:n] {
+		node := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID), class.String()})
+		if !node.visitItems(func(v any) bool { return fn(v.(*tenantRequest)) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// tenantNextRequest returns the request at the front of the tenant queue, which is dequeued next unless a request
+// matcher selects another one, or nil if the tenant has no queued request.
+func (qb *queueBroker) tenantNextRequest(tenantID TenantID) *tenantRequest {
+	order, n := qb.tenantPriorityClassOrder(tenantID)
+	if n == 0 {
+		return nil
+	}
+	if v := qb.tenantQueuesTree.getNode(QueuePath{string(tenantID), order[0].String()}).front(); v != nil {
+		return v.(*tenantRequest)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_VisitAllRequests(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+
+	type visited struct {
+		tenantID TenantID
+		req      Request
+	}
+	visitAll := func() []visited {
+		var result []visited
+		qb.visitAllRequests(func(tenantID TenantID, req *tenantRequest) bool {
+			result = append(result, visited{tenantID, req.req})
+			return true
+		})
+		return result
+	}
+
+	assert.Empty(t, visitAll())
+
+	for _, r := range []visited{
+		{"tenant-a", "a1"}, {"tenant-b", "b1"}, {"tenant-a", "a2"},
+		{"tenant-c", "c1"}, {"tenant-b", "b2"}, {"tenant-a", "a3"},
+	} {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: r.tenantID, req: r.req}, 0))
+	}
+
+	// remove tenant-b, leaving an empty slot in the tenant order
+	qb.removeTenantQueue("tenant-b")
+	require.Equal(t, []TenantID{"tenant-a", "", "tenant-c"}, qb.tenantQuerierAssignments.tenantIDOrder)
+
+	expected := []visited{
+		{"tenant-a", "a1"}, {"tenant-a", "a2"}, {"tenant-a", "a3"},
+		{"tenant-c", "c1"},
+	}
+	assert.Equal(t, expected, visitAll())
+
+	// visiting does not modify the queue
+	assert.Equal(t, 4, qb.tenantQueuesTree.ItemCount())
+	assert.NoError(t, isConsistent(qb))
+
+	// visiting stops early once fn returns false
+	var stopped []Request
+	qb.visitAllRequests(func(_ TenantID, req *tenantRequest) bool {
+		stopped = append(stopped, req.req)
+		return len(stopped) < 2
+	})
+	assert.Equal(t, []Request{"a1", "a2"}, stopped)
+}
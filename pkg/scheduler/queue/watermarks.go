@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+// checkTenantWatermarks notifies the observer when the tenant's queue depth crosses the watermarks.
+// The low watermark is expected to be below the high watermark; the gap between them
+// prevents repeated notifications while the depth fluctuates around a single threshold.
+func (qb *queueBroker) checkTenantWatermarks(tenant *queueTenant) {
+	if qb.tenantHighWatermark <= 0 {
+		return
+	}
+
+	depth := 0
+	if queue := qb.tenantQueuesTree.getNode(QueuePath{string(tenant.tenantID)}); queue != nil {
+		depth = queue.ItemCount()
+	}
+
+	switch {
+	case !tenant.aboveHighWatermark && depth >= qb.tenantHighWatermark:
+		tenant.aboveHighWatermark = true
+		if qb.observer.OnTenantHighWatermark != nil {
+			qb.observer.OnTenantHighWatermark(tenant.tenantID, depth)
+		}
+	case tenant.aboveHighWatermark && depth <= qb.tenantLowWatermark:
+		tenant.aboveHighWatermark = false
+		if qb.observer.OnTenantLowWatermark != nil {
+			qb.observer.OnTenantLowWatermark(tenant.tenantID, depth)
+		}
+	}
+}
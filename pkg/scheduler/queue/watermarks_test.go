@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueues_TenantWatermarks(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.tenantHighWatermark = 5
+	qb.tenantLowWatermark = 2
+	qb.addQuerierConnection("querier-1")
+
+	var events []string
+	qb.observer.OnTenantHighWatermark = func(tenantID TenantID, depth int) {
+		events = append(events, fmt.Sprintf("high %s %d", tenantID, depth))
+	}
+	qb.observer.OnTenantLowWatermark = func(tenantID TenantID, depth int) {
+		events = append(events, fmt.Sprintf("low %s %d", tenantID, depth))
+	}
+	enqueue := func(n int) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+		}
+	}
+
+	enqueue(4)
+	assert.Empty(t, events)
+
+	enqueue(1)
+	assert.Equal(t, []string{"high tenant-1 5"}, events)
+
+	// fluctuating between the watermarks does not notify again
+	enqueue(3)
+	dequeueN(t, qb, "querier-1", 5)
+	enqueue(1)
+	assert.Equal(t, []string{"high tenant-1 5"}, events)
+
+	dequeueN(t, qb, "querier-1", 2)
+	assert.Equal(t, []string{"high tenant-1 5", "low tenant-1 2"}, events)
+
+	dequeueN(t, qb, "querier-1", 2)
+	enqueue(4)
+	assert.Equal(t, []string{"high tenant-1 5", "low tenant-1 2"}, events)
+
+	// crossing again notifies again
+	enqueue(1)
+	dequeueN(t, qb, "querier-1", 5)
+	assert.Equal(t, []string{"high tenant-1 5", "low tenant-1 2", "high tenant-1 5", "low tenant-1 2"}, events)
+}
+
+func TestQueues_TenantWatermarks_Disabled(t *testing.T) {
+	qb := newQueueBroker(100, 0)
+	qb.addQuerierConnection("querier-1")
+	qb.observer.OnTenantHighWatermark = func(TenantID, int) { t.Fatal("unexpected high watermark notification") }
+	qb.observer.OnTenantLowWatermark = func(TenantID, int) { t.Fatal("unexpected low watermark notification") }
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, qb.enqueueRequestBack(&tenantRequest{tenantID: "tenant-1", req: i}, 0))
+	}
+	dequeueN(t, qb, "querier-1", 50)
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import "time"
+
+// windowedTenantCounter counts events per tenant over a sliding time window.
+// The window is approximated by a fixed number of time buckets, so that memory
+// is bounded by the number of tenants rather than by the number of events.
+type windowedTenantCounter struct {
+	bucketWidth time.Duration
+	buckets     []tenantCounterBucket
+}
+
+type tenantCounterBucket struct {
+	// epoch is the index of the bucket-wide time slot currently held by the bucket
+	epoch  int64
+	counts map[TenantID]int
+}
+
+func newWindowedTenantCounter(window time.Duration, numBuckets int) *windowedTenantCounter {
+	if numBuckets < 1 {
+		numBuckets = 1
+	}
+	bucketWidth := window / time.Duration(numBuckets)
+	if bucketWidth <= 0 {
+		bucketWidth = 1
+	}
+	return &windowedTenantCounter{
+		bucketWidth: bucketWidth,
+		buckets:     make([]tenantCounterBucket, numBuckets),
+	}
+}
+
+func (c *windowedTenantCounter) epoch(now time.Time) int64 {
+	return now.UnixNano() / int64(c.bucketWidth)
+}
+
+// add adds n events for the tenant at the given time.
+func (c *windowedTenantCounter) add(tenantID TenantID, n int, now time.Time) {
+	epoch := c.epoch(now)
+	bucket := &c.buckets[epoch%int64(len(c.buckets))]
+	if bucket.epoch != epoch || bucket.counts == nil {
+		bucket.epoch = epoch
+		bucket.counts = map[TenantID]int{}
+	}
+	bucket.counts[tenantID] += n
+}
+
+// counts returns the per-tenant event counts within the window ending at the given time.
+func (c *windowedTenantCounter) counts(now time.Time) map[TenantID]int {
+	return c.countsWithin(now, c.bucketWidth*time.Duration(len(c.buckets)))
+}
+
+// countsWithin returns the per-tenant event counts within the given window ending at the given time,
+// rounded up to whole buckets and capped at the counter's window.
+func (c *windowedTenantCounter) countsWithin(now time.Time, window time.Duration) map[TenantID]int {
+	numBuckets := int64((window + c.bucketWidth - 1) / c.bucketWidth)
+	if numBuckets > int64(len(c.buckets)) || numBuckets <= 0 {
+		numBuckets = int64(len(c.buckets))
+	}
+	epoch := c.epoch(now)
+	result := map[TenantID]int{}
+	for _, bucket := range c.buckets {
+		if bucket.counts == nil || bucket.epoch > epoch || bucket.epoch <= epoch-numBuckets {
+			continue
+		}
+		for tenantID, n := range bucket.counts {
+			result[tenantID] += n
+		}
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowedTenantCounter(t *testing.T) {
+	clk := newManualClock()
+	c := newWindowedTenantCounter(time.Minute, 6)
+
+	assert.Empty(t, c.counts(clk.Now()))
+
+	c.add("tenant-1", 1, clk.Now())
+	c.add("tenant-2", 2, clk.Now())
+	clk.Advance(30 * time.Second)
+	c.add("tenant-1", 3, clk.Now())
+	assert.Equal(t, map[TenantID]int{"tenant-1": 4, "tenant-2": 2}, c.counts(clk.Now()))
+
+	// events older than the window are dropped
+	clk.Advance(40 * time.Second)
+	assert.Equal(t, map[TenantID]int{"tenant-1": 3}, c.counts(clk.Now()))
+
+	clk.Advance(time.Minute)
+	assert.Empty(t, c.counts(clk.Now()))
+}
+
+func TestWindowedTenantCounter_CountsWithin(t *testing.T) {
+	clk := newManualClock()
+	c := newWindowedTenantCounter(time.Minute, 6)
+	for i := 0; i < 6; i++ {
+		c.add("tenant-1", 1, clk.Now())
+		clk.Advance(10 * time.Second)
+	}
+	now := clk.Now().Add(-time.Nanosecond)
+
+	assert.Equal(t, map[TenantID]int{"tenant-1": 1}, c.countsWithin(now, 10*time.Second))
+	assert.Equal(t, map[TenantID]int{"tenant-1": 2}, c.countsWithin(now, 11*time.Second))
+	assert.Equal(t, map[TenantID]int{"tenant-1": 6}, c.countsWithin(now, time.Hour))
+	assert.Equal(t, c.counts(now), c.countsWithin(now, time.Minute))
+}
@@ -0,0 +1,223 @@
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+
+	"github.com/grafana/mimir/pkg/scheduler/queue"
+	"github.com/grafana/mimir/pkg/scheduler/schedulerpb"
+)
+
+var (
+	errInvalidQueueSnapshotInterval = errors.New("the queue snapshot interval must be greater than 0 when the queue snapshot path is set")
+	errStaleQueueSnapshot           = errors.New("the queue snapshot is older than the queue snapshot interval")
+)
+
+// queueSnapshots persists the snapshots of the request queue to a local file.
+type queueSnapshots struct {
+	path string
+	// snapshots written longer ago than maxAge are stale: a fresher periodic snapshot would have replaced them
+	// had the request queue still been running, so their requests may have been dispatched since
+	maxAge time.Duration
+
+	mtx sync.Mutex
+	// set once the snapshot written by the stopped request queue superseded the periodic snapshots
+	final bool
+}
+
+// consume returns the persisted snapshot, or nil if there is none, and removes it, so that its requests
+// are restored at most once. A stale snapshot is removed without being returned.
+func (q *queueSnapshots) consume() ([]byte, error) {
+	info, err := os.Stat(q.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if time.Since(info.ModTime()) > q.maxAge {
+		err = errStaleQueueSnapshot
+	} else {
+		data, err = os.ReadFile(q.path)
+	}
+	if rmErr := os.Remove(q.path); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = rmErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// write persists the snapshot, replacing the previous one. Once the final snapshot is written, further snapshots
+// are ignored, so that a periodic snapshot taken before the request queue stopped does not replace it.
+func (q *queueSnapshots) write(data []byte, final bool) error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	if q.final {
+		return nil
+	}
+	q.final = final
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that a crash while writing does not leave a truncated snapshot behind.
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
+
+// snapshotQueue writes a snapshot of the request queue. It never fails, so that the periodic snapshots carry on.
+func (s *Scheduler) snapshotQueue(ctx context.Context) error {
+	data, err := s.requestQueue.Snapshot(ctx, schedulerRequestCodec{})
+	if err == nil {
+		err = s.queueSnapshots.write(data, false)
+	}
+	if err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, queue.ErrStopped) {
+		level.Warn(s.log).Log("msg", "failed to write queue snapshot", "path", s.cfg.QueueSnapshotPath, "err", err)
+	}
+	return nil
+}
+
+// readQueueSnapshot returns the queue snapshot to restore, or nil if there is none.
+func (s *Scheduler) readQueueSnapshot() []byte {
+	if s.queueSnapshots == nil {
+		return nil
+	}
+	data, err := s.queueSnapshots.consume()
+	if errors.Is(err, errStaleQueueSnapshot) {
+		level.Warn(s.log).Log("msg", "queue snapshot is stale, queued requests are not restored", "path", s.cfg.QueueSnapshotPath, "max_age", s.cfg.QueueSnapshotInterval)
+		return nil
+	}
+	if err != nil {
+		level.Warn(s.log).Log("msg", "failed to read queue snapshot, queued requests are not restored", "path", s.cfg.QueueSnapshotPath, "err", err)
+		return nil
+	}
+	return data
+}
+
+// restoreQueueSnapshot enqueues the requests of the queue snapshot with the current limits of their tenants,
+// and tracks them as pending requests, so that their query-frontends can still cancel them once reconnected.
+func (s *Scheduler) restoreQueueSnapshot(ctx context.Context, data []byte) {
+	restored, err := s.requestQueue.RestoreSnapshot(ctx, data, schedulerRequestCodec{}, queue.RestoreOptions{
+		TenantLimits: s.tenantQueueLimits,
+		OnRestored: func(req queue.Request) {
+			r := req.(*schedulerRequest)
+			s.activeUsers.UpdateUserTimestamp(r.userID, time.Now())
+
+			// Lock the connected frontends first, as frontendConnected does, so that the request is linked to
+			// the connection of its query-frontend whether it reconnected before or after the restore.
+			s.connectedFrontendsMu.Lock()
+			defer s.connectedFrontendsMu.Unlock()
+			if cf := s.connectedFrontends[r.frontendAddress]; cf != nil {
+				r.linkToFrontend(cf.ctx)
+			}
+
+			s.pendingRequestsMu.Lock()
+			s.pendingRequests[requestKey{frontendAddr: r.frontendAddress, queryID: r.queryID}] = r
+			s.pendingRequestsMu.Unlock()
+		},
+	})
+	if err != nil {
+		level.Warn(s.log).Log("msg", "failed to restore queue snapshot", "path", s.cfg.QueueSnapshotPath, "err", err)
+		return
+	}
+	level.Info(s.log).Log("msg", "restored queued requests from queue snapshot", "path", s.cfg.QueueSnapshotPath, "requests", restored)
+}
+
+// linkRestoredRequestsToFrontend links the pending restored requests of frontendAddr to the connection of the
+// query-frontend. Must be called with connectedFrontendsMu held.
+func (s *Scheduler) linkRestoredRequestsToFrontend(frontendCtx context.Context, frontendAddr string) {
+	s.pendingRequestsMu.Lock()
+	defer s.pendingRequestsMu.Unlock()
+
+	for key, req := range s.pendingRequests {
+		if key.frontendAddr == frontendAddr && req.restored {
+			req.linkToFrontend(frontendCtx)
+		}
+	}
+}
+
+// schedulerRequestCodec serializes the scheduler requests into queue snapshots.
+type schedulerRequestCodec struct{}
+
+type schedulerRequestSnapshot struct {
+	// the ENQUEUE message the request was received with
+	Message     []byte    `json:"message"`
+	EnqueueTime time.Time `json:"enqueue_time"`
+}
+
+func (schedulerRequestCodec) EncodeRequest(req queue.Request) ([]byte, error) {
+	r, ok := req.(*schedulerRequest)
+	if !ok {
+		return nil, fmt.Errorf("unexpected request type %T", req)
+	}
+	msg := &schedulerpb.FrontendToScheduler{
+		Type:            schedulerpb.ENQUEUE,
+		FrontendAddress: r.frontendAddress,
+		QueryID:         r.queryID,
+		UserID:          r.userID,
+		HttpRequest:     r.request,
+		StatsEnabled:    r.statsEnabled,
+	}
+	if !r.deadline.IsZero() {
+		msg.DeadlineUnixNano = r.deadline.UnixNano()
+	}
+	data, err := msg.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(schedulerRequestSnapshot{Message: data, EnqueueTime: r.enqueueTime})
+}
+
+func (schedulerRequestCodec) DecodeRequest(data []byte) (queue.Request, error) {
+	var snapshot schedulerRequestSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	msg := &schedulerpb.FrontendToScheduler{}
+	if err := msg.Unmarshal(snapshot.Message); err != nil {
+		return nil, err
+	}
+
+	req := &schedulerRequest{
+		frontendAddress: msg.FrontendAddress,
+		userID:          msg.UserID,
+		queryID:         msg.QueryID,
+		request:         msg.HttpRequest,
+		statsEnabled:    msg.StatsEnabled,
+		deadline:        requestDeadline(msg),
+		enqueueTime:     snapshot.EnqueueTime,
+		restored:        true,
+	}
+
+	// The restored request is bound to the connection of its query-frontend once it reconnects.
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if req.deadline.IsZero() {
+		ctx, cancel = context.WithCancel(context.Background())
+	} else {
+		ctx, cancel = context.WithDeadline(context.Background(), req.deadline)
+	}
+	req.queueSpan, req.ctx = opentracing.StartSpanFromContext(ctx, "queued")
+	req.ctxCancel = cancel
+	return req, nil
+}
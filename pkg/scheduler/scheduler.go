@@ -27,9 +27,11 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/atomic"
 	"google.golang.org/grpc"
 
 	"github.com/grafana/mimir/pkg/frontend/v2/frontendv2pb"
+	"github.com/grafana/mimir/pkg/querier/querycomponent"
 	"github.com/grafana/mimir/pkg/scheduler/queue"
 	"github.com/grafana/mimir/pkg/scheduler/schedulerdiscovery"
 	"github.com/grafana/mimir/pkg/scheduler/schedulerpb"
@@ -38,6 +40,14 @@ import (
 	"github.com/grafana/mimir/pkg/util/validation"
 )
 
+var (
+	errRequestExpired                 = errors.New("the request expired in the query-scheduler queue before being dispatched to a querier")
+	errInvalidBackpressureQueueLength = errors.New("the tenant backpressure queue length must be lower than the maximum number of outstanding requests per tenant")
+)
+
+// expiredRequestReportTimeout bounds the time spent reporting a request expired in the queue to its query-frontend.
+const expiredRequestReportTimeout = 10 * time.Second
+
 // Scheduler is responsible for queueing and dispatching queries to Queriers.
 type Scheduler struct {
 	services.Service
@@ -56,6 +66,9 @@ type Scheduler struct {
 	pendingRequestsMu sync.Mutex
 	pendingRequests   map[requestKey]*schedulerRequest // Request is kept in this map even after being dispatched to querier. It can still be canceled at that time.
 
+	// Nil unless queue snapshots are enabled.
+	queueSnapshots *queueSnapshots
+
 	// The ring is used to let other components discover query-scheduler replicas.
 	// The ring is optional.
 	schedulerLifecycler *ring.BasicLifecycler
@@ -67,6 +80,8 @@ type Scheduler struct {
 	// Metrics.
 	queueLength              *prometheus.GaugeVec
 	discardedRequests        *prometheus.CounterVec
+	expiredRequests          *prometheus.CounterVec
+	tenantQueueHistograms    *queue.TenantQueueHistograms
 	cancelledRequests        *prometheus.CounterVec
 	connectedQuerierClients  prometheus.GaugeFunc
 	connectedFrontendClients prometheus.GaugeFunc
@@ -89,20 +104,40 @@ type connectedFrontend struct {
 }
 
 type Config struct {
-	MaxOutstandingPerTenant int                       `yaml:"max_outstanding_requests_per_tenant"`
-	QuerierForgetDelay      time.Duration             `yaml:"querier_forget_delay" category:"experimental"`
-	GRPCClientConfig        grpcclient.Config         `yaml:"grpc_client_config" doc:"description=This configures the gRPC client used to report errors back to the query-frontend."`
-	ServiceDiscovery        schedulerdiscovery.Config `yaml:",inline"`
+	MaxOutstandingPerTenant  int                       `yaml:"max_outstanding_requests_per_tenant"`
+	QuerierForgetDelay       time.Duration             `yaml:"querier_forget_delay" category:"experimental"`
+	QuerierCostBudget        int64                     `yaml:"querier_cost_budget" category:"experimental"`
+	MaxTenantQueueHistograms int                       `yaml:"max_tenant_queue_histograms" category:"experimental"`
+	BackpressureQueueLength  int                       `yaml:"tenant_backpressure_queue_length" category:"experimental"`
+	QueryComponentQueues     bool                      `yaml:"query_component_queues" category:"experimental"`
+	PriorityClassMaxWait     time.Duration             `yaml:"priority_class_max_wait" category:"experimental"`
+	QueueSnapshotPath        string                    `yaml:"queue_snapshot_path" category:"experimental"`
+	QueueSnapshotInterval    time.Duration             `yaml:"queue_snapshot_interval" category:"experimental"`
+	GRPCClientConfig         grpcclient.Config         `yaml:"grpc_client_config" doc:"description=This configures the gRPC client used to report errors back to the query-frontend."`
+	ServiceDiscovery         schedulerdiscovery.Config `yaml:",inline"`
 }
 
 func (cfg *Config) RegisterFlags(f *flag.FlagSet, logger log.Logger) {
 	f.IntVar(&cfg.MaxOutstandingPerTenant, "query-scheduler.max-outstanding-requests-per-tenant", 100, "Maximum number of outstanding requests per tenant per query-scheduler. In-flight requests above this limit will fail with HTTP response status code 429.")
 	f.DurationVar(&cfg.QuerierForgetDelay, "query-scheduler.querier-forget-delay", 0, "If a querier disconnects without sending notification about graceful shutdown, the query-scheduler will keep the querier in the tenant's shard until the forget delay has passed. This feature is useful to reduce the blast radius when shuffle-sharding is enabled.")
+	f.Int64Var(&cfg.QuerierCostBudget, "query-scheduler.querier-cost-budget", 0, "Maximum estimated cost of the queries a querier executes at once. The query-frontend estimates the cost of each query from its number of steps and estimated number of series. A querier is not dispatched a query which would take the estimated cost of its running queries over the budget, unless the querier is idle. 0 to disable.")
+	f.IntVar(&cfg.MaxTenantQueueHistograms, "query-scheduler.max-tenant-queue-histograms", 0, "Maximum number of tenants tracked by the per-tenant histograms of the queue wait time and queue depth. The requests of further tenants are tracked together, under the user label __overflow__. 0 to disable the per-tenant histograms.")
+	f.IntVar(&cfg.BackpressureQueueLength, "query-scheduler.tenant-backpressure-queue-length", 0, "Length of a tenant's queue from which the query-scheduler signals backpressure to the query-frontends enqueuing the tenant's queries, until the queue length drops to half of it. Query-frontends configured with -query-frontend.scheduler-backpressure-period reject the tenant's queries for that period. Must be lower than -query-scheduler.max-outstanding-requests-per-tenant. 0 to disable.")
+	f.BoolVar(&cfg.QueryComponentQueues, "query-scheduler.query-component-queues", false, "Split each tenant's queue into sub-queues by the component expected to serve its queries: the ingesters, the store-gateways, or both, as estimated by the query-frontend from the query time range. The sub-queues are dispatched to queriers in turn, so that slow queries served by the store-gateways do not hold back the queries of recent data of the same tenant.")
+	f.DurationVar(&cfg.PriorityClassMaxWait, "query-scheduler.priority-class-max-wait", 30*time.Second, "Maximum time the queries of a lower priority class, as set by the Query-Priority header, wait in a tenant's queue for the tenant's queries of the higher classes. Queries which waited longer are dispatched ahead of the higher classes, so that a steady stream of interactive queries does not starve the normal and background queries. 0 to disable.")
+	f.StringVar(&cfg.QueueSnapshotPath, "query-scheduler.queue-snapshot-path", "", "Path of the local file the query-scheduler periodically writes a snapshot of its queued requests to, and restores the queued requests from on startup, so that restarting the query-scheduler does not fail the queued queries. Empty to disable.")
+	f.DurationVar(&cfg.QueueSnapshotInterval, "query-scheduler.queue-snapshot-interval", 10*time.Second, "How often the query-scheduler writes a snapshot of its queued requests, when -query-scheduler.queue-snapshot-path is set. The query-scheduler also writes a snapshot when it shuts down. Snapshots older than this interval are not restored.")
 	cfg.GRPCClientConfig.RegisterFlagsWithPrefix("query-scheduler.grpc-client-config", f)
 	cfg.ServiceDiscovery.RegisterFlags(f, logger)
 }
 
 func (cfg *Config) Validate() error {
+	if cfg.QueueSnapshotPath != "" && cfg.QueueSnapshotInterval <= 0 {
+		return errInvalidQueueSnapshotInterval
+	}
+	if cfg.BackpressureQueueLength > 0 && cfg.BackpressureQueueLength >= cfg.MaxOutstandingPerTenant {
+		return errInvalidBackpressureQueueLength
+	}
 	return cfg.ServiceDiscovery.Validate()
 }
 
@@ -133,11 +168,24 @@ func NewScheduler(cfg Config, limits Limits, log log.Logger, registerer promethe
 		Name: "cortex_query_scheduler_discarded_requests_total",
 		Help: "Total number of query requests discarded.",
 	}, []string{"user"})
+	s.expiredRequests = promauto.With(registerer).NewCounterVec(prometheus.CounterOpts{
+		Name: "cortex_query_scheduler_expired_requests_total",
+		Help: "Total number of query requests dropped from the queue because their deadline passed before they were dispatched.",
+	}, []string{"user"})
 	enqueueDuration := promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
 		Name: "cortex_query_scheduler_enqueue_duration_seconds",
 		Help: "Time spent by requests waiting to join the queue or be rejected.",
 	})
-	s.requestQueue = queue.NewRequestQueue(s.log, cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, s.queueLength, s.discardedRequests, enqueueDuration)
+	s.tenantQueueHistograms = queue.NewTenantQueueHistograms(registerer, "cortex_query_scheduler", cfg.MaxTenantQueueHistograms)
+	s.requestQueue = queue.NewRequestQueue(s.log, cfg.MaxOutstandingPerTenant, cfg.QuerierForgetDelay, s.queueLength, s.discardedRequests, enqueueDuration, queue.RequestQueueOptions{
+		QuerierCostBudget:       cfg.QuerierCostBudget,
+		BackpressureQueueLength: cfg.BackpressureQueueLength,
+		QueryComponentQueues:    cfg.QueryComponentQueues,
+		PriorityClassMaxWait:    cfg.PriorityClassMaxWait,
+		ExpiredRequests:         s.expiredRequests,
+		OnRequestExpired:        s.requestExpired,
+		TenantHistograms:        s.tenantQueueHistograms,
+	})
 
 	s.queueDuration = promauto.With(registerer).NewHistogram(prometheus.HistogramOpts{
 		Name:    "cortex_query_scheduler_queue_duration_seconds",
@@ -164,6 +212,14 @@ func NewScheduler(cfg Config, limits Limits, log log.Logger, registerer promethe
 	s.activeUsers = util.NewActiveUsersCleanupWithDefaultValues(s.cleanupMetricsForInactiveUser)
 	subservices := []services.Service{s.requestQueue, s.activeUsers}
 
+	if cfg.QueueSnapshotPath != "" {
+		s.queueSnapshots = &queueSnapshots{path: cfg.QueueSnapshotPath, maxAge: cfg.QueueSnapshotInterval}
+		s.requestQueue.SnapshotOnStop(schedulerRequestCodec{}, func(data []byte) error {
+			return s.queueSnapshots.write(data, true)
+		})
+		subservices = append(subservices, services.NewTimerService(cfg.QueueSnapshotInterval, nil, s.snapshotQueue, nil))
+	}
+
 	// Init the ring only if the ring-based service discovery mode is used.
 	if cfg.ServiceDiscovery.Mode == schedulerdiscovery.ModeRing {
 		s.schedulerLifecycler, err = schedulerdiscovery.NewRingLifecycler(cfg.ServiceDiscovery.SchedulerRing, log, registerer)
@@ -187,6 +243,9 @@ func NewScheduler(cfg Config, limits Limits, log log.Logger, registerer promethe
 type Limits interface {
 	// MaxQueriersPerUser returns max queriers to use per tenant, or 0 if shuffle sharding is disabled.
 	MaxQueriersPerUser(user string) int
+
+	// TenantQueueWeight returns the weight of the tenant's queue, which queriers are dispatched requests in proportion to.
+	TenantQueueWeight(user string) int
 }
 
 type schedulerRequest struct {
@@ -195,6 +254,8 @@ type schedulerRequest struct {
 	queryID         uint64
 	request         *httpgrpc.HTTPRequest
 	statsEnabled    bool
+	// the time after which the query-frontend no longer waits for the response, zero if there is none
+	deadline time.Time
 
 	enqueueTime time.Time
 
@@ -204,6 +265,55 @@ type schedulerRequest struct {
 
 	// This is only used for testing.
 	parentSpanContext opentracing.SpanContext
+
+	// Set on the requests restored from a queue snapshot. They are only dispatched once linked to the connection
+	// of their query-frontend, as a query-frontend which didn't reconnect no longer waits for their responses.
+	restored       bool
+	frontendLinked atomic.Bool
+}
+
+// linkToFrontend cancels the restored request once the connection of its query-frontend is closed.
+func (s *schedulerRequest) linkToFrontend(frontendCtx context.Context) {
+	if !s.frontendLinked.CompareAndSwap(false, true) {
+		return
+	}
+	stop := context.AfterFunc(frontendCtx, s.ctxCancel)
+	context.AfterFunc(s.ctx, func() { stop() })
+}
+
+// PriorityClass implements queue.PrioritizedRequest.
+func (s *schedulerRequest) PriorityClass() queue.PriorityClass {
+	return queue.PriorityClassFromHTTPGRPCRequest(s.request)
+}
+
+// EstimatedCost implements queue.CostEstimatedRequest.
+func (s *schedulerRequest) EstimatedCost() int64 {
+	return queue.CostEstimateFromHTTPGRPCRequest(s.request)
+}
+
+// ExpectedQueryComponent implements queue.QueryComponentRequest.
+func (s *schedulerRequest) ExpectedQueryComponent() querycomponent.Component {
+	return queue.QueryComponentFromHTTPGRPCRequest(s.request)
+}
+
+// RequestKey implements queue.KeyedRequest: query IDs are only unique per frontend.
+func (s *schedulerRequest) RequestKey() queue.RequestKey {
+	return queue.RequestKey{Source: s.frontendAddress, ID: s.queryID}
+}
+
+// Deadline implements queue.DeadlineRequest: the request is no longer wanted once the query-frontend
+// has given up on it. The request context is bound to the query-frontend connection, not to the client
+// request, so the deadline is taken from the ENQUEUE message.
+func (s *schedulerRequest) Deadline() (time.Time, bool) {
+	return s.deadline, !s.deadline.IsZero()
+}
+
+// requestDeadline returns the deadline carried by the ENQUEUE message, or the zero time if there is none.
+func requestDeadline(msg *schedulerpb.FrontendToScheduler) time.Time {
+	if msg.DeadlineUnixNano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, msg.DeadlineUnixNano)
 }
 
 // FrontendLoop handles connection from frontend.
@@ -254,7 +364,10 @@ func (s *Scheduler) FrontendLoop(frontend schedulerpb.SchedulerForFrontend_Front
 			err = s.enqueueRequest(reqCtx, frontendAddress, msg)
 			switch {
 			case err == nil:
-				resp = &schedulerpb.SchedulerToFrontend{Status: schedulerpb.OK}
+				resp = &schedulerpb.SchedulerToFrontend{
+					Status:             schedulerpb.OK,
+					TenantBackpressure: s.requestQueue.TenantUnderBackpressure(msg.UserID),
+				}
 			case errors.Is(err, queue.ErrTooManyRequests):
 				enqueueSpan.LogKV("error", err.Error())
 				resp = &schedulerpb.SchedulerToFrontend{Status: schedulerpb.TOO_MANY_REQUESTS_PER_TENANT}
@@ -303,6 +416,10 @@ func (s *Scheduler) frontendConnected(frontend schedulerpb.SchedulerForFrontend_
 		}
 		cf.ctx, cf.cancel = context.WithCancel(context.Background())
 		s.connectedFrontends[msg.FrontendAddress] = cf
+
+		if s.queueSnapshots != nil {
+			s.linkRestoredRequestsToFrontend(cf.ctx, msg.FrontendAddress)
+		}
 	}
 
 	cf.connections++
@@ -339,6 +456,7 @@ func (s *Scheduler) enqueueRequest(requestContext context.Context, frontendAddr
 		queryID:         msg.QueryID,
 		request:         msg.HttpRequest,
 		statsEnabled:    msg.StatsEnabled,
+		deadline:        requestDeadline(msg),
 	}
 
 	now := time.Now()
@@ -348,15 +466,13 @@ func (s *Scheduler) enqueueRequest(requestContext context.Context, frontendAddr
 	req.enqueueTime = now
 	req.ctxCancel = cancel
 
-	// aggregate the max queriers limit in the case of a multi tenant query
-	tenantIDs, err := tenant.TenantIDsFromOrgID(userID)
+	maxQueriers, weight, err := s.tenantQueueLimits(userID)
 	if err != nil {
 		return err
 	}
-	maxQueriers := validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, s.limits.MaxQueriersPerUser)
 
 	s.activeUsers.UpdateUserTimestamp(userID, now)
-	return s.requestQueue.EnqueueRequestToDispatcher(userID, req, maxQueriers, func() {
+	return s.requestQueue.EnqueueRequestToDispatcher(userID, req, maxQueriers, weight, func() {
 		shouldCancel = false
 
 		s.pendingRequestsMu.Lock()
@@ -365,6 +481,18 @@ func (s *Scheduler) enqueueRequest(requestContext context.Context, frontendAddr
 	})
 }
 
+// tenantQueueLimits returns the max queriers and the queue weight the requests of userID are enqueued with.
+func (s *Scheduler) tenantQueueLimits(userID string) (maxQueriers, weight int, err error) {
+	// aggregate the max queriers limit and the queue weight in the case of a multi tenant query
+	tenantIDs, err := tenant.TenantIDsFromOrgID(userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	maxQueriers = validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, s.limits.MaxQueriersPerUser)
+	weight = validation.SmallestPositiveNonZeroIntPerTenant(tenantIDs, s.limits.TenantQueueWeight)
+	return maxQueriers, weight, nil
+}
+
 // This method doesn't do removal from the queue.
 func (s *Scheduler) cancelRequestAndRemoveFromPending(frontendAddr string, queryID uint64) {
 	s.pendingRequestsMu.Lock()
@@ -379,6 +507,21 @@ func (s *Scheduler) cancelRequestAndRemoveFromPending(frontendAddr string, query
 	delete(s.pendingRequests, key)
 }
 
+// requestExpired is called by the request queue with each request it dropped past its deadline. The request
+// is cancelled, and its query-frontend is told, in case it still waits for a response.
+func (s *Scheduler) requestExpired(req queue.Request) {
+	r := req.(*schedulerRequest)
+	r.queueSpan.Finish()
+	s.cancelRequestAndRemoveFromPending(r.frontendAddress, r.queryID)
+
+	// The request queue must not be blocked by the query-frontend.
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), expiredRequestReportTimeout)
+		defer cancel()
+		s.forwardErrorToFrontend(ctx, r, http.StatusGatewayTimeout, errRequestExpired)
+	}()
+}
+
 // QuerierLoop is started by querier to receive queries from scheduler.
 func (s *Scheduler) QuerierLoop(querier schedulerpb.SchedulerForQuerier_QuerierLoopServer) error {
 	resp, err := querier.Recv()
@@ -387,6 +530,8 @@ func (s *Scheduler) QuerierLoop(querier schedulerpb.SchedulerForQuerier_QuerierL
 	}
 
 	querierID := resp.GetQuerierID()
+	// the query component the querier worker is reserved for, if any
+	queryComponent := querycomponent.Parse(resp.GetQueryComponent())
 
 	s.requestQueue.RegisterQuerierConnection(querierID)
 	defer s.requestQueue.UnregisterQuerierConnection(querierID)
@@ -395,7 +540,7 @@ func (s *Scheduler) QuerierLoop(querier schedulerpb.SchedulerForQuerier_QuerierL
 
 	// In stopping state scheduler is not accepting new queries, but still dispatching queries in the queues.
 	for s.isRunningOrStopping() {
-		req, idx, err := s.requestQueue.GetNextRequestForQuerier(querier.Context(), lastUserIndex, querierID)
+		req, idx, err := s.requestQueue.GetNextRequestForQuerier(querier.Context(), lastUserIndex, querierID, queryComponent)
 		if err != nil {
 			// Return a more clear error if the queue is stopped because the query-scheduler is not running.
 			if errors.Is(err, queue.ErrStopped) && !s.isRunning() {
@@ -422,9 +567,11 @@ func (s *Scheduler) QuerierLoop(querier schedulerpb.SchedulerForQuerier_QuerierL
 		  before an active request was handled for the tenant in question.
 		  If this tenant meanwhile continued to queue requests,
 		  it's possible that its own queue would perpetually contain only expired requests.
+		  Requests restored from a queue snapshot whose query-frontend didn't reconnect are skipped likewise.
 		*/
 
-		if r.ctx.Err() != nil {
+		if r.ctx.Err() != nil || (r.restored && !r.frontendLinked.Load()) {
+			s.requestQueue.CompleteRequest(r)
 			// Remove from pending requests.
 			s.cancelRequestAndRemoveFromPending(r.frontendAddress, r.queryID)
 
@@ -432,7 +579,10 @@ func (s *Scheduler) QuerierLoop(querier schedulerpb.SchedulerForQuerier_QuerierL
 			continue
 		}
 
-		if err := s.forwardRequestToQuerier(querier, r, queueTime); err != nil {
+		err = s.forwardRequestToQuerier(querier, r, queueTime)
+		// The querier is done with the request once it has been forwarded, whether it succeeded or not.
+		s.requestQueue.CompleteRequest(r)
+		if err != nil {
 			return err
 		}
 	}
@@ -485,13 +635,13 @@ func (s *Scheduler) forwardRequestToQuerier(querier schedulerpb.SchedulerForQuer
 		// then error out this upstream request _and_ stream.
 
 		if err != nil {
-			s.forwardErrorToFrontend(req.ctx, req, err)
+			s.forwardErrorToFrontend(req.ctx, req, http.StatusInternalServerError, err)
 		}
 		return err
 	}
 }
 
-func (s *Scheduler) forwardErrorToFrontend(ctx context.Context, req *schedulerRequest, requestErr error) {
+func (s *Scheduler) forwardErrorToFrontend(ctx context.Context, req *schedulerRequest, code int32, requestErr error) {
 	opts, err := s.cfg.GRPCClientConfig.DialOption([]grpc.UnaryClientInterceptor{
 		otgrpc.OpenTracingClientInterceptor(opentracing.GlobalTracer()),
 		middleware.ClientUserHeaderInterceptor},
@@ -517,7 +667,7 @@ func (s *Scheduler) forwardErrorToFrontend(ctx context.Context, req *schedulerRe
 	_, err = client.QueryResult(userCtx, &frontendv2pb.QueryResultRequest{
 		QueryID: req.queryID,
 		HttpResponse: &httpgrpc.HTTPResponse{
-			Code: http.StatusInternalServerError,
+			Code: code,
 			Body: []byte(requestErr.Error()),
 		},
 	})
@@ -541,10 +691,16 @@ func (s *Scheduler) isRunningOrStopping() bool {
 func (s *Scheduler) starting(ctx context.Context) error {
 	s.subservicesWatcher.WatchManager(s.subservices)
 
+	// Read the queue snapshot before the subservices start, as they include the periodic queue snapshots.
+	snapshot := s.readQueueSnapshot()
+
 	if err := services.StartManagerAndAwaitHealthy(ctx, s.subservices); err != nil {
 		return errors.Wrap(err, "unable to start scheduler subservices")
 	}
 
+	if snapshot != nil {
+		s.restoreQueueSnapshot(ctx, snapshot)
+	}
 	return nil
 }
 
@@ -581,6 +737,8 @@ func (s *Scheduler) stopping(_ error) error {
 func (s *Scheduler) cleanupMetricsForInactiveUser(user string) {
 	s.queueLength.DeleteLabelValues(user)
 	s.discardedRequests.DeleteLabelValues(user)
+	s.expiredRequests.DeleteLabelValues(user)
+	s.tenantQueueHistograms.DeleteTenant(user)
 	s.cancelledRequests.DeleteLabelValues(user)
 }
 
@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -43,9 +45,16 @@ func TestMain(m *testing.M) {
 }
 
 func setupScheduler(t *testing.T, reg prometheus.Registerer) (*Scheduler, schedulerpb.SchedulerForFrontendClient, schedulerpb.SchedulerForQuerierClient) {
+	return setupSchedulerWithConfig(t, reg, nil)
+}
+
+func setupSchedulerWithConfig(t *testing.T, reg prometheus.Registerer, configure func(cfg *Config)) (*Scheduler, schedulerpb.SchedulerForFrontendClient, schedulerpb.SchedulerForQuerierClient) {
 	cfg := Config{}
 	flagext.DefaultValues(&cfg)
 	cfg.MaxOutstandingPerTenant = testMaxOutstandingPerTenant
+	if configure != nil {
+		configure(&cfg)
+	}
 
 	s, err := NewScheduler(cfg, &limits{queriers: 2}, log.NewNopLogger(), reg)
 	require.NoError(t, err)
@@ -133,6 +142,35 @@ func TestSchedulerEnqueueWithCancel(t *testing.T) {
 	verifyNoPendingRequestsLeft(t, scheduler)
 }
 
+func TestSchedulerDoesNotDispatchRequestsPastTheirDeadline(t *testing.T) {
+	scheduler, frontendClient, querierClient := setupScheduler(t, nil)
+	fm, frontendAddress := setupFrontendMock(t)
+
+	frontendLoop := initFrontendLoop(t, frontendClient, frontendAddress)
+	frontendToScheduler(t, frontendLoop, &schedulerpb.FrontendToScheduler{
+		Type:             schedulerpb.ENQUEUE,
+		QueryID:          1,
+		UserID:           "test",
+		HttpRequest:      &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello"},
+		DeadlineUnixNano: time.Now().Add(-time.Second).UnixNano(),
+	})
+
+	querierLoop := initQuerierLoop(t, querierClient, "querier-1")
+	verifyQuerierDoesntReceiveRequest(t, querierLoop, 500*time.Millisecond)
+	verifyNoPendingRequestsLeft(t, scheduler)
+
+	// the frontend is told the request expired
+	test.Poll(t, 2*time.Second, true, func() interface{} {
+		resp := fm.getRequest(1)
+		if resp == nil {
+			return false
+		}
+
+		require.Equal(t, int32(http.StatusGatewayTimeout), resp.Code)
+		return true
+	})
+}
+
 func initQuerierLoop(t *testing.T, querierClient schedulerpb.SchedulerForQuerierClient, querier string) schedulerpb.SchedulerForQuerier_QuerierLoopClient {
 	querierLoop, err := querierClient.QuerierLoop(context.Background())
 	require.NoError(t, err)
@@ -373,30 +411,161 @@ func TestSchedulerMaxOutstandingRequests(t *testing.T) {
 	require.Greater(t, len(spans), 0, "expected at least one span even if rejected by queue full")
 }
 
-func TestSchedulerForwardsErrorToFrontend(t *testing.T) {
-	_, frontendClient, querierClient := setupScheduler(t, nil)
-
-	fm := &frontendMock{resp: map[uint64]*httpgrpc.HTTPResponse{}}
-	frontendAddress := ""
+func TestSchedulerSignalsTenantBackpressure(t *testing.T) {
+	_, frontendClient, _ := setupSchedulerWithConfig(t, nil, func(cfg *Config) {
+		cfg.BackpressureQueueLength = 3
+	})
+	frontendLoop := initFrontendLoop(t, frontendClient, "frontend-12345")
 
-	// Setup frontend grpc server
-	{
-		frontendGrpcServer := grpc.NewServer()
-		frontendv2pb.RegisterFrontendForQuerierServer(frontendGrpcServer, fm)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, frontendLoop.Send(&schedulerpb.FrontendToScheduler{
+			Type:        schedulerpb.ENQUEUE,
+			QueryID:     uint64(i),
+			UserID:      "test",
+			HttpRequest: &httpgrpc.HTTPRequest{},
+		}))
 
-		l, err := net.Listen("tcp", "localhost:0")
+		msg, err := frontendLoop.Recv()
 		require.NoError(t, err)
+		require.Equal(t, schedulerpb.OK, msg.Status)
+		// the backpressure is signalled from the enqueue which takes the queue length to the backpressure queue length
+		require.Equal(t, i >= 2, msg.TenantBackpressure, "query %d", i)
+	}
+}
 
-		frontendAddress = l.Addr().String()
-
-		go func() {
-			_ = frontendGrpcServer.Serve(l)
-		}()
+func TestConfig_Validate(t *testing.T) {
+	tests := map[string]struct {
+		setup       func(cfg *Config)
+		expectedErr error
+	}{
+		"should pass with the default config": {
+			setup: func(*Config) {},
+		},
+		"should pass with a backpressure queue length lower than the max outstanding requests per tenant": {
+			setup: func(cfg *Config) {
+				cfg.BackpressureQueueLength = cfg.MaxOutstandingPerTenant - 1
+			},
+		},
+		"should fail with a backpressure queue length not lower than the max outstanding requests per tenant": {
+			setup: func(cfg *Config) {
+				cfg.BackpressureQueueLength = cfg.MaxOutstandingPerTenant
+			},
+			expectedErr: errInvalidBackpressureQueueLength,
+		},
+		"should fail with a queue snapshot path but no queue snapshot interval": {
+			setup: func(cfg *Config) {
+				cfg.QueueSnapshotPath = "snapshot"
+				cfg.QueueSnapshotInterval = 0
+			},
+			expectedErr: errInvalidQueueSnapshotInterval,
+		},
+	}
 
-		t.Cleanup(func() {
-			_ = l.Close()
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			cfg := Config{}
+			flagext.DefaultValues(&cfg)
+			testData.setup(&cfg)
+			require.ErrorIs(t, cfg.Validate(), testData.expectedErr)
 		})
 	}
+}
+
+func TestSchedulerRestoresQueueSnapshot(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "queue-snapshot.json")
+	configure := func(cfg *Config) {
+		cfg.QueueSnapshotPath = snapshotPath
+		cfg.QueueSnapshotInterval = time.Hour
+	}
+
+	scheduler, frontendClient, _ := setupSchedulerWithConfig(t, nil, configure)
+	frontendLoop := initFrontendLoop(t, frontendClient, "frontend-12345")
+	frontendToScheduler(t, frontendLoop, &schedulerpb.FrontendToScheduler{
+		Type:         schedulerpb.ENQUEUE,
+		QueryID:      1,
+		UserID:       "test",
+		HttpRequest:  &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello"},
+		StatsEnabled: true,
+	})
+
+	// with no querier connected, the request is left in the queue snapshot written on shutdown
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), scheduler))
+	require.FileExists(t, snapshotPath)
+
+	// restart
+	scheduler, frontendClient, querierClient := setupSchedulerWithConfig(t, nil, configure)
+	// the snapshot is consumed by the restore, so that a second restart doesn't restore the requests again
+	require.NoFileExists(t, snapshotPath)
+	// the restored request is only dispatched once its query-frontend reconnected
+	initFrontendLoop(t, frontendClient, "frontend-12345")
+	querierLoop := initQuerierLoop(t, querierClient, "querier-1")
+
+	msg, err := querierLoop.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), msg.QueryID)
+	require.Equal(t, "frontend-12345", msg.FrontendAddress)
+	require.Equal(t, "/hello", msg.HttpRequest.Url)
+	require.True(t, msg.StatsEnabled)
+	require.NoError(t, querierLoop.Send(&schedulerpb.QuerierToScheduler{}))
+
+	verifyNoPendingRequestsLeft(t, scheduler)
+}
+
+func TestSchedulerDoesNotDispatchRestoredRequestsOfDisconnectedFrontends(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "queue-snapshot.json")
+	configure := func(cfg *Config) {
+		cfg.QueueSnapshotPath = snapshotPath
+		cfg.QueueSnapshotInterval = time.Hour
+	}
+
+	scheduler, frontendClient, _ := setupSchedulerWithConfig(t, nil, configure)
+	frontendLoop := initFrontendLoop(t, frontendClient, "frontend-12345")
+	frontendToScheduler(t, frontendLoop, &schedulerpb.FrontendToScheduler{
+		Type:        schedulerpb.ENQUEUE,
+		QueryID:     1,
+		UserID:      "test",
+		HttpRequest: &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello"},
+	})
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), scheduler))
+
+	// restart, without the query-frontend reconnecting
+	scheduler, _, querierClient := setupSchedulerWithConfig(t, nil, configure)
+	querierLoop := initQuerierLoop(t, querierClient, "querier-1")
+	verifyQuerierDoesntReceiveRequest(t, querierLoop, 500*time.Millisecond)
+	verifyNoPendingRequestsLeft(t, scheduler)
+}
+
+func TestSchedulerDoesNotRestoreStaleQueueSnapshot(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "queue-snapshot.json")
+	configure := func(cfg *Config) {
+		cfg.QueueSnapshotPath = snapshotPath
+		cfg.QueueSnapshotInterval = time.Minute
+	}
+
+	scheduler, frontendClient, _ := setupSchedulerWithConfig(t, nil, configure)
+	frontendLoop := initFrontendLoop(t, frontendClient, "frontend-12345")
+	frontendToScheduler(t, frontendLoop, &schedulerpb.FrontendToScheduler{
+		Type:        schedulerpb.ENQUEUE,
+		QueryID:     1,
+		UserID:      "test",
+		HttpRequest: &httpgrpc.HTTPRequest{Method: "GET", Url: "/hello"},
+	})
+	require.NoError(t, services.StopAndAwaitTerminated(context.Background(), scheduler))
+
+	// the snapshot was written longer than an interval ago
+	written := time.Now().Add(-2 * time.Minute)
+	require.NoError(t, os.Chtimes(snapshotPath, written, written))
+
+	scheduler, _, querierClient := setupSchedulerWithConfig(t, nil, configure)
+	require.NoFileExists(t, snapshotPath)
+	querierLoop := initQuerierLoop(t, querierClient, "querier-1")
+	verifyQuerierDoesntReceiveRequest(t, querierLoop, 500*time.Millisecond)
+	verifyNoPendingRequestsLeft(t, scheduler)
+}
+
+func TestSchedulerForwardsErrorToFrontend(t *testing.T) {
+	_, frontendClient, querierClient := setupScheduler(t, nil)
+	fm, frontendAddress := setupFrontendMock(t)
 
 	// After preparations, start frontend and querier.
 	frontendLoop := initFrontendLoop(t, frontendClient, frontendAddress)
@@ -433,6 +602,25 @@ func TestSchedulerForwardsErrorToFrontend(t *testing.T) {
 	})
 }
 
+func setupFrontendMock(t *testing.T) (*frontendMock, string) {
+	fm := &frontendMock{resp: map[uint64]*httpgrpc.HTTPResponse{}}
+
+	frontendGrpcServer := grpc.NewServer()
+	frontendv2pb.RegisterFrontendForQuerierServer(frontendGrpcServer, fm)
+
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	go func() {
+		_ = frontendGrpcServer.Serve(l)
+	}()
+
+	t.Cleanup(func() {
+		_ = l.Close()
+	})
+	return fm, l.Addr().String()
+}
+
 func TestSchedulerQueueMetrics(t *testing.T) {
 	reg := prometheus.NewPedanticRegistry()
 
@@ -562,6 +750,10 @@ func (l limits) MaxQueriersPerUser(_ string) int {
 	return l.queriers
 }
 
+func (l limits) TenantQueueWeight(_ string) int {
+	return 1
+}
+
 type frontendMock struct {
 	mu   sync.Mutex
 	resp map[uint64]*httpgrpc.HTTPResponse
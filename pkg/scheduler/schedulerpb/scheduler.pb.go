@@ -85,7 +85,8 @@ func (SchedulerToFrontendStatus) EnumDescriptor() ([]byte, []int) {
 // Querier reports its own clientID when it connects, so that scheduler knows how many *different* queriers are connected.
 // To signal that querier is ready to accept another request, querier sends empty message.
 type QuerierToScheduler struct {
-	QuerierID string `protobuf:"bytes,1,opt,name=querierID,proto3" json:"querierID,omitempty"`
+	QuerierID      string `protobuf:"bytes,1,opt,name=querierID,proto3" json:"querierID,omitempty"`
+	QueryComponent string `protobuf:"bytes,2,opt,name=queryComponent,proto3" json:"queryComponent,omitempty"`
 }
 
 func (m *QuerierToScheduler) Reset()      { *m = QuerierToScheduler{} }
@@ -127,6 +128,13 @@ func (m *QuerierToScheduler) GetQuerierID() string {
 	return ""
 }
 
+func (m *QuerierToScheduler) GetQueryComponent() string {
+	if m != nil {
+		return m.QueryComponent
+	}
+	return ""
+}
+
 type SchedulerToQuerier struct {
 	// Query ID as reported by frontend. When querier sends the response back to frontend (using frontendAddress),
 	// it identifies the query by using this ID.
@@ -228,6 +236,9 @@ type FrontendToScheduler struct {
 	UserID       string                `protobuf:"bytes,4,opt,name=userID,proto3" json:"userID,omitempty"`
 	HttpRequest  *httpgrpc.HTTPRequest `protobuf:"bytes,5,opt,name=httpRequest,proto3" json:"httpRequest,omitempty"`
 	StatsEnabled bool                  `protobuf:"varint,6,opt,name=statsEnabled,proto3" json:"statsEnabled,omitempty"`
+	// Deadline of the request, as Unix time in nanoseconds, after which the frontend no longer waits for its response.
+	// 0 if the request has no deadline.
+	DeadlineUnixNano int64 `protobuf:"varint,7,opt,name=deadlineUnixNano,proto3" json:"deadlineUnixNano,omitempty"`
 }
 
 func (m *FrontendToScheduler) Reset()      { *m = FrontendToScheduler{} }
@@ -304,9 +315,19 @@ func (m *FrontendToScheduler) GetStatsEnabled() bool {
 	return false
 }
 
+func (m *FrontendToScheduler) GetDeadlineUnixNano() int64 {
+	if m != nil {
+		return m.DeadlineUnixNano
+	}
+	return 0
+}
+
 type SchedulerToFrontend struct {
 	Status SchedulerToFrontendStatus `protobuf:"varint,1,opt,name=status,proto3,enum=schedulerpb.SchedulerToFrontendStatus" json:"status,omitempty"`
 	Error  string                    `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	// Set on OK responses to ENQUEUE when the queue of the request's tenant is nearly full, for the frontend
+	// to hold back the tenant's further requests rather than have them rejected by the scheduler.
+	TenantBackpressure bool `protobuf:"varint,3,opt,name=tenantBackpressure,proto3" json:"tenantBackpressure,omitempty"`
 }
 
 func (m *SchedulerToFrontend) Reset()      { *m = SchedulerToFrontend{} }
@@ -355,6 +376,13 @@ func (m *SchedulerToFrontend) GetError() string {
 	return ""
 }
 
+func (m *SchedulerToFrontend) GetTenantBackpressure() bool {
+	if m != nil {
+		return m.TenantBackpressure
+	}
+	return false
+}
+
 type NotifyQuerierShutdownRequest struct {
 	QuerierID string `protobuf:"bytes,1,opt,name=querierID,proto3" json:"querierID,omitempty"`
 }
@@ -447,49 +475,52 @@ func init() {
 func init() { proto.RegisterFile("scheduler.proto", fileDescriptor_2b3fc28395a6d9c5) }
 
 var fileDescriptor_2b3fc28395a6d9c5 = []byte{
-	// 660 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x54, 0x3d, 0x4f, 0xdb, 0x50,
-	0x14, 0xf5, 0xcb, 0x87, 0x81, 0x1b, 0x0a, 0xee, 0x03, 0xda, 0x34, 0xa2, 0xc6, 0xb2, 0x2a, 0x94,
-	0x32, 0x24, 0x28, 0x1d, 0xda, 0x01, 0x55, 0x4a, 0xc1, 0x94, 0xa8, 0xd4, 0x81, 0x97, 0x17, 0xf5,
-	0x63, 0x89, 0x92, 0xf8, 0x91, 0x44, 0x80, 0x9f, 0xf1, 0x87, 0xaa, 0x6c, 0x1d, 0x3b, 0xf6, 0x67,
-	0xf4, 0xa7, 0x74, 0x64, 0x64, 0xe8, 0x50, 0xcc, 0xd2, 0x91, 0xa5, 0x7b, 0x15, 0xc7, 0x49, 0x9d,
-	0x90, 0x00, 0xdb, 0x7d, 0x27, 0xe7, 0xc4, 0xf7, 0x9c, 0x7b, 0xdf, 0x83, 0x45, 0xa7, 0xd9, 0x66,
-	0x86, 0x77, 0xc2, 0xec, 0x9c, 0x65, 0x73, 0x97, 0xe3, 0xd4, 0x10, 0xb0, 0x1a, 0x99, 0xe5, 0x16,
-	0x6f, 0xf1, 0x00, 0xcf, 0xf7, 0xaa, 0x3e, 0x25, 0xb3, 0xd9, 0xea, 0xb8, 0x6d, 0xaf, 0x91, 0x6b,
-	0xf2, 0xd3, 0x7c, 0xcb, 0xae, 0x1f, 0xd5, 0xcd, 0x7a, 0xde, 0x70, 0x8e, 0x3b, 0x6e, 0xbe, 0xed,
-	0xba, 0x56, 0xcb, 0xb6, 0x9a, 0xc3, 0xa2, 0xaf, 0x50, 0x0b, 0x80, 0x0f, 0x3d, 0x66, 0x77, 0x98,
-	0x4d, 0x79, 0x65, 0xf0, 0xff, 0x78, 0x15, 0xe6, 0xce, 0xfa, 0x68, 0x69, 0x27, 0x8d, 0x14, 0x94,
-	0x9d, 0x23, 0xff, 0x01, 0xf5, 0x2f, 0x02, 0x3c, 0xe4, 0x52, 0x1e, 0xea, 0x71, 0x1a, 0x66, 0x7a,
-	0x9c, 0x6e, 0x28, 0x49, 0x90, 0xc1, 0x11, 0xbf, 0x84, 0x54, 0xef, 0xb3, 0x84, 0x9d, 0x79, 0xcc,
-	0x71, 0xd3, 0x31, 0x05, 0x65, 0x53, 0x85, 0x95, 0xdc, 0xb0, 0x95, 0x3d, 0x4a, 0x0f, 0xc2, 0x1f,
-	0x49, 0x94, 0x89, 0xb3, 0xb0, 0x78, 0x64, 0x73, 0xd3, 0x65, 0xa6, 0x51, 0x34, 0x0c, 0x9b, 0x39,
-	0x4e, 0x3a, 0x1e, 0x74, 0x33, 0x0e, 0xe3, 0x47, 0x20, 0x7a, 0x4e, 0xd0, 0x6e, 0x22, 0x20, 0x84,
-	0x27, 0xac, 0xc2, 0xbc, 0xe3, 0xd6, 0x5d, 0x47, 0x33, 0xeb, 0x8d, 0x13, 0x66, 0xa4, 0x93, 0x0a,
-	0xca, 0xce, 0x92, 0x11, 0x0c, 0xaf, 0xc3, 0xc2, 0x99, 0xc7, 0x3c, 0x46, 0x3b, 0xa7, 0x4c, 0xaf,
-	0x9b, 0xdc, 0x49, 0x8b, 0x0a, 0xca, 0xc6, 0xc9, 0x18, 0xaa, 0x7e, 0x8b, 0xc1, 0xd2, 0x6e, 0xf8,
-	0xdd, 0x68, 0x5a, 0xaf, 0x20, 0xe1, 0x76, 0x2d, 0x16, 0xb8, 0x5e, 0x28, 0x3c, 0xcb, 0x45, 0xe6,
-	0x94, 0x9b, 0xc0, 0xa7, 0x5d, 0x8b, 0x91, 0x40, 0x31, 0xc9, 0x5f, 0x6c, 0xb2, 0xbf, 0x48, 0xb8,
-	0xf1, 0xd1, 0x70, 0xa7, 0x39, 0x1f, 0x0b, 0x3d, 0x79, 0xef, 0xd0, 0xc7, 0x23, 0x13, 0x6f, 0x46,
-	0xa6, 0x1e, 0xc3, 0x52, 0x64, 0x03, 0x06, 0x26, 0xf1, 0x6b, 0x10, 0x7b, 0x34, 0xcf, 0x09, 0xb3,
-	0x58, 0x1f, 0xc9, 0x62, 0x82, 0xa2, 0x12, 0xb0, 0x49, 0xa8, 0xc2, 0xcb, 0x90, 0x64, 0xb6, 0xcd,
-	0xed, 0x30, 0x85, 0xfe, 0x41, 0xdd, 0x82, 0x55, 0x9d, 0xbb, 0x9d, 0xa3, 0x6e, 0xb8, 0x69, 0x95,
-	0xb6, 0xe7, 0x1a, 0xfc, 0x8b, 0x39, 0x68, 0xf8, 0xf6, 0x6d, 0x5d, 0x83, 0xa7, 0x53, 0xd4, 0x8e,
-	0xc5, 0x4d, 0x87, 0x6d, 0x6c, 0xc1, 0xe3, 0x29, 0x53, 0xc2, 0xb3, 0x90, 0x28, 0xe9, 0x25, 0x2a,
-	0x09, 0x38, 0x05, 0x33, 0x9a, 0x7e, 0x58, 0xd5, 0xaa, 0x9a, 0x84, 0x30, 0x80, 0xb8, 0x5d, 0xd4,
-	0xb7, 0xb5, 0x7d, 0x29, 0xb6, 0xd1, 0x84, 0x27, 0x53, 0x7d, 0x61, 0x11, 0x62, 0xe5, 0x77, 0x92,
-	0x80, 0x15, 0x58, 0xa5, 0xe5, 0x72, 0xed, 0x7d, 0x51, 0xff, 0x54, 0x23, 0xda, 0x61, 0x55, 0xab,
-	0xd0, 0x4a, 0xed, 0x40, 0x23, 0x35, 0xaa, 0xe9, 0x45, 0x9d, 0x4a, 0x08, 0xcf, 0x41, 0x52, 0x23,
-	0xa4, 0x4c, 0xa4, 0x18, 0x7e, 0x08, 0x0f, 0x2a, 0x7b, 0x55, 0x4a, 0x4b, 0xfa, 0xdb, 0xda, 0x4e,
-	0xf9, 0x83, 0x2e, 0xc5, 0x0b, 0xbf, 0x50, 0x24, 0xef, 0x5d, 0x6e, 0x0f, 0xae, 0x5c, 0x15, 0x52,
-	0x61, 0xb9, 0xcf, 0xb9, 0x85, 0xd7, 0x46, 0xe2, 0xbe, 0x79, 0xaf, 0x33, 0x6b, 0xd3, 0xe6, 0x11,
-	0x72, 0x55, 0x21, 0x8b, 0x36, 0x11, 0x36, 0x61, 0x65, 0x62, 0x64, 0xf8, 0xf9, 0x88, 0xfe, 0xb6,
-	0xa1, 0x64, 0x36, 0xee, 0x43, 0xed, 0x4f, 0xa0, 0x60, 0xc1, 0x72, 0xd4, 0xdd, 0x70, 0x9d, 0x3e,
-	0xc2, 0xfc, 0xa0, 0x0e, 0xfc, 0x29, 0x77, 0x5d, 0xad, 0x8c, 0x72, 0xd7, 0xc2, 0xf5, 0x1d, 0xbe,
-	0x29, 0x9e, 0x5f, 0xca, 0xc2, 0xc5, 0xa5, 0x2c, 0x5c, 0x5f, 0xca, 0xe8, 0xab, 0x2f, 0xa3, 0x1f,
-	0xbe, 0x8c, 0x7e, 0xfa, 0x32, 0x3a, 0xf7, 0x65, 0xf4, 0xdb, 0x97, 0xd1, 0x1f, 0x5f, 0x16, 0xae,
-	0x7d, 0x19, 0x7d, 0xbf, 0x92, 0x85, 0xf3, 0x2b, 0x59, 0xb8, 0xb8, 0x92, 0x85, 0xcf, 0xd1, 0x17,
-	0xb8, 0x21, 0x06, 0x0f, 0xe8, 0x8b, 0x7f, 0x01, 0x00, 0x00, 0xff, 0xff, 0x9d, 0xe2, 0x46, 0x88,
-	0xa8, 0x05, 0x00, 0x00,
+	// 718 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x95, 0xbf, 0x52, 0xdb, 0x4a,
+	0x14, 0xc6, 0xb5, 0xfe, 0x07, 0x1c, 0x73, 0x41, 0x77, 0x81, 0x7b, 0x1d, 0x0f, 0x11, 0x1e, 0x4d,
+	0x86, 0x71, 0x5c, 0xd8, 0x8c, 0x53, 0x24, 0x05, 0x93, 0x19, 0x03, 0x22, 0x78, 0x42, 0x64, 0x90,
+	0xe5, 0x49, 0x42, 0xe3, 0x91, 0xad, 0xc5, 0xf6, 0x00, 0xbb, 0x42, 0x5a, 0x4d, 0xe2, 0x2e, 0x8f,
+	0x90, 0x3e, 0x2f, 0x90, 0x07, 0xc8, 0x43, 0xa4, 0xa4, 0xa4, 0x48, 0x11, 0x4c, 0x93, 0x92, 0x26,
+	0x7d, 0xc6, 0xb2, 0xec, 0xc8, 0x46, 0x06, 0xba, 0xdd, 0xa3, 0xef, 0x1c, 0xed, 0xf7, 0x3b, 0x67,
+	0x25, 0x58, 0x74, 0x9a, 0x6d, 0x62, 0xba, 0xa7, 0xc4, 0xce, 0x5b, 0x36, 0xe3, 0x0c, 0x27, 0x47,
+	0x01, 0xab, 0x91, 0x5e, 0x6e, 0xb1, 0x16, 0xf3, 0xe2, 0x85, 0xfe, 0x6a, 0x20, 0x49, 0x6f, 0xb4,
+	0x3a, 0xbc, 0xed, 0x36, 0xf2, 0x4d, 0x76, 0x56, 0x68, 0xd9, 0xc6, 0xb1, 0x41, 0x8d, 0x82, 0xe9,
+	0x9c, 0x74, 0x78, 0xa1, 0xcd, 0xb9, 0xd5, 0xb2, 0xad, 0xe6, 0x68, 0x31, 0xc8, 0x90, 0x8f, 0x00,
+	0x1f, 0xba, 0xc4, 0xee, 0x10, 0x5b, 0x67, 0xd5, 0x61, 0x7d, 0xbc, 0x0a, 0x73, 0xe7, 0x83, 0x68,
+	0x79, 0x27, 0x85, 0x32, 0x28, 0x3b, 0xa7, 0xfd, 0x0d, 0xe0, 0x75, 0x58, 0xe8, 0x6f, 0xba, 0xdb,
+	0xec, 0xcc, 0x62, 0x94, 0x50, 0x9e, 0x8a, 0x78, 0x92, 0x89, 0xa8, 0xfc, 0x1b, 0x01, 0x1e, 0xd5,
+	0xd4, 0x99, 0xff, 0x1e, 0x9c, 0x82, 0x19, 0x4f, 0xe8, 0x97, 0x8e, 0x69, 0xc3, 0x2d, 0x7e, 0x0e,
+	0xc9, 0xfe, 0xf1, 0x34, 0x72, 0xee, 0x12, 0x67, 0x50, 0x35, 0x59, 0x5c, 0xc9, 0x8f, 0x8e, 0xbc,
+	0xa7, 0xeb, 0x07, 0xfe, 0x43, 0x2d, 0xa8, 0xc4, 0x59, 0x58, 0x3c, 0xb6, 0x19, 0xe5, 0x84, 0x9a,
+	0x25, 0xd3, 0xb4, 0x89, 0xe3, 0xa4, 0xa2, 0xde, 0x91, 0x26, 0xc3, 0xf8, 0x3f, 0x48, 0xb8, 0x8e,
+	0x67, 0x2b, 0xe6, 0x09, 0xfc, 0x1d, 0x96, 0x61, 0xde, 0xe1, 0x06, 0x77, 0x14, 0x6a, 0x34, 0x4e,
+	0x89, 0x99, 0x8a, 0x67, 0x50, 0x76, 0x56, 0x1b, 0x8b, 0xf9, 0xbe, 0x5d, 0xa2, 0x77, 0xce, 0x88,
+	0x6a, 0x50, 0xe6, 0xa4, 0x12, 0x19, 0x94, 0x8d, 0x6a, 0x13, 0x51, 0xf9, 0x5b, 0x04, 0x96, 0x76,
+	0xfd, 0xf7, 0x06, 0xa9, 0xbe, 0x80, 0x18, 0xef, 0x5a, 0xc4, 0x73, 0xbd, 0x50, 0x7c, 0x92, 0x0f,
+	0xf4, 0x33, 0x1f, 0xa2, 0xd7, 0xbb, 0x16, 0xd1, 0xbc, 0x8c, 0x30, 0x7f, 0x91, 0x70, 0x7f, 0x01,
+	0xb8, 0xd1, 0x71, 0xb8, 0xd3, 0x9c, 0x4f, 0x40, 0x8f, 0x3f, 0x18, 0xfa, 0x24, 0xb2, 0x44, 0x08,
+	0xb2, 0x1c, 0x88, 0x26, 0x31, 0xcc, 0xd3, 0x0e, 0x25, 0x35, 0xda, 0xf9, 0xd8, 0xe7, 0x93, 0x9a,
+	0xf1, 0xa0, 0xdd, 0x8a, 0xcb, 0x5f, 0x10, 0x2c, 0x05, 0xc6, 0x65, 0x48, 0x04, 0xbf, 0x84, 0x44,
+	0xbf, 0xa6, 0xeb, 0xf8, 0xe0, 0xd6, 0xc7, 0xc0, 0x85, 0x64, 0x54, 0x3d, 0xb5, 0xe6, 0x67, 0xe1,
+	0x65, 0x88, 0x13, 0xdb, 0x66, 0xb6, 0x8f, 0x6c, 0xb0, 0xc1, 0x79, 0xc0, 0x9c, 0x50, 0x83, 0xf2,
+	0x2d, 0xa3, 0x79, 0x62, 0xf5, 0xd9, 0xb9, 0x36, 0xf1, 0x98, 0xcd, 0x6a, 0x21, 0x4f, 0xe4, 0x4d,
+	0x58, 0x55, 0x19, 0xef, 0x1c, 0x77, 0xfd, 0x31, 0xae, 0xb6, 0x5d, 0x6e, 0xb2, 0x0f, 0x74, 0x48,
+	0xe3, 0xce, 0x2b, 0x23, 0xaf, 0xc1, 0xe3, 0x29, 0xd9, 0x8e, 0xc5, 0xa8, 0x43, 0x72, 0x9b, 0xf0,
+	0xff, 0x94, 0x11, 0xc0, 0xb3, 0x10, 0x2b, 0xab, 0x65, 0x5d, 0x14, 0x70, 0x12, 0x66, 0x14, 0xf5,
+	0xb0, 0xa6, 0xd4, 0x14, 0x11, 0x61, 0x80, 0xc4, 0x76, 0x49, 0xdd, 0x56, 0xf6, 0xc5, 0x48, 0xae,
+	0x09, 0x8f, 0xa6, 0x72, 0xc0, 0x09, 0x88, 0x54, 0x5e, 0x8b, 0x02, 0xce, 0xc0, 0xaa, 0x5e, 0xa9,
+	0xd4, 0xdf, 0x94, 0xd4, 0xf7, 0x75, 0x4d, 0x39, 0xac, 0x29, 0x55, 0xbd, 0x5a, 0x3f, 0x50, 0xb4,
+	0xba, 0xae, 0xa8, 0x25, 0x55, 0x17, 0x11, 0x9e, 0x83, 0xb8, 0xa2, 0x69, 0x15, 0x4d, 0x8c, 0xe0,
+	0x7f, 0xe1, 0x9f, 0xea, 0x5e, 0x4d, 0xd7, 0xcb, 0xea, 0xab, 0xfa, 0x4e, 0xe5, 0xad, 0x2a, 0x46,
+	0x8b, 0x3f, 0x82, 0xfd, 0xd9, 0x65, 0xf6, 0xf0, 0x3e, 0xd7, 0x20, 0xe9, 0x2f, 0xf7, 0x19, 0xb3,
+	0xf0, 0xda, 0x58, 0x7b, 0x6e, 0x7f, 0x5c, 0xd2, 0x6b, 0xd3, 0xfa, 0xe7, 0x6b, 0x65, 0x21, 0x8b,
+	0x36, 0x10, 0xa6, 0xb0, 0x12, 0x8a, 0x0c, 0x3f, 0x1d, 0xcb, 0xbf, 0xab, 0x29, 0xe9, 0xdc, 0x43,
+	0xa4, 0x83, 0x0e, 0x14, 0x2d, 0x58, 0x0e, 0xba, 0x1b, 0x8d, 0xdf, 0x3b, 0x98, 0x1f, 0xae, 0x3d,
+	0x7f, 0x99, 0xfb, 0xee, 0x6d, 0x3a, 0x73, 0xdf, 0x80, 0x0e, 0x1c, 0x6e, 0x95, 0x2e, 0xae, 0x24,
+	0xe1, 0xf2, 0x4a, 0x12, 0x6e, 0xae, 0x24, 0xf4, 0xa9, 0x27, 0xa1, 0xaf, 0x3d, 0x09, 0x7d, 0xef,
+	0x49, 0xe8, 0xa2, 0x27, 0xa1, 0x9f, 0x3d, 0x09, 0xfd, 0xea, 0x49, 0xc2, 0x4d, 0x4f, 0x42, 0x9f,
+	0xaf, 0x25, 0xe1, 0xe2, 0x5a, 0x12, 0x2e, 0xaf, 0x25, 0xe1, 0x28, 0xf8, 0x1b, 0x68, 0x24, 0xbc,
+	0xaf, 0xf8, 0xb3, 0x3f, 0x03, 0x00, 0x3b, 0x43, 0x7e, 0xa1, 0x2d, 0x06, 0x00, 0x00,
 }
 
 func (x FrontendToSchedulerType) String() string {
@@ -528,6 +559,9 @@ func (this *QuerierToScheduler) Equal(that interface{}) bool {
 	if this.QuerierID != that1.QuerierID {
 		return false
 	}
+	if this.QueryComponent != that1.QueryComponent {
+		return false
+	}
 	return true
 }
 func (this *SchedulerToQuerier) Equal(that interface{}) bool {
@@ -606,6 +640,9 @@ func (this *FrontendToScheduler) Equal(that interface{}) bool {
 	if this.StatsEnabled != that1.StatsEnabled {
 		return false
 	}
+	if this.DeadlineUnixNano != that1.DeadlineUnixNano {
+		return false
+	}
 	return true
 }
 func (this *SchedulerToFrontend) Equal(that interface{}) bool {
@@ -633,6 +670,9 @@ func (this *SchedulerToFrontend) Equal(that interface{}) bool {
 	if this.Error != that1.Error {
 		return false
 	}
+	if this.TenantBackpressure != that1.TenantBackpressure {
+		return false
+	}
 	return true
 }
 func (this *NotifyQuerierShutdownRequest) Equal(that interface{}) bool {
@@ -684,9 +724,10 @@ func (this *QuerierToScheduler) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 5)
+	s := make([]string, 0, 6)
 	s = append(s, "&schedulerpb.QuerierToScheduler{")
 	s = append(s, "QuerierID: "+fmt.Sprintf("%#v", this.QuerierID)+",\n")
+	s = append(s, "QueryComponent: "+fmt.Sprintf("%#v", this.QueryComponent)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -711,7 +752,7 @@ func (this *FrontendToScheduler) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 10)
+	s := make([]string, 0, 11)
 	s = append(s, "&schedulerpb.FrontendToScheduler{")
 	s = append(s, "Type: "+fmt.Sprintf("%#v", this.Type)+",\n")
 	s = append(s, "FrontendAddress: "+fmt.Sprintf("%#v", this.FrontendAddress)+",\n")
@@ -721,6 +762,7 @@ func (this *FrontendToScheduler) GoString() string {
 		s = append(s, "HttpRequest: "+fmt.Sprintf("%#v", this.HttpRequest)+",\n")
 	}
 	s = append(s, "StatsEnabled: "+fmt.Sprintf("%#v", this.StatsEnabled)+",\n")
+	s = append(s, "DeadlineUnixNano: "+fmt.Sprintf("%#v", this.DeadlineUnixNano)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -728,10 +770,11 @@ func (this *SchedulerToFrontend) GoString() string {
 	if this == nil {
 		return "nil"
 	}
-	s := make([]string, 0, 6)
+	s := make([]string, 0, 7)
 	s = append(s, "&schedulerpb.SchedulerToFrontend{")
 	s = append(s, "Status: "+fmt.Sprintf("%#v", this.Status)+",\n")
 	s = append(s, "Error: "+fmt.Sprintf("%#v", this.Error)+",\n")
+	s = append(s, "TenantBackpressure: "+fmt.Sprintf("%#v", this.TenantBackpressure)+",\n")
 	s = append(s, "}")
 	return strings.Join(s, "")
 }
@@ -1062,6 +1105,13 @@ func (m *QuerierToScheduler) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if len(m.QueryComponent) > 0 {
+		i -= len(m.QueryComponent)
+		copy(dAtA[i:], m.QueryComponent)
+		i = encodeVarintScheduler(dAtA, i, uint64(len(m.QueryComponent)))
+		i--
+		dAtA[i] = 0x12
+	}
 	if len(m.QuerierID) > 0 {
 		i -= len(m.QuerierID)
 		copy(dAtA[i:], m.QuerierID)
@@ -1161,6 +1211,11 @@ func (m *FrontendToScheduler) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.DeadlineUnixNano != 0 {
+		i = encodeVarintScheduler(dAtA, i, uint64(m.DeadlineUnixNano))
+		i--
+		dAtA[i] = 0x38
+	}
 	if m.StatsEnabled {
 		i--
 		if m.StatsEnabled {
@@ -1230,6 +1285,16 @@ func (m *SchedulerToFrontend) MarshalToSizedBuffer(dAtA []byte) (int, error) {
 	_ = i
 	var l int
 	_ = l
+	if m.TenantBackpressure {
+		i--
+		if m.TenantBackpressure {
+			dAtA[i] = 1
+		} else {
+			dAtA[i] = 0
+		}
+		i--
+		dAtA[i] = 0x18
+	}
 	if len(m.Error) > 0 {
 		i -= len(m.Error)
 		copy(dAtA[i:], m.Error)
@@ -1319,6 +1384,10 @@ func (m *QuerierToScheduler) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovScheduler(uint64(l))
 	}
+	l = len(m.QueryComponent)
+	if l > 0 {
+		n += 1 + l + sovScheduler(uint64(l))
+	}
 	return n
 }
 
@@ -1379,6 +1448,9 @@ func (m *FrontendToScheduler) Size() (n int) {
 	if m.StatsEnabled {
 		n += 2
 	}
+	if m.DeadlineUnixNano != 0 {
+		n += 1 + sovScheduler(uint64(m.DeadlineUnixNano))
+	}
 	return n
 }
 
@@ -1395,6 +1467,9 @@ func (m *SchedulerToFrontend) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovScheduler(uint64(l))
 	}
+	if m.TenantBackpressure {
+		n += 2
+	}
 	return n
 }
 
@@ -1432,6 +1507,7 @@ func (this *QuerierToScheduler) String() string {
 	}
 	s := strings.Join([]string{`&QuerierToScheduler{`,
 		`QuerierID:` + fmt.Sprintf("%v", this.QuerierID) + `,`,
+		`QueryComponent:` + fmt.Sprintf("%v", this.QueryComponent) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1462,6 +1538,7 @@ func (this *FrontendToScheduler) String() string {
 		`UserID:` + fmt.Sprintf("%v", this.UserID) + `,`,
 		`HttpRequest:` + strings.Replace(fmt.Sprintf("%v", this.HttpRequest), "HTTPRequest", "httpgrpc.HTTPRequest", 1) + `,`,
 		`StatsEnabled:` + fmt.Sprintf("%v", this.StatsEnabled) + `,`,
+		`DeadlineUnixNano:` + fmt.Sprintf("%v", this.DeadlineUnixNano) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1473,6 +1550,7 @@ func (this *SchedulerToFrontend) String() string {
 	s := strings.Join([]string{`&SchedulerToFrontend{`,
 		`Status:` + fmt.Sprintf("%v", this.Status) + `,`,
 		`Error:` + fmt.Sprintf("%v", this.Error) + `,`,
+		`TenantBackpressure:` + fmt.Sprintf("%v", this.TenantBackpressure) + `,`,
 		`}`,
 	}, "")
 	return s
@@ -1565,6 +1643,38 @@ func (m *QuerierToScheduler) Unmarshal(dAtA []byte) error {
 			}
 			m.QuerierID = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 2:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field QueryComponent", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowScheduler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthScheduler
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex < 0 {
+				return ErrInvalidLengthScheduler
+			}
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.QueryComponent = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipScheduler(dAtA[iNdEx:])
@@ -1987,6 +2097,25 @@ func (m *FrontendToScheduler) Unmarshal(dAtA []byte) error {
 				}
 			}
 			m.StatsEnabled = bool(v != 0)
+		case 7:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field DeadlineUnixNano", wireType)
+			}
+			m.DeadlineUnixNano = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowScheduler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.DeadlineUnixNano |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
 		default:
 			iNdEx = preIndex
 			skippy, err := skipScheduler(dAtA[iNdEx:])
@@ -2091,6 +2220,26 @@ func (m *SchedulerToFrontend) Unmarshal(dAtA []byte) error {
 			}
 			m.Error = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field TenantBackpressure", wireType)
+			}
+			var v int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowScheduler
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				v |= int(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			m.TenantBackpressure = bool(v != 0)
 		default:
 			iNdEx = preIndex
 			skippy, err := skipScheduler(dAtA[iNdEx:])